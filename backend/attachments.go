@@ -0,0 +1,371 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "log/slog"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+const (
+    maxAttachmentBytes = 25 << 20 // 25 MiB per file
+    maxAttachmentFiles = 10       // files per upload request
+)
+
+// Evidence types accepted for upload, by sniffed content type.
+var attachmentTypes = map[string]bool{
+    "application/pdf": true,
+    "image/jpeg":      true,
+    "image/png":       true,
+    "image/gif":       true,
+    "image/webp":      true,
+    "video/mp4":       true,
+    "video/webm":      true,
+}
+
+// attachmentOwners maps the owner_type to its table and attachments column.
+var attachmentOwners = map[string]struct{ table, idColumn string }{
+    "safety_event":    {"safety_events", "safety_event_id"},
+    "scorecard_event": {"scorecard_events", "scorecard_event_id"},
+}
+
+const attachmentColumns = `attachment_id, safety_event_id, scorecard_event_id, kind, file_name, content_type, size_bytes, sha256, url, description, uploaded_at`
+
+func scanAttachment(row rowScanner, a *Attachment) error {
+    var (
+        safetyID    sql.NullInt64
+        scorecardID sql.NullInt64
+        name        sql.NullString
+        contentType sql.NullString
+        size        sql.NullInt64
+        sum         sql.NullString
+        link        sql.NullString
+        uploadedAt  time.Time
+    )
+    if err := row.Scan(&a.AttachmentID, &safetyID, &scorecardID, &a.Kind, &name, &contentType, &size, &sum, &link, &a.Description, &uploadedAt); err != nil {
+        return err
+    }
+    if safetyID.Valid {
+        a.OwnerType, a.OwnerID = "safety_event", int(safetyID.Int64)
+    } else {
+        a.OwnerType, a.OwnerID = "scorecard_event", int(scorecardID.Int64)
+    }
+    if name.Valid {
+        a.FileName = &name.String
+    }
+    if contentType.Valid {
+        a.ContentType = &contentType.String
+    }
+    if size.Valid {
+        a.SizeBytes = &size.Int64
+    }
+    if sum.Valid {
+        a.SHA256 = &sum.String
+    }
+    if link.Valid {
+        a.URL = &link.String
+    }
+    a.UploadedAt = uploadedAt.In(localTZ).Format(time.RFC3339)
+    return nil
+}
+
+func attachmentStoreKey(sum string) string {
+    return "attachments/" + sum[:2] + "/" + sum
+}
+
+func ownerExists(ctx context.Context, ownerType string, id int) (bool, error) {
+    owner := attachmentOwners[ownerType]
+    var one int
+    err := queryRow(ctx, fmt.Sprintf(`SELECT 1 FROM %s WHERE %s=?`, owner.table, owner.idColumn), id).Scan(&one)
+    if err == sql.ErrNoRows {
+        return false, nil
+    }
+    return err == nil, err
+}
+
+// storeAttachment saves one uploaded file. Content is addressed by SHA-256, so the
+// same bytes are stored once; re-uploading a file already on this event returns
+// the existing attachment instead of a duplicate.
+func storeAttachment(ctx context.Context, ownerType string, ownerID int, fileName, description string, data []byte) (Attachment, error) {
+    owner := attachmentOwners[ownerType]
+    sumBytes := sha256.Sum256(data)
+    sum := hex.EncodeToString(sumBytes[:])
+
+    var a Attachment
+    row := queryRow(ctx, `SELECT `+attachmentColumns+` FROM attachments WHERE `+owner.idColumn+`=? AND sha256=? LIMIT 1`, ownerID, sum)
+    if err := scanAttachment(row, &a); err == nil {
+        return a, nil
+    } else if err != sql.ErrNoRows {
+        return a, err
+    }
+
+    contentType := http.DetectContentType(data)
+    key := attachmentStoreKey(sum)
+    err := inTx(ctx, func(ctx context.Context) error {
+        // Lock the checksum against releaseAttachmentFiles, which takes the same lock
+        // before deleting: a release either sees the new row or is done before the
+        // copy is checked for
+        var shared int
+        if err := queryRow(ctx, `SELECT COUNT(*) FROM attachments WHERE sha256=? FOR UPDATE`, sum).Scan(&shared); err != nil {
+            return err
+        }
+        res, err := exec(ctx, `
+            INSERT INTO attachments (`+owner.idColumn+`, kind, file_name, content_type, size_bytes, sha256, storage_key, description)
+            VALUES (?, 'file', ?, ?, ?, ?, ?, ?)`,
+            ownerID, fileName, contentType, len(data), sum, key, description)
+        if err != nil {
+            return err
+        }
+        if shared == 0 {
+            if err := files.Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+                return err
+            }
+        }
+        id, _ := res.LastInsertId()
+        return scanAttachment(queryRow(ctx, `SELECT `+attachmentColumns+` FROM attachments WHERE attachment_id=?`, id), &a)
+    })
+    return a, err
+}
+
+// --- Attachment endpoints (mounted under /safety-events/:id and /scorecard-events/:id) ---
+
+func listAttachments(ownerType string) gin.HandlerFunc {
+    owner := attachmentOwners[ownerType]
+    return func(c *gin.Context) {
+        ownerID := c.Param("id")
+        ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+        defer cancel()
+
+        rows, err := queryRows(ctx, `SELECT `+attachmentColumns+` FROM attachments WHERE `+owner.idColumn+`=? ORDER BY uploaded_at, attachment_id`, ownerID)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+            return
+        }
+        defer rows.Close()
+
+        var out []Attachment
+        for rows.Next() {
+            var a Attachment
+            if err := scanAttachment(rows, &a); err != nil {
+                continue
+            }
+            out = append(out, a)
+        }
+        c.JSON(http.StatusOK, out)
+    }
+}
+
+// uploadAttachments accepts multipart "file" parts (one or more, with an optional
+// "description" field) or a JSON body {"url": "...", "description": "..."} for
+// evidence kept elsewhere, such as a dashcam clip.
+func uploadAttachments(ownerType string) gin.HandlerFunc {
+    owner := attachmentOwners[ownerType]
+    return func(c *gin.Context) {
+        ownerID := atoi(c.Param("id"))
+        ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+        defer cancel()
+
+        ok, err := ownerExists(ctx, ownerType, ownerID)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+            return
+        }
+        if !ok {
+            c.JSON(http.StatusNotFound, APIError{Message: strings.ReplaceAll(ownerType, "_", " ") + " not found"})
+            return
+        }
+
+        if !strings.HasPrefix(c.ContentType(), "multipart/") {
+            var body LinkAttachmentRequest
+            if err := c.ShouldBindJSON(&body); err != nil {
+                c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+                return
+            }
+            u, err := url.Parse(body.URL)
+            if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+                c.JSON(http.StatusBadRequest, APIError{Message: "url must be an absolute http(s) URL"})
+                return
+            }
+            res, err := exec(ctx, `INSERT INTO attachments (`+owner.idColumn+`, kind, url, description) VALUES (?, 'link', ?, ?)`,
+                ownerID, body.URL, body.Description)
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+                return
+            }
+            id, _ := res.LastInsertId()
+            var a Attachment
+            if err := scanAttachment(queryRow(ctx, `SELECT `+attachmentColumns+` FROM attachments WHERE attachment_id=?`, id), &a); err != nil {
+                c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+                return
+            }
+            c.JSON(http.StatusOK, []Attachment{a})
+            return
+        }
+
+        c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAttachmentFiles*maxAttachmentBytes+1<<20)
+        form, err := c.MultipartForm()
+        if err != nil {
+            c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+            return
+        }
+        uploads := form.File["file"]
+        if len(uploads) == 0 {
+            c.JSON(http.StatusBadRequest, APIError{Message: "multipart field 'file' is required"})
+            return
+        }
+        if len(uploads) > maxAttachmentFiles {
+            c.JSON(http.StatusBadRequest, APIError{Message: fmt.Sprintf("at most %d files per upload", maxAttachmentFiles)})
+            return
+        }
+        description := c.PostForm("description")
+
+        // Validate everything before storing anything so a bad file doesn't leave a partial upload
+        contents := make([][]byte, len(uploads))
+        for i, fh := range uploads {
+            if fh.Size > maxAttachmentBytes {
+                c.JSON(http.StatusRequestEntityTooLarge, APIError{Message: fmt.Sprintf("%s exceeds %d MiB", fh.Filename, maxAttachmentBytes>>20)})
+                return
+            }
+            f, err := fh.Open()
+            if err != nil {
+                c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+                return
+            }
+            data, err := io.ReadAll(f)
+            f.Close()
+            if err != nil {
+                c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+                return
+            }
+            if ct := http.DetectContentType(data); !attachmentTypes[ct] {
+                c.JSON(http.StatusUnsupportedMediaType, APIError{Message: fmt.Sprintf("%s: type %s is not allowed (PDF, JPEG, PNG, GIF, WebP, MP4, WebM)", fh.Filename, ct)})
+                return
+            }
+            contents[i] = data
+        }
+
+        var out []Attachment
+        for i, fh := range uploads {
+            a, err := storeAttachment(ctx, ownerType, ownerID, fh.Filename, description, contents[i])
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+                return
+            }
+            out = append(out, a)
+        }
+        c.JSON(http.StatusOK, out)
+    }
+}
+
+func downloadAttachment(c *gin.Context) {
+    id := c.Param("id")
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+    defer cancel()
+
+    var a Attachment
+    if err := scanAttachment(queryRow(ctx, `SELECT `+attachmentColumns+` FROM attachments WHERE attachment_id=?`, id), &a); err != nil {
+        if err == sql.ErrNoRows {
+            c.JSON(http.StatusNotFound, APIError{Message: "attachment not found"})
+            return
+        }
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    if a.Kind == "link" {
+        c.Redirect(http.StatusFound, *a.URL)
+        return
+    }
+
+    r, info, err := files.Get(ctx, attachmentStoreKey(*a.SHA256))
+    if err == ErrFileNotFound {
+        c.JSON(http.StatusNotFound, APIError{Message: "attachment file missing from store"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    defer r.Close()
+    c.Header("ETag", `"`+*a.SHA256+`"`)
+    c.DataFromReader(http.StatusOK, info.Size, *a.ContentType, r, map[string]string{
+        "Content-Disposition": `attachment; filename="` + strings.ReplaceAll(*a.FileName, `"`, "") + `"`,
+    })
+}
+
+// deleteAttachment removes the record, and the stored file once nothing else references it.
+func deleteAttachment(c *gin.Context) {
+    id := c.Param("id")
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+    defer cancel()
+
+    var sum sql.NullString
+    err := queryRow(ctx, `SELECT sha256 FROM attachments WHERE attachment_id=?`, id).Scan(&sum)
+    if err == sql.ErrNoRows {
+        c.Status(http.StatusNoContent)
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    if _, err := exec(ctx, `DELETE FROM attachments WHERE attachment_id=?`, id); err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+
+    if sum.Valid {
+        releaseAttachmentFiles(ctx, []string{sum.String})
+    }
+    c.Status(http.StatusNoContent)
+}
+
+// attachmentSums lists the checksums of files attached to rows about to be deleted;
+// the attachment rows themselves go with the owner via ON DELETE CASCADE.
+func attachmentSums(ctx context.Context, where string, args ...any) []string {
+    rows, err := queryRows(ctx, `
+        SELECT DISTINCT a.sha256 FROM attachments a
+        LEFT JOIN safety_events se ON se.safety_event_id = a.safety_event_id
+        LEFT JOIN scorecard_events sce ON sce.scorecard_event_id = a.scorecard_event_id
+        WHERE a.sha256 IS NOT NULL AND (`+where+`)`, args...)
+    if err != nil {
+        slog.WarnContext(ctx, "listing attachments for cleanup failed", "err", err)
+        return nil
+    }
+    defer rows.Close()
+    var sums []string
+    for rows.Next() {
+        var s string
+        if err := rows.Scan(&s); err == nil {
+            sums = append(sums, s)
+        }
+    }
+    return sums
+}
+
+// releaseAttachmentFiles deletes stored files that no attachment references any more.
+// Each file is deleted while holding the checksum lock storeAttachment takes, so
+// an upload of the same bytes can't be left pointing at a removed file.
+func releaseAttachmentFiles(ctx context.Context, sums []string) {
+    for _, sum := range sums {
+        err := inTx(ctx, func(ctx context.Context) error {
+            var remaining int
+            if err := queryRow(ctx, `SELECT COUNT(*) FROM attachments WHERE sha256=? FOR UPDATE`, sum).Scan(&remaining); err != nil || remaining > 0 {
+                return err
+            }
+            return files.Delete(ctx, attachmentStoreKey(sum))
+        })
+        if err != nil {
+            slog.WarnContext(ctx, "failed removing attachment file", "sha256", sum, "err", err)
+        }
+    }
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "testing"
+    "time"
+
+    "github.com/DATA-DOG/go-sqlmock"
+)
+
+var attachmentCols = []string{"attachment_id", "safety_event_id", "scorecard_event_id", "kind", "file_name", "content_type", "size_bytes", "sha256", "url", "description", "uploaded_at"}
+
+// A new file is stored after its row is inserted under the checksum lock, inside
+// one transaction; a copy already referenced elsewhere is not stored again.
+func TestStoreAttachmentLocksChecksum(t *testing.T) {
+    mock := withMockDB(t)
+    store := withFileStore(t)
+
+    data := []byte("%PDF-1.4 ticket")
+    raw := sha256.Sum256(data)
+    sum := hex.EncodeToString(raw[:])
+    for _, shared := range []int{0, 1} {
+        mock.ExpectQuery(`FROM attachments WHERE safety_event_id=\? AND sha256=\?`).WithArgs(12, sum).WillReturnRows(sqlmock.NewRows(attachmentCols))
+        mock.ExpectBegin()
+        mock.ExpectQuery(`SELECT COUNT\(\*\) FROM attachments WHERE sha256=\? FOR UPDATE`).WithArgs(sum).
+            WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(shared))
+        mock.ExpectExec(`INSERT INTO attachments`).WillReturnResult(sqlmock.NewResult(40, 1))
+        mock.ExpectQuery(`FROM attachments WHERE attachment_id=\?`).WithArgs(40).
+            WillReturnRows(sqlmock.NewRows(attachmentCols).AddRow(40, 12, nil, "file", "ticket.pdf", "application/pdf", len(data), sum, nil, "", time.Now()))
+        mock.ExpectCommit()
+
+        if _, err := storeAttachment(context.Background(), "safety_event", 12, "ticket.pdf", "", data); err != nil {
+            t.Fatal(err)
+        }
+        r, _, err := store.Get(context.Background(), attachmentStoreKey(sum))
+        if stored := err == nil; stored != (shared == 0) {
+            t.Errorf("shared by %d: stored = %v (%v)", shared, stored, err)
+        }
+        if err == nil {
+            r.Close()
+            if err := store.Delete(context.Background(), attachmentStoreKey(sum)); err != nil {
+                t.Fatal(err)
+            }
+        }
+    }
+}
+
+// The file goes only when no row references it, checked under the same lock.
+func TestReleaseAttachmentFiles(t *testing.T) {
+    mock := withMockDB(t)
+    store := withFileStore(t)
+
+    ctx := context.Background()
+    for _, sum := range []string{"aa11", "bb22"} {
+        if err := store.Put(ctx, attachmentStoreKey(sum), bytes.NewReader([]byte(sum)), 4, "application/pdf"); err != nil {
+            t.Fatal(err)
+        }
+    }
+    mock.ExpectBegin()
+    mock.ExpectQuery(`SELECT COUNT\(\*\) FROM attachments WHERE sha256=\? FOR UPDATE`).WithArgs("aa11").
+        WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(0))
+    mock.ExpectCommit()
+    mock.ExpectBegin()
+    mock.ExpectQuery(`SELECT COUNT\(\*\) FROM attachments WHERE sha256=\? FOR UPDATE`).WithArgs("bb22").
+        WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(2))
+    mock.ExpectCommit()
+
+    releaseAttachmentFiles(ctx, []string{"aa11", "bb22"})
+    if _, _, err := store.Get(ctx, attachmentStoreKey("aa11")); err != ErrFileNotFound {
+        t.Errorf("unreferenced file kept: %v", err)
+    }
+    if r, _, err := store.Get(ctx, attachmentStoreKey("bb22")); err != nil {
+        t.Errorf("shared file removed: %v", err)
+    } else {
+        r.Close()
+    }
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+    "bufio"
+    "compress/gzip"
+    "context"
+    "database/sql"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "strings"
+    "time"
+)
+
+// Rows per INSERT statement in a backup.
+const backupBatchRows = 200
+
+type backupStats struct {
+    Tables int
+    Rows   int64
+}
+
+// backupDatabase writes every table as DROP/CREATE TABLE plus INSERTs, readable by
+// the mysql client: mysql driver_safety < backup.sql. It needs no mysqldump in the
+// image. All tables are read on one connection inside a consistent snapshot, so
+// rows referenced by foreign keys match even while the API keeps writing. Photos
+// and documents in the file store are not included.
+func backupDatabase(ctx context.Context, out io.Writer, compress bool) (backupStats, error) {
+    var stats backupStats
+    if compress {
+        zw := gzip.NewWriter(out)
+        defer zw.Close()
+        out = zw
+    }
+    w := bufio.NewWriterSize(out, 1<<16)
+
+    conn, err := db.Conn(ctx)
+    if err != nil {
+        return stats, err
+    }
+    defer conn.Close()
+    for _, stmt := range []string{
+        `SET TRANSACTION ISOLATION LEVEL REPEATABLE READ`,
+        `START TRANSACTION WITH CONSISTENT SNAPSHOT`,
+    } {
+        if _, err := conn.ExecContext(ctx, stmt); err != nil {
+            return stats, err
+        }
+    }
+    // Read only, so nothing to commit; the connection goes back to the pool clean
+    defer conn.ExecContext(context.WithoutCancel(ctx), `ROLLBACK`)
+
+    rows, err := conn.QueryContext(ctx, `SHOW FULL TABLES WHERE Table_type = 'BASE TABLE'`)
+    if err != nil {
+        return stats, err
+    }
+    var tables []string
+    for rows.Next() {
+        var name, kind string
+        if err := rows.Scan(&name, &kind); err != nil {
+            rows.Close()
+            return stats, err
+        }
+        tables = append(tables, name)
+    }
+    rows.Close()
+
+    fmt.Fprintf(w, "-- DriverSafetyBonus backup %s\n", time.Now().In(localTZ).Format(time.RFC3339))
+    fmt.Fprintln(w, "SET NAMES utf8mb4;")
+    fmt.Fprintln(w, "SET FOREIGN_KEY_CHECKS = 0;")
+    for _, table := range tables {
+        n, err := backupTable(ctx, conn, w, table)
+        if err != nil {
+            return stats, fmt.Errorf("%s: %w", table, err)
+        }
+        stats.Tables++
+        stats.Rows += n
+    }
+    fmt.Fprintln(w, "SET FOREIGN_KEY_CHECKS = 1;")
+    return stats, w.Flush()
+}
+
+func backupTable(ctx context.Context, conn *sql.Conn, w *bufio.Writer, table string) (int64, error) {
+    var name, create string
+    if err := conn.QueryRowContext(ctx, "SHOW CREATE TABLE `"+table+"`").Scan(&name, &create); err != nil {
+        return 0, err
+    }
+    fmt.Fprintf(w, "\nDROP TABLE IF EXISTS `%s`;\n%s;\n", table, create)
+
+    rows, err := conn.QueryContext(ctx, "SELECT * FROM `"+table+"`")
+    if err != nil {
+        return 0, err
+    }
+    defer rows.Close()
+    types, err := rows.ColumnTypes()
+    if err != nil {
+        return 0, err
+    }
+    values := make([]any, len(types))
+    dest := make([]any, len(types))
+    for i := range values {
+        dest[i] = &values[i]
+    }
+
+    var n int64
+    for rows.Next() {
+        if err := rows.Scan(dest...); err != nil {
+            return n, err
+        }
+        if n%backupBatchRows == 0 {
+            if n > 0 {
+                w.WriteString(";\n")
+            }
+            fmt.Fprintf(w, "INSERT INTO `%s` VALUES ", table)
+        } else {
+            w.WriteString(",")
+        }
+        w.WriteString("(")
+        for i, v := range values {
+            if i > 0 {
+                w.WriteString(",")
+            }
+            w.WriteString(sqlLiteral(v, types[i].DatabaseTypeName()))
+        }
+        w.WriteString(")")
+        n++
+    }
+    if n > 0 {
+        w.WriteString(";\n")
+    }
+    return n, rows.Err()
+}
+
+var sqlEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\x00", `\0`, "\n", `\n`, "\r", `\r`, "\x1a", `\Z`)
+
+// sqlLiteral quotes a column value as MariaDB reads it back. Binary columns are
+// written as hex. With parseTime=true the driver returns DATE, DATETIME and
+// TIMESTAMP columns as time.Time, holding the stored wall clock; they are written
+// in MariaDB's own format, since strict mode rejects RFC 3339.
+func sqlLiteral(v any, dbType string) string {
+    switch v := v.(type) {
+    case nil:
+        return "NULL"
+    case []byte:
+        if strings.Contains(dbType, "BLOB") || strings.Contains(dbType, "BINARY") {
+            if len(v) == 0 {
+                return "''"
+            }
+            return "0x" + hex.EncodeToString(v)
+        }
+        return "'" + sqlEscaper.Replace(string(v)) + "'"
+    case time.Time:
+        return "'" + sqlTime(v, dbType) + "'"
+    }
+    return "'" + sqlEscaper.Replace(fmt.Sprint(v)) + "'"
+}
+
+func sqlTime(t time.Time, dbType string) string {
+    if dbType == "DATE" {
+        if t.IsZero() {
+            return "0000-00-00"
+        }
+        return t.Format("2006-01-02")
+    }
+    if t.IsZero() {
+        return "0000-00-00 00:00:00"
+    }
+    return t.Format("2006-01-02 15:04:05.999999")
+}
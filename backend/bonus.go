@@ -0,0 +1,374 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "log/slog"
+    "math"
+    "net/http"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-sql-driver/mysql"
+)
+
+// Stars available per scorecard metric
+const scorecardMaxStars = 5
+
+var periodKeyPattern = regexp.MustCompile(`^(\d{4})-(?:(0[1-9]|1[0-2])|Q([1-4]))$`)
+
+// periodBounds turns "YYYY-MM" or "YYYY-Qn" into its first and last local dates.
+func periodBounds(key string) (start, end time.Time, err error) {
+    m := periodKeyPattern.FindStringSubmatch(key)
+    if m == nil {
+        return start, end, fmt.Errorf("period must be YYYY-MM or YYYY-Qn")
+    }
+    year, _ := strconv.Atoi(m[1])
+    if m[2] != "" {
+        month, _ := strconv.Atoi(m[2])
+        start = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, localTZ)
+        return start, start.AddDate(0, 1, -1), nil
+    }
+    q, _ := strconv.Atoi(m[3])
+    start = time.Date(year, time.Month(3*(q-1)+1), 1, 0, 0, 0, 0, localTZ)
+    return start, start.AddDate(0, 3, -1), nil
+}
+
+const bonusPeriodColumns = `period_id, period_key, starts_on, ends_on, status, max_payout, approved_by, approved_at`
+
+func scanBonusPeriod(row rowScanner, p *BonusPeriod) error {
+    var (
+        startsOn   time.Time
+        endsOn     time.Time
+        approvedBy sql.NullString
+        approvedAt sql.NullTime
+    )
+    if err := row.Scan(&p.PeriodID, &p.Period, &startsOn, &endsOn, &p.Status, &p.MaxPayout, &approvedBy, &approvedAt); err != nil {
+        return err
+    }
+    p.StartsOn = formatLocalDate(startsOn)
+    p.EndsOn = formatLocalDate(endsOn)
+    if approvedBy.Valid {
+        p.ApprovedBy = &approvedBy.String
+    }
+    if approvedAt.Valid {
+        val := approvedAt.Time.In(localTZ).Format(time.RFC3339)
+        p.ApprovedAt = &val
+    }
+    return nil
+}
+
+func loadBonusPeriod(ctx context.Context, id any) (BonusPeriod, error) {
+    var p BonusPeriod
+    err := scanBonusPeriod(queryRow(ctx, `SELECT `+bonusPeriodColumns+` FROM bonus_periods WHERE period_id=?`, id), &p)
+    return p, err
+}
+
+// computeBonusLines works out every driver's bonus for the period. Safety points
+// count events flagged bonus_period that have not been overturned on dispute; the
+// scorecard percentage is stars earned over stars possible for the period's
+// scorecard events. Inactive drivers (no longer employed), drivers over the warning
+// threshold, and drivers holding an expired bonus-blocking credential at period end
+// get a line but no payout. driverID limits the
+// result to one driver; 0 returns everyone.
+func computeBonusLines(ctx context.Context, p BonusPeriod, driverID int) ([]BonusLine, error) {
+    rows, err := queryRows(ctx, `
+        SELECT d.driver_id, d.driver_code, d.first_name, d.last_name, COALESCE(dt.driver_type, ''), d.active,
+               COALESCE((SELECT SUM(se.bonus_score) FROM safety_events se
+                         WHERE se.driver_id = d.driver_id AND se.bonus_period = TRUE
+                           AND se.event_date BETWEEN ? AND ?
+                           AND (se.dispute_status IS NULL OR se.dispute_status <> 'overturned')), 0),
+               COALESCE((SELECT SUM(sce.sc_score) FROM scorecard_events sce
+                         WHERE sce.driver_id = d.driver_id AND sce.event_date BETWEEN ? AND ?), 0),
+               (SELECT COUNT(*) FROM scorecard_events sce
+                         WHERE sce.driver_id = d.driver_id AND sce.event_date BETWEEN ? AND ?),
+               (SELECT COUNT(*) FROM driver_credentials dc
+                         WHERE dc.driver_id = d.driver_id AND dc.blocks_bonus = TRUE
+                           AND dc.expiry_date IS NOT NULL AND dc.expiry_date <= ?)
+        FROM drivers d
+        LEFT JOIN driver_type dt ON dt.driver_type_id = d.driver_type_id
+        WHERE (d.start_date IS NULL OR d.start_date <= ?) AND (? = 0 OR d.driver_id = ?)
+        ORDER BY d.last_name, d.first_name, d.driver_code`,
+        p.StartsOn, p.EndsOn, p.StartsOn, p.EndsOn, p.StartsOn, p.EndsOn, p.EndsOn, p.EndsOn, driverID, driverID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    lines := []BonusLine{}
+    for rows.Next() {
+        var (
+            l            BonusLine
+            active       bool
+            stars        int
+            scored       int
+            expiredCreds int
+        )
+        if err := rows.Scan(&l.DriverID, &l.DriverCode, &l.FirstName, &l.LastName, &l.DriverType, &active, &l.SafetyPoints, &stars, &scored, &expiredCreds); err != nil {
+            return nil, err
+        }
+        l.Period = p.Period
+        if scored > 0 {
+            l.ScorecardPct = math.Round(float64(stars)/float64(scored*scorecardMaxStars)*1000) / 10
+        }
+        l.Eligible = true
+        switch {
+        case !active:
+            l.Eligible, l.IneligibleReason = false, "inactive driver"
+        case l.SafetyPoints > conf.Thresholds.BonusWarningPoints:
+            l.Eligible, l.IneligibleReason = false, fmt.Sprintf("safety points above %d", conf.Thresholds.BonusWarningPoints)
+        case expiredCreds > 0:
+            l.Eligible, l.IneligibleReason = false, "expired credential"
+        }
+        if l.Eligible {
+            l.Payout = math.Round(p.MaxPayout*l.ScorecardPct) / 100
+        }
+        lines = append(lines, l)
+    }
+    return lines, rows.Err()
+}
+
+// freezeBonusLines stores the period's lines as they stand at approval, so later
+// edits, disputes or credential changes can't alter what payroll is paid.
+func freezeBonusLines(ctx context.Context, p BonusPeriod) error {
+    lines, err := computeBonusLines(ctx, p, 0)
+    if err != nil {
+        return err
+    }
+    if _, err := exec(ctx, `DELETE FROM bonus_period_lines WHERE period_id=?`, p.PeriodID); err != nil {
+        return err
+    }
+    for _, l := range lines {
+        var reason any
+        if l.IneligibleReason != "" {
+            reason = l.IneligibleReason
+        }
+        if _, err := exec(ctx, `
+            INSERT INTO bonus_period_lines (period_id, driver_id, driver_code, first_name, last_name, driver_type,
+                                            safety_points, scorecard_pct, eligible, ineligible_reason, payout)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+            p.PeriodID, l.DriverID, l.DriverCode, l.FirstName, l.LastName, l.DriverType,
+            l.SafetyPoints, l.ScorecardPct, l.Eligible, reason, l.Payout); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// periodLines returns the lines frozen when an approved period was approved, and
+// the live calculation for an open or closed one. driverID works as in computeBonusLines.
+func periodLines(ctx context.Context, p BonusPeriod, driverID int) ([]BonusLine, error) {
+    if p.Status != "approved" {
+        return computeBonusLines(ctx, p, driverID)
+    }
+    rows, err := queryRows(ctx, `
+        SELECT driver_id, driver_code, first_name, last_name, driver_type,
+               safety_points, scorecard_pct, eligible, ineligible_reason, payout
+        FROM bonus_period_lines
+        WHERE period_id=? AND (? = 0 OR driver_id = ?)
+        ORDER BY last_name, first_name, driver_code`, p.PeriodID, driverID, driverID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    lines := []BonusLine{}
+    for rows.Next() {
+        var (
+            l      BonusLine
+            reason sql.NullString
+        )
+        if err := rows.Scan(&l.DriverID, &l.DriverCode, &l.FirstName, &l.LastName, &l.DriverType,
+            &l.SafetyPoints, &l.ScorecardPct, &l.Eligible, &reason, &l.Payout); err != nil {
+            return nil, err
+        }
+        l.Period = p.Period
+        l.IneligibleReason = reason.String
+        lines = append(lines, l)
+    }
+    return lines, rows.Err()
+}
+
+// --- Bonus periods ---
+
+func getBonusPeriods(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    rows, err := queryRows(ctx, `SELECT `+bonusPeriodColumns+` FROM bonus_periods ORDER BY starts_on DESC, ends_on DESC`)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    var periods []BonusPeriod
+    for rows.Next() {
+        var p BonusPeriod
+        if err := scanBonusPeriod(rows, &p); err != nil {
+            continue
+        }
+        periods = append(periods, p)
+    }
+    c.JSON(http.StatusOK, periods)
+}
+
+func createBonusPeriod(c *gin.Context) {
+    var p BonusPeriod
+    if err := c.ShouldBindJSON(&p); err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    p.Period = strings.ToUpper(strings.TrimSpace(p.Period))
+    start, end, err := periodBounds(p.Period)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    if p.MaxPayout < 0 {
+        c.JSON(http.StatusBadRequest, APIError{Message: "max_payout must not be negative"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    res, err := exec(ctx, `
+        INSERT INTO bonus_periods (period_key, starts_on, ends_on, status, max_payout)
+        VALUES (?, ?, ?, 'open', ?)`, p.Period, formatLocalDate(start), formatLocalDate(end), p.MaxPayout)
+    if err != nil {
+        var me *mysql.MySQLError
+        if errors.As(err, &me) && me.Number == 1062 {
+            c.JSON(http.StatusConflict, APIError{Message: "bonus period " + p.Period + " already exists"})
+            return
+        }
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    id, _ := res.LastInsertId()
+    saved, err := loadBonusPeriod(ctx, id)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, saved)
+}
+
+// setBonusPeriodStatus moves a period forward: open -> closed -> approved. Approval
+// freezes the period's lines, so run it inside inTx.
+func setBonusPeriodStatus(ctx context.Context, id any, from, to, actor string) (BonusPeriod, error) {
+    var res sql.Result
+    var err error
+    if to == "approved" {
+        res, err = exec(ctx, `UPDATE bonus_periods SET status='approved', approved_by=?, approved_at=? WHERE period_id=? AND status=?`,
+            actor, time.Now().In(localTZ), id, from)
+    } else {
+        res, err = exec(ctx, `UPDATE bonus_periods SET status=?, closed_at=? WHERE period_id=? AND status=?`,
+            to, time.Now().In(localTZ), id, from)
+    }
+    if err != nil {
+        return BonusPeriod{}, err
+    }
+    p, err := loadBonusPeriod(ctx, id)
+    if err != nil {
+        return p, err
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        return p, fmt.Errorf("bonus period %s is %s, expected %s", p.Period, p.Status, from)
+    }
+    if to == "approved" {
+        if err := freezeBonusLines(ctx, p); err != nil {
+            return p, err
+        }
+    }
+    return p, nil
+}
+
+func bonusPeriodTransition(from, to string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var body PeriodActionRequest
+        _ = c.ShouldBindJSON(&body)
+        if to == "approved" && strings.TrimSpace(body.Actor) == "" {
+            c.JSON(http.StatusBadRequest, APIError{Message: "actor is required to approve a period"})
+            return
+        }
+
+        ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+        defer cancel()
+
+        var p BonusPeriod
+        err := inTx(ctx, func(ctx context.Context) error {
+            var err error
+            p, err = setBonusPeriodStatus(ctx, c.Param("id"), from, to, body.Actor)
+            if err == sql.ErrNoRows {
+                c.JSON(http.StatusNotFound, APIError{Message: "bonus period not found"})
+                return errAnswered
+            }
+            if err != nil {
+                c.JSON(http.StatusConflict, APIError{Message: err.Error()})
+                return errAnswered
+            }
+            if to == "approved" {
+                return publishEvent(ctx, "bonus_period.locked", p)
+            }
+            return nil
+        })
+        if txFailed(c, err) {
+            return
+        }
+        if to == "approved" {
+            notifyPeriodApproval(ctx, p)
+        }
+        c.JSON(http.StatusOK, p)
+    }
+}
+
+// notifyPeriodApproval tells payroll a period is ready to export.
+func notifyPeriodApproval(ctx context.Context, p BonusPeriod) {
+    lines, err := periodLines(ctx, p, 0)
+    if err != nil {
+        slog.WarnContext(ctx, "bonus period approval notification skipped", "period", p.Period, "err", err)
+        return
+    }
+    approver, eligible, total := "", 0, 0.0
+    if p.ApprovedBy != nil {
+        approver = *p.ApprovedBy
+    }
+    for _, l := range lines {
+        if l.Eligible {
+            eligible++
+        }
+        total += l.Payout
+    }
+    notify(ctx, notifyPeriodApproved, 0, map[string]any{
+        "Period": p, "Approver": approver, "Lines": len(lines), "Eligible": eligible, "Total": total,
+    })
+}
+
+// GET /bonus-periods/:id/lines previews the per-driver bonus calculation, or shows
+// the lines frozen at approval.
+func getBonusLines(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+    defer cancel()
+
+    p, err := loadBonusPeriod(ctx, c.Param("id"))
+    if err == sql.ErrNoRows {
+        c.JSON(http.StatusNotFound, APIError{Message: "bonus period not found"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    lines, err := periodLines(ctx, p, 0)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, lines)
+}
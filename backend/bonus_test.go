@@ -0,0 +1,101 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/gin-gonic/gin"
+    "github.com/go-sql-driver/mysql"
+)
+
+var bonusPeriodCols = []string{"period_id", "period_key", "starts_on", "ends_on", "status", "max_payout", "approved_by", "approved_at"}
+
+// Approval stores the lines as computed at that moment; afterwards they are read back, not recomputed.
+func TestApprovalFreezesBonusLines(t *testing.T) {
+    mock := withMockDB(t)
+
+    starts, ends := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)
+    mock.ExpectBegin()
+    mock.ExpectExec(`UPDATE bonus_periods SET status='approved'`).WithArgs("dana", sqlmock.AnyArg(), 4, "closed").
+        WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectQuery(`FROM bonus_periods WHERE period_id=\?`).WithArgs(4).
+        WillReturnRows(sqlmock.NewRows(bonusPeriodCols).AddRow(4, "2025-Q2", starts, ends, "approved", 500.0, "dana", time.Now()))
+    mock.ExpectQuery(`FROM drivers d`).
+        WillReturnRows(sqlmock.NewRows([]string{"driver_id", "driver_code", "first_name", "last_name", "driver_type", "active", "safety", "stars", "scored", "expired"}).
+            AddRow(1, "D1", "Ann", "Able", "OTR", true, 2, 24, 6, 0).
+            AddRow(2, "D2", "Bo", "Baker", "OTR", true, 1, 30, 6, 1).
+            AddRow(3, "D3", "Cy", "Cole", "OTR", false, 0, 30, 6, 0))
+    mock.ExpectExec(`DELETE FROM bonus_period_lines WHERE period_id=\?`).WithArgs(4).WillReturnResult(sqlmock.NewResult(0, 0))
+    mock.ExpectExec(`INSERT INTO bonus_period_lines`).
+        WithArgs(4, 1, "D1", "Ann", "Able", "OTR", 2, 80.0, true, nil, 400.0).WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectExec(`INSERT INTO bonus_period_lines`).
+        WithArgs(4, 2, "D2", "Bo", "Baker", "OTR", 1, 100.0, false, "expired credential", 0.0).WillReturnResult(sqlmock.NewResult(0, 1))
+    // A driver who has left still has scorecards for the period but is not paid
+    mock.ExpectExec(`INSERT INTO bonus_period_lines`).
+        WithArgs(4, 3, "D3", "Cy", "Cole", "OTR", 0, 100.0, false, "inactive driver", 0.0).WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectCommit()
+
+    var p BonusPeriod
+    err := inTx(context.Background(), func(ctx context.Context) error {
+        var err error
+        p, err = setBonusPeriodStatus(ctx, 4, "closed", "approved", "dana")
+        return err
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    mock.ExpectQuery(`FROM bonus_period_lines`).WithArgs(4, 0, 0).
+        WillReturnRows(sqlmock.NewRows([]string{"driver_id", "driver_code", "first_name", "last_name", "driver_type", "safety_points", "scorecard_pct", "eligible", "ineligible_reason", "payout"}).
+            AddRow(1, "D1", "Ann", "Able", "OTR", 2, 80.0, true, nil, 400.0))
+    lines, err := periodLines(context.Background(), p, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(lines) != 1 || lines[0].Period != "2025-Q2" || lines[0].Payout != 400 {
+        t.Errorf("lines = %+v", lines)
+    }
+}
+
+func TestCreateBonusPeriodDuplicate(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+
+    mock.ExpectExec(`INSERT INTO bonus_periods`).WithArgs("2025-Q2", "2025-04-01", "2025-06-30", 500.0).
+        WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry '2025-Q2' for key 'period_key'"})
+    w := httptest.NewRecorder()
+    newRouter().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/bonus-periods", strings.NewReader(`{"period": "2025-q2", "max_payout": 500}`)))
+    if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "2025-Q2 already exists") {
+        t.Errorf("duplicate period: %d %s", w.Code, w.Body)
+    }
+}
+
+func TestPeriodBounds(t *testing.T) {
+    prevTZ := localTZ
+    localTZ = time.UTC
+    defer func() { localTZ = prevTZ }()
+
+    for key, want := range map[string]string{
+        "2025-02": "2025-02-01..2025-02-28",
+        "2024-02": "2024-02-01..2024-02-29",
+        "2025-12": "2025-12-01..2025-12-31",
+        "2025-Q1": "2025-01-01..2025-03-31",
+        "2025-Q2": "2025-04-01..2025-06-30",
+        "2025-Q4": "2025-10-01..2025-12-31",
+    } {
+        start, end, err := periodBounds(key)
+        if got := formatLocalDate(start) + ".." + formatLocalDate(end); err != nil || got != want {
+            t.Errorf("periodBounds(%s) = %s, %v; want %s", key, got, err, want)
+        }
+    }
+    for _, key := range []string{"2025-13", "2025-00", "2025-Q5", "2025-q2", "2025-1", "25-01", ""} {
+        if _, _, err := periodBounds(key); err == nil {
+            t.Errorf("periodBounds(%q) accepted", key)
+        }
+    }
+}
@@ -0,0 +1,550 @@
+package main
+
+import (
+    "context"
+    "encoding/csv"
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "text/tabwriter"
+    "time"
+
+    "driver-safety-bonus/client"
+
+    "github.com/gin-gonic/gin"
+)
+
+// Admin commands run by the API binary itself, e.g.
+//
+//    ./main --json periods close 2025-06
+//
+// Commands that change records go through the API's own router in-process (via the
+// Go client), so they get the same validation, events and notifications as the UI.
+// Exit status: 0 on success, 1 when the command fails, 2 for usage errors.
+
+type cliCommand struct {
+    name    string // one or two words, e.g. "periods close"
+    args    string
+    summary string
+    run     func(cl *cli, args []string) error
+}
+
+var cliCommands = []cliCommand{
+    {"users list", "", "List email recipients", cliUsersList},
+    {"users add", "--email E --name N --role R [--driver-id ID] [--inactive]", "Add an email recipient", cliUsersAdd},
+    {"users remove", "ID", "Remove an email recipient", cliUsersRemove},
+    {"categories import", "FILE [--dry-run]", "Create or update safety categories by code from CSV or JSON (- for stdin)", cliCategoriesImport},
+    {"summaries recompute", "[--month YYYY-MM]", "Rebuild scorecard summaries for a month (default last month)", cliSummariesRecompute},
+    {"periods list", "", "List bonus periods", cliPeriodsList},
+    {"periods close", "PERIOD [--actor NAME]", "Close an open bonus period (PERIOD is e.g. 2025-06 or its id)", cliPeriodsClose},
+    {"periods approve", "PERIOD --actor NAME", "Approve a closed bonus period", cliPeriodsApprove},
+    {"payroll export", "PERIOD --by NAME [--template T] [--reissue --reason R] [-o FILE]", "Export an approved period for payroll", cliPayrollExport},
+    {"backup", "[-o FILE]", "Dump the database as SQL (gzipped for .gz; - for stdout)", cliBackup},
+}
+
+type cli struct {
+    ctx    context.Context
+    api    *client.Client
+    json   bool
+    out    io.Writer
+    errOut io.Writer
+}
+
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+// routerTransport answers client requests with the API router in-process.
+type routerTransport struct{ h http.Handler }
+
+func (t routerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+    rec := httptest.NewRecorder()
+    t.h.ServeHTTP(rec, r)
+    return rec.Result(), nil
+}
+
+// program is how the binary was invoked (./main in the API image).
+func program() string { return filepath.Base(os.Args[0]) }
+
+func cliUsage(w io.Writer) {
+    fmt.Fprintf(w, "Usage: %s [--json] <command> [arguments]\n", program())
+    fmt.Fprintf(w, "       %s [serve]   run the API\n", program())
+    fmt.Fprintln(w)
+    tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+    for _, c := range cliCommands {
+        fmt.Fprintf(tw, "  %s %s\t%s\n", c.name, c.args, c.summary)
+    }
+    tw.Flush()
+    fmt.Fprintln(w, "\nDB_DSN and the same environment as the API are required. --json prints results (and errors, on stderr) as JSON.")
+}
+
+// runCLI runs one admin command and returns the process exit status.
+func runCLI(args []string, stdout, stderr io.Writer) int {
+    cl := &cli{ctx: context.Background(), out: stdout, errOut: stderr}
+    global := flag.NewFlagSet(program(), flag.ContinueOnError)
+    global.SetOutput(stderr)
+    global.Usage = func() { cliUsage(stderr) }
+    global.BoolVar(&cl.json, "json", false, "print results as JSON")
+    if err := global.Parse(args); err != nil {
+        if errors.Is(err, flag.ErrHelp) {
+            return 0
+        }
+        return 2
+    }
+    args = global.Args()
+    if len(args) == 0 || args[0] == "help" {
+        cliUsage(stdout)
+        return 0
+    }
+
+    var cmd *cliCommand
+    for i := range cliCommands {
+        words := strings.Fields(cliCommands[i].name)
+        if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == cliCommands[i].name {
+            cmd, args = &cliCommands[i], args[len(words):]
+            break
+        }
+    }
+    if cmd == nil {
+        fmt.Fprintf(stderr, "unknown command %q\n\n", strings.Join(args, " "))
+        cliUsage(stderr)
+        return 2
+    }
+
+    // Tests set db themselves
+    if db == nil {
+        if err := connectDB(3); err != nil {
+            return cl.fail(fmt.Errorf("database: %w", err))
+        }
+        if err := loadServices(); err != nil {
+            return cl.fail(err)
+        }
+    }
+    if gin.Mode() == gin.DebugMode {
+        gin.SetMode(gin.ReleaseMode)
+    }
+    logRequests = false // no request log lines in command output
+    cl.api = client.New("http://cli", client.WithHTTPClient(&http.Client{Transport: routerTransport{newRouter()}}),
+        client.WithRetries(0, 0), client.WithTimeout(0))
+
+    if err := cmd.run(cl, args); err != nil {
+        var usage usageError
+        if errors.As(err, &usage) || errors.Is(err, flag.ErrHelp) {
+            if !errors.Is(err, flag.ErrHelp) {
+                fmt.Fprintln(stderr, err)
+            }
+            fmt.Fprintf(stderr, "usage: %s %s %s\n", program(), cmd.name, cmd.args)
+            return 2
+        }
+        return cl.fail(err)
+    }
+    return 0
+}
+
+// fail reports err on stderr, as {"message", "status"} JSON with --json.
+func (cl *cli) fail(err error) int {
+    if cl.json {
+        body := map[string]any{"message": err.Error()}
+        var apiErr *client.Error
+        if errors.As(err, &apiErr) {
+            body["message"], body["status"] = apiErr.Message, apiErr.StatusCode
+        }
+        json.NewEncoder(cl.errOut).Encode(body)
+    } else {
+        fmt.Fprintln(cl.errOut, "error:", err)
+    }
+    return 1
+}
+
+// flags is a flag set for one command that also accepts --json.
+func (cl *cli) flags(name string) *flag.FlagSet {
+    fs := flag.NewFlagSet(name, flag.ContinueOnError)
+    fs.SetOutput(cl.errOut)
+    fs.BoolVar(&cl.json, "json", cl.json, "print results as JSON")
+    return fs
+}
+
+// parse accepts flags before, between and after positional arguments and checks
+// their count.
+func parse(fs *flag.FlagSet, args []string, positional int) ([]string, error) {
+    var pos []string
+    for {
+        if err := fs.Parse(args); err != nil {
+            return nil, err
+        }
+        if args = fs.Args(); len(args) == 0 {
+            break
+        }
+        pos, args = append(pos, args[0]), args[1:]
+    }
+    if len(pos) != positional {
+        return nil, usageError(fmt.Sprintf("expected %d argument(s), got %d", positional, len(pos)))
+    }
+    return pos, nil
+}
+
+// result prints v as indented JSON with --json and otherwise lets table write text
+// to a tab-aligned writer.
+func (cl *cli) result(v any, table func(w io.Writer)) error {
+    if cl.json {
+        enc := json.NewEncoder(cl.out)
+        enc.SetIndent("", "  ")
+        return enc.Encode(v)
+    }
+    tw := tabwriter.NewWriter(cl.out, 0, 4, 2, ' ', 0)
+    table(tw)
+    return tw.Flush()
+}
+
+func ptrOrDash[T any](p *T) string {
+    if p == nil {
+        return "-"
+    }
+    return fmt.Sprint(*p)
+}
+
+// --- Users ---
+
+func cliUsersList(cl *cli, args []string) error {
+    if _, err := parse(cl.flags("users list"), args, 0); err != nil {
+        return err
+    }
+    users, err := cl.api.ListNotificationUsers(cl.ctx)
+    if err != nil {
+        return err
+    }
+    return cl.result(users, func(w io.Writer) {
+        fmt.Fprintln(w, "ID\tEMAIL\tNAME\tROLE\tDRIVER\tACTIVE")
+        for _, u := range users {
+            fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%t\n", u.UserID, u.Email, u.Name, u.Role, ptrOrDash(u.DriverID), u.Active)
+        }
+    })
+}
+
+func cliUsersAdd(cl *cli, args []string) error {
+    fs := cl.flags("users add")
+    var u NotificationUser
+    fs.StringVar(&u.Email, "email", "", "email address")
+    fs.StringVar(&u.Name, "name", "", "display name")
+    fs.StringVar(&u.Role, "role", "", "manager, supervisor, payroll or driver")
+    driverID := fs.Int("driver-id", 0, "the driver, for the driver role")
+    inactive := fs.Bool("inactive", false, "add without sending anything yet")
+    if _, err := parse(fs, args, 0); err != nil {
+        return err
+    }
+    if u.Email == "" || u.Role == "" {
+        return usageError("--email and --role are required")
+    }
+    if *driverID > 0 {
+        u.DriverID = driverID
+    }
+    u.Active = !*inactive
+    saved, err := cl.api.CreateNotificationUser(cl.ctx, u)
+    if err != nil {
+        return err
+    }
+    return cl.result(saved, func(w io.Writer) {
+        fmt.Fprintf(w, "added user %d <%s> as %s\n", saved.UserID, saved.Email, saved.Role)
+    })
+}
+
+func cliUsersRemove(cl *cli, args []string) error {
+    pos, err := parse(cl.flags("users remove"), args, 1)
+    if err != nil {
+        return err
+    }
+    id, err := strconv.Atoi(pos[0])
+    if err != nil {
+        return usageError("ID must be a number")
+    }
+    if err := cl.api.DeleteNotificationUser(cl.ctx, id); err != nil {
+        return err
+    }
+    return cl.result(map[string]any{"removed": id}, func(w io.Writer) {
+        fmt.Fprintf(w, "removed user %d\n", id)
+    })
+}
+
+// --- Safety categories ---
+
+type categoryImport struct {
+    Code       string `json:"code"`
+    Action     string `json:"action" enum:"created,updated,unchanged"`
+    CategoryID int    `json:"category_id,omitempty"`
+}
+
+func cliCategoriesImport(cl *cli, args []string) error {
+    fs := cl.flags("categories import")
+    dryRun := fs.Bool("dry-run", false, "report what would change without saving")
+    pos, err := parse(fs, args, 1)
+    if err != nil {
+        return err
+    }
+    var in io.Reader = os.Stdin
+    if pos[0] != "-" {
+        f, err := os.Open(pos[0])
+        if err != nil {
+            return err
+        }
+        defer f.Close()
+        in = f
+    }
+    incoming, err := readCategories(in)
+    if err != nil {
+        return err
+    }
+
+    existing, err := cl.api.ListSafetyCategories(cl.ctx)
+    if err != nil {
+        return err
+    }
+    byCode := map[string]SafetyCategory{}
+    for _, sc := range existing {
+        byCode[strings.ToUpper(sc.Code)] = sc
+    }
+    var report []categoryImport
+    for _, sc := range incoming {
+        r := categoryImport{Code: sc.Code, Action: "created"}
+        if old, ok := byCode[strings.ToUpper(sc.Code)]; ok {
+            sc.CategoryID, r.CategoryID = old.CategoryID, old.CategoryID
+            r.Action = "updated"
+            if sc == old {
+                r.Action = "unchanged"
+            }
+        }
+        if !*dryRun {
+            switch r.Action {
+            case "created":
+                saved, err := cl.api.CreateSafetyCategory(cl.ctx, sc)
+                if err != nil {
+                    return fmt.Errorf("%s: %w", sc.Code, err)
+                }
+                r.CategoryID = saved.CategoryID
+            case "updated":
+                if _, err := cl.api.UpdateSafetyCategory(cl.ctx, sc); err != nil {
+                    return fmt.Errorf("%s: %w", sc.Code, err)
+                }
+            }
+        }
+        report = append(report, r)
+    }
+    return cl.result(report, func(w io.Writer) {
+        fmt.Fprintln(w, "CODE\tACTION\tID")
+        for _, r := range report {
+            fmt.Fprintf(w, "%s\t%s\t%d\n", r.Code, r.Action, r.CategoryID)
+        }
+    })
+}
+
+// readCategories takes a JSON array of safety categories or a CSV file with the
+// header code,description,scoring_system,p_i_score.
+func readCategories(r io.Reader) ([]SafetyCategory, error) {
+    data, err := io.ReadAll(r)
+    if err != nil {
+        return nil, err
+    }
+    var out []SafetyCategory
+    if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+        if err := json.Unmarshal(data, &out); err != nil {
+            return nil, fmt.Errorf("categories JSON: %w", err)
+        }
+    } else {
+        records, err := csv.NewReader(strings.NewReader(trimmed)).ReadAll()
+        if err != nil {
+            return nil, fmt.Errorf("categories CSV: %w", err)
+        }
+        if len(records) == 0 || strings.Join(records[0], ",") != "code,description,scoring_system,p_i_score" {
+            return nil, errors.New("categories CSV must start with the header code,description,scoring_system,p_i_score")
+        }
+        for i, rec := range records[1:] {
+            scoring, err1 := strconv.Atoi(strings.TrimSpace(rec[2]))
+            points, err2 := strconv.Atoi(strings.TrimSpace(rec[3]))
+            if err1 != nil || err2 != nil {
+                return nil, fmt.Errorf("categories CSV line %d: scoring_system and p_i_score must be numbers", i+2)
+            }
+            out = append(out, SafetyCategory{Code: strings.TrimSpace(rec[0]), Description: strings.TrimSpace(rec[1]), ScoringSystem: scoring, PIScore: points})
+        }
+    }
+    for i, sc := range out {
+        if sc.Code == "" {
+            return nil, fmt.Errorf("category %d has no code", i+1)
+        }
+    }
+    return out, nil
+}
+
+// --- Scorecard summaries ---
+
+func cliSummariesRecompute(cl *cli, args []string) error {
+    fs := cl.flags("summaries recompute")
+    month := fs.String("month", "", "YYYY-MM (default last month)")
+    if _, err := parse(fs, args, 0); err != nil {
+        return err
+    }
+    // The job summarises the month before the time it runs at
+    at := time.Now().In(localTZ)
+    if *month != "" {
+        first, err := time.ParseInLocation("2006-01", *month, localTZ)
+        if err != nil {
+            return usageError("--month must be YYYY-MM")
+        }
+        at = first.AddDate(0, 1, 0)
+    }
+    msg, err := generateScorecardSummaries(cl.ctx, at)
+    if err != nil {
+        return err
+    }
+    done := map[string]string{"month": at.AddDate(0, -1, 0).Format("2006-01"), "message": msg}
+    return cl.result(done, func(w io.Writer) { fmt.Fprintln(w, msg) })
+}
+
+// --- Bonus periods & payroll ---
+
+func cliPeriodsList(cl *cli, args []string) error {
+    if _, err := parse(cl.flags("periods list"), args, 0); err != nil {
+        return err
+    }
+    periods, err := cl.api.ListBonusPeriods(cl.ctx)
+    if err != nil {
+        return err
+    }
+    return cl.result(periods, func(w io.Writer) { printPeriods(w, periods) })
+}
+
+func printPeriods(w io.Writer, periods []BonusPeriod) {
+    fmt.Fprintln(w, "ID\tPERIOD\tSTARTS\tENDS\tSTATUS\tMAX PAYOUT\tAPPROVED BY")
+    for _, p := range periods {
+        fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%.2f\t%s\n", p.PeriodID, p.Period, p.StartsOn, p.EndsOn, p.Status, p.MaxPayout, ptrOrDash(p.ApprovedBy))
+    }
+}
+
+// periodID accepts a period key (2025-06, 2025-Q2) or a period id.
+func (cl *cli) periodID(arg string) (int, error) {
+    if id, err := strconv.Atoi(arg); err == nil {
+        return id, nil
+    }
+    periods, err := cl.api.ListBonusPeriods(cl.ctx)
+    if err != nil {
+        return 0, err
+    }
+    for _, p := range periods {
+        if strings.EqualFold(p.Period, arg) {
+            return p.PeriodID, nil
+        }
+    }
+    return 0, fmt.Errorf("no bonus period %s", arg)
+}
+
+func cliPeriodsClose(cl *cli, args []string) error {
+    return cl.periodTransition("periods close", args, false)
+}
+
+func cliPeriodsApprove(cl *cli, args []string) error {
+    return cl.periodTransition("periods approve", args, true)
+}
+
+func (cl *cli) periodTransition(name string, args []string, approve bool) error {
+    fs := cl.flags(name)
+    actor := fs.String("actor", "", "who is doing it (required to approve)")
+    pos, err := parse(fs, args, 1)
+    if err != nil {
+        return err
+    }
+    if approve && *actor == "" {
+        return usageError("--actor is required")
+    }
+    id, err := cl.periodID(pos[0])
+    if err != nil {
+        return err
+    }
+    var p BonusPeriod
+    if approve {
+        p, err = cl.api.ApproveBonusPeriod(cl.ctx, id, *actor)
+    } else {
+        p, err = cl.api.CloseBonusPeriod(cl.ctx, id, *actor)
+    }
+    if err != nil {
+        return err
+    }
+    return cl.result(p, func(w io.Writer) { fmt.Fprintf(w, "bonus period %s is %s\n", p.Period, p.Status) })
+}
+
+func cliPayrollExport(cl *cli, args []string) error {
+    fs := cl.flags("payroll export")
+    var req PayrollExportRequest
+    fs.StringVar(&req.ExportedBy, "by", "", "who is exporting")
+    fs.BoolVar(&req.Reissue, "reissue", false, "export a period that was exported before")
+    fs.StringVar(&req.Reason, "reason", "", "why it is reissued")
+    template := fs.String("template", "", "payroll template (default csv)")
+    output := fs.String("o", "", "file to write (default the server's file name; - for stdout)")
+    pos, err := parse(fs, args, 1)
+    if err != nil {
+        return err
+    }
+    if req.ExportedBy == "" {
+        return usageError("--by is required")
+    }
+    id, err := cl.periodID(pos[0])
+    if err != nil {
+        return err
+    }
+    f, err := cl.api.ExportPayroll(cl.ctx, id, *template, req)
+    if err != nil {
+        return err
+    }
+    if *output == "-" {
+        _, err := cl.out.Write(f.Data)
+        return err
+    }
+    name := *output
+    if name == "" {
+        name = filepath.Base(f.Name)
+    }
+    if err := os.WriteFile(name, f.Data, 0o644); err != nil {
+        return err
+    }
+    done := map[string]any{"file": name, "bytes": len(f.Data)}
+    return cl.result(done, func(w io.Writer) { fmt.Fprintf(w, "wrote %s (%d bytes)\n", name, len(f.Data)) })
+}
+
+// --- Backup ---
+
+func cliBackup(cl *cli, args []string) error {
+    fs := cl.flags("backup")
+    output := fs.String("o", "", "file to write (default driver_safety-<time>.sql.gz; - for stdout)")
+    if _, err := parse(fs, args, 0); err != nil {
+        return err
+    }
+    name := *output
+    if name == "" {
+        name = "driver_safety-" + time.Now().In(localTZ).Format("20060102-150405") + ".sql.gz"
+    }
+    if name == "-" {
+        _, err := backupDatabase(cl.ctx, cl.out, false)
+        return err
+    }
+    f, err := os.Create(name)
+    if err != nil {
+        return err
+    }
+    stats, err := backupDatabase(cl.ctx, f, strings.HasSuffix(name, ".gz"))
+    if cerr := f.Close(); err == nil {
+        err = cerr
+    }
+    if err != nil {
+        os.Remove(name)
+        return err
+    }
+    done := map[string]any{"file": name, "tables": stats.Tables, "rows": stats.Rows}
+    return cl.result(done, func(w io.Writer) {
+        fmt.Fprintf(w, "wrote %s (%d tables, %d rows)\n", name, stats.Tables, stats.Rows)
+    })
+}
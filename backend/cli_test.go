@@ -0,0 +1,121 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/gin-gonic/gin"
+)
+
+// testCLI runs a command against a mocked database and returns its exit status,
+// stdout and stderr.
+func testCLI(t *testing.T, mock func(sqlmock.Sqlmock), args ...string) (int, string, string) {
+    t.Helper()
+    gin.SetMode(gin.TestMode)
+    m := withMockDB(t)
+    if mock != nil {
+        mock(m)
+    }
+    var stdout, stderr bytes.Buffer
+    code := runCLI(args, &stdout, &stderr)
+    return code, stdout.String(), stderr.String()
+}
+
+func TestCLIUsageErrors(t *testing.T) {
+    for _, args := range [][]string{
+        {"frobnicate"},
+        {"periods", "approve", "2025-06"},
+        {"users", "remove"},
+        {"summaries", "recompute", "--month", "June"},
+    } {
+        t.Run(strings.Join(args, " "), func(t *testing.T) {
+            if code, _, _ := testCLI(t, nil, args...); code != 2 {
+                t.Errorf("%v exited %d, want 2", args, code)
+            }
+        })
+    }
+}
+
+func TestCLIErrorsAsJSON(t *testing.T) {
+    code, _, stderr := testCLI(t, nil, "--json", "users", "add", "--email", "ops@example.com", "--name", "Ops", "--role", "pilot")
+    var body struct {
+        Message string `json:"message"`
+        Status  int    `json:"status"`
+    }
+    if code != 1 || json.Unmarshal([]byte(stderr), &body) != nil || body.Status != 400 || !strings.Contains(body.Message, "role") {
+        t.Errorf("exit %d, stderr %q", code, stderr)
+    }
+}
+
+func TestCLICategoriesImportDryRun(t *testing.T) {
+    file := filepath.Join(t.TempDir(), "categories.csv")
+    csv := "code,description,scoring_system,p_i_score\nSPD,Speeding,1,3\nHOS,Hours of service,1,5\nNEW,New one,2,1\n"
+    if err := os.WriteFile(file, []byte(csv), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    code, stdout, stderr := testCLI(t, func(m sqlmock.Sqlmock) {
+        m.ExpectQuery(`FROM safety_categories`).WillReturnRows(
+            sqlmock.NewRows([]string{"category_id", "code", "description", "scoring_system", "p_i_score"}).
+                AddRow(1, "SPD", "Speeding", 1, 3).
+                AddRow(2, "HOS", "Hours", 1, 5))
+    }, "categories", "import", file, "--dry-run", "--json")
+    if code != 0 {
+        t.Fatalf("exit %d: %s", code, stderr)
+    }
+    var report []categoryImport
+    if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+        t.Fatal(err)
+    }
+    got := []string{}
+    for _, r := range report {
+        got = append(got, r.Code+"="+r.Action)
+    }
+    if strings.Join(got, " ") != "SPD=unchanged HOS=updated NEW=created" {
+        t.Errorf("report = %v", got)
+    }
+}
+
+func TestBackupDatabase(t *testing.T) {
+    m := withMockDB(t)
+
+    // One connection, one snapshot for every table
+    m.ExpectExec(`SET TRANSACTION ISOLATION LEVEL REPEATABLE READ`).WillReturnResult(sqlmock.NewResult(0, 0))
+    m.ExpectExec(`START TRANSACTION WITH CONSISTENT SNAPSHOT`).WillReturnResult(sqlmock.NewResult(0, 0))
+    m.ExpectQuery(`SHOW FULL TABLES`).WillReturnRows(sqlmock.NewRows([]string{"Tables_in_x", "Table_type"}).AddRow("trucks", "BASE TABLE").AddRow("truck_history", "BASE TABLE"))
+    m.ExpectQuery("SHOW CREATE TABLE `trucks`").WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("trucks", "CREATE TABLE `trucks` (...)"))
+    m.ExpectQuery("SELECT \\* FROM `trucks`").WillReturnRows(sqlmock.NewRowsWithColumnDefinition(
+        sqlmock.NewColumn("truck_id").OfType("INT", 0),
+        sqlmock.NewColumn("unit_number").OfType("VARCHAR", ""),
+        sqlmock.NewColumn("photo").OfType("BLOB", nil),
+    ).AddRow([]byte("1"), []byte("O'Brien\n"), []byte{0xff}).AddRow([]byte("2"), []byte("T-2"), nil))
+    // parseTime=true: time columns arrive as time.Time and must not be written as RFC 3339
+    m.ExpectQuery("SHOW CREATE TABLE `truck_history`").WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("truck_history", "CREATE TABLE `truck_history` (...)"))
+    m.ExpectQuery("SELECT \\* FROM `truck_history`").WillReturnRows(sqlmock.NewRowsWithColumnDefinition(
+        sqlmock.NewColumn("history_id").OfType("INT", 0),
+        sqlmock.NewColumn("date").OfType("DATETIME", time.Time{}),
+        sqlmock.NewColumn("starts_on").OfType("DATE", time.Time{}),
+    ).AddRow([]byte("1"), time.Date(2025, 6, 1, 14, 30, 5, 0, time.UTC), time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)).
+        AddRow([]byte("2"), time.Date(2025, 6, 2, 8, 0, 0, 250000000, time.UTC), nil))
+    m.ExpectExec(`ROLLBACK`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+    var out bytes.Buffer
+    stats, err := backupDatabase(context.Background(), &out, false)
+    if err != nil || stats.Tables != 2 || stats.Rows != 4 {
+        t.Fatalf("stats %+v, err %v", stats, err)
+    }
+    for _, want := range []string{
+        "INSERT INTO `trucks` VALUES ('1','O\\'Brien\\n',0xff),('2','T-2',NULL);",
+        "INSERT INTO `truck_history` VALUES ('1','2025-06-01 14:30:05','2025-06-01'),('2','2025-06-02 08:00:00.25',NULL);",
+    } {
+        if !strings.Contains(out.String(), want) {
+            t.Errorf("backup lacks %s:\n%s", want, out.String())
+        }
+    }
+}
@@ -0,0 +1,271 @@
+package client
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "iter"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+
+    "driver-safety-bonus/config"
+    "driver-safety-bonus/model"
+)
+
+// pages walks a newest-first list that pages with ?beforeId=, fetching the next
+// page only when the caller has consumed the previous one.
+func pages[T any](size int, fetch func(before int64) ([]T, error), id func(T) int64) iter.Seq2[T, error] {
+    return func(yield func(T, error) bool) {
+        var before int64
+        for {
+            page, err := fetch(before)
+            if err != nil {
+                var zero T
+                yield(zero, err)
+                return
+            }
+            for _, v := range page {
+                if !yield(v, nil) {
+                    return
+                }
+            }
+            if len(page) < size {
+                return
+            }
+            before = id(page[len(page)-1])
+        }
+    }
+}
+
+// pageSize keeps n within what the server accepts, using def when unset.
+func pageSize(n, def, max int) int {
+    if n <= 0 || n > max {
+        return def
+    }
+    return n
+}
+
+// --- Admin: config ---
+
+// Config is the server's configuration in effect, with secrets redacted.
+func (c *Client) Config(ctx context.Context) (config.Config, error) {
+    return get[config.Config](ctx, c, "/api/admin/config", nil)
+}
+
+// --- Admin: jobs ---
+
+func (c *Client) ListJobs(ctx context.Context) ([]model.JobStatus, error) {
+    return get[[]model.JobStatus](ctx, c, "/api/admin/jobs", nil)
+}
+
+// JobRuns lists a job's latest runs; limit 0 uses the server default.
+func (c *Client) JobRuns(ctx context.Context, name string, limit int) ([]model.JobRun, error) {
+    return get[[]model.JobRun](ctx, c, path("/admin/jobs/%s/runs", url.PathEscape(name)), query("limit", itoa(limit)))
+}
+
+// RunJob starts a job now; 409 while another replica is running it.
+func (c *Client) RunJob(ctx context.Context, name string) (model.JobRun, error) {
+    return write[model.JobRun](ctx, c, request{method: http.MethodPost, path: path("/admin/jobs/%s/run", url.PathEscape(name))}, nil)
+}
+
+// --- Notifications ---
+
+func (c *Client) ListNotificationUsers(ctx context.Context) ([]model.NotificationUser, error) {
+    return get[[]model.NotificationUser](ctx, c, "/api/notification-users", nil)
+}
+
+func (c *Client) CreateNotificationUser(ctx context.Context, u model.NotificationUser) (model.NotificationUser, error) {
+    return write[model.NotificationUser](ctx, c, request{method: http.MethodPost, path: "/api/notification-users"}, u)
+}
+
+func (c *Client) UpdateNotificationUser(ctx context.Context, u model.NotificationUser) (model.NotificationUser, error) {
+    return write[model.NotificationUser](ctx, c, request{method: http.MethodPut, path: path("/notification-users/%d", u.UserID)}, u)
+}
+
+func (c *Client) DeleteNotificationUser(ctx context.Context, id int) error {
+    return c.call(ctx, request{method: http.MethodDelete, path: path("/notification-users/%d", id)}, nil, nil)
+}
+
+func (c *Client) NotificationPreferences(ctx context.Context, userID int) ([]model.NotificationPreference, error) {
+    return get[[]model.NotificationPreference](ctx, c, path("/notification-users/%d/preferences", userID), nil)
+}
+
+// UpdateNotificationPreferences overrides the role defaults per event type; a nil
+// value goes back to the default.
+func (c *Client) UpdateNotificationPreferences(ctx context.Context, userID int, prefs map[string]*bool) ([]model.NotificationPreference, error) {
+    r := request{method: http.MethodPut, path: path("/notification-users/%d/preferences", userID)}
+    return write[[]model.NotificationPreference](ctx, c, r, prefs)
+}
+
+// OutboxQuery narrows Outbox. PageSize is 1-1000 (default 100).
+type OutboxQuery struct {
+    Status   string
+    PageSize int
+}
+
+// Outbox yields queued and sent email, newest first, across as many pages as the
+// loop consumes. Iteration stops after the first error.
+func (c *Client) Outbox(ctx context.Context, q OutboxQuery) iter.Seq2[model.OutboxMessage, error] {
+    size := pageSize(q.PageSize, 100, 1000)
+    return pages(size, func(before int64) ([]model.OutboxMessage, error) {
+        v := query("status", q.Status, "limit", strconv.Itoa(size), "beforeId", itoa(before))
+        return get[[]model.OutboxMessage](ctx, c, "/api/notifications/outbox", v)
+    }, func(m model.OutboxMessage) int64 { return m.OutboxID })
+}
+
+// RetryOutboxMessage sends a failed message again.
+func (c *Client) RetryOutboxMessage(ctx context.Context, id int64) error {
+    return c.call(ctx, request{method: http.MethodPost, path: path("/notifications/outbox/%d/retry", id)}, nil, nil)
+}
+
+// SendTestNotification queues a test email to u.Email.
+func (c *Client) SendTestNotification(ctx context.Context, u model.NotificationUser) error {
+    return c.call(ctx, request{method: http.MethodPost, path: "/api/notifications/test"}, u, nil)
+}
+
+// --- Webhooks ---
+
+func (c *Client) ListWebhooks(ctx context.Context) ([]model.WebhookSubscription, error) {
+    return get[[]model.WebhookSubscription](ctx, c, "/api/webhooks", nil)
+}
+
+// CreateWebhook subscribes s.URL; the result carries the signing secret, which
+// is not shown again.
+func (c *Client) CreateWebhook(ctx context.Context, s model.WebhookSubscription) (model.WebhookSubscription, error) {
+    return write[model.WebhookSubscription](ctx, c, request{method: http.MethodPost, path: "/api/webhooks"}, s)
+}
+
+func (c *Client) WebhookEventTypes(ctx context.Context) ([]model.WebhookEventType, error) {
+    return get[[]model.WebhookEventType](ctx, c, "/api/webhooks/event-types", nil)
+}
+
+// UpdateWebhook saves s; Secret "rotate" issues a new signing secret.
+func (c *Client) UpdateWebhook(ctx context.Context, s model.WebhookSubscription) (model.WebhookSubscription, error) {
+    return write[model.WebhookSubscription](ctx, c, request{method: http.MethodPut, path: path("/webhooks/%d", s.SubscriptionID)}, s)
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, id int) error {
+    return c.call(ctx, request{method: http.MethodDelete, path: path("/webhooks/%d", id)}, nil, nil)
+}
+
+func (c *Client) PingWebhook(ctx context.Context, id int) (model.WebhookPingResult, error) {
+    return write[model.WebhookPingResult](ctx, c, request{method: http.MethodPost, path: path("/webhooks/%d/ping", id)}, nil)
+}
+
+// DeliveryQuery narrows WebhookDeliveries. PageSize is 1-500 (default 50).
+type DeliveryQuery struct {
+    Status    string
+    EventType string
+    PageSize  int
+}
+
+// WebhookDeliveries yields a subscription's delivery log, newest first, across as
+// many pages as the loop consumes. Iteration stops after the first error.
+func (c *Client) WebhookDeliveries(ctx context.Context, subscriptionID int, q DeliveryQuery) iter.Seq2[model.WebhookDelivery, error] {
+    size := pageSize(q.PageSize, 50, 500)
+    p := path("/webhooks/%d/deliveries", subscriptionID)
+    return pages(size, func(before int64) ([]model.WebhookDelivery, error) {
+        v := query("status", q.Status, "eventType", q.EventType, "limit", strconv.Itoa(size), "beforeId", itoa(before))
+        return get[[]model.WebhookDelivery](ctx, c, p, v)
+    }, func(d model.WebhookDelivery) int64 { return d.DeliveryID })
+}
+
+// ReplayWebhookDeliveries re-sends the subscription's deliveries since req.Since.
+func (c *Client) ReplayWebhookDeliveries(ctx context.Context, subscriptionID int, req model.WebhookReplayRequest) (model.WebhookReplayResult, error) {
+    return write[model.WebhookReplayResult](ctx, c, request{method: http.MethodPost, path: path("/webhooks/%d/replay", subscriptionID)}, req)
+}
+
+// GetWebhookDelivery returns a delivery with its attempt history.
+func (c *Client) GetWebhookDelivery(ctx context.Context, id int64) (model.WebhookDelivery, error) {
+    return get[model.WebhookDelivery](ctx, c, path("/webhooks/deliveries/%d", id), nil)
+}
+
+func (c *Client) ReplayWebhookDelivery(ctx context.Context, id int64) (model.WebhookDelivery, error) {
+    return write[model.WebhookDelivery](ctx, c, request{method: http.MethodPost, path: path("/webhooks/deliveries/%d/replay", id)}, nil)
+}
+
+// --- Live updates ---
+
+// Change is one event of the /stream feed. Type "reset" means the history needed
+// to resume is gone: reload what you show, then keep reading.
+type Change struct {
+    ID         int64
+    Type       string          // e.g. "safety_event.created"
+    EventID    string          // same id as the webhook delivery of this change
+    OccurredAt string          // RFC 3339
+    Data       json.RawMessage // the record, e.g. a model.SafetyEvent
+}
+
+// StreamQuery narrows Stream. LastEventID resumes after that change; 0 starts
+// with changes made from now on.
+type StreamQuery struct {
+    Types       []string // driver, truck, safety_event, scorecard_event
+    DriverID    int
+    LastEventID int64
+}
+
+// Stream calls fn for each change until ctx ends, fn returns an error or the
+// connection drops, and returns that error. It does not reconnect: to resume, call
+// it again with LastEventID set to the last Change.ID seen.
+func (c *Client) Stream(ctx context.Context, q StreamQuery, fn func(Change) error) error {
+    v := query("types", strings.Join(q.Types, ","), "driverId", itoa(q.DriverID))
+    r := request{method: http.MethodGet, path: "/api/stream", query: v}
+    if q.LastEventID > 0 {
+        r.query.Set("lastEventId", strconv.FormatInt(q.LastEventID, 10))
+    }
+    // No per-attempt timeout: the response is open for as long as ctx is
+    resp, err := c.send(ctx, r, 0)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    var (
+        ch   Change
+        data strings.Builder
+    )
+    sc := bufio.NewScanner(resp.Body)
+    sc.Buffer(make([]byte, 64<<10), 4<<20)
+    for sc.Scan() {
+        line := sc.Text()
+        if line != "" {
+            field, value, _ := strings.Cut(line, ":")
+            value = strings.TrimPrefix(value, " ")
+            switch field {
+            case "id":
+                ch.ID, _ = strconv.ParseInt(value, 10, 64)
+            case "event":
+                ch.Type = value
+            case "data":
+                if data.Len() > 0 {
+                    data.WriteByte('\n')
+                }
+                data.WriteString(value)
+            }
+            continue
+        }
+        // A blank line ends an event; keepalive comments and "retry:" have no type
+        if ch.Type != "" {
+            var env struct {
+                ID         string          `json:"id"`
+                OccurredAt string          `json:"occurred_at"`
+                Data       json.RawMessage `json:"data"`
+            }
+            if err := json.Unmarshal([]byte(data.String()), &env); err != nil {
+                return err
+            }
+            ch.EventID, ch.OccurredAt, ch.Data = env.ID, env.OccurredAt, env.Data
+            if err := fn(ch); err != nil {
+                return err
+            }
+        }
+        ch = Change{}
+        data.Reset()
+    }
+    if err := sc.Err(); err != nil {
+        return err
+    }
+    return ctx.Err()
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+    "context"
+    "net/http"
+
+    "driver-safety-bonus/model"
+)
+
+// --- Bonus periods & payroll ---
+
+func (c *Client) ListBonusPeriods(ctx context.Context) ([]model.BonusPeriod, error) {
+    return get[[]model.BonusPeriod](ctx, c, "/api/bonus-periods", nil)
+}
+
+// CreateBonusPeriod opens p.Period ("YYYY-MM" or "YYYY-Qn"); 409 if it exists.
+func (c *Client) CreateBonusPeriod(ctx context.Context, p model.BonusPeriod) (model.BonusPeriod, error) {
+    return write[model.BonusPeriod](ctx, c, request{method: http.MethodPost, path: "/api/bonus-periods"}, p)
+}
+
+func (c *Client) CloseBonusPeriod(ctx context.Context, id int, actor string) (model.BonusPeriod, error) {
+    r := request{method: http.MethodPost, path: path("/bonus-periods/%d/close", id)}
+    return write[model.BonusPeriod](ctx, c, r, model.PeriodActionRequest{Actor: actor})
+}
+
+// ApproveBonusPeriod locks a closed period; actor is required.
+func (c *Client) ApproveBonusPeriod(ctx context.Context, id int, actor string) (model.BonusPeriod, error) {
+    r := request{method: http.MethodPost, path: path("/bonus-periods/%d/approve", id)}
+    return write[model.BonusPeriod](ctx, c, r, model.PeriodActionRequest{Actor: actor})
+}
+
+func (c *Client) BonusLines(ctx context.Context, periodID int) ([]model.BonusLine, error) {
+    return get[[]model.BonusLine](ctx, c, path("/bonus-periods/%d/lines", periodID), nil)
+}
+
+// ExportPayroll writes the payroll file of an approved period with template
+// ("" for the default csv) and returns it.
+func (c *Client) ExportPayroll(ctx context.Context, periodID int, template string, req model.PayrollExportRequest) (File, error) {
+    r := request{method: http.MethodPost, path: path("/bonus-periods/%d/payroll-export", periodID), query: query("template", template)}
+    if err := setJSON(&r, req); err != nil {
+        return File{}, err
+    }
+    return c.download(ctx, r)
+}
+
+// ListPayrollExports is the export log, for one period or (periodID 0) all.
+func (c *Client) ListPayrollExports(ctx context.Context, periodID int) ([]model.PayrollExport, error) {
+    return get[[]model.PayrollExport](ctx, c, "/api/payroll-exports", query("periodId", itoa(periodID)))
+}
+
+func (c *Client) DownloadPayrollExport(ctx context.Context, id int) (File, error) {
+    return c.download(ctx, request{method: http.MethodGet, path: path("/payroll-exports/%d/download", id)})
+}
+
+// --- Reports ---
+
+// Interval of a safety timeseries: "week" or "month".
+func (c *Client) SafetyTimeseries(ctx context.Context, r DateRange, interval string) (model.ReportSeries, error) {
+    q := r.values()
+    if interval != "" {
+        q.Set("interval", interval)
+    }
+    return get[model.ReportSeries](ctx, c, "/api/reports/safety/timeseries", q)
+}
+
+func (c *Client) SafetyByCategory(ctx context.Context, r DateRange) (model.ReportSeries, error) {
+    return get[model.ReportSeries](ctx, c, "/api/reports/safety/by-category", r.values())
+}
+
+func (c *Client) SafetyByDriverType(ctx context.Context, r DateRange) (model.ReportSeries, error) {
+    return get[model.ReportSeries](ctx, c, "/api/reports/safety/by-driver-type", r.values())
+}
+
+func (c *Client) SafetyByTruck(ctx context.Context, r DateRange) (model.ReportSeries, error) {
+    return get[model.ReportSeries](ctx, c, "/api/reports/safety/by-truck", r.values())
+}
+
+// TopOffenders lists the drivers with the most points; limit 0 uses the server default.
+func (c *Client) TopOffenders(ctx context.Context, r DateRange, limit int) ([]model.TopOffender, error) {
+    q := r.values()
+    if limit > 0 {
+        q.Set("limit", itoa(limit))
+    }
+    return get[[]model.TopOffender](ctx, c, "/api/reports/safety/top-offenders", q)
+}
+
+func (c *Client) SafetyTrend(ctx context.Context, r DateRange) (model.SafetyTrend, error) {
+    return get[model.SafetyTrend](ctx, c, "/api/reports/safety/trend", r.values())
+}
+
+func (c *Client) InspectionReport(ctx context.Context, r DateRange) (model.InspectionReport, error) {
+    return get[model.InspectionReport](ctx, c, "/api/reports/safety/inspections", r.values())
+}
+
+// --- Scorecards ---
+
+// ScorecardSummaries for month (YYYY-MM; "" for the current month).
+func (c *Client) ScorecardSummaries(ctx context.Context, month string) ([]model.ScorecardSummary, error) {
+    return get[[]model.ScorecardSummary](ctx, c, "/api/scorecards/summaries", query("month", month))
+}
+
+func (c *Client) MissingScorecards(ctx context.Context, month string) ([]model.ScorecardChecklist, error) {
+    return get[[]model.ScorecardChecklist](ctx, c, "/api/scorecards/missing", query("month", month))
+}
@@ -0,0 +1,373 @@
+// Package client is a typed Go client for the DriverSafetyBonus API. It uses the
+// server's own JSON types (package model), so requests and responses always match
+// what the API sends and accepts.
+//
+//    api := client.New("http://localhost:8080")
+//    d, err := api.GetDriver(ctx, 12)
+//    if client.IsNotFound(err) { ... }
+//    d.LastName = "Smith"
+//    d, err = api.UpdateDriver(ctx, d) // If-Match from d.Version; 412 if someone saved first
+//
+// Reads and conditional writes are retried on 5xx responses and timeouts; POSTs are
+// never retried because the server may already have acted on them.
+package client
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "mime"
+    "net"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+
+    "driver-safety-bonus/model"
+)
+
+type Client struct {
+    baseURL string
+    http    *http.Client
+    header  http.Header
+    timeout time.Duration // per attempt; 0 = none
+    retries int
+    backoff time.Duration
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sends requests through h (proxies, TLS settings, test transports).
+func WithHTTPClient(h *http.Client) Option {
+    return func(c *Client) { c.http = h }
+}
+
+// WithRetries sets how often a failed idempotent request is tried again (default 3)
+// and the wait before the first retry, which doubles after each one (default 250ms).
+func WithRetries(n int, backoff time.Duration) Option {
+    return func(c *Client) { c.retries, c.backoff = n, backoff }
+}
+
+// WithTimeout limits each attempt (default 30s). A timed-out attempt counts as a
+// failure and is retried like a 5xx; the caller's context bounds the whole call.
+func WithTimeout(d time.Duration) Option {
+    return func(c *Client) { c.timeout = d }
+}
+
+// WithHeader adds a header to every request, e.g. Authorization behind a gateway.
+func WithHeader(key, value string) Option {
+    return func(c *Client) { c.header.Add(key, value) }
+}
+
+// New returns a client for the API at baseURL, e.g. "http://localhost:8080".
+func New(baseURL string, opts ...Option) *Client {
+    c := &Client{
+        baseURL: strings.TrimRight(baseURL, "/"),
+        http:    http.DefaultClient,
+        header:  http.Header{},
+        timeout: 30 * time.Second,
+        retries: 3,
+        backoff: 250 * time.Millisecond,
+    }
+    for _, opt := range opts {
+        opt(c)
+    }
+    return c
+}
+
+// --- Errors ---
+
+// Error is a non-2xx answer from the API. The server's message is in Message and
+// the id of the request (X-Request-ID, also in the server logs) in RequestID.
+type Error struct {
+    StatusCode int
+    model.APIError
+    // Current is the record as stored now, sent with 412 Precondition Failed.
+    Current json.RawMessage
+}
+
+func (e *Error) Error() string {
+    if e.Message == "" {
+        return fmt.Sprintf("api: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+    }
+    return fmt.Sprintf("api: %d %s", e.StatusCode, e.Message)
+}
+
+// CurrentAs decodes Current (the stored record of a 412) into v, e.g. a *model.Driver.
+func (e *Error) CurrentAs(v any) error {
+    if len(e.Current) == 0 {
+        return errors.New("api: error has no current record")
+    }
+    return json.Unmarshal(e.Current, v)
+}
+
+// StatusCode is the HTTP status of an API error, or 0 for transport errors.
+func StatusCode(err error) int {
+    var e *Error
+    if errors.As(err, &e) {
+        return e.StatusCode
+    }
+    return 0
+}
+
+func IsNotFound(err error) bool { return StatusCode(err) == http.StatusNotFound }
+func IsConflict(err error) bool { return StatusCode(err) == http.StatusConflict }
+
+// IsPreconditionFailed reports a stale version: someone else saved the record
+// first. The error's Current holds their version.
+func IsPreconditionFailed(err error) bool { return StatusCode(err) == http.StatusPreconditionFailed }
+
+func decodeError(resp *http.Response) error {
+    e := &Error{StatusCode: resp.StatusCode}
+    var body struct {
+        Message string          `json:"message"`
+        Error   string          `json:"error"` // healthz reports failures here
+        Current json.RawMessage `json:"current"`
+    }
+    raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+    if json.Unmarshal(raw, &body) == nil {
+        e.Message, e.Current = body.Message, body.Current
+        if e.Message == "" {
+            e.Message = body.Error
+        }
+    } else {
+        e.Message = strings.TrimSpace(string(raw))
+    }
+    e.RequestID = resp.Header.Get("X-Request-ID")
+    return e
+}
+
+// --- Transport ---
+
+type request struct {
+    method      string
+    path        string
+    query       url.Values
+    body        []byte
+    contentType string
+    ifMatch     string
+    conditional bool // a versioned write: refused without ifMatch
+}
+
+// idempotent requests can be sent again safely. A conditional PATCH is: a repeat
+// of one that already landed fails with 412 instead of applying twice.
+func (r request) idempotent() bool {
+    switch r.method {
+    case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+        return true
+    case http.MethodPatch:
+        return r.ifMatch != "" && r.ifMatch != "*"
+    }
+    return false
+}
+
+// AnyVersion in place of a record version writes whatever version is stored
+// (If-Match: *), overwriting changes the caller hasn't seen.
+const AnyVersion = -1
+
+// ErrNoVersion is returned, without sending anything, for an update or delete
+// whose version is 0 (unknown). Read the record first, or pass AnyVersion.
+var ErrNoVersion = errors.New("client: record version unknown; read the record first or pass AnyVersion")
+
+// ifMatch is the If-Match value for a record version; "" when it is unknown.
+func ifMatch(version int) string {
+    switch {
+    case version == AnyVersion:
+        return "*"
+    case version <= 0:
+        return ""
+    }
+    return `"` + strconv.Itoa(version) + `"`
+}
+
+// cancelBody ends the attempt's timeout once the caller is done with the body.
+type cancelBody struct {
+    io.ReadCloser
+    cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+    err := b.ReadCloser.Close()
+    b.cancel()
+    return err
+}
+
+// send runs r, retrying idempotent requests on 5xx and timeouts. Any status of 400
+// or above comes back as *Error; otherwise the caller must close the body.
+func (c *Client) send(ctx context.Context, r request, timeout time.Duration) (*http.Response, error) {
+    if r.conditional && r.ifMatch == "" {
+        return nil, ErrNoVersion
+    }
+    u := c.baseURL + r.path
+    if len(r.query) > 0 {
+        u += "?" + r.query.Encode()
+    }
+    for attempt := 0; ; attempt++ {
+        actx, cancel := ctx, context.CancelFunc(func() {})
+        if timeout > 0 {
+            actx, cancel = context.WithTimeout(ctx, timeout)
+        }
+        req, err := http.NewRequestWithContext(actx, r.method, u, bytes.NewReader(r.body))
+        if err != nil {
+            cancel()
+            return nil, err
+        }
+        for k, v := range c.header {
+            req.Header[k] = v
+        }
+        req.Header.Set("Accept", "application/json")
+        if r.contentType != "" {
+            req.Header.Set("Content-Type", r.contentType)
+        }
+        if r.ifMatch != "" {
+            req.Header.Set("If-Match", r.ifMatch)
+        }
+
+        retry := r.idempotent() && attempt < c.retries
+        resp, err := c.http.Do(req)
+        switch {
+        case err != nil:
+            cancel()
+            if !retry || ctx.Err() != nil || !isTimeout(err) {
+                return nil, err
+            }
+        case resp.StatusCode >= 500 && retry:
+            io.Copy(io.Discard, resp.Body)
+            resp.Body.Close()
+            cancel()
+        case resp.StatusCode >= 400:
+            defer cancel()
+            defer resp.Body.Close()
+            return nil, decodeError(resp)
+        default:
+            resp.Body = cancelBody{resp.Body, cancel}
+            return resp, nil
+        }
+
+        wait := c.backoff << attempt
+        t := time.NewTimer(wait)
+        select {
+        case <-ctx.Done():
+            t.Stop()
+            return nil, ctx.Err()
+        case <-t.C:
+        }
+    }
+}
+
+func isTimeout(err error) bool {
+    var ne net.Error
+    return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout())
+}
+
+// call sends in as JSON (when not nil) and decodes the response into out (when not nil).
+func (c *Client) call(ctx context.Context, r request, in, out any) error {
+    if in != nil {
+        if err := setJSON(&r, in); err != nil {
+            return err
+        }
+    }
+    resp, err := c.send(ctx, r, c.timeout)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if out == nil || resp.StatusCode == http.StatusNoContent {
+        _, err = io.Copy(io.Discard, resp.Body)
+        return err
+    }
+    return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func setJSON(r *request, in any) error {
+    b, err := json.Marshal(in)
+    if err != nil {
+        return err
+    }
+    r.body = b
+    if r.contentType == "" {
+        r.contentType = "application/json"
+    }
+    return nil
+}
+
+func get[T any](ctx context.Context, c *Client, path string, query url.Values) (T, error) {
+    var out T
+    err := c.call(ctx, request{method: http.MethodGet, path: path, query: query}, nil, &out)
+    return out, err
+}
+
+// write sends in with method and decodes the answer as T.
+func write[T any](ctx context.Context, c *Client, r request, in any) (T, error) {
+    var out T
+    err := c.call(ctx, r, in, &out)
+    return out, err
+}
+
+// Patch is a JSON Merge Patch (RFC 7386): only the fields present change, and a nil
+// value clears a nullable field.
+type Patch map[string]any
+
+func patchRequest(path, ifMatch string) request {
+    return request{method: http.MethodPatch, path: path, contentType: "application/merge-patch+json", ifMatch: ifMatch}
+}
+
+// versionedPatch patches a versioned record; see ifMatch.
+func versionedPatch(path string, version int) request {
+    r := patchRequest(path, ifMatch(version))
+    r.conditional = true
+    return r
+}
+
+// --- Files ---
+
+// File is a document sent to or received from the API.
+type File struct {
+    Name        string
+    ContentType string
+    Data        []byte
+}
+
+func (c *Client) download(ctx context.Context, r request) (File, error) {
+    resp, err := c.send(ctx, r, c.timeout)
+    if err != nil {
+        return File{}, err
+    }
+    defer resp.Body.Close()
+    data, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return File{}, err
+    }
+    f := File{ContentType: resp.Header.Get("Content-Type"), Data: data}
+    if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+        f.Name = params["filename"]
+    }
+    return f, nil
+}
+
+func path(format string, a ...any) string {
+    return "/api" + fmt.Sprintf(format, a...)
+}
+
+// query builds url.Values from name/value pairs, leaving out empty values.
+func query(pairs ...string) url.Values {
+    q := url.Values{}
+    for i := 0; i+1 < len(pairs); i += 2 {
+        if pairs[i+1] != "" {
+            q.Set(pairs[i], pairs[i+1])
+        }
+    }
+    return q
+}
+
+// itoa is strconv.Itoa with 0 as "" so unset filters drop out of query.
+func itoa[N int | int64](n N) string {
+    if n == 0 {
+        return ""
+    }
+    return strconv.FormatInt(int64(n), 10)
+}
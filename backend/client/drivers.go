@@ -0,0 +1,188 @@
+package client
+
+import (
+    "bytes"
+    "context"
+    "mime/multipart"
+    "net/http"
+    "net/textproto"
+    "strconv"
+
+    "driver-safety-bonus/model"
+)
+
+// Health pings the API and its database. An unhealthy API answers with a 503 *Error.
+func (c *Client) Health(ctx context.Context) (model.HealthStatus, error) {
+    return get[model.HealthStatus](ctx, c, "/api/healthz", nil)
+}
+
+// Bootstrap loads everything the UI needs on first load in one request.
+func (c *Client) Bootstrap(ctx context.Context) (model.Bootstrap, error) {
+    return get[model.Bootstrap](ctx, c, "/api/bootstrap", nil)
+}
+
+// --- Drivers ---
+
+func (c *Client) ListDrivers(ctx context.Context) ([]model.Driver, error) {
+    return get[[]model.Driver](ctx, c, "/api/drivers", nil)
+}
+
+func (c *Client) GetDriver(ctx context.Context, id int) (model.Driver, error) {
+    return get[model.Driver](ctx, c, path("/drivers/%d", id), nil)
+}
+
+// CreateDriver adds d; ProfilePic may be a base64 data URL.
+func (c *Client) CreateDriver(ctx context.Context, d model.Driver) (model.Driver, error) {
+    return write[model.Driver](ctx, c, request{method: http.MethodPost, path: "/api/drivers"}, d)
+}
+
+// UpdateDriver replaces the driver d.DriverID if it is still at d.Version.
+func (c *Client) UpdateDriver(ctx context.Context, d model.Driver) (model.Driver, error) {
+    return write[model.Driver](ctx, c, request{method: http.MethodPut, path: path("/drivers/%d", d.DriverID), ifMatch: ifMatch(d.Version), conditional: true}, d)
+}
+
+// PatchDriver changes only the fields in p, if the driver is still at version.
+func (c *Client) PatchDriver(ctx context.Context, id, version int, p Patch) (model.Driver, error) {
+    return write[model.Driver](ctx, c, versionedPatch(path("/drivers/%d", id), version), p)
+}
+
+func (c *Client) DeleteDriver(ctx context.Context, id, version int) error {
+    return c.call(ctx, request{method: http.MethodDelete, path: path("/drivers/%d", id), ifMatch: ifMatch(version), conditional: true}, nil, nil)
+}
+
+func (c *Client) DriverStats(ctx context.Context, id int) (model.DriverStats, error) {
+    return get[model.DriverStats](ctx, c, path("/drivers/%d/stats", id), nil)
+}
+
+// AssignTruck puts the driver in truckID, or takes them out of their truck when nil.
+func (c *Client) AssignTruck(ctx context.Context, driverID int, truckID *int) (model.AssignTruckResult, error) {
+    r := request{method: http.MethodPost, path: path("/drivers/%d/assign-truck", driverID)}
+    return write[model.AssignTruckResult](ctx, c, r, model.AssignTruckRequest{TruckID: truckID})
+}
+
+// DriverStatement is the printable PDF statement for period ("YYYY-MM" or "YYYY-Qn";
+// "" for the current month).
+func (c *Client) DriverStatement(ctx context.Context, id int, period string) (File, error) {
+    return c.download(ctx, request{method: http.MethodGet, path: path("/drivers/%d/statement.pdf", id), query: query("period", period)})
+}
+
+// StatementsZip holds the statements of every active driver for period.
+func (c *Client) StatementsZip(ctx context.Context, period string) (File, error) {
+    return c.download(ctx, request{method: http.MethodGet, path: "/api/statements.zip", query: query("period", period)})
+}
+
+// --- Driver photos ---
+
+// DriverPhoto downloads the photo, or its 256px thumbnail.
+func (c *Client) DriverPhoto(ctx context.Context, id int, thumb bool) (File, error) {
+    r := request{method: http.MethodGet, path: path("/drivers/%d/photo", id)}
+    if thumb {
+        r.query = query("size", "thumb")
+    }
+    return c.download(ctx, r)
+}
+
+// PutDriverPhoto uploads a JPEG, PNG or WebP, if the driver is still at version; the
+// server detects the type from the data.
+func (c *Client) PutDriverPhoto(ctx context.Context, id, version int, image []byte) (model.PhotoResult, error) {
+    var out model.PhotoResult
+    r := request{method: http.MethodPut, path: path("/drivers/%d/photo", id), body: image, contentType: http.DetectContentType(image),
+        ifMatch: ifMatch(version), conditional: true}
+    err := c.call(ctx, r, nil, &out)
+    return out, err
+}
+
+func (c *Client) DeleteDriverPhoto(ctx context.Context, id, version int) error {
+    return c.call(ctx, request{method: http.MethodDelete, path: path("/drivers/%d/photo", id), ifMatch: ifMatch(version), conditional: true}, nil, nil)
+}
+
+// --- Driver credentials ---
+
+func (c *Client) ListCredentials(ctx context.Context, driverID int) ([]model.DriverCredential, error) {
+    return get[[]model.DriverCredential](ctx, c, path("/drivers/%d/credentials", driverID), nil)
+}
+
+func (c *Client) CreateCredential(ctx context.Context, driverID int, cr model.DriverCredential) (model.DriverCredential, error) {
+    return write[model.DriverCredential](ctx, c, request{method: http.MethodPost, path: path("/drivers/%d/credentials", driverID)}, cr)
+}
+
+func (c *Client) UpdateCredential(ctx context.Context, cr model.DriverCredential) (model.DriverCredential, error) {
+    return write[model.DriverCredential](ctx, c, request{method: http.MethodPut, path: path("/credentials/%d", cr.CredentialID)}, cr)
+}
+
+func (c *Client) DeleteCredential(ctx context.Context, id int) error {
+    return c.call(ctx, request{method: http.MethodDelete, path: path("/credentials/%d", id)}, nil, nil)
+}
+
+// CredentialFile downloads the scanned document of a credential.
+func (c *Client) CredentialFile(ctx context.Context, id int) (File, error) {
+    return c.download(ctx, request{method: http.MethodGet, path: path("/credentials/%d/file", id)})
+}
+
+// UploadCredentialFile stores f as the credential's scanned document (PDF or image).
+func (c *Client) UploadCredentialFile(ctx context.Context, id int, f File) (model.CredentialFileResult, error) {
+    r, err := multipartRequest(http.MethodPut, path("/credentials/%d/file", id), nil, f)
+    if err != nil {
+        return model.CredentialFileResult{}, err
+    }
+    return write[model.CredentialFileResult](ctx, c, r, nil)
+}
+
+// ExpiringCredentials lists credentials expiring within days (0 = the server's
+// default of 30), expired ones included.
+func (c *Client) ExpiringCredentials(ctx context.Context, days int) ([]model.ExpiringCredential, error) {
+    return get[[]model.ExpiringCredential](ctx, c, "/api/compliance/expiring", query("days", itoa(days)))
+}
+
+// --- Driver types ---
+
+func (c *Client) ListDriverTypes(ctx context.Context) ([]model.DriverType, error) {
+    return get[[]model.DriverType](ctx, c, "/api/driver-types", nil)
+}
+
+func (c *Client) CreateDriverType(ctx context.Context, t model.DriverType) (model.DriverType, error) {
+    return write[model.DriverType](ctx, c, request{method: http.MethodPost, path: "/api/driver-types"}, t)
+}
+
+func (c *Client) UpdateDriverType(ctx context.Context, t model.DriverType) (model.DriverType, error) {
+    return write[model.DriverType](ctx, c, request{method: http.MethodPut, path: path("/driver-types/%d", t.DriverTypeID)}, t)
+}
+
+func (c *Client) PatchDriverType(ctx context.Context, id int, p Patch) (model.DriverType, error) {
+    return write[model.DriverType](ctx, c, patchRequest(path("/driver-types/%d", id), ""), p)
+}
+
+func (c *Client) DeleteDriverType(ctx context.Context, id int) error {
+    return c.call(ctx, request{method: http.MethodDelete, path: path("/driver-types/%d", id)}, nil, nil)
+}
+
+// multipartRequest builds a form with each file as a "file" part plus the given fields.
+func multipartRequest(method, path string, fields map[string]string, files ...File) (request, error) {
+    var buf bytes.Buffer
+    w := multipart.NewWriter(&buf)
+    for k, v := range fields {
+        if err := w.WriteField(k, v); err != nil {
+            return request{}, err
+        }
+    }
+    for _, f := range files {
+        h := textproto.MIMEHeader{}
+        h.Set("Content-Disposition", `form-data; name="file"; filename=`+strconv.Quote(f.Name))
+        ct := f.ContentType
+        if ct == "" {
+            ct = http.DetectContentType(f.Data)
+        }
+        h.Set("Content-Type", ct)
+        part, err := w.CreatePart(h)
+        if err != nil {
+            return request{}, err
+        }
+        if _, err := part.Write(f.Data); err != nil {
+            return request{}, err
+        }
+    }
+    if err := w.Close(); err != nil {
+        return request{}, err
+    }
+    return request{method: method, path: path, body: buf.Bytes(), contentType: w.FormDataContentType()}, nil
+}
@@ -0,0 +1,211 @@
+package client
+
+import (
+    "context"
+    "net/http"
+    "net/url"
+
+    "driver-safety-bonus/model"
+)
+
+// EventFilter narrows safety and scorecard event lists; zero fields are ignored.
+type EventFilter struct {
+    DateRange
+    DriverID int
+}
+
+func (f EventFilter) values() url.Values {
+    q := f.DateRange.values()
+    if f.DriverID != 0 {
+        q.Set("driverId", itoa(f.DriverID))
+    }
+    return q
+}
+
+// --- Safety categories ---
+
+func (c *Client) ListSafetyCategories(ctx context.Context) ([]model.SafetyCategory, error) {
+    return get[[]model.SafetyCategory](ctx, c, "/api/safety-categories", nil)
+}
+
+func (c *Client) CreateSafetyCategory(ctx context.Context, sc model.SafetyCategory) (model.SafetyCategory, error) {
+    return write[model.SafetyCategory](ctx, c, request{method: http.MethodPost, path: "/api/safety-categories"}, sc)
+}
+
+func (c *Client) UpdateSafetyCategory(ctx context.Context, sc model.SafetyCategory) (model.SafetyCategory, error) {
+    return write[model.SafetyCategory](ctx, c, request{method: http.MethodPut, path: path("/safety-categories/%d", sc.CategoryID)}, sc)
+}
+
+func (c *Client) PatchSafetyCategory(ctx context.Context, id int, p Patch) (model.SafetyCategory, error) {
+    return write[model.SafetyCategory](ctx, c, patchRequest(path("/safety-categories/%d", id), ""), p)
+}
+
+func (c *Client) DeleteSafetyCategory(ctx context.Context, id int) error {
+    return c.call(ctx, request{method: http.MethodDelete, path: path("/safety-categories/%d", id)}, nil, nil)
+}
+
+// --- Scorecard metrics ---
+
+func (c *Client) ListScorecardMetrics(ctx context.Context) ([]model.ScoreCardItem, error) {
+    return get[[]model.ScoreCardItem](ctx, c, "/api/scorecard-metrics", nil)
+}
+
+func (c *Client) CreateScorecardMetric(ctx context.Context, m model.ScoreCardItem) (model.ScoreCardItem, error) {
+    return write[model.ScoreCardItem](ctx, c, request{method: http.MethodPost, path: "/api/scorecard-metrics"}, m)
+}
+
+func (c *Client) UpdateScorecardMetric(ctx context.Context, m model.ScoreCardItem) (model.ScoreCardItem, error) {
+    return write[model.ScoreCardItem](ctx, c, request{method: http.MethodPut, path: path("/scorecard-metrics/%d", m.ScCategoryID)}, m)
+}
+
+func (c *Client) PatchScorecardMetric(ctx context.Context, id int, p Patch) (model.ScoreCardItem, error) {
+    return write[model.ScoreCardItem](ctx, c, patchRequest(path("/scorecard-metrics/%d", id), ""), p)
+}
+
+func (c *Client) DeleteScorecardMetric(ctx context.Context, id int) error {
+    return c.call(ctx, request{method: http.MethodDelete, path: path("/scorecard-metrics/%d", id)}, nil, nil)
+}
+
+// --- Safety events ---
+
+func (c *Client) ListSafetyEvents(ctx context.Context, f EventFilter) ([]model.SafetyEvent, error) {
+    return get[[]model.SafetyEvent](ctx, c, "/api/safety-events", f.values())
+}
+
+func (c *Client) ExportSafetyEvents(ctx context.Context, f EventFilter, format ExportFormat) (File, error) {
+    return c.export(ctx, "/api/safety-events", f.values(), format)
+}
+
+func (c *Client) GetSafetyEvent(ctx context.Context, id int) (model.SafetyEvent, error) {
+    return get[model.SafetyEvent](ctx, c, path("/safety-events/%d", id), nil)
+}
+
+func (c *Client) CreateSafetyEvent(ctx context.Context, e model.SafetyEvent) (model.SafetyEvent, error) {
+    return write[model.SafetyEvent](ctx, c, request{method: http.MethodPost, path: "/api/safety-events"}, e)
+}
+
+// UpdateSafetyEvent replaces the event e.SafetyEventID if it is still at e.Version.
+func (c *Client) UpdateSafetyEvent(ctx context.Context, e model.SafetyEvent) (model.SafetyEvent, error) {
+    r := request{method: http.MethodPut, path: path("/safety-events/%d", e.SafetyEventID), ifMatch: ifMatch(e.Version), conditional: true}
+    return write[model.SafetyEvent](ctx, c, r, e)
+}
+
+func (c *Client) PatchSafetyEvent(ctx context.Context, id, version int, p Patch) (model.SafetyEvent, error) {
+    return write[model.SafetyEvent](ctx, c, versionedPatch(path("/safety-events/%d", id), version), p)
+}
+
+func (c *Client) DeleteSafetyEvent(ctx context.Context, id, version int) error {
+    return c.call(ctx, request{method: http.MethodDelete, path: path("/safety-events/%d", id), ifMatch: ifMatch(version), conditional: true}, nil, nil)
+}
+
+func (c *Client) SafetyEventAttachments(ctx context.Context, id int) ([]model.Attachment, error) {
+    return get[[]model.Attachment](ctx, c, path("/safety-events/%d/attachments", id), nil)
+}
+
+// AttachSafetyEventFiles uploads evidence files; description applies to each.
+func (c *Client) AttachSafetyEventFiles(ctx context.Context, id int, description string, files ...File) ([]model.Attachment, error) {
+    return c.attachFiles(ctx, path("/safety-events/%d/attachments", id), description, files)
+}
+
+// LinkSafetyEventAttachment attaches a URL, e.g. a dashcam clip.
+func (c *Client) LinkSafetyEventAttachment(ctx context.Context, id int, link model.LinkAttachmentRequest) ([]model.Attachment, error) {
+    return write[[]model.Attachment](ctx, c, request{method: http.MethodPost, path: path("/safety-events/%d/attachments", id)}, link)
+}
+
+func (c *Client) SafetyEventDisputes(ctx context.Context, id int) ([]model.SafetyEventDispute, error) {
+    return get[[]model.SafetyEventDispute](ctx, c, path("/safety-events/%d/disputes", id), nil)
+}
+
+// OpenDispute disputes a safety event; 409 if it already has an open dispute.
+func (c *Client) OpenDispute(ctx context.Context, safetyEventID int, req model.OpenDisputeRequest) (model.SafetyEventDispute, error) {
+    return write[model.SafetyEventDispute](ctx, c, request{method: http.MethodPost, path: path("/safety-events/%d/disputes", safetyEventID)}, req)
+}
+
+// --- Disputes ---
+
+// ListDisputes filters by status and driver; zero values list all.
+func (c *Client) ListDisputes(ctx context.Context, status string, driverID int) ([]model.SafetyEventDispute, error) {
+    return get[[]model.SafetyEventDispute](ctx, c, "/api/disputes", query("status", status, "driverId", itoa(driverID)))
+}
+
+func (c *Client) GetDispute(ctx context.Context, id int) (model.SafetyEventDispute, error) {
+    return get[model.SafetyEventDispute](ctx, c, path("/disputes/%d", id), nil)
+}
+
+func (c *Client) TransitionDispute(ctx context.Context, id int, req model.DisputeTransitionRequest) (model.SafetyEventDispute, error) {
+    return write[model.SafetyEventDispute](ctx, c, request{method: http.MethodPost, path: path("/disputes/%d/transition", id)}, req)
+}
+
+// --- Scorecard events ---
+
+func (c *Client) ListScoreCardEvents(ctx context.Context, f EventFilter) ([]model.ScoreCardEvent, error) {
+    return get[[]model.ScoreCardEvent](ctx, c, "/api/scorecard-events", f.values())
+}
+
+func (c *Client) ExportScoreCardEvents(ctx context.Context, f EventFilter, format ExportFormat) (File, error) {
+    return c.export(ctx, "/api/scorecard-events", f.values(), format)
+}
+
+func (c *Client) GetScoreCardEvent(ctx context.Context, id int) (model.ScoreCardEvent, error) {
+    return get[model.ScoreCardEvent](ctx, c, path("/scorecard-events/%d", id), nil)
+}
+
+func (c *Client) CreateScoreCardEvent(ctx context.Context, e model.ScoreCardEvent) (model.ScoreCardEvent, error) {
+    return write[model.ScoreCardEvent](ctx, c, request{method: http.MethodPost, path: "/api/scorecard-events"}, e)
+}
+
+func (c *Client) UpdateScoreCardEvent(ctx context.Context, e model.ScoreCardEvent) (model.ScoreCardEvent, error) {
+    r := request{method: http.MethodPut, path: path("/scorecard-events/%d", e.ScorecardEventID), ifMatch: ifMatch(e.Version), conditional: true}
+    return write[model.ScoreCardEvent](ctx, c, r, e)
+}
+
+func (c *Client) PatchScoreCardEvent(ctx context.Context, id, version int, p Patch) (model.ScoreCardEvent, error) {
+    return write[model.ScoreCardEvent](ctx, c, versionedPatch(path("/scorecard-events/%d", id), version), p)
+}
+
+func (c *Client) DeleteScoreCardEvent(ctx context.Context, id, version int) error {
+    return c.call(ctx, request{method: http.MethodDelete, path: path("/scorecard-events/%d", id), ifMatch: ifMatch(version), conditional: true}, nil, nil)
+}
+
+// DeleteScoreCardEvents removes a driver's scorecard events in one category for a
+// day, month or year (datePrefix YYYY-MM-DD, YYYY-MM or YYYY).
+func (c *Client) DeleteScoreCardEvents(ctx context.Context, driverID int, datePrefix, category string) error {
+    q := query("driverId", itoa(driverID), "datePrefix", datePrefix, "category", category)
+    return c.call(ctx, request{method: http.MethodDelete, path: "/api/scorecard-events", query: q}, nil, nil)
+}
+
+func (c *Client) ScoreCardEventAttachments(ctx context.Context, id int) ([]model.Attachment, error) {
+    return get[[]model.Attachment](ctx, c, path("/scorecard-events/%d/attachments", id), nil)
+}
+
+func (c *Client) AttachScoreCardEventFiles(ctx context.Context, id int, description string, files ...File) ([]model.Attachment, error) {
+    return c.attachFiles(ctx, path("/scorecard-events/%d/attachments", id), description, files)
+}
+
+func (c *Client) LinkScoreCardEventAttachment(ctx context.Context, id int, link model.LinkAttachmentRequest) ([]model.Attachment, error) {
+    return write[[]model.Attachment](ctx, c, request{method: http.MethodPost, path: path("/scorecard-events/%d/attachments", id)}, link)
+}
+
+// --- Attachments ---
+
+// DownloadAttachment fetches an attached file. Link attachments redirect, so the
+// result is whatever the linked URL serves.
+func (c *Client) DownloadAttachment(ctx context.Context, id int) (File, error) {
+    return c.download(ctx, request{method: http.MethodGet, path: path("/attachments/%d/download", id)})
+}
+
+func (c *Client) DeleteAttachment(ctx context.Context, id int) error {
+    return c.call(ctx, request{method: http.MethodDelete, path: path("/attachments/%d", id)}, nil, nil)
+}
+
+func (c *Client) attachFiles(ctx context.Context, p, description string, files []File) ([]model.Attachment, error) {
+    var fields map[string]string
+    if description != "" {
+        fields = map[string]string{"description": description}
+    }
+    r, err := multipartRequest(http.MethodPost, p, fields, files...)
+    if err != nil {
+        return nil, err
+    }
+    return write[[]model.Attachment](ctx, c, r, nil)
+}
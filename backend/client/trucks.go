@@ -0,0 +1,88 @@
+package client
+
+import (
+    "context"
+    "net/http"
+    "net/url"
+
+    "driver-safety-bonus/model"
+)
+
+// DateRange limits a list or report to days From..To (YYYY-MM-DD, inclusive);
+// empty ends are left to the server's defaults.
+type DateRange struct {
+    From string
+    To   string
+}
+
+func (r DateRange) values() url.Values {
+    return query("from", r.From, "to", r.To)
+}
+
+// ExportFormat picks a spreadsheet download for the exportable lists.
+type ExportFormat string
+
+const (
+    CSV  ExportFormat = "csv"
+    XLSX ExportFormat = "xlsx"
+)
+
+func (c *Client) export(ctx context.Context, p string, q url.Values, format ExportFormat) (File, error) {
+    if q == nil {
+        q = url.Values{}
+    }
+    q.Set("format", string(format))
+    return c.download(ctx, request{method: http.MethodGet, path: p, query: q})
+}
+
+// ExportDrivers downloads the driver list as a spreadsheet.
+func (c *Client) ExportDrivers(ctx context.Context, format ExportFormat) (File, error) {
+    return c.export(ctx, "/api/drivers", nil, format)
+}
+
+// --- Trucks ---
+
+func (c *Client) ListTrucks(ctx context.Context) ([]model.Truck, error) {
+    return get[[]model.Truck](ctx, c, "/api/trucks", nil)
+}
+
+func (c *Client) ExportTrucks(ctx context.Context, format ExportFormat) (File, error) {
+    return c.export(ctx, "/api/trucks", nil, format)
+}
+
+func (c *Client) GetTruck(ctx context.Context, id int) (model.Truck, error) {
+    return get[model.Truck](ctx, c, path("/trucks/%d", id), nil)
+}
+
+func (c *Client) CreateTruck(ctx context.Context, t model.Truck) (model.Truck, error) {
+    return write[model.Truck](ctx, c, request{method: http.MethodPost, path: "/api/trucks"}, t)
+}
+
+// UpdateTruck replaces the truck t.TruckID if it is still at t.Version.
+func (c *Client) UpdateTruck(ctx context.Context, t model.Truck) (model.Truck, error) {
+    return write[model.Truck](ctx, c, request{method: http.MethodPut, path: path("/trucks/%d", t.TruckID), ifMatch: ifMatch(t.Version), conditional: true}, t)
+}
+
+func (c *Client) PatchTruck(ctx context.Context, id, version int, p Patch) (model.Truck, error) {
+    return write[model.Truck](ctx, c, versionedPatch(path("/trucks/%d", id), version), p)
+}
+
+// DeleteTruck removes the truck and unassigns its driver.
+func (c *Client) DeleteTruck(ctx context.Context, id, version int) error {
+    return c.call(ctx, request{method: http.MethodDelete, path: path("/trucks/%d", id), ifMatch: ifMatch(version), conditional: true}, nil, nil)
+}
+
+// TruckHistory lists assignments and status changes of a truck.
+func (c *Client) TruckHistory(ctx context.Context, id int, r DateRange) ([]model.TruckHistoryEvent, error) {
+    return get[[]model.TruckHistoryEvent](ctx, c, path("/trucks/%d/history", id), r.values())
+}
+
+func (c *Client) ExportTruckHistory(ctx context.Context, id int, r DateRange, format ExportFormat) (File, error) {
+    return c.export(ctx, path("/trucks/%d/history", id), r.values(), format)
+}
+
+// AssignDriver puts driverID in the truck, or empties the truck when nil.
+func (c *Client) AssignDriver(ctx context.Context, truckID int, driverID *int) (model.AssignDriverResult, error) {
+    r := request{method: http.MethodPost, path: path("/trucks/%d/assign-driver", truckID)}
+    return write[model.AssignDriverResult](ctx, c, r, model.AssignDriverRequest{DriverID: driverID})
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "driver-safety-bonus/client"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/gin-gonic/gin"
+)
+
+// testAPI serves the real router over HTTP with a mocked database and returns a
+// client for it plus a count of requests the server received.
+func testAPI(t *testing.T, opts ...client.Option) (*client.Client, sqlmock.Sqlmock, *atomic.Int32) {
+    t.Helper()
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+
+    var hits atomic.Int32
+    router := newRouter()
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        hits.Add(1)
+        router.ServeHTTP(w, r)
+    }))
+    t.Cleanup(srv.Close)
+    opts = append([]client.Option{client.WithRetries(2, time.Millisecond)}, opts...)
+    return client.New(srv.URL, opts...), mock, &hits
+}
+
+var truckCols = []string{"truck_id", "unit_number", "year", "status", "version"}
+
+func TestClientGetTruck(t *testing.T) {
+    api, mock, _ := testAPI(t)
+    mock.ExpectQuery(`SELECT .+ FROM trucks WHERE truck_id=\?`).WithArgs(7).
+        WillReturnRows(sqlmock.NewRows(truckCols).AddRow(7, "T-07", 2021, "available", 3))
+
+    tr, err := api.GetTruck(context.Background(), 7)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if tr.TruckID != 7 || tr.UnitNumber != "T-07" || tr.Version != 3 {
+        t.Errorf("GetTruck = %+v", tr)
+    }
+}
+
+func TestClientNotFound(t *testing.T) {
+    api, mock, hits := testAPI(t)
+    mock.ExpectQuery(`SELECT .+ FROM trucks WHERE truck_id=\?`).WithArgs(99).
+        WillReturnRows(sqlmock.NewRows(truckCols))
+
+    _, err := api.GetTruck(context.Background(), 99)
+    var apiErr *client.Error
+    if !client.IsNotFound(err) || !errors.As(err, &apiErr) || apiErr.Message != "truck not found" {
+        t.Fatalf("err = %v, want a 404 *client.Error", err)
+    }
+    if apiErr.RequestID == "" {
+        t.Error("404 has no request id")
+    }
+    if n := hits.Load(); n != 1 {
+        t.Errorf("a 404 was sent %d times", n)
+    }
+}
+
+func TestClientStaleUpdate(t *testing.T) {
+    api, mock, _ := testAPI(t)
+    mock.ExpectBegin()
+    mock.ExpectExec(`UPDATE trucks SET`).WithArgs("T-07", 2021, "maintenance", 7, 3, 3).
+        WillReturnResult(sqlmock.NewResult(0, 0))
+    mock.ExpectQuery(`SELECT .+ FROM trucks WHERE truck_id=\?`).WithArgs(7).
+        WillReturnRows(sqlmock.NewRows(truckCols).AddRow(7, "T-07", 2021, "assigned", 4))
+    mock.ExpectRollback()
+
+    _, err := api.UpdateTruck(context.Background(), Truck{TruckID: 7, UnitNumber: "T-07", Year: 2021, Status: "maintenance", Version: 3})
+    if !client.IsPreconditionFailed(err) {
+        t.Fatalf("err = %v, want 412", err)
+    }
+    var current Truck
+    if err := err.(*client.Error).CurrentAs(&current); err != nil || current.Version != 4 || current.Status != "assigned" {
+        t.Errorf("current = %+v (%v)", current, err)
+    }
+}
+
+// A write without a known version is refused before it is sent; overwriting
+// whatever is stored has to be asked for with AnyVersion.
+func TestClientVersionRequired(t *testing.T) {
+    api, mock, hits := testAPI(t)
+    if err := api.DeleteTruck(context.Background(), 7, 0); !errors.Is(err, client.ErrNoVersion) {
+        t.Errorf("DeleteTruck without a version: %v", err)
+    }
+    if _, err := api.UpdateTruck(context.Background(), Truck{TruckID: 7, UnitNumber: "T-07"}); !errors.Is(err, client.ErrNoVersion) {
+        t.Errorf("UpdateTruck without a version: %v", err)
+    }
+    if n := hits.Load(); n != 0 {
+        t.Errorf("%d requests sent", n)
+    }
+
+    mock.ExpectBegin()
+    mock.ExpectExec(`UPDATE trucks SET`).WithArgs("T-07", 2021, "available", 7, 0, 0).
+        WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectQuery(`SELECT version FROM trucks`).WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(5))
+    mock.ExpectQuery(`FROM webhook_subscriptions`).WillReturnRows(sqlmock.NewRows([]string{"subscription_id", "event_types"}))
+    mock.ExpectExec(`INSERT INTO change_events`).WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectCommit()
+    tr, err := api.UpdateTruck(context.Background(), Truck{TruckID: 7, UnitNumber: "T-07", Year: 2021, Status: "available", Version: client.AnyVersion})
+    if err != nil || tr.Version != 5 {
+        t.Errorf("UpdateTruck with AnyVersion = %+v, %v", tr, err)
+    }
+}
+
+func TestClientPatchWithoutChanges(t *testing.T) {
+    api, mock, _ := testAPI(t)
+    mock.ExpectQuery(`SELECT .+ FROM trucks WHERE truck_id=\?`).WithArgs(7).
+        WillReturnRows(sqlmock.NewRows(truckCols).AddRow(7, "T-07", 2021, "available", 3))
+
+    tr, err := api.PatchTruck(context.Background(), 7, 3, client.Patch{"status": "available"})
+    if err != nil || tr.Version != 3 {
+        t.Fatalf("PatchTruck = %+v, %v", tr, err)
+    }
+}
+
+func TestClientRetriesServerErrors(t *testing.T) {
+    api, mock, hits := testAPI(t)
+    mock.ExpectQuery(`SELECT .+ FROM trucks`).WillReturnError(errors.New("connection reset"))
+    mock.ExpectQuery(`SELECT .+ FROM trucks`).
+        WillReturnRows(sqlmock.NewRows(truckCols).AddRow(1, "T-01", 2020, "available", 1))
+
+    trucks, err := api.ListTrucks(context.Background())
+    if err != nil || len(trucks) != 1 {
+        t.Fatalf("ListTrucks = %v, %v", trucks, err)
+    }
+    if n := hits.Load(); n != 2 {
+        t.Errorf("requests = %d, want 2", n)
+    }
+}
+
+func TestClientRetriesTimeouts(t *testing.T) {
+    api, mock, hits := testAPI(t, client.WithTimeout(100*time.Millisecond))
+    mock.ExpectQuery(`SELECT .+ FROM trucks`).WillDelayFor(time.Second).
+        WillReturnRows(sqlmock.NewRows(truckCols))
+    mock.ExpectQuery(`SELECT .+ FROM trucks`).
+        WillReturnRows(sqlmock.NewRows(truckCols).AddRow(1, "T-01", 2020, "available", 1))
+
+    trucks, err := api.ListTrucks(context.Background())
+    if err != nil || len(trucks) != 1 {
+        t.Fatalf("ListTrucks = %v, %v", trucks, err)
+    }
+    if n := hits.Load(); n != 2 {
+        t.Errorf("requests = %d, want 2", n)
+    }
+}
+
+func TestClientDoesNotRetryPost(t *testing.T) {
+    api, mock, hits := testAPI(t)
+    mock.ExpectBegin()
+    mock.ExpectExec(`INSERT INTO trucks`).WillReturnError(errors.New("connection reset"))
+    mock.ExpectRollback()
+
+    _, err := api.CreateTruck(context.Background(), Truck{UnitNumber: "T-09", Year: 2024, Status: "available"})
+    if client.StatusCode(err) != http.StatusInternalServerError {
+        t.Fatalf("err = %v, want 500", err)
+    }
+    if n := hits.Load(); n != 1 {
+        t.Errorf("POST sent %d times", n)
+    }
+}
+
+func TestClientOutboxPages(t *testing.T) {
+    api, mock, _ := testAPI(t)
+    cols := []string{"outbox_id", "user_id", "recipient", "event_type", "subject", "body", "status", "attempts", "next_attempt_at", "last_error", "created_at", "sent_at"}
+    now := time.Now()
+    row := func(rows *sqlmock.Rows, id int64) *sqlmock.Rows {
+        return rows.AddRow(id, nil, "ops@example.com", "safety_event", "Subject", "Body", "sent", 1, now, nil, now, now)
+    }
+    mock.ExpectQuery(`FROM notification_outbox ORDER BY outbox_id DESC LIMIT \?`).WithArgs(2).
+        WillReturnRows(row(row(sqlmock.NewRows(cols), 5), 4))
+    mock.ExpectQuery(`FROM notification_outbox WHERE outbox_id < \? ORDER BY`).WithArgs(4, 2).
+        WillReturnRows(row(sqlmock.NewRows(cols), 3))
+
+    var ids []int64
+    for m, err := range api.Outbox(context.Background(), client.OutboxQuery{PageSize: 2}) {
+        if err != nil {
+            t.Fatal(err)
+        }
+        ids = append(ids, m.OutboxID)
+    }
+    if len(ids) != 3 || ids[0] != 5 || ids[2] != 3 {
+        t.Errorf("ids = %v, want [5 4 3]", ids)
+    }
+}
+
+func TestClientConfigRedacted(t *testing.T) {
+    api, _, _ := testAPI(t)
+    prev := conf
+    defer func() { conf = prev }()
+    conf.Database.DSN = "app:hunter2@tcp(mysql:3306)/driver_safety"
+    conf.Mail.Password = "smtp-secret"
+
+    got, err := api.Config(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got.Database.DSN != "app:[redacted]@tcp(mysql:3306)/driver_safety" || got.Mail.Password != "[redacted]" {
+        t.Errorf("secrets not redacted: %q, %q", got.Database.DSN, got.Mail.Password)
+    }
+    if got.Server.ShutdownTimeout != conf.Server.ShutdownTimeout || got.Timezone != conf.Timezone {
+        t.Errorf("Config = %+v", got)
+    }
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "math"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-sql-driver/mysql"
+)
+
+const (
+    maxCredentialFileBytes = 10 << 20 // 10 MiB per scanned document
+)
+
+var credentialTypes = map[string]bool{
+    "license":     true,
+    "medical":     true,
+    "hazmat_tdg":  true,
+    "border_card": true,
+    "other":       true,
+}
+
+const credentialColumns = `credential_id, driver_id, credential_type, number, jurisdiction, issue_date, expiry_date, blocks_bonus, file_name, file_content_type`
+
+func scanCredential(row rowScanner, dc *DriverCredential, extra ...any) error {
+    var (
+        issueNullable  sql.NullTime
+        expiryNullable sql.NullTime
+        nameNullable   sql.NullString
+        typeNullable   sql.NullString
+    )
+    dest := []any{&dc.CredentialID, &dc.DriverID, &dc.CredentialType, &dc.Number, &dc.Jurisdiction, &issueNullable, &expiryNullable, &dc.BlocksBonus, &nameNullable, &typeNullable}
+    if err := row.Scan(append(dest, extra...)...); err != nil {
+        return err
+    }
+    if issueNullable.Valid {
+        dc.IssueDate = formatLocalDate(issueNullable.Time)
+    }
+    if expiryNullable.Valid {
+        dc.ExpiryDate = formatLocalDate(expiryNullable.Time)
+    }
+    if nameNullable.Valid {
+        val := nameNullable.String
+        dc.FileName = &val
+    }
+    if typeNullable.Valid {
+        val := typeNullable.String
+        dc.FileContentType = &val
+    }
+    return nil
+}
+
+// validateCredential normalizes the optional dates and checks the type enum.
+func validateCredential(dc *DriverCredential) (issue, expiry sql.NullString, msg string) {
+    if !credentialTypes[dc.CredentialType] {
+        return issue, expiry, "credential_type must be one of license, medical, hazmat_tdg, border_card, other"
+    }
+    if strings.TrimSpace(dc.IssueDate) != "" {
+        t, err := parseLocalDate(dc.IssueDate)
+        if err != nil {
+            return issue, expiry, "invalid issue_date"
+        }
+        issue = sql.NullString{String: formatLocalDate(t), Valid: true}
+    }
+    if strings.TrimSpace(dc.ExpiryDate) != "" {
+        t, err := parseLocalDate(dc.ExpiryDate)
+        if err != nil {
+            return issue, expiry, "invalid expiry_date"
+        }
+        expiry = sql.NullString{String: formatLocalDate(t), Valid: true}
+    }
+    if issue.Valid && expiry.Valid && expiry.String < issue.String {
+        return issue, expiry, "expiry_date must not be before issue_date"
+    }
+    return issue, expiry, ""
+}
+
+// countExpiredCredentials returns how many of the driver's credentials are past
+// their expiry date, and how many of those block bonus eligibility.
+func countExpiredCredentials(ctx context.Context, driverID any) (expired, blocking int, err error) {
+    today := formatLocalDate(time.Now())
+    err = queryRow(ctx, `
+        SELECT COUNT(*), COALESCE(SUM(blocks_bonus),0)
+        FROM driver_credentials
+        WHERE driver_id=? AND expiry_date IS NOT NULL AND expiry_date < ?`, driverID, today).Scan(&expired, &blocking)
+    return expired, blocking, err
+}
+
+// --- Driver credentials ---
+
+func getDriverCredentials(c *gin.Context) {
+    driverID := c.Param("id")
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    rows, err := queryRows(ctx, `SELECT `+credentialColumns+` FROM driver_credentials WHERE driver_id=? ORDER BY expiry_date`, driverID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    var creds []DriverCredential
+    for rows.Next() {
+        var dc DriverCredential
+        if err := scanCredential(rows, &dc); err != nil {
+            continue
+        }
+        creds = append(creds, dc)
+    }
+    c.JSON(http.StatusOK, creds)
+}
+
+func createDriverCredential(c *gin.Context) {
+    driverID := atoi(c.Param("id"))
+    var dc DriverCredential
+    if err := c.ShouldBindJSON(&dc); err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    issue, expiry, msg := validateCredential(&dc)
+    if msg != "" {
+        c.JSON(http.StatusBadRequest, APIError{Message: msg})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    res, err := exec(ctx, `
+        INSERT INTO driver_credentials (driver_id, credential_type, number, jurisdiction, issue_date, expiry_date, blocks_bonus)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`,
+        driverID, dc.CredentialType, dc.Number, dc.Jurisdiction, issue, expiry, dc.BlocksBonus)
+    var me *mysql.MySQLError
+    if errors.As(err, &me) && me.Number == 1452 { // foreign key: no such driver
+        c.JSON(http.StatusNotFound, APIError{Message: "driver not found"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    id, _ := res.LastInsertId()
+    dc.CredentialID = int(id)
+    dc.DriverID = driverID
+    dc.FileName, dc.FileContentType = nil, nil
+    c.JSON(http.StatusOK, dc)
+}
+
+func updateDriverCredential(c *gin.Context) {
+    id := atoi(c.Param("id"))
+    var dc DriverCredential
+    if err := c.ShouldBindJSON(&dc); err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    issue, expiry, msg := validateCredential(&dc)
+    if msg != "" {
+        c.JSON(http.StatusBadRequest, APIError{Message: msg})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    _, err := exec(ctx, `
+        UPDATE driver_credentials
+        SET expiry_flagged_at=IF(expiry_date <=> ?, expiry_flagged_at, NULL),
+            credential_type=?, number=?, jurisdiction=?, issue_date=?, expiry_date=?, blocks_bonus=?
+        WHERE credential_id=?`,
+        expiry, dc.CredentialType, dc.Number, dc.Jurisdiction, issue, expiry, dc.BlocksBonus, id)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+
+    // Re-read so the response carries the stored driver_id and file metadata
+    row := queryRow(ctx, `SELECT `+credentialColumns+` FROM driver_credentials WHERE credential_id=?`, id)
+    var saved DriverCredential
+    if err := scanCredential(row, &saved); err != nil {
+        if err == sql.ErrNoRows {
+            c.JSON(http.StatusNotFound, APIError{Message: "credential not found"})
+            return
+        }
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, saved)
+}
+
+func deleteDriverCredential(c *gin.Context) {
+    id := c.Param("id")
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    var key sql.NullString
+    err := queryRow(ctx, `SELECT file_key FROM driver_credentials WHERE credential_id=?`, id).Scan(&key)
+    if err == sql.ErrNoRows {
+        c.Status(http.StatusNoContent)
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    if _, err := exec(ctx, `DELETE FROM driver_credentials WHERE credential_id=?`, id); err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    deleteStoredFiles(ctx, key)
+    c.Status(http.StatusNoContent)
+}
+
+// saveCredentialFile stores a scanned document under credentials/<id>/ in the file
+// store and points the credential at it; the previous scan is removed once the
+// change commits. sql.ErrNoRows means there is no such credential.
+func saveCredentialFile(ctx context.Context, id int, name string, data []byte) (string, error) {
+    contentType := http.DetectContentType(data)
+    sum := sha256.Sum256(data)
+    key := fmt.Sprintf("credentials/%d/%s", id, hex.EncodeToString(sum[:])[:16])
+    err := inTx(ctx, func(ctx context.Context) error {
+        var old sql.NullString
+        if err := queryRow(ctx, `SELECT file_key FROM driver_credentials WHERE credential_id=? FOR UPDATE`, id).Scan(&old); err != nil {
+            return err
+        }
+        if err := files.Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+            return err
+        }
+        if _, err := exec(ctx, `UPDATE driver_credentials SET file_name=?, file_content_type=?, file_key=?, file_size=? WHERE credential_id=?`,
+            name, contentType, key, len(data), id); err != nil {
+            return err
+        }
+        if old.Valid && old.String != key {
+            afterCommit(ctx, func() { deleteStoredFiles(ctx, old) })
+        }
+        return nil
+    })
+    return contentType, err
+}
+
+// Upload the scanned document (multipart field "file"); replaces any previous scan.
+func uploadCredentialFile(c *gin.Context) {
+    id := atoi(c.Param("id"))
+    c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCredentialFileBytes+1<<20)
+
+    fh, err := c.FormFile("file")
+    if err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: "multipart field 'file' is required"})
+        return
+    }
+    if fh.Size > maxCredentialFileBytes {
+        c.JSON(http.StatusRequestEntityTooLarge, APIError{Message: "file exceeds " + strconv.Itoa(maxCredentialFileBytes>>20) + " MiB"})
+        return
+    }
+    f, err := fh.Open()
+    if err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    defer f.Close()
+    data, err := io.ReadAll(f)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+    defer cancel()
+
+    contentType, err := saveCredentialFile(ctx, id, fh.Filename, data)
+    if err == sql.ErrNoRows {
+        c.JSON(http.StatusNotFound, APIError{Message: "credential not found"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"file_name": fh.Filename, "file_content_type": contentType, "size": len(data)})
+}
+
+func downloadCredentialFile(c *gin.Context) {
+    id := c.Param("id")
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+    defer cancel()
+
+    var name, contentType, key sql.NullString
+    err := queryRow(ctx, `SELECT file_name, file_content_type, file_key FROM driver_credentials WHERE credential_id=?`, id).Scan(&name, &contentType, &key)
+    if err == sql.ErrNoRows || (err == nil && !key.Valid) {
+        c.JSON(http.StatusNotFound, APIError{Message: "no file on record"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    r, info, err := files.Get(ctx, key.String)
+    if err == ErrFileNotFound {
+        c.JSON(http.StatusNotFound, APIError{Message: "credential file missing from store"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    defer r.Close()
+    c.DataFromReader(http.StatusOK, info.Size, contentType.String, r, map[string]string{
+        "Content-Disposition": `attachment; filename="` + strings.ReplaceAll(name.String, `"`, "") + `"`,
+    })
+}
+
+// migrateLegacyCredentialFiles moves scans stored in the old file_data column into
+// the file store, then drops the column so backups no longer carry the blobs. A
+// scan that fails to move keeps the column for the next start.
+func migrateLegacyCredentialFiles(ctx context.Context) error {
+    var legacy int
+    err := queryRow(ctx, `
+        SELECT COUNT(*) FROM information_schema.columns
+        WHERE table_schema = DATABASE() AND table_name = 'driver_credentials' AND column_name = 'file_data'`).Scan(&legacy)
+    if err != nil || legacy == 0 {
+        return err
+    }
+    rows, err := queryRows(ctx, `SELECT credential_id FROM driver_credentials WHERE file_data IS NOT NULL`)
+    if err != nil {
+        return err
+    }
+    var ids []int
+    for rows.Next() {
+        var id int
+        if err := rows.Scan(&id); err == nil {
+            ids = append(ids, id)
+        }
+    }
+    rows.Close()
+
+    failed := 0
+    for _, id := range ids {
+        err := inTx(ctx, func(ctx context.Context) error {
+            var (
+                name sql.NullString
+                data []byte
+            )
+            if err := queryRow(ctx, `SELECT file_name, file_data FROM driver_credentials WHERE credential_id=?`, id).Scan(&name, &data); err != nil {
+                return err
+            }
+            if _, err := saveCredentialFile(ctx, id, name.String, data); err != nil {
+                return err
+            }
+            _, err := exec(ctx, `UPDATE driver_credentials SET file_data=NULL WHERE credential_id=?`, id)
+            return err
+        })
+        if err != nil {
+            slog.WarnContext(ctx, "credential file migration skipped credential", "credential_id", id, "err", err)
+            failed++
+        }
+    }
+    if len(ids) > 0 {
+        slog.InfoContext(ctx, "migrated credential files to the file store", "migrated", len(ids)-failed, "total", len(ids))
+    }
+    if failed > 0 {
+        return fmt.Errorf("%d credential files left in the database", failed)
+    }
+    _, err = exec(ctx, `ALTER TABLE driver_credentials DROP COLUMN IF EXISTS file_data`)
+    return err
+}
+
+// --- Compliance ---
+
+// GET /compliance/expiring?days=30 lists credentials expiring within the window,
+// including ones that have already expired; days defaults to CREDENTIAL_EXPIRY_DAYS.
+func getExpiringCredentials(c *gin.Context) {
+    days := conf.Thresholds.CredentialExpiryDays
+    if v := c.Query("days"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n < 0 {
+            c.JSON(http.StatusBadRequest, APIError{Message: "days must be a non-negative integer"})
+            return
+        }
+        days = n
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    now := time.Now().In(localTZ)
+    today, _ := parseLocalDate(formatLocalDate(now))
+    cutoff := formatLocalDate(today.AddDate(0, 0, days))
+
+    rows, err := queryRows(ctx, `
+        SELECT dc.credential_id, dc.driver_id, dc.credential_type, dc.number, dc.jurisdiction, dc.issue_date, dc.expiry_date, dc.blocks_bonus, dc.file_name, dc.file_content_type,
+               d.driver_code, d.first_name, d.last_name
+        FROM driver_credentials dc
+        JOIN drivers d ON d.driver_id = dc.driver_id
+        WHERE dc.expiry_date IS NOT NULL AND dc.expiry_date <= ?
+        ORDER BY dc.expiry_date, d.last_name, d.first_name`, cutoff)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    var out []ExpiringCredential
+    for rows.Next() {
+        var ec ExpiringCredential
+        if err := scanCredential(rows, &ec.DriverCredential, &ec.DriverCode, &ec.FirstName, &ec.LastName); err != nil {
+            continue
+        }
+        if expiry, err := parseLocalDate(ec.ExpiryDate); err == nil {
+            ec.DaysRemaining = int(math.Round(expiry.Sub(today).Hours() / 24))
+        }
+        out = append(out, ec)
+    }
+    c.JSON(http.StatusOK, out)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "mime/multipart"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/gin-gonic/gin"
+    "github.com/go-sql-driver/mysql"
+)
+
+// An uploaded scan lands in the file store, replaces the previous one and is
+// served back from there.
+func TestCredentialFileInStore(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+    store := withFileStore(t)
+
+    ctx := context.Background()
+    if err := store.Put(ctx, "credentials/4/old", strings.NewReader("old"), 3, "image/png"); err != nil {
+        t.Fatal(err)
+    }
+    var body bytes.Buffer
+    mw := multipart.NewWriter(&body)
+    fw, _ := mw.CreateFormFile("file", "licence.pdf")
+    fw.Write([]byte("%PDF-1.4 licence"))
+    mw.Close()
+
+    mock.ExpectBegin()
+    mock.ExpectQuery(`SELECT file_key FROM driver_credentials WHERE credential_id=\? FOR UPDATE`).WithArgs(4).
+        WillReturnRows(sqlmock.NewRows([]string{"file_key"}).AddRow("credentials/4/old"))
+    mock.ExpectExec(`UPDATE driver_credentials SET file_name=\?, file_content_type=\?, file_key=\?, file_size=\?`).
+        WithArgs("licence.pdf", "application/pdf", sqlmock.AnyArg(), 16, 4).WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectCommit()
+
+    req := httptest.NewRequest(http.MethodPut, "/api/credentials/4/file", &body)
+    req.Header.Set("Content-Type", mw.FormDataContentType())
+    w := httptest.NewRecorder()
+    newRouter().ServeHTTP(w, req)
+    if w.Code != http.StatusOK {
+        t.Fatalf("upload = %d %s", w.Code, w.Body)
+    }
+    if _, _, err := store.Get(ctx, "credentials/4/old"); err != ErrFileNotFound {
+        t.Errorf("old scan still stored: %v", err)
+    }
+
+    sum := sha256.Sum256([]byte("%PDF-1.4 licence"))
+    key := "credentials/4/" + hex.EncodeToString(sum[:])[:16]
+    mock.ExpectQuery(`SELECT file_name, file_content_type, file_key FROM driver_credentials WHERE credential_id=\?`).WithArgs("4").
+        WillReturnRows(sqlmock.NewRows([]string{"file_name", "file_content_type", "file_key"}).AddRow("licence.pdf", "application/pdf", key))
+    w = httptest.NewRecorder()
+    newRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/credentials/4/file", nil))
+    if w.Code != http.StatusOK || w.Body.String() != "%PDF-1.4 licence" || w.Header().Get("Content-Type") != "application/pdf" {
+        t.Errorf("download = %d %q %s", w.Code, w.Body, w.Header().Get("Content-Type"))
+    }
+}
+
+// A credential for a driver that does not exist is a 404, not a failed insert.
+func TestCreateCredentialUnknownDriver(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+
+    mock.ExpectExec(`INSERT INTO driver_credentials`).
+        WillReturnError(&mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row"})
+    w := testPost("/api/drivers/99/credentials", `{"credential_type": "license", "number": "X1"}`)
+    if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "driver not found") {
+        t.Errorf("create = %d %s", w.Code, w.Body)
+    }
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// Optimistic concurrency: drivers, trucks, safety events and scorecard events carry
+// a version that every write to the row bumps. It is returned as the ETag, PUT and
+// DELETE must send it back in If-Match, and a stale version gets 412 with the
+// record as it is now, so the client can show what changed and retry.
+
+func etagFor(version int) string {
+    return `"` + strconv.Itoa(version) + `"`
+}
+
+func setETag(c *gin.Context, version int) {
+    c.Header("ETag", etagFor(version))
+}
+
+// ifMatchVersion reads the If-Match header. "*" returns 0, meaning any version.
+// When it returns false the 428/400 response has been written.
+func ifMatchVersion(c *gin.Context) (int, bool) {
+    h := strings.TrimSpace(c.GetHeader("If-Match"))
+    if h == "" {
+        c.JSON(http.StatusPreconditionRequired, APIError{Message: "If-Match header with the record's ETag is required"})
+        return 0, false
+    }
+    if h == "*" {
+        return 0, true
+    }
+    v, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(h, "W/"), `"`))
+    if err != nil || v <= 0 {
+        c.JSON(http.StatusBadRequest, APIError{Message: "If-Match must be an ETag returned by the API"})
+        return 0, false
+    }
+    return v, true
+}
+
+// notModified answers 304 when If-None-Match already names the current version.
+func notModified(c *gin.Context, version int) bool {
+    for _, tag := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+        if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etagFor(version) {
+            c.Status(http.StatusNotModified)
+            return true
+        }
+    }
+    return false
+}
+
+// writeMissed explains a conditional write that matched no row: either the record
+// is gone (404) or someone changed it first (412 with the current record).
+func writeMissed(c *gin.Context, what string, load func() (any, int, error)) {
+    current, version, err := load()
+    if err == sql.ErrNoRows {
+        c.JSON(http.StatusNotFound, APIError{Message: what + " not found"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    preconditionFailed(c, what, current, version)
+}
+
+func preconditionFailed(c *gin.Context, what string, current any, version int) {
+    setETag(c, version)
+    c.JSON(http.StatusPreconditionFailed, PreconditionFailed{
+        Message: what + " was changed by someone else; review the current version and retry",
+        Current: current,
+    })
+}
+
+func loadDriver(ctx context.Context, id int, base string) (Driver, error) {
+    var d Driver
+    err := scanDriver(queryRow(ctx, `SELECT `+driverColumns+` FROM drivers WHERE driver_id=?`, id), &d, base)
+    return d, err
+}
+
+func loadTruck(ctx context.Context, id int) (Truck, error) {
+    var t Truck
+    err := scanTruck(queryRow(ctx, `SELECT `+truckColumns+` FROM trucks WHERE truck_id=?`, id), &t)
+    return t, err
+}
+
+func loadSafetyEvent(ctx context.Context, id int) (SafetyEvent, error) {
+    var e SafetyEvent
+    err := scanSafetyEvent(queryRow(ctx, `SELECT `+safetyEventColumns+` FROM safety_events WHERE safety_event_id=?`, id), &e)
+    return e, err
+}
+
+func loadScoreCardEvent(ctx context.Context, id int) (ScoreCardEvent, error) {
+    var e ScoreCardEvent
+    err := scanScoreCardEvent(queryRow(ctx, `SELECT `+scoreCardEventColumns+` FROM scorecard_events WHERE scorecard_event_id=?`, id), &e)
+    return e, err
+}
+
+// --- Single-record reads (with ETag) ---
+
+func getDriver(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    d, err := loadDriver(ctx, atoi(c.Param("id")), apiBaseURL(c))
+    respondVersioned(c, "driver", d, d.Version, err)
+}
+
+func getTruck(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    t, err := loadTruck(ctx, atoi(c.Param("id")))
+    respondVersioned(c, "truck", t, t.Version, err)
+}
+
+func getSafetyEvent(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    e, err := loadSafetyEvent(ctx, atoi(c.Param("id")))
+    respondVersioned(c, "safety event", e, e.Version, err)
+}
+
+func getScoreCardEvent(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    e, err := loadScoreCardEvent(ctx, atoi(c.Param("id")))
+    respondVersioned(c, "scorecard event", e, e.Version, err)
+}
+
+func respondVersioned(c *gin.Context, what string, v any, version int, err error) {
+    if err == sql.ErrNoRows {
+        c.JSON(http.StatusNotFound, APIError{Message: what + " not found"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    setETag(c, version)
+    if notModified(c, version) {
+        return
+    }
+    c.JSON(http.StatusOK, v)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/gin-gonic/gin"
+)
+
+// testWrite sends a write with the given If-Match header, if any.
+func testWrite(method, path, ifMatch, body string) *httptest.ResponseRecorder {
+    req := httptest.NewRequest(method, path, strings.NewReader(body))
+    if ifMatch != "" {
+        req.Header.Set("If-Match", ifMatch)
+    }
+    w := httptest.NewRecorder()
+    newRouter().ServeHTTP(w, req)
+    return w
+}
+
+// Versioned writes without a usable If-Match are refused before the database is read.
+func TestWritesRequireIfMatch(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    withMockDB(t)
+
+    truck := `{"unit_number": "T-07", "year": 2021, "status": "available"}`
+    for _, tc := range []struct {
+        method, path, ifMatch string
+        want                  int
+    }{
+        {http.MethodPut, "/api/trucks/7", "", http.StatusPreconditionRequired},
+        {http.MethodPatch, "/api/trucks/7", "", http.StatusPreconditionRequired},
+        {http.MethodDelete, "/api/trucks/7", "", http.StatusPreconditionRequired},
+        {http.MethodPatch, "/api/drivers/1", "", http.StatusPreconditionRequired},
+        {http.MethodPatch, "/api/safety-events/3", "", http.StatusPreconditionRequired},
+        {http.MethodPut, "/api/drivers/1/photo", "", http.StatusPreconditionRequired},
+        {http.MethodDelete, "/api/drivers/1/photo", "", http.StatusPreconditionRequired},
+        {http.MethodPatch, "/api/trucks/7", `"abc"`, http.StatusBadRequest},
+        {http.MethodPatch, "/api/trucks/7", `"0"`, http.StatusBadRequest},
+    } {
+        if w := testWrite(tc.method, tc.path, tc.ifMatch, truck); w.Code != tc.want {
+            t.Errorf("%s %s If-Match %q = %d, want %d", tc.method, tc.path, tc.ifMatch, w.Code, tc.want)
+        }
+    }
+}
+
+// A stale If-Match gets 412 with the current record and its ETag, and nothing is written.
+func TestStaleIfMatch(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+
+    for _, method := range []string{http.MethodPatch, http.MethodDelete} {
+        mock.ExpectQuery(`SELECT .+ FROM trucks WHERE truck_id=\?`).WithArgs(7).
+            WillReturnRows(sqlmock.NewRows(truckCols).AddRow(7, "T-07", 2021, "assigned", 3))
+        w := testWrite(method, "/api/trucks/7", `W/"2"`, `{"status": "maintenance"}`)
+
+        var body struct{ Current Truck }
+        if err := json.Unmarshal(w.Body.Bytes(), &body); w.Code != http.StatusPreconditionFailed || err != nil ||
+            w.Header().Get("ETag") != `"3"` || body.Current.Version != 3 || body.Current.Status != "assigned" {
+            t.Errorf("%s = %d %s, ETag %s", method, w.Code, w.Body, w.Header().Get("ETag"))
+        }
+    }
+}
+
+// A write that loses the race after the version check still gets 412 (or 404 when
+// the record went away), and its transaction is rolled back.
+func TestConcurrentWriteLoses(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+
+    for _, tc := range []struct {
+        reload *sqlmock.Rows
+        want   int
+    }{
+        {sqlmock.NewRows(truckCols).AddRow(7, "T-07", 2021, "assigned", 4), http.StatusPreconditionFailed},
+        {sqlmock.NewRows(truckCols), http.StatusNotFound},
+    } {
+        mock.ExpectQuery(`SELECT .+ FROM trucks WHERE truck_id=\?`).WithArgs(7).
+            WillReturnRows(sqlmock.NewRows(truckCols).AddRow(7, "T-07", 2021, "available", 3))
+        mock.ExpectBegin()
+        mock.ExpectExec(`UPDATE trucks SET status=\?, version=version\+1 WHERE truck_id=\? AND version=\?`).WithArgs("maintenance", 7, 3).
+            WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectQuery(`SELECT .+ FROM trucks WHERE truck_id=\?`).WithArgs(7).WillReturnRows(tc.reload)
+        mock.ExpectRollback()
+
+        if w := testWrite(http.MethodPatch, "/api/trucks/7", `"3"`, `{"status": "maintenance"}`); w.Code != tc.want {
+            t.Errorf("patch = %d %s, want %d", w.Code, w.Body, tc.want)
+        }
+    }
+}
@@ -0,0 +1,398 @@
+// Package config is the API's configuration: defaults, then an optional YAML file
+// (CONFIG_FILE), then environment variables, validated as a whole at startup.
+//
+// Every setting has a yaml key and, for most, an environment variable (the env
+// tag). Fields tagged secret are shown as "[redacted]" by Redacted.
+package config
+
+import (
+    "errors"
+    "fmt"
+    "log/slog"
+    "net/mail"
+    "net/netip"
+    "net/url"
+    "os"
+    "reflect"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/goccy/go-yaml"
+)
+
+type Config struct {
+    Server     Server     `json:"server" yaml:"server"`
+    Database   Database   `json:"database" yaml:"database"`
+    Timezone   string     `json:"timezone" yaml:"timezone" env:"APP_TIMEZONE"` // IANA name; dates are local to it
+    CORS       CORS       `json:"cors" yaml:"cors"`
+    Thresholds Thresholds `json:"thresholds" yaml:"thresholds"`
+    Jobs       Jobs       `json:"jobs" yaml:"jobs"`
+    Logging    Logging    `json:"logging" yaml:"logging"`
+    FileStore  FileStore  `json:"filestore" yaml:"filestore"`
+    Mail       Mail       `json:"mail" yaml:"mail"`
+    Templates  Templates  `json:"templates" yaml:"templates"`
+    Webhooks   Webhooks   `json:"webhooks" yaml:"webhooks"`
+}
+
+type Server struct {
+    Port              string   `json:"port" yaml:"port" env:"API_PORT"`
+    PublicURL         string   `json:"public_url" yaml:"public_url" env:"PUBLIC_API_URL"` // origin for photo URLs; empty: from the request
+    ReadHeaderTimeout Duration `json:"read_header_timeout" yaml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+    ReadTimeout       Duration `json:"read_timeout" yaml:"read_timeout" env:"HTTP_READ_TIMEOUT"`
+    WriteTimeout      Duration `json:"write_timeout" yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+    IdleTimeout       Duration `json:"idle_timeout" yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT"`
+    ShutdownTimeout   Duration `json:"shutdown_timeout" yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+    // How long /readyz reports 503 before the listener closes, so load balancers notice
+    ShutdownDrainDelay Duration `json:"shutdown_drain_delay" yaml:"shutdown_drain_delay" env:"SHUTDOWN_DRAIN_DELAY"`
+}
+
+type Database struct {
+    DSN             string   `json:"dsn" yaml:"dsn" env:"DB_DSN" secret:"password"` // only the password is redacted
+    MaxOpenConns    int      `json:"max_open_conns" yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+    MaxIdleConns    int      `json:"max_idle_conns" yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+    ConnMaxLifetime Duration `json:"conn_max_lifetime" yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+    ConnectAttempts int      `json:"connect_attempts" yaml:"connect_attempts" env:"DB_CONNECT_ATTEMPTS"` // at startup, 2s apart
+}
+
+type CORS struct {
+    AllowedOrigins []string `json:"allowed_origins" yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"` // comma-separated in env; "*" allows any
+    MaxAge         Duration `json:"max_age" yaml:"max_age" env:"CORS_MAX_AGE"`
+}
+
+type Thresholds struct {
+    BonusWarningPoints   int `json:"bonus_warning_points" yaml:"bonus_warning_points" env:"BONUS_WARNING_POINTS"`       // above: "Warning" status, no bonus
+    HighRiskPoints       int `json:"high_risk_points" yaml:"high_risk_points" env:"HIGH_RISK_POINTS"`                   // above: high-risk alert and metric
+    CredentialExpiryDays int `json:"credential_expiry_days" yaml:"credential_expiry_days" env:"CREDENTIAL_EXPIRY_DAYS"` // expiring-credentials warning window
+    ReadyOutboxMax       int `json:"ready_outbox_max" yaml:"ready_outbox_max" env:"READY_OUTBOX_MAX"`                   // unsent mail above: /readyz fails
+}
+
+type Jobs struct {
+    Enabled bool     `json:"enabled" yaml:"enabled" env:"JOBS_ENABLED"` // false on replicas that only serve requests
+    Timeout Duration `json:"timeout" yaml:"timeout" env:"JOB_TIMEOUT"`
+}
+
+type Logging struct {
+    Level  string `json:"level" yaml:"level" env:"LOG_LEVEL"`    // debug, info, warn or error
+    Format string `json:"format" yaml:"format" env:"LOG_FORMAT"` // json or text
+}
+
+type FileStore struct {
+    Driver            string `json:"driver" yaml:"driver" env:"FILESTORE_DRIVER"` // local or s3
+    Dir               string `json:"dir" yaml:"dir" env:"FILESTORE_DIR"`
+    S3Endpoint        string `json:"s3_endpoint" yaml:"s3_endpoint" env:"S3_ENDPOINT"`
+    S3Bucket          string `json:"s3_bucket" yaml:"s3_bucket" env:"S3_BUCKET"`
+    S3Region          string `json:"s3_region" yaml:"s3_region" env:"S3_REGION"`
+    S3AccessKeyID     string `json:"s3_access_key_id" yaml:"s3_access_key_id" env:"S3_ACCESS_KEY_ID"`
+    S3SecretAccessKey string `json:"s3_secret_access_key" yaml:"s3_secret_access_key" env:"S3_SECRET_ACCESS_KEY" secret:"true"`
+}
+
+type Mail struct {
+    SMTPHost     string `json:"smtp_host" yaml:"smtp_host" env:"SMTP_HOST"` // empty: mail is logged, not sent
+    SMTPPort     string `json:"smtp_port" yaml:"smtp_port" env:"SMTP_PORT"`
+    From         string `json:"from" yaml:"from" env:"SMTP_FROM"`
+    Username     string `json:"username" yaml:"username" env:"SMTP_USERNAME"`
+    Password     string `json:"password" yaml:"password" env:"SMTP_PASSWORD" secret:"true"`
+    StartTLS     string `json:"starttls" yaml:"starttls" env:"SMTP_STARTTLS"` // auto, always or never
+    TemplatesDir string `json:"templates_dir" yaml:"templates_dir" env:"NOTIFY_TEMPLATE_DIR"`
+}
+
+type Templates struct {
+    PayrollFile string `json:"payroll_file" yaml:"payroll_file" env:"PAYROLL_TEMPLATES_FILE"`
+}
+
+type Webhooks struct {
+    // Receivers allowed on loopback, private or link-local addresses: host names,
+    // IPs or CIDRs (comma-separated in env). Everything else must be public.
+    AllowedHosts []string `json:"allowed_hosts" yaml:"allowed_hosts" env:"WEBHOOK_ALLOWED_HOSTS"`
+}
+
+// Default is the configuration with nothing set.
+func Default() Config {
+    return Config{
+        Server: Server{
+            Port:               "8080",
+            ReadHeaderTimeout:  Duration(10 * time.Second),
+            ReadTimeout:        Duration(2 * time.Minute),
+            WriteTimeout:       Duration(5 * time.Minute),
+            IdleTimeout:        Duration(2 * time.Minute),
+            ShutdownTimeout:    Duration(30 * time.Second),
+            ShutdownDrainDelay: Duration(5 * time.Second),
+        },
+        Database: Database{
+            MaxOpenConns:    100,
+            MaxIdleConns:    10,
+            ConnMaxLifetime: Duration(3 * time.Minute),
+            ConnectAttempts: 20,
+        },
+        Timezone: "America/Winnipeg",
+        CORS: CORS{
+            AllowedOrigins: []string{"*"},
+            MaxAge:         Duration(12 * time.Hour),
+        },
+        Thresholds: Thresholds{
+            BonusWarningPoints:   5,
+            HighRiskPoints:       10, // the Dashboard's "High Risk (>10)" band
+            CredentialExpiryDays: 30,
+            ReadyOutboxMax:       500,
+        },
+        Jobs:    Jobs{Enabled: true, Timeout: Duration(25 * time.Minute)},
+        Logging: Logging{Level: "info", Format: "json"},
+        FileStore: FileStore{
+            Driver:   "local",
+            Dir:      "./data/files",
+            S3Region: "us-east-1",
+        },
+        Mail: Mail{
+            SMTPPort: "587",
+            From:     "Driver Safety <no-reply@localhost>",
+            StartTLS: "auto",
+        },
+    }
+}
+
+// Load reads the defaults, then file (YAML; skipped when ""), then the environment,
+// and validates the result. The error lists every problem found.
+func Load(file string) (Config, error) {
+    c := Default()
+    if file != "" {
+        b, err := os.ReadFile(file)
+        if err != nil {
+            return c, fmt.Errorf("config file: %w", err)
+        }
+        if err := yaml.UnmarshalWithOptions(b, &c, yaml.DisallowUnknownField()); err != nil {
+            return c, fmt.Errorf("config file %s: %w", file, err)
+        }
+    }
+    if err := c.applyEnv(os.LookupEnv); err != nil {
+        return c, err
+    }
+    return c, c.Validate()
+}
+
+// applyEnv overrides fields whose env variable is set; empty counts as unset, as
+// it always has for these variables.
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+    var errs []error
+    walk(reflect.ValueOf(c).Elem(), func(f reflect.StructField, v reflect.Value) {
+        name := f.Tag.Get("env")
+        if name == "" {
+            return
+        }
+        raw, _ := lookup(name)
+        if raw = strings.TrimSpace(raw); raw == "" {
+            return
+        }
+        if err := setFromString(v, raw); err != nil {
+            errs = append(errs, fmt.Errorf("%s: %w", name, err))
+        }
+    })
+    return errors.Join(errs...)
+}
+
+func setFromString(v reflect.Value, s string) error {
+    switch v.Interface().(type) {
+    case Duration:
+        var d Duration
+        if err := d.UnmarshalText([]byte(s)); err != nil {
+            return err
+        }
+        v.Set(reflect.ValueOf(d))
+        return nil
+    }
+    switch v.Kind() {
+    case reflect.String:
+        v.SetString(s)
+    case reflect.Int:
+        n, err := strconv.Atoi(s)
+        if err != nil {
+            return fmt.Errorf("not a whole number: %q", s)
+        }
+        v.SetInt(int64(n))
+    case reflect.Bool:
+        b, err := strconv.ParseBool(s)
+        if err != nil {
+            return fmt.Errorf("not true or false: %q", s)
+        }
+        v.SetBool(b)
+    case reflect.Slice:
+        var list []string
+        for _, part := range strings.Split(s, ",") {
+            if part = strings.TrimSpace(part); part != "" {
+                list = append(list, part)
+            }
+        }
+        v.Set(reflect.ValueOf(list))
+    default:
+        return fmt.Errorf("unsupported type %s", v.Type())
+    }
+    return nil
+}
+
+// walk calls fn for every leaf field, descending into nested structs.
+func walk(v reflect.Value, fn func(reflect.StructField, reflect.Value)) {
+    t := v.Type()
+    for i := 0; i < t.NumField(); i++ {
+        f, fv := t.Field(i), v.Field(i)
+        if f.Type.Kind() == reflect.Struct {
+            walk(fv, fn)
+            continue
+        }
+        fn(f, fv)
+    }
+}
+
+// Validate checks every setting and reports all problems at once.
+func (c Config) Validate() error {
+    var errs []error
+    check := func(ok bool, format string, args ...any) {
+        if !ok {
+            errs = append(errs, fmt.Errorf(format, args...))
+        }
+    }
+
+    port, err := strconv.Atoi(c.Server.Port)
+    check(err == nil && port > 0 && port < 65536, "server.port (API_PORT) must be a port number: %q", c.Server.Port)
+    if c.Server.PublicURL != "" {
+        u, err := url.Parse(c.Server.PublicURL)
+        check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "server.public_url (PUBLIC_API_URL) must be an http(s) URL: %q", c.Server.PublicURL)
+    }
+    for name, d := range map[string]Duration{
+        "server.read_header_timeout (HTTP_READ_HEADER_TIMEOUT)": c.Server.ReadHeaderTimeout,
+        "server.read_timeout (HTTP_READ_TIMEOUT)":               c.Server.ReadTimeout,
+        "server.write_timeout (HTTP_WRITE_TIMEOUT)":             c.Server.WriteTimeout,
+        "server.idle_timeout (HTTP_IDLE_TIMEOUT)":               c.Server.IdleTimeout,
+        "server.shutdown_drain_delay (SHUTDOWN_DRAIN_DELAY)":    c.Server.ShutdownDrainDelay,
+        "database.conn_max_lifetime (DB_CONN_MAX_LIFETIME)":     c.Database.ConnMaxLifetime,
+        "cors.max_age (CORS_MAX_AGE)":                           c.CORS.MaxAge,
+    } {
+        check(d >= 0, "%s must not be negative", name)
+    }
+    check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout (SHUTDOWN_TIMEOUT) must be positive")
+    check(c.Jobs.Timeout > 0 && c.Jobs.Timeout < Duration(30*time.Minute), "jobs.timeout (JOB_TIMEOUT) must be positive and below the 30m job lease")
+
+    check(c.Database.MaxOpenConns > 0, "database.max_open_conns (DB_MAX_OPEN_CONNS) must be at least 1")
+    check(c.Database.MaxIdleConns >= 0 && c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+        "database.max_idle_conns (DB_MAX_IDLE_CONNS) must be between 0 and max_open_conns (%d)", c.Database.MaxOpenConns)
+    check(c.Database.ConnectAttempts > 0, "database.connect_attempts (DB_CONNECT_ATTEMPTS) must be at least 1")
+
+    _, err = time.LoadLocation(c.Timezone)
+    check(c.Timezone != "" && err == nil, "timezone (APP_TIMEZONE) is not a known IANA zone: %q", c.Timezone)
+
+    check(len(c.CORS.AllowedOrigins) > 0, "cors.allowed_origins (CORS_ALLOWED_ORIGINS) must list at least one origin, or *")
+    for _, o := range c.CORS.AllowedOrigins {
+        if o == "*" {
+            continue
+        }
+        u, err := url.Parse(o)
+        check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.Path == "",
+            "cors.allowed_origins: %q is not an origin like http://localhost:3000", o)
+    }
+
+    check(c.Thresholds.BonusWarningPoints >= 0, "thresholds.bonus_warning_points (BONUS_WARNING_POINTS) must not be negative")
+    check(c.Thresholds.HighRiskPoints >= 0, "thresholds.high_risk_points (HIGH_RISK_POINTS) must not be negative")
+    check(c.Thresholds.CredentialExpiryDays > 0, "thresholds.credential_expiry_days (CREDENTIAL_EXPIRY_DAYS) must be at least 1")
+    check(c.Thresholds.ReadyOutboxMax > 0, "thresholds.ready_outbox_max (READY_OUTBOX_MAX) must be at least 1")
+
+    var level slog.Level
+    check(level.UnmarshalText([]byte(c.Logging.Level)) == nil, "logging.level (LOG_LEVEL) must be debug, info, warn or error: %q", c.Logging.Level)
+    check(oneOf(strings.ToLower(c.Logging.Format), "json", "text"), "logging.format (LOG_FORMAT) must be json or text: %q", c.Logging.Format)
+
+    switch strings.ToLower(c.FileStore.Driver) {
+    case "local":
+        check(c.FileStore.Dir != "", "filestore.dir (FILESTORE_DIR) is required for the local driver")
+    case "s3":
+        check(c.FileStore.S3Endpoint != "" && c.FileStore.S3Bucket != "" && c.FileStore.S3AccessKeyID != "" && c.FileStore.S3SecretAccessKey != "",
+            "S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required for FILESTORE_DRIVER=s3")
+    default:
+        check(false, "filestore.driver (FILESTORE_DRIVER) must be local or s3: %q", c.FileStore.Driver)
+    }
+
+    for _, h := range c.Webhooks.AllowedHosts {
+        _, cidrErr := netip.ParsePrefix(h)
+        _, ipErr := netip.ParseAddr(h)
+        check(cidrErr == nil || ipErr == nil || hostName.MatchString(h),
+            "webhooks.allowed_hosts (WEBHOOK_ALLOWED_HOSTS): %q is not a host name, IP or CIDR", h)
+    }
+
+    if c.Mail.SMTPHost != "" {
+        _, err := mail.ParseAddress(c.Mail.From)
+        check(err == nil, "mail.from (SMTP_FROM) is not an address: %q", c.Mail.From)
+        port, err := strconv.Atoi(c.Mail.SMTPPort)
+        check(err == nil && port > 0 && port < 65536, "mail.smtp_port (SMTP_PORT) must be a port number: %q", c.Mail.SMTPPort)
+        check(oneOf(c.Mail.StartTLS, "auto", "always", "never"), "mail.starttls (SMTP_STARTTLS) must be auto, always or never: %q", c.Mail.StartTLS)
+    }
+    return errors.Join(errs...)
+}
+
+var hostName = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$`)
+
+func oneOf(s string, values ...string) bool {
+    for _, v := range values {
+        if s == v {
+            return true
+        }
+    }
+    return false
+}
+
+// --- Redaction ---
+
+const redacted = "[redacted]"
+
+// Redacted is a copy safe to show: secret fields are replaced when set, and the
+// database DSN keeps everything but its password.
+func (c Config) Redacted() Config {
+    c.CORS.AllowedOrigins = append([]string(nil), c.CORS.AllowedOrigins...)
+    c.Webhooks.AllowedHosts = append([]string(nil), c.Webhooks.AllowedHosts...)
+    walk(reflect.ValueOf(&c).Elem(), func(f reflect.StructField, v reflect.Value) {
+        switch f.Tag.Get("secret") {
+        case "true":
+            if v.String() != "" {
+                v.SetString(redacted)
+            }
+        case "password":
+            v.SetString(redactDSN(v.String()))
+        }
+    })
+    return c
+}
+
+// redactDSN hides the password of user:password@tcp(host)/db; like the MySQL
+// driver, it takes the last @ before the last / as the end of the password.
+func redactDSN(dsn string) string {
+    slash := strings.LastIndex(dsn, "/")
+    if slash < 0 {
+        return dsn
+    }
+    at := strings.LastIndex(dsn[:slash], "@")
+    if at < 0 {
+        return dsn
+    }
+    user, _, found := strings.Cut(dsn[:at], ":")
+    if !found {
+        return dsn
+    }
+    return user + ":" + redacted + dsn[at:]
+}
+
+// --- Duration ---
+
+// Duration is a time.Duration written as "30s" or "5m" in YAML, env and JSON.
+type Duration time.Duration
+
+func (d Duration) Std() time.Duration { return time.Duration(d) }
+
+func (d Duration) MarshalText() ([]byte, error) {
+    return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+    parsed, err := time.ParseDuration(string(b))
+    if err != nil {
+        return fmt.Errorf("not a duration like 30s or 2m: %q", b)
+    }
+    *d = Duration(parsed)
+    return nil
+}
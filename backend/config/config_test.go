@@ -0,0 +1,95 @@
+package config
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestLoadFileThenEnv(t *testing.T) {
+    file := filepath.Join(t.TempDir(), "config.yaml")
+    os.WriteFile(file, []byte(`
+timezone: America/Regina
+server:
+  write_timeout: 90s
+database:
+  max_open_conns: 40
+cors:
+  allowed_origins: [http://localhost:3000]
+thresholds:
+  high_risk_points: 12
+`), 0o600)
+    t.Setenv("DB_MAX_OPEN_CONNS", "60")
+    t.Setenv("CORS_ALLOWED_ORIGINS", "https://safety.example.com, http://localhost:3000")
+    t.Setenv("JOBS_ENABLED", "false")
+    t.Setenv("LOG_LEVEL", "")
+
+    c, err := Load(file)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if c.Timezone != "America/Regina" || c.Server.WriteTimeout.Std() != 90*time.Second || c.Thresholds.HighRiskPoints != 12 {
+        t.Errorf("file not applied: %+v", c)
+    }
+    if c.Database.MaxOpenConns != 60 || c.Jobs.Enabled || len(c.CORS.AllowedOrigins) != 2 {
+        t.Errorf("env not applied: %+v", c)
+    }
+    if c.Server.ReadTimeout.Std() != 2*time.Minute || c.Logging.Level != "info" {
+        t.Errorf("defaults lost: %+v", c)
+    }
+}
+
+func TestLoadUnknownKey(t *testing.T) {
+    file := filepath.Join(t.TempDir(), "config.yaml")
+    os.WriteFile(file, []byte("server:\n  prot: 8081\n"), 0o600)
+    if _, err := Load(file); err == nil {
+        t.Error("misspelt key accepted")
+    }
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+    t.Setenv("SHUTDOWN_TIMEOUT", "soon")
+    if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "SHUTDOWN_TIMEOUT") {
+        t.Errorf("SHUTDOWN_TIMEOUT=soon: %v", err)
+    }
+
+    c := Default()
+    c.Timezone = "Mars/Olympus"
+    c.Database.MaxIdleConns = 200
+    c.CORS.AllowedOrigins = []string{"localhost:3000"}
+    c.FileStore.Driver = "s3"
+    c.Webhooks.AllowedHosts = []string{"http://receiver:9000/"}
+    err := c.Validate()
+    if err == nil {
+        t.Fatal("invalid config accepted")
+    }
+    for _, want := range []string{"APP_TIMEZONE", "DB_MAX_IDLE_CONNS", "cors.allowed_origins", "S3_BUCKET", "WEBHOOK_ALLOWED_HOSTS"} {
+        if !strings.Contains(err.Error(), want) {
+            t.Errorf("error does not mention %s:\n%v", want, err)
+        }
+    }
+}
+
+func TestRedacted(t *testing.T) {
+    c := Default()
+    c.Database.DSN = "app:p@ss:word@tcp(mysql:3306)/driver_safety?parseTime=true"
+    c.FileStore.S3SecretAccessKey = "s3-secret"
+    r := c.Redacted()
+    if r.Database.DSN != "app:[redacted]@tcp(mysql:3306)/driver_safety?parseTime=true" {
+        t.Errorf("DSN = %q", r.Database.DSN)
+    }
+    if r.FileStore.S3SecretAccessKey != "[redacted]" || r.Mail.Password != "" {
+        t.Errorf("secrets = %q, %q", r.FileStore.S3SecretAccessKey, r.Mail.Password)
+    }
+    if c.FileStore.S3SecretAccessKey != "s3-secret" {
+        t.Error("Redacted changed the original")
+    }
+}
+
+func TestExampleFile(t *testing.T) {
+    if _, err := Load("../config.example.yaml"); err != nil {
+        t.Error(err)
+    }
+}
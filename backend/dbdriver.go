@@ -0,0 +1,288 @@
+package main
+
+import (
+    "cmp"
+    "context"
+    "database/sql/driver"
+    "io"
+    "log/slog"
+    "reflect"
+    "strings"
+    "time"
+
+    "go.opentelemetry.io/otel/attribute"
+    semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+)
+
+// observedConnector wraps the MySQL connector so every statement, wherever it runs
+// (helpers, transactions, db.QueryRowContext), reports to observeQuery. Queries
+// report when their rows are closed, with the number of rows read.
+type observedConnector struct{ driver.Connector }
+
+func (c observedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+    conn, err := c.Connector.Connect(ctx)
+    if err != nil {
+        return nil, err
+    }
+    return &observedConn{Conn: conn}, nil
+}
+
+type observedConn struct{ driver.Conn }
+
+func (c *observedConn) Prepare(query string) (driver.Stmt, error) {
+    return c.PrepareContext(context.Background(), query)
+}
+
+func (c *observedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+    var (
+        st  driver.Stmt
+        err error
+    )
+    if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+        st, err = p.PrepareContext(ctx, query)
+    } else {
+        st, err = c.Conn.Prepare(query)
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &observedStmt{Stmt: st, query: query}, nil
+}
+
+func (c *observedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+    if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+        return b.BeginTx(ctx, opts)
+    }
+    return c.Conn.Begin() // drivers without BeginTx
+}
+
+// Queries with arguments usually come back as driver.ErrSkip and run as prepared
+// statements instead; those are observed by observedStmt.
+func (c *observedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+    q, ok := c.Conn.(driver.QueryerContext)
+    if !ok {
+        return nil, driver.ErrSkip
+    }
+    start := time.Now()
+    rows, err := q.QueryContext(ctx, query, args)
+    if err == driver.ErrSkip {
+        return nil, err
+    }
+    return observeRows(ctx, query, start, rows, err)
+}
+
+func (c *observedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+    e, ok := c.Conn.(driver.ExecerContext)
+    if !ok {
+        return nil, driver.ErrSkip
+    }
+    start := time.Now()
+    res, err := e.ExecContext(ctx, query, args)
+    if err == driver.ErrSkip {
+        return nil, err
+    }
+    observeExec(ctx, query, start, res, err)
+    return res, err
+}
+
+func (c *observedConn) Ping(ctx context.Context) error {
+    if p, ok := c.Conn.(driver.Pinger); ok {
+        return p.Ping(ctx)
+    }
+    return nil
+}
+
+func (c *observedConn) ResetSession(ctx context.Context) error {
+    if r, ok := c.Conn.(driver.SessionResetter); ok {
+        return r.ResetSession(ctx)
+    }
+    return nil
+}
+
+func (c *observedConn) IsValid() bool {
+    if v, ok := c.Conn.(driver.Validator); ok {
+        return v.IsValid()
+    }
+    return true
+}
+
+func (c *observedConn) CheckNamedValue(nv *driver.NamedValue) error {
+    if ch, ok := c.Conn.(driver.NamedValueChecker); ok {
+        return ch.CheckNamedValue(nv)
+    }
+    return driver.ErrSkip
+}
+
+type observedStmt struct {
+    driver.Stmt
+    query string
+}
+
+func (s *observedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+    start := time.Now()
+    var (
+        res driver.Result
+        err error
+    )
+    if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+        res, err = e.ExecContext(ctx, args)
+    } else {
+        res, err = s.Stmt.Exec(namedValues(args))
+    }
+    observeExec(ctx, s.query, start, res, err)
+    return res, err
+}
+
+func (s *observedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+    start := time.Now()
+    var (
+        rows driver.Rows
+        err  error
+    )
+    if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+        rows, err = q.QueryContext(ctx, args)
+    } else {
+        rows, err = s.Stmt.Query(namedValues(args))
+    }
+    return observeRows(ctx, s.query, start, rows, err)
+}
+
+func (s *observedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+    if ch, ok := s.Stmt.(driver.NamedValueChecker); ok {
+        return ch.CheckNamedValue(nv)
+    }
+    return driver.ErrSkip
+}
+
+func namedValues(args []driver.NamedValue) []driver.Value {
+    out := make([]driver.Value, len(args))
+    for i, a := range args {
+        out[i] = a.Value
+    }
+    return out
+}
+
+// observedRows counts the rows read and reports the query when closed.
+type observedRows struct {
+    driver.Rows
+    ctx   context.Context
+    query string
+    start time.Time
+    n     int64
+    err   error
+}
+
+func (r *observedRows) Next(dest []driver.Value) error {
+    err := r.Rows.Next(dest)
+    switch {
+    case err == nil:
+        r.n++
+    case err != io.EOF:
+        r.err = err
+    }
+    return err
+}
+
+func (r *observedRows) Close() error {
+    err := r.Rows.Close()
+    observeQuery(r.ctx, r.query, r.start, cmp.Or(r.err, err), semconv.DBResponseReturnedRows(int(r.n)))
+    return err
+}
+
+// The column type and result set methods pass through, so rows.ColumnTypes and
+// multiple result sets work as with the bare driver.
+
+func (r *observedRows) ColumnTypeDatabaseTypeName(i int) string {
+    if t, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+        return t.ColumnTypeDatabaseTypeName(i)
+    }
+    return ""
+}
+
+func (r *observedRows) ColumnTypeScanType(i int) reflect.Type {
+    if t, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+        return t.ColumnTypeScanType(i)
+    }
+    return reflect.TypeFor[any]()
+}
+
+func (r *observedRows) ColumnTypeLength(i int) (int64, bool) {
+    if t, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+        return t.ColumnTypeLength(i)
+    }
+    return 0, false
+}
+
+func (r *observedRows) ColumnTypeNullable(i int) (bool, bool) {
+    if t, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+        return t.ColumnTypeNullable(i)
+    }
+    return false, false
+}
+
+func (r *observedRows) ColumnTypePrecisionScale(i int) (int64, int64, bool) {
+    if t, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+        return t.ColumnTypePrecisionScale(i)
+    }
+    return 0, 0, false
+}
+
+func (r *observedRows) HasNextResultSet() bool {
+    m, ok := r.Rows.(driver.RowsNextResultSet)
+    return ok && m.HasNextResultSet()
+}
+
+func (r *observedRows) NextResultSet() error {
+    if m, ok := r.Rows.(driver.RowsNextResultSet); ok {
+        return m.NextResultSet()
+    }
+    return io.EOF
+}
+
+func observeRows(ctx context.Context, query string, start time.Time, rows driver.Rows, err error) (driver.Rows, error) {
+    if err != nil {
+        observeQuery(ctx, query, start, err)
+        return nil, err
+    }
+    return &observedRows{Rows: rows, ctx: ctx, query: query, start: start}, nil
+}
+
+func observeExec(ctx context.Context, query string, start time.Time, res driver.Result, err error) {
+    var attrs []attribute.KeyValue
+    if err == nil {
+        if n, rerr := res.RowsAffected(); rerr == nil {
+            attrs = append(attrs, attribute.Int64("db.response.affected_rows", n))
+        }
+    }
+    observeQuery(ctx, query, start, err, attrs...)
+}
+
+// observeQuery adds a statement's time to its request (logged with the request),
+// logs the statement itself at debug level and records it as a trace span.
+func observeQuery(ctx context.Context, query string, start time.Time, err error, attrs ...attribute.KeyValue) {
+    d := time.Since(start)
+    if info := requestInfoFrom(ctx); info != nil {
+        info.dbQueries.Add(1)
+        info.dbTime.Add(int64(d))
+    }
+    if slog.Default().Enabled(ctx, slog.LevelDebug) {
+        args := []any{"statement", compactSQL(query), "duration_ms", millis(d)}
+        for _, a := range attrs {
+            args = append(args, string(a.Key), a.Value.AsInterface())
+        }
+        if err != nil {
+            args = append(args, "err", err)
+        }
+        slog.DebugContext(ctx, "sql", args...)
+    }
+    traceQuery(ctx, query, start, err, attrs...)
+}
+
+// compactSQL puts a statement on one line and shortens long ones for logs.
+func compactSQL(q string) string {
+    q = strings.Join(strings.Fields(q), " ")
+    if len(q) > 300 {
+        q = q[:300] + "…"
+    }
+    return q
+}
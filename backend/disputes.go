@@ -0,0 +1,295 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// Allowed dispute status transitions. upheld and overturned are final; an upheld
+// dispute can be appealed by opening a new one, an overturned event cannot.
+var disputeTransitions = map[string][]string{
+    "open":         {"under_review", "upheld", "overturned"},
+    "under_review": {"upheld", "overturned"},
+}
+
+func canTransition(from, to string) bool {
+    for _, s := range disputeTransitions[from] {
+        if s == to {
+            return true
+        }
+    }
+    return false
+}
+
+const disputeColumns = `dispute_id, safety_event_id, reason, opened_by, opened_by_role, status, opened_at, reviewer, resolution_notes, resolved_at`
+
+func scanDispute(row rowScanner, d *SafetyEventDispute) error {
+    var (
+        openedAt   time.Time
+        reviewer   sql.NullString
+        resolution sql.NullString
+        resolvedAt sql.NullTime
+    )
+    if err := row.Scan(&d.DisputeID, &d.SafetyEventID, &d.Reason, &d.OpenedBy, &d.OpenedByRole, &d.Status, &openedAt, &reviewer, &resolution, &resolvedAt); err != nil {
+        return err
+    }
+    d.OpenedAt = openedAt.In(localTZ).Format(time.RFC3339)
+    if reviewer.Valid {
+        d.Reviewer = &reviewer.String
+    }
+    if resolution.Valid {
+        d.ResolutionNotes = &resolution.String
+    }
+    if resolvedAt.Valid {
+        val := resolvedAt.Time.In(localTZ).Format(time.RFC3339)
+        d.ResolvedAt = &val
+    }
+    return nil
+}
+
+// loadDisputes fetches disputes matching the filter along with their transition history.
+func loadDisputes(ctx context.Context, where string, args ...any) ([]SafetyEventDispute, error) {
+    rows, err := queryRows(ctx, `SELECT `+disputeColumns+` FROM safety_event_disputes WHERE `+where+` ORDER BY opened_at, dispute_id`, args...)
+    if err != nil {
+        return nil, err
+    }
+    var disputes []SafetyEventDispute
+    for rows.Next() {
+        var d SafetyEventDispute
+        if err := scanDispute(rows, &d); err != nil {
+            continue
+        }
+        d.Transitions = []DisputeTransition{}
+        disputes = append(disputes, d)
+    }
+    rows.Close()
+
+    for i := range disputes {
+        trows, err := queryRows(ctx, `
+            SELECT transition_id, from_status, to_status, actor, notes, changed_at
+            FROM safety_event_dispute_transitions WHERE dispute_id=? ORDER BY changed_at, transition_id`, disputes[i].DisputeID)
+        if err != nil {
+            return nil, err
+        }
+        for trows.Next() {
+            var (
+                t         DisputeTransition
+                from      sql.NullString
+                notes     sql.NullString
+                changedAt time.Time
+            )
+            if err := trows.Scan(&t.TransitionID, &from, &t.ToStatus, &t.Actor, &notes, &changedAt); err != nil {
+                continue
+            }
+            if from.Valid {
+                t.FromStatus = &from.String
+            }
+            t.Notes = notes.String
+            t.ChangedAt = changedAt.In(localTZ).Format(time.RFC3339)
+            disputes[i].Transitions = append(disputes[i].Transitions, t)
+        }
+        trows.Close()
+    }
+    return disputes, nil
+}
+
+// setDisputeStatus mirrors a dispute's status onto its event, which bumps the
+// event's version, and publishes the event so open clients pick up the new ETag.
+func setDisputeStatus(ctx context.Context, eventID int, status string) error {
+    if _, err := exec(ctx, `UPDATE safety_events SET dispute_status=?, version=version+1 WHERE safety_event_id=?`, status, eventID); err != nil {
+        return err
+    }
+    e, err := loadSafetyEvent(ctx, eventID)
+    if err != nil {
+        return err
+    }
+    return publishEvent(ctx, "safety_event.updated", e)
+}
+
+// --- Disputes ---
+
+func getSafetyEventDisputes(c *gin.Context) {
+    id := c.Param("id")
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    disputes, err := loadDisputes(ctx, `safety_event_id=?`, id)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, disputes)
+}
+
+// GET /disputes?status=open&driverId=
+func getDisputes(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    where := []string{"1=1"}
+    var args []any
+    if status := c.Query("status"); status != "" {
+        where = append(where, "status=?")
+        args = append(args, status)
+    }
+    if driverID := c.Query("driverId"); driverID != "" {
+        where = append(where, "safety_event_id IN (SELECT safety_event_id FROM safety_events WHERE driver_id=?)")
+        args = append(args, driverID)
+    }
+    disputes, err := loadDisputes(ctx, strings.Join(where, " AND "), args...)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, disputes)
+}
+
+func getDispute(c *gin.Context) {
+    id := c.Param("id")
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    disputes, err := loadDisputes(ctx, `dispute_id=?`, id)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    if len(disputes) == 0 {
+        c.JSON(http.StatusNotFound, APIError{Message: "dispute not found"})
+        return
+    }
+    c.JSON(http.StatusOK, disputes[0])
+}
+
+func openDispute(c *gin.Context) {
+    eventID := atoi(c.Param("id"))
+    var body OpenDisputeRequest
+    if err := c.ShouldBindJSON(&body); err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    if strings.TrimSpace(body.Reason) == "" || strings.TrimSpace(body.OpenedBy) == "" {
+        c.JSON(http.StatusBadRequest, APIError{Message: "reason and opened_by are required"})
+        return
+    }
+    if body.OpenedByRole != "driver" && body.OpenedByRole != "manager" {
+        c.JSON(http.StatusBadRequest, APIError{Message: "opened_by_role must be 'driver' or 'manager'"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    var disputeID int64
+    err := inTx(ctx, func(ctx context.Context) error {
+        // Lock the event row so two disputes can't be opened at once
+        var current sql.NullString
+        err := queryRow(ctx, `SELECT dispute_status FROM safety_events WHERE safety_event_id=? FOR UPDATE`, eventID).Scan(&current)
+        if err == sql.ErrNoRows {
+            c.JSON(http.StatusNotFound, APIError{Message: "safety event not found"})
+            return errAnswered
+        }
+        if err != nil {
+            return err
+        }
+        if current.Valid && current.String != "upheld" {
+            c.JSON(http.StatusConflict, APIError{Message: "safety event already has a dispute that is " + current.String})
+            return errAnswered
+        }
+
+        now := time.Now().In(localTZ)
+        res, err := exec(ctx, `
+            INSERT INTO safety_event_disputes (safety_event_id, reason, opened_by, opened_by_role, status, opened_at)
+            VALUES (?, ?, ?, ?, 'open', ?)`, eventID, body.Reason, body.OpenedBy, body.OpenedByRole, now)
+        if err != nil {
+            return err
+        }
+        disputeID, _ = res.LastInsertId()
+        if _, err := exec(ctx, `
+            INSERT INTO safety_event_dispute_transitions (dispute_id, from_status, to_status, actor, notes, changed_at)
+            VALUES (?, NULL, 'open', ?, ?, ?)`, disputeID, body.OpenedBy, body.Reason, now); err != nil {
+            return err
+        }
+        return setDisputeStatus(ctx, eventID, "open")
+    })
+    if txFailed(c, err) {
+        return
+    }
+
+    disputes, err := loadDisputes(ctx, `dispute_id=?`, disputeID)
+    if err != nil || len(disputes) == 0 {
+        c.JSON(http.StatusInternalServerError, APIError{Message: "dispute saved but could not be reloaded"})
+        return
+    }
+    c.JSON(http.StatusOK, disputes[0])
+}
+
+// POST /disputes/:id/transition {"status": "under_review|upheld|overturned", "reviewer": "...", "notes": "..."}
+func transitionDispute(c *gin.Context) {
+    id := atoi(c.Param("id"))
+    var body DisputeTransitionRequest
+    if err := c.ShouldBindJSON(&body); err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    if strings.TrimSpace(body.Reviewer) == "" {
+        c.JSON(http.StatusBadRequest, APIError{Message: "reviewer is required"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    err := inTx(ctx, func(ctx context.Context) error {
+        var (
+            from    string
+            eventID int
+        )
+        err := queryRow(ctx, `SELECT status, safety_event_id FROM safety_event_disputes WHERE dispute_id=? FOR UPDATE`, id).Scan(&from, &eventID)
+        if err == sql.ErrNoRows {
+            c.JSON(http.StatusNotFound, APIError{Message: "dispute not found"})
+            return errAnswered
+        }
+        if err != nil {
+            return err
+        }
+        if !canTransition(from, body.Status) {
+            c.JSON(http.StatusConflict, APIError{Message: "cannot move dispute from " + from + " to " + body.Status})
+            return errAnswered
+        }
+
+        now := time.Now().In(localTZ)
+        final := body.Status == "upheld" || body.Status == "overturned"
+        var resolvedAt, resolution any
+        if final {
+            resolvedAt, resolution = now, body.Notes
+        }
+        if _, err := exec(ctx, `
+            UPDATE safety_event_disputes
+            SET status=?, reviewer=?, resolution_notes=COALESCE(?, resolution_notes), resolved_at=?
+            WHERE dispute_id=?`, body.Status, body.Reviewer, resolution, resolvedAt, id); err != nil {
+            return err
+        }
+        if _, err := exec(ctx, `
+            INSERT INTO safety_event_dispute_transitions (dispute_id, from_status, to_status, actor, notes, changed_at)
+            VALUES (?, ?, ?, ?, ?, ?)`, id, from, body.Status, body.Reviewer, body.Notes, now); err != nil {
+            return err
+        }
+        return setDisputeStatus(ctx, eventID, body.Status)
+    })
+    if txFailed(c, err) {
+        return
+    }
+
+    disputes, err := loadDisputes(ctx, `dispute_id=?`, id)
+    if err != nil || len(disputes) == 0 {
+        c.JSON(http.StatusInternalServerError, APIError{Message: "dispute saved but could not be reloaded"})
+        return
+    }
+    c.JSON(http.StatusOK, disputes[0])
+}
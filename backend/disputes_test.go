@@ -0,0 +1,150 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/gin-gonic/gin"
+)
+
+var disputeCols = []string{"dispute_id", "safety_event_id", "reason", "opened_by", "opened_by_role", "status", "opened_at", "reviewer", "resolution_notes", "resolved_at"}
+
+var safetyEventCols = []string{"safety_event_id", "driver_id", "event_date", "category_id", "notes", "bonus_score", "p_i_score", "bonus_period", "dispute_status", "version"}
+
+// expectEventPublished expects event 12 of driver 3 to be reloaded with the new
+// dispute status and published to webhooks and /stream.
+func expectEventPublished(mock sqlmock.Sqlmock, status string) {
+    mock.ExpectQuery(`FROM safety_events WHERE safety_event_id=\?`).WithArgs(12).
+        WillReturnRows(sqlmock.NewRows(safetyEventCols).AddRow(12, 3, time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), 2, nil, 3, 1, true, status, 8))
+    mock.ExpectQuery(`FROM webhook_subscriptions`).WillReturnRows(sqlmock.NewRows([]string{"subscription_id", "event_types"}))
+    mock.ExpectExec(`INSERT INTO change_events`).WithArgs("safety_event.updated", 3, sqlmock.AnyArg(), sqlmock.AnyArg()).
+        WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+func TestCanTransition(t *testing.T) {
+    for _, tc := range []struct {
+        from, to string
+        ok       bool
+    }{
+        {"open", "under_review", true},
+        {"open", "upheld", true},
+        {"open", "overturned", true},
+        {"under_review", "upheld", true},
+        {"under_review", "overturned", true},
+        {"open", "open", false},
+        {"under_review", "open", false},
+        {"upheld", "under_review", false},
+        {"upheld", "overturned", false},
+        {"overturned", "open", false},
+        {"open", "closed", false},
+    } {
+        if got := canTransition(tc.from, tc.to); got != tc.ok {
+            t.Errorf("canTransition(%s, %s) = %v", tc.from, tc.to, got)
+        }
+    }
+}
+
+// testPost sends a JSON body to the router.
+func testPost(path, body string) *httptest.ResponseRecorder {
+    w := httptest.NewRecorder()
+    newRouter().ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+    return w
+}
+
+// Resolving a dispute records the transition, mirrors the status onto the event and
+// publishes the event with its new version, all in one transaction.
+func TestTransitionDisputeResolves(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+
+    opened, resolved := time.Date(2025, 6, 2, 15, 0, 0, 0, time.UTC), time.Date(2025, 6, 9, 15, 0, 0, 0, time.UTC)
+    mock.ExpectBegin()
+    mock.ExpectQuery(`SELECT status, safety_event_id FROM safety_event_disputes WHERE dispute_id=\? FOR UPDATE`).WithArgs(5).
+        WillReturnRows(sqlmock.NewRows([]string{"status", "safety_event_id"}).AddRow("under_review", 12))
+    mock.ExpectExec(`UPDATE safety_event_disputes`).WithArgs("upheld", "dana", "video confirms", sqlmock.AnyArg(), 5).
+        WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectExec(`INSERT INTO safety_event_dispute_transitions`).WithArgs(5, "under_review", "upheld", "dana", "video confirms", sqlmock.AnyArg()).
+        WillReturnResult(sqlmock.NewResult(3, 1))
+    mock.ExpectExec(`UPDATE safety_events SET dispute_status=\?`).WithArgs("upheld", 12).WillReturnResult(sqlmock.NewResult(0, 1))
+    expectEventPublished(mock, "upheld")
+    mock.ExpectCommit()
+    mock.ExpectQuery(`FROM safety_event_disputes WHERE dispute_id=\?`).WithArgs(5).
+        WillReturnRows(sqlmock.NewRows(disputeCols).AddRow(5, 12, "not me", "Ann", "driver", "upheld", opened, "dana", "video confirms", resolved))
+    mock.ExpectQuery(`FROM safety_event_dispute_transitions`).WithArgs(5).
+        WillReturnRows(sqlmock.NewRows([]string{"transition_id", "from_status", "to_status", "actor", "notes", "changed_at"}).
+            AddRow(1, nil, "open", "Ann", "not me", opened).
+            AddRow(3, "under_review", "upheld", "dana", "video confirms", resolved))
+
+    w := testPost("/api/disputes/5/transition", `{"status": "upheld", "reviewer": "dana", "notes": "video confirms"}`)
+    var d SafetyEventDispute
+    if err := json.Unmarshal(w.Body.Bytes(), &d); w.Code != http.StatusOK || err != nil {
+        t.Fatalf("transition = %d %s", w.Code, w.Body)
+    }
+    if d.Status != "upheld" || d.ResolvedAt == nil || len(d.Transitions) != 2 || *d.Transitions[1].FromStatus != "under_review" {
+        t.Errorf("dispute = %+v", d)
+    }
+}
+
+// Final states cannot be left; nothing is written.
+func TestTransitionDisputeFromFinal(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+
+    mock.ExpectBegin()
+    mock.ExpectQuery(`FROM safety_event_disputes WHERE dispute_id=\? FOR UPDATE`).WithArgs(5).
+        WillReturnRows(sqlmock.NewRows([]string{"status", "safety_event_id"}).AddRow("overturned", 12))
+    mock.ExpectRollback()
+
+    w := testPost("/api/disputes/5/transition", `{"status": "under_review", "reviewer": "dana"}`)
+    if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "cannot move dispute from overturned to under_review") {
+        t.Errorf("transition = %d %s", w.Code, w.Body)
+    }
+}
+
+// An event carries at most one live dispute.
+func TestOpenDisputeWhileOneIsLive(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+
+    mock.ExpectBegin()
+    mock.ExpectQuery(`SELECT dispute_status FROM safety_events WHERE safety_event_id=\? FOR UPDATE`).WithArgs(12).
+        WillReturnRows(sqlmock.NewRows([]string{"dispute_status"}).AddRow("under_review"))
+    mock.ExpectRollback()
+
+    w := testPost("/api/safety-events/12/disputes", `{"reason": "again", "opened_by": "Ann", "opened_by_role": "driver"}`)
+    if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "already has a dispute that is under_review") {
+        t.Errorf("open = %d %s", w.Code, w.Body)
+    }
+}
+
+func TestOpenDisputePublishesEvent(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+
+    opened := time.Date(2025, 6, 2, 15, 0, 0, 0, time.UTC)
+    mock.ExpectBegin()
+    mock.ExpectQuery(`SELECT dispute_status FROM safety_events WHERE safety_event_id=\? FOR UPDATE`).WithArgs(12).
+        WillReturnRows(sqlmock.NewRows([]string{"dispute_status"}).AddRow("upheld"))
+    mock.ExpectExec(`INSERT INTO safety_event_disputes`).WithArgs(12, "appeal", "Ann", "driver", sqlmock.AnyArg()).
+        WillReturnResult(sqlmock.NewResult(6, 1))
+    mock.ExpectExec(`INSERT INTO safety_event_dispute_transitions`).WithArgs(6, "Ann", "appeal", sqlmock.AnyArg()).
+        WillReturnResult(sqlmock.NewResult(7, 1))
+    mock.ExpectExec(`UPDATE safety_events SET dispute_status=\?`).WithArgs("open", 12).WillReturnResult(sqlmock.NewResult(0, 1))
+    expectEventPublished(mock, "open")
+    mock.ExpectCommit()
+    mock.ExpectQuery(`FROM safety_event_disputes WHERE dispute_id=\?`).WithArgs(6).
+        WillReturnRows(sqlmock.NewRows(disputeCols).AddRow(6, 12, "appeal", "Ann", "driver", "open", opened, nil, nil, nil))
+    mock.ExpectQuery(`FROM safety_event_dispute_transitions`).WithArgs(6).
+        WillReturnRows(sqlmock.NewRows([]string{"transition_id", "from_status", "to_status", "actor", "notes", "changed_at"}).
+            AddRow(7, nil, "open", "Ann", "appeal", opened))
+
+    w := testPost("/api/safety-events/12/disputes", `{"reason": "appeal", "opened_by": "Ann", "opened_by_role": "driver"}`)
+    if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"open"`) {
+        t.Errorf("open = %d %s", w.Code, w.Body)
+    }
+}
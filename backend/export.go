@@ -0,0 +1,556 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/csv"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/xuri/excelize/v2"
+)
+
+// Column kinds decide how a value is written: date cells in XLSX, plain text in CSV.
+const (
+    colText = iota
+    colInt
+    colNumber
+    colDate     // YYYY-MM-DD Winnipeg local date
+    colDateTime // YYYY-MM-DD HH:MM:SS Winnipeg local time
+    colBool
+)
+
+type exportColumn struct {
+    Header string
+    Kind   int
+    Width  float64 // XLSX column width; 0 uses the default
+}
+
+// tableExport describes a list endpoint's spreadsheet form. Select must return the
+// columns in order, with dates as DATE_FORMAT strings so no zone conversion applies.
+// colDateTime columns are selected as stored and shown in local time, like the JSON.
+type tableExport struct {
+    Name    string
+    Columns []exportColumn
+    Select  string
+    Filters func(c *gin.Context) (where []string, args []any, err error)
+    OrderBy string
+}
+
+// exportFormat returns "csv", "xlsx" or "" for the normal JSON response.
+func exportFormat(c *gin.Context) (string, error) {
+    switch f := strings.ToLower(c.Query("format")); f {
+    case "", "json":
+        return "", nil
+    case "csv", "xlsx":
+        return f, nil
+    default:
+        return "", fmt.Errorf("format must be json, csv or xlsx")
+    }
+}
+
+// exportable serves t when ?format=csv|xlsx is given and falls through to h otherwise.
+func exportable(h gin.HandlerFunc, t tableExport) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        format, err := exportFormat(c)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+            return
+        }
+        if format == "" {
+            h(c)
+            return
+        }
+        exportTable(c, format, t)
+    }
+}
+
+func exportTable(c *gin.Context, format string, t tableExport) {
+    var (
+        where []string
+        args  []any
+    )
+    if t.Filters != nil {
+        var err error
+        if where, args, err = t.Filters(c); err != nil {
+            c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+            return
+        }
+    }
+    q := t.Select
+    if len(where) > 0 {
+        q += ` WHERE ` + strings.Join(where, " AND ")
+    }
+    if t.OrderBy != "" {
+        q += ` ORDER BY ` + t.OrderBy
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Minute)
+    defer cancel()
+
+    rows, err := queryRows(ctx, q, args...)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    w, err := newTableWriter(c, format, t.Name, t.Columns)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    raw := make([]sql.NullString, len(t.Columns))
+    times := make([]sql.NullTime, len(t.Columns))
+    dest := make([]any, len(raw))
+    for i, col := range t.Columns {
+        dest[i] = &raw[i]
+        if col.Kind == colDateTime {
+            dest[i] = &times[i]
+        }
+    }
+    values := make([]any, len(raw))
+    for rows.Next() {
+        if err := rows.Scan(dest...); err != nil {
+            continue
+        }
+        for i, col := range t.Columns {
+            switch {
+            case col.Kind != colDateTime:
+                values[i] = exportValue(raw[i], col.Kind)
+            case times[i].Valid:
+                values[i] = times[i].Time.In(localTZ)
+            default:
+                values[i] = nil
+            }
+        }
+        if err := w.WriteRow(values); err != nil {
+            c.Error(err)
+            return
+        }
+    }
+    if err := w.Close(); err != nil {
+        c.Error(err)
+    }
+}
+
+// exportValue converts a database string into the Go value for its column kind.
+func exportValue(s sql.NullString, kind int) any {
+    if !s.Valid {
+        return nil
+    }
+    switch kind {
+    case colInt:
+        if n, err := strconv.ParseInt(s.String, 10, 64); err == nil {
+            return n
+        }
+    case colNumber:
+        if f, err := strconv.ParseFloat(s.String, 64); err == nil {
+            return f
+        }
+    case colDate:
+        if t, err := parseLocalDate(s.String); err == nil {
+            return t
+        }
+    case colBool:
+        return s.String == "1"
+    }
+    return s.String
+}
+
+// tableWriter streams rows to the response as CSV or XLSX.
+type tableWriter interface {
+    WriteRow(values []any) error
+    Close() error
+}
+
+func newTableWriter(c *gin.Context, format, name string, cols []exportColumn) (tableWriter, error) {
+    stamp := time.Now().In(localTZ).Format("20060102")
+    if format == "csv" {
+        c.Header("Content-Type", "text/csv; charset=utf-8")
+        c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.csv"`, name, stamp))
+        c.Status(http.StatusOK)
+        w := &csvTableWriter{w: csv.NewWriter(c.Writer), cols: cols}
+        header := make([]string, len(cols))
+        for i, col := range cols {
+            header[i] = col.Header
+        }
+        return w, w.w.Write(header)
+    }
+
+    f := excelize.NewFile()
+    sheet := name
+    if len(sheet) > 31 {
+        sheet = sheet[:31]
+    }
+    if err := f.SetSheetName("Sheet1", sheet); err != nil {
+        return nil, err
+    }
+    sw, err := f.NewStreamWriter(sheet)
+    if err != nil {
+        return nil, err
+    }
+    dateFmt, dateTimeFmt, numberFmt := "yyyy-mm-dd", "yyyy-mm-dd hh:mm", "0.##"
+    x := &xlsxTableWriter{c: c, f: f, sw: sw, cols: cols, row: 1,
+        filename: fmt.Sprintf("%s-%s.xlsx", name, stamp)}
+    if x.headerStyle, err = f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}}); err != nil {
+        return nil, err
+    }
+    if x.dateStyle, err = f.NewStyle(&excelize.Style{CustomNumFmt: &dateFmt}); err != nil {
+        return nil, err
+    }
+    if x.dateTimeStyle, err = f.NewStyle(&excelize.Style{CustomNumFmt: &dateTimeFmt}); err != nil {
+        return nil, err
+    }
+    if x.numberStyle, err = f.NewStyle(&excelize.Style{CustomNumFmt: &numberFmt}); err != nil {
+        return nil, err
+    }
+    for i, col := range cols {
+        width := col.Width
+        if width == 0 {
+            width = 14
+        }
+        if err := sw.SetColWidth(i+1, i+1, width); err != nil {
+            return nil, err
+        }
+    }
+    if err := sw.SetPanes(&excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+        return nil, err
+    }
+    header := make([]any, len(cols))
+    for i, col := range cols {
+        header[i] = excelize.Cell{StyleID: x.headerStyle, Value: col.Header}
+    }
+    return x, x.setRow(header)
+}
+
+// spreadsheetText prefixes a quote to text a spreadsheet would take for a formula
+// (=, +, -, @, tab or CR first), so a note like "=HYPERLINK(...)" stays text.
+func spreadsheetText(s string) string {
+    if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+        return "'" + s
+    }
+    return s
+}
+
+type csvTableWriter struct {
+    w    *csv.Writer
+    cols []exportColumn
+    n    int
+}
+
+func (t *csvTableWriter) WriteRow(values []any) error {
+    rec := make([]string, len(values))
+    for i, v := range values {
+        switch val := v.(type) {
+        case nil:
+        case time.Time:
+            if t.cols[i].Kind == colDateTime {
+                rec[i] = val.Format("2006-01-02 15:04:05")
+            } else {
+                rec[i] = val.Format(dateOnlyLayout)
+            }
+        case bool:
+            rec[i] = map[bool]string{true: "Yes", false: "No"}[val]
+        case float64:
+            rec[i] = strconv.FormatFloat(val, 'f', -1, 64)
+        case string:
+            rec[i] = spreadsheetText(val)
+        default:
+            rec[i] = fmt.Sprint(val)
+        }
+    }
+    if err := t.w.Write(rec); err != nil {
+        return err
+    }
+    // Flush periodically so large ranges reach the client as they are read
+    if t.n++; t.n%500 == 0 {
+        t.w.Flush()
+    }
+    return t.w.Error()
+}
+
+func (t *csvTableWriter) Close() error {
+    t.w.Flush()
+    return t.w.Error()
+}
+
+// xlsxTableWriter spools rows through excelize's stream writer (which keeps
+// memory flat by buffering to a temp file) and sends the workbook on Close.
+type xlsxTableWriter struct {
+    c        *gin.Context
+    f        *excelize.File
+    sw       *excelize.StreamWriter
+    cols     []exportColumn
+    row      int
+    filename string
+
+    headerStyle, dateStyle, dateTimeStyle, numberStyle int
+}
+
+func (t *xlsxTableWriter) setRow(values []any) error {
+    cell, err := excelize.CoordinatesToCellName(1, t.row)
+    if err != nil {
+        return err
+    }
+    t.row++
+    return t.sw.SetRow(cell, values)
+}
+
+func (t *xlsxTableWriter) WriteRow(values []any) error {
+    cells := make([]any, len(values))
+    for i, v := range values {
+        switch val := v.(type) {
+        case time.Time:
+            style := t.dateStyle
+            if t.cols[i].Kind == colDateTime {
+                style = t.dateTimeStyle
+            }
+            cells[i] = excelize.Cell{StyleID: style, Value: val}
+        case bool:
+            cells[i] = map[bool]string{true: "Yes", false: "No"}[val]
+        case float64:
+            cells[i] = excelize.Cell{StyleID: t.numberStyle, Value: val}
+        case string:
+            cells[i] = spreadsheetText(val)
+        default:
+            cells[i] = val
+        }
+    }
+    return t.setRow(cells)
+}
+
+func (t *xlsxTableWriter) Close() error {
+    defer t.f.Close()
+    if err := t.sw.Flush(); err != nil {
+        return err
+    }
+    t.c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+    t.c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, t.filename))
+    t.c.Status(http.StatusOK)
+    return t.f.Write(t.c.Writer)
+}
+
+// dateRangeFilter turns ?from=&to= into conditions on a DATE column.
+func dateRangeFilter(c *gin.Context, column string) (where []string, args []any, err error) {
+    for _, p := range []struct{ param, op string }{{"from", ">="}, {"to", "<="}} {
+        s := c.Query(p.param)
+        if s == "" {
+            continue
+        }
+        t, err := parseLocalDate(s)
+        if err != nil {
+            return nil, nil, fmt.Errorf("%s must be YYYY-MM-DD", p.param)
+        }
+        where = append(where, column+" "+p.op+" ?")
+        args = append(args, formatLocalDate(t))
+    }
+    return where, args, nil
+}
+
+// localDayRangeFilter turns ?from=&to= into conditions on a DATETIME column, from
+// the start of the from day to the end of the to day in local time.
+func localDayRangeFilter(c *gin.Context, column string) (where []string, args []any, err error) {
+    for _, p := range []struct {
+        param, op string
+        days      int
+    }{{"from", ">=", 0}, {"to", "<", 1}} {
+        s := c.Query(p.param)
+        if s == "" {
+            continue
+        }
+        t, err := parseLocalDate(s)
+        if err != nil {
+            return nil, nil, fmt.Errorf("%s must be YYYY-MM-DD", p.param)
+        }
+        where = append(where, column+" "+p.op+" ?")
+        args = append(args, t.AddDate(0, 0, p.days))
+    }
+    return where, args, nil
+}
+
+func eventFilters(c *gin.Context) ([]string, []any, error) {
+    where, args, err := dateRangeFilter(c, "e.event_date")
+    if err != nil {
+        return nil, nil, err
+    }
+    if id := c.Query("driverId"); id != "" {
+        where = append(where, "e.driver_id = ?")
+        args = append(args, id)
+    }
+    return where, args, nil
+}
+
+// --- Spreadsheet forms of the list endpoints ---
+
+var driversExport = tableExport{
+    Name: "drivers",
+    Columns: []exportColumn{
+        {"Driver Code", colText, 12}, {"First Name", colText, 18}, {"Last Name", colText, 18},
+        {"Driver Type", colText, 18}, {"Start Date", colDate, 12}, {"Truck Unit", colText, 12}, {"Active", colBool, 8},
+    },
+    Select: `SELECT d.driver_code, d.first_name, d.last_name, dt.driver_type, DATE_FORMAT(d.start_date, '%Y-%m-%d'), t.unit_number, d.active
+        FROM drivers d
+        LEFT JOIN driver_type dt ON dt.driver_type_id = d.driver_type_id
+        LEFT JOIN trucks t ON t.truck_id = d.truck_id`,
+    OrderBy: `d.last_name, d.first_name, d.driver_code`,
+}
+
+var trucksExport = tableExport{
+    Name: "trucks",
+    Columns: []exportColumn{
+        {"Unit Number", colText, 12}, {"Year", colInt, 8}, {"Status", colText, 12}, {"Assigned Driver", colText, 28},
+    },
+    Select: `SELECT t.unit_number, t.year, t.status,
+            (SELECT GROUP_CONCAT(CONCAT(d.first_name, ' ', d.last_name) ORDER BY d.last_name SEPARATOR ', ')
+             FROM drivers d WHERE d.truck_id = t.truck_id)
+        FROM trucks t`,
+    OrderBy: `t.unit_number`,
+}
+
+var safetyEventsExport = tableExport{
+    Name: "safety-events",
+    Columns: []exportColumn{
+        {"Date", colDate, 12}, {"Driver Code", colText, 12}, {"Driver", colText, 24}, {"Category Code", colText, 12},
+        {"Category", colText, 40}, {"Bonus Points", colInt, 12}, {"P&I Points", colInt, 10}, {"Bonus Period", colBool, 12},
+        {"Dispute Status", colText, 14}, {"Notes", colText, 40},
+    },
+    Select: `SELECT DATE_FORMAT(e.event_date, '%Y-%m-%d'), d.driver_code, CONCAT(d.first_name, ' ', d.last_name),
+            sc.code, sc.description, e.bonus_score, e.p_i_score, e.bonus_period, e.dispute_status, e.notes
+        FROM safety_events e
+        JOIN drivers d ON d.driver_id = e.driver_id
+        JOIN safety_categories sc ON sc.category_id = e.category_id`,
+    Filters: eventFilters,
+    OrderBy: `e.event_date, e.safety_event_id`,
+}
+
+var scorecardEventsExport = tableExport{
+    Name: "scorecard-events",
+    Columns: []exportColumn{
+        {"Date", colDate, 12}, {"Driver Code", colText, 12}, {"Driver", colText, 24}, {"Scorecard Category", colText, 16},
+        {"Item", colText, 40}, {"Stars", colInt, 8}, {"Notes", colText, 40},
+    },
+    Select: `SELECT DATE_FORMAT(e.event_date, '%Y-%m-%d'), d.driver_code, CONCAT(d.first_name, ' ', d.last_name),
+            sm.sc_category, sm.sc_description, e.sc_score, e.notes
+        FROM scorecard_events e
+        JOIN drivers d ON d.driver_id = e.driver_id
+        JOIN scorecard_metrics sm ON sm.sc_category_id = e.sc_category_id`,
+    Filters: eventFilters,
+    OrderBy: `e.event_date, e.scorecard_event_id`,
+}
+
+var truckHistoryExport = tableExport{
+    Name: "truck-history",
+    Columns: []exportColumn{
+        {"Date", colDateTime, 18}, {"Unit Number", colText, 12}, {"Type", colText, 14}, {"Driver", colText, 24}, {"Notes", colText, 50},
+    },
+    Select: `SELECT h.date, t.unit_number, h.type, CONCAT(d.first_name, ' ', d.last_name), h.notes
+        FROM truck_history h
+        JOIN trucks t ON t.truck_id = h.truck_id
+        LEFT JOIN drivers d ON d.driver_id = h.driver_id`,
+    Filters: func(c *gin.Context) ([]string, []any, error) {
+        where, args, err := localDayRangeFilter(c, "h.date")
+        if err != nil {
+            return nil, nil, err
+        }
+        return append(where, "h.truck_id = ?"), append(args, c.Param("id")), nil
+    },
+    OrderBy: `h.date DESC`,
+}
+
+// --- Spreadsheet forms of the reports ---
+
+// respondReport writes a report as JSON, or as a table when ?format=csv|xlsx.
+func respondReport(c *gin.Context, name string, v any) {
+    format, err := exportFormat(c)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    if format == "" {
+        c.JSON(http.StatusOK, v)
+        return
+    }
+    cols, rows := reportTable(v)
+    w, err := newTableWriter(c, format, name, cols)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    for _, r := range rows {
+        if err := w.WriteRow(r); err != nil {
+            c.Error(err)
+            return
+        }
+    }
+    if err := w.Close(); err != nil {
+        c.Error(err)
+    }
+}
+
+func reportTable(v any) ([]exportColumn, [][]any) {
+    var rows [][]any
+    switch r := v.(type) {
+    case ReportSeries:
+        cols := []exportColumn{{"Label", colText, 16}}
+        if len(r.Descriptions) > 0 {
+            cols = append(cols, exportColumn{"Description", colText, 40})
+        }
+        for _, s := range r.Series {
+            cols = append(cols, exportColumn{strings.ToUpper(s.Name[:1]) + s.Name[1:], colNumber, 10})
+        }
+        for i, label := range r.Labels {
+            row := []any{label}
+            if len(r.Descriptions) > 0 {
+                row = append(row, r.Descriptions[i])
+            }
+            for _, s := range r.Series {
+                row = append(row, s.Data[i])
+            }
+            rows = append(rows, row)
+        }
+        return cols, rows
+    case []TopOffender:
+        for _, o := range r {
+            rows = append(rows, []any{o.DriverCode, o.Name, o.DriverType, int64(o.Events), int64(o.Points)})
+        }
+        return []exportColumn{{"Driver Code", colText, 12}, {"Driver", colText, 24}, {"Driver Type", colText, 18}, {"Events", colInt, 8}, {"Points", colInt, 8}}, rows
+    case SafetyTrend:
+        for _, p := range []struct {
+            label string
+            t     PeriodTotals
+        }{{"Current", r.Current}, {"Prior", r.Prior}} {
+            from, _ := parseLocalDate(p.t.From)
+            to, _ := parseLocalDate(p.t.To)
+            rows = append(rows, []any{p.label, from, to, float64(p.t.Events), float64(p.t.Points)})
+        }
+        rows = append(rows, []any{"Change %", nil, nil, floatOrNil(r.EventsChangePct), floatOrNil(r.PointsChangePct)})
+        return []exportColumn{{"Period", colText, 10}, {"From", colDate, 12}, {"To", colDate, 12}, {"Events", colNumber, 10}, {"Points", colNumber, 10}}, rows
+    case InspectionReport:
+        passed, failed := r.ByLevel.Series[0].Data, r.ByLevel.Series[1].Data
+        for i, label := range r.ByLevel.Labels {
+            rows = append(rows, []any{label, passed[i], failed[i], passRate(passed[i], failed[i])})
+        }
+        rows = append(rows, []any{"All", float64(r.Passed), float64(r.Failed), floatOrNil(r.PassRate)})
+        return []exportColumn{{"Level", colText, 10}, {"Passed", colNumber, 10}, {"Failed", colNumber, 10}, {"Pass Rate %", colNumber, 12}}, rows
+    }
+    return []exportColumn{{"Value", colText, 40}}, [][]any{{fmt.Sprint(v)}}
+}
+
+func floatOrNil(f *float64) any {
+    if f == nil {
+        return nil
+    }
+    return *f
+}
+
+func passRate(passed, failed float64) any {
+    if passed+failed == 0 {
+        return nil
+    }
+    return float64(int(passed/(passed+failed)*1000+0.5)) / 10
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+    "encoding/csv"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/gin-gonic/gin"
+)
+
+// Truck history timestamps are stored in UTC; the export shows and filters them by
+// local day, the same as the JSON.
+func TestTruckHistoryExportLocalTime(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+    cdt := time.FixedZone("CDT", -5*3600)
+    localTZ = cdt
+
+    mock.ExpectQuery(`SELECT h.date, .+ WHERE h.date >= \? AND h.date < \? AND h.truck_id = \? ORDER BY h.date DESC`).
+        WithArgs(time.Date(2025, 5, 31, 0, 0, 0, 0, cdt), time.Date(2025, 6, 1, 0, 0, 0, 0, cdt), "7").
+        WillReturnRows(sqlmock.NewRows([]string{"date", "unit_number", "type", "driver", "notes"}).
+            AddRow(time.Date(2025, 6, 1, 3, 30, 0, 0, time.UTC), "T-07", "assignment", "Ann Able", "late shift"))
+    w := httptest.NewRecorder()
+    newRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/trucks/7/history?format=csv&from=2025-05-31&to=2025-05-31", nil))
+
+    want := "Date,Unit Number,Type,Driver,Notes\n2025-05-31 22:30:00,T-07,assignment,Ann Able,late shift\n"
+    if w.Code != http.StatusOK || w.Body.String() != want {
+        t.Errorf("export = %d %q, want %q", w.Code, w.Body, want)
+    }
+}
+
+// Text that a spreadsheet would evaluate is quoted; numbers, negative ones included, are not.
+func TestSpreadsheetText(t *testing.T) {
+    for in, want := range map[string]string{
+        "=1+2":        "'=1+2",
+        "+1 555 0100": "'+1 555 0100",
+        "-5 points":   "'-5 points",
+        "@SUM(A1)":    "'@SUM(A1)",
+        "late shift":  "late shift",
+        "":            "",
+    } {
+        if got := spreadsheetText(in); got != want {
+            t.Errorf("spreadsheetText(%q) = %q, want %q", in, got, want)
+        }
+    }
+
+    var b strings.Builder
+    w := &csvTableWriter{w: csv.NewWriter(&b), cols: []exportColumn{{"Notes", colText, 0}, {"Points", colInt, 0}}}
+    if err := w.WriteRow([]any{"=cmd|' /C calc'!A0", int64(-3)}); err != nil || w.Close() != nil {
+        t.Fatal(err)
+    }
+    if want := "'=cmd|' /C calc'!A0,-3\n"; b.String() != want {
+        t.Errorf("csv = %q, want %q", b.String(), want)
+    }
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "driver-safety-bonus/config"
+)
+
+// FileStore keeps binary objects (photos, scans, evidence) outside the database.
+// Keys are slash-separated relative paths such as "photos/driver-12/ab12.jpg".
+type FileStore interface {
+    Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+    Get(ctx context.Context, key string) (io.ReadCloser, FileInfo, error)
+    Delete(ctx context.Context, key string) error
+}
+
+type FileInfo struct {
+    Size        int64
+    ContentType string
+    ModTime     time.Time
+}
+
+var ErrFileNotFound = errors.New("file not found")
+
+var files FileStore
+
+// deleteStoredFiles removes files whose rows are gone. A failure is only logged:
+// a leftover file costs storage, while failing the request would not bring the
+// row back.
+func deleteStoredFiles(ctx context.Context, keys ...sql.NullString) {
+    for _, k := range keys {
+        if !k.Valid || k.String == "" {
+            continue
+        }
+        if err := files.Delete(ctx, k.String); err != nil {
+            slog.WarnContext(ctx, "failed removing stored file", "key", k.String, "err", err)
+        }
+    }
+}
+
+// newFileStore picks the implementation from FILESTORE_DRIVER ("local" or "s3").
+func newFileStore(cfg config.FileStore) (FileStore, error) {
+    switch driver := strings.ToLower(cfg.Driver); driver {
+    case "", "local":
+        return newLocalFileStore(cfg.Dir)
+    case "s3":
+        s := &s3FileStore{
+            endpoint:  strings.TrimRight(cfg.S3Endpoint, "/"),
+            bucket:    cfg.S3Bucket,
+            region:    cfg.S3Region,
+            accessKey: cfg.S3AccessKeyID,
+            secretKey: cfg.S3SecretAccessKey,
+            client:    &http.Client{Timeout: 60 * time.Second},
+        }
+        if s.endpoint == "" || s.bucket == "" || s.accessKey == "" || s.secretKey == "" {
+            return nil, errors.New("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required for FILESTORE_DRIVER=s3")
+        }
+        return s, nil
+    default:
+        return nil, fmt.Errorf("unknown FILESTORE_DRIVER %q", driver)
+    }
+}
+
+func validStoreKey(key string) bool {
+    if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+        return false
+    }
+    for _, part := range strings.Split(key, "/") {
+        if part == "" || part == "." || part == ".." {
+            return false
+        }
+    }
+    return true
+}
+
+// --- Local filesystem ---
+
+type localFileStore struct {
+    root string
+}
+
+func newLocalFileStore(root string) (*localFileStore, error) {
+    if err := os.MkdirAll(root, 0o755); err != nil {
+        return nil, err
+    }
+    return &localFileStore{root: root}, nil
+}
+
+func (s *localFileStore) path(key string) (string, error) {
+    if !validStoreKey(key) {
+        return "", fmt.Errorf("invalid file key %q", key)
+    }
+    return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+func (s *localFileStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+    p, err := s.path(key)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+        return err
+    }
+    // Write to a temp file first so readers never see a partial object
+    tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+    if _, err := io.Copy(tmp, r); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Close(); err != nil {
+        return err
+    }
+    return os.Rename(tmp.Name(), p)
+}
+
+func (s *localFileStore) Get(ctx context.Context, key string) (io.ReadCloser, FileInfo, error) {
+    p, err := s.path(key)
+    if err != nil {
+        return nil, FileInfo{}, err
+    }
+    f, err := os.Open(p)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, FileInfo{}, ErrFileNotFound
+    }
+    if err != nil {
+        return nil, FileInfo{}, err
+    }
+    st, err := f.Stat()
+    if err != nil {
+        f.Close()
+        return nil, FileInfo{}, err
+    }
+    return f, FileInfo{Size: st.Size(), ModTime: st.ModTime()}, nil
+}
+
+func (s *localFileStore) Delete(ctx context.Context, key string) error {
+    p, err := s.path(key)
+    if err != nil {
+        return err
+    }
+    if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+        return err
+    }
+    return nil
+}
+
+// --- S3-compatible (AWS S3, MinIO, ...) using path-style requests and SigV4 ---
+
+type s3FileStore struct {
+    endpoint  string
+    bucket    string
+    region    string
+    accessKey string
+    secretKey string
+    client    *http.Client
+}
+
+func (s *s3FileStore) objectURL(key string) string {
+    return s.endpoint + "/" + s3Escape(s.bucket) + "/" + s3EscapePath(key)
+}
+
+func (s *s3FileStore) do(ctx context.Context, method, key string, body io.Reader, size int64, contentType string) (*http.Response, error) {
+    if !validStoreKey(key) {
+        return nil, fmt.Errorf("invalid file key %q", key)
+    }
+    req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key), body)
+    if err != nil {
+        return nil, err
+    }
+    if body != nil {
+        req.ContentLength = size
+    }
+    if contentType != "" {
+        req.Header.Set("Content-Type", contentType)
+    }
+    s.sign(req, time.Now().UTC())
+    return s.client.Do(req)
+}
+
+func (s *s3FileStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+    if size < 0 {
+        // SigV4 with an unsigned payload still needs a Content-Length
+        buf, err := io.ReadAll(r)
+        if err != nil {
+            return err
+        }
+        r, size = bytes.NewReader(buf), int64(len(buf))
+    }
+    resp, err := s.do(ctx, http.MethodPut, key, r, size, contentType)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode/100 != 2 {
+        msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+        return fmt.Errorf("s3 put %s: %s: %s", key, resp.Status, strings.TrimSpace(string(msg)))
+    }
+    return nil
+}
+
+func (s *s3FileStore) Get(ctx context.Context, key string) (io.ReadCloser, FileInfo, error) {
+    resp, err := s.do(ctx, http.MethodGet, key, nil, 0, "")
+    if err != nil {
+        return nil, FileInfo{}, err
+    }
+    if resp.StatusCode == http.StatusNotFound {
+        resp.Body.Close()
+        return nil, FileInfo{}, ErrFileNotFound
+    }
+    if resp.StatusCode/100 != 2 {
+        resp.Body.Close()
+        return nil, FileInfo{}, fmt.Errorf("s3 get %s: %s", key, resp.Status)
+    }
+    info := FileInfo{Size: resp.ContentLength, ContentType: resp.Header.Get("Content-Type")}
+    if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+        info.ModTime = t
+    }
+    return resp.Body, info, nil
+}
+
+func (s *s3FileStore) Delete(ctx context.Context, key string) error {
+    resp, err := s.do(ctx, http.MethodDelete, key, nil, 0, "")
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+        return fmt.Errorf("s3 delete %s: %s", key, resp.Status)
+    }
+    return nil
+}
+
+// sign adds AWS Signature Version 4 headers. The payload is left unsigned so
+// uploads can be streamed without hashing them up front.
+func (s *s3FileStore) sign(req *http.Request, now time.Time) {
+    const payloadHash = "UNSIGNED-PAYLOAD"
+    amzDate := now.Format("20060102T150405Z")
+    day := now.Format("20060102")
+
+    req.Header.Set("X-Amz-Date", amzDate)
+    req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+    headers := map[string]string{
+        "host":                 req.URL.Host,
+        "x-amz-content-sha256": payloadHash,
+        "x-amz-date":           amzDate,
+    }
+    if ct := req.Header.Get("Content-Type"); ct != "" {
+        headers["content-type"] = ct
+    }
+    names := make([]string, 0, len(headers))
+    for k := range headers {
+        names = append(names, k)
+    }
+    sort.Strings(names)
+    var canonicalHeaders strings.Builder
+    for _, k := range names {
+        canonicalHeaders.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+    }
+    signedHeaders := strings.Join(names, ";")
+
+    canonicalRequest := strings.Join([]string{
+        req.Method,
+        req.URL.EscapedPath(),
+        canonicalQuery(req.URL.Query()),
+        canonicalHeaders.String(),
+        signedHeaders,
+        payloadHash,
+    }, "\n")
+
+    scope := day + "/" + s.region + "/s3/aws4_request"
+    crHash := sha256.Sum256([]byte(canonicalRequest))
+    stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(crHash[:])
+
+    key := hmacSHA256([]byte("AWS4"+s.secretKey), day)
+    key = hmacSHA256(key, s.region)
+    key = hmacSHA256(key, "s3")
+    key = hmacSHA256(key, "aws4_request")
+    signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+    req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+        s.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+    h := hmac.New(sha256.New, key)
+    h.Write([]byte(data))
+    return h.Sum(nil)
+}
+
+func canonicalQuery(v url.Values) string {
+    keys := make([]string, 0, len(v))
+    for k := range v {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    var parts []string
+    for _, k := range keys {
+        vals := append([]string(nil), v[k]...)
+        sort.Strings(vals)
+        for _, val := range vals {
+            parts = append(parts, s3Escape(k)+"="+s3Escape(val))
+        }
+    }
+    return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes everything except the RFC 3986 unreserved characters.
+func s3Escape(s string) string {
+    var b strings.Builder
+    for i := 0; i < len(s); i++ {
+        ch := s[i]
+        if ('A' <= ch && ch <= 'Z') || ('a' <= ch && ch <= 'z') || ('0' <= ch && ch <= '9') ||
+            ch == '-' || ch == '_' || ch == '.' || ch == '~' {
+            b.WriteByte(ch)
+            continue
+        }
+        b.WriteString("%" + strings.ToUpper(strconv.FormatInt(int64(ch)|0x100, 16)[1:]))
+    }
+    return b.String()
+}
+
+func s3EscapePath(key string) string {
+    parts := strings.Split(key, "/")
+    for i, p := range parts {
+        parts[i] = s3Escape(p)
+    }
+    return strings.Join(parts, "/")
+}
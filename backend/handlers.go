@@ -3,9 +3,11 @@ package main
 import (
     "context"
     "database/sql"
+    "errors"
     "fmt"
-    "log"
+    "log/slog"
     "net/http"
+    "slices"
     "strconv"
     "strings"
     "time"
@@ -31,14 +33,166 @@ func formatLocalDate(t time.Time) string {
     return t.In(localTZ).Format(dateOnlyLayout)
 }
 
+// queryRows, queryRow and exec run inside ctx's transaction when inTx started one.
 func queryRows(ctx context.Context, q string, args ...any) (*sql.Rows, error) {
+    if st := txFrom(ctx); st != nil {
+        return st.tx.QueryContext(ctx, q, args...)
+    }
     return db.QueryContext(ctx, q, args...)
 }
 
+func queryRow(ctx context.Context, q string, args ...any) *sql.Row {
+    if st := txFrom(ctx); st != nil {
+        return st.tx.QueryRowContext(ctx, q, args...)
+    }
+    return db.QueryRowContext(ctx, q, args...)
+}
+
 func exec(ctx context.Context, q string, args ...any) (sql.Result, error) {
+    if st := txFrom(ctx); st != nil {
+        return st.tx.ExecContext(ctx, q, args...)
+    }
     return db.ExecContext(ctx, q, args...)
 }
 
+// --- Transactions ---
+
+type txKey struct{}
+
+type txState struct {
+    tx       *sql.Tx
+    onCommit []func()
+}
+
+func txFrom(ctx context.Context) *txState {
+    st, _ := ctx.Value(txKey{}).(*txState)
+    return st
+}
+
+// inTx runs fn in one transaction: exec, queryRows and queryRow called with the ctx
+// it is given run inside it, so a write and the webhook deliveries and /stream
+// change it publishes commit or roll back together. Within another inTx, fn joins
+// the outer transaction.
+func inTx(ctx context.Context, fn func(ctx context.Context) error) error {
+    if txFrom(ctx) != nil {
+        return fn(ctx)
+    }
+    tx, err := db.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    st := &txState{tx: tx}
+    if err := fn(context.WithValue(ctx, txKey{}, st)); err != nil {
+        tx.Rollback()
+        return err
+    }
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    for _, f := range st.onCommit {
+        f()
+    }
+    return nil
+}
+
+// afterCommit runs f once ctx's transaction commits, or right away outside one;
+// workers are woken and stored files removed this way. f must not query through
+// ctx, whose transaction is finished by then.
+func afterCommit(ctx context.Context, f func()) {
+    if st := txFrom(ctx); st != nil {
+        st.onCommit = append(st.onCommit, f)
+        return
+    }
+    f()
+}
+
+// errAnswered ends an inTx whose fn has already written the response (404, 412):
+// the transaction rolls back and the handler writes nothing more.
+var errAnswered = errors.New("response already written")
+
+// txFailed answers an inTx error with a 500 unless fn already answered, and
+// reports whether the handler should stop.
+func txFailed(c *gin.Context, err error) bool {
+    if err == nil {
+        return false
+    }
+    if !errors.Is(err, errAnswered) {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+    }
+    return true
+}
+
+type rowScanner interface {
+    Scan(dest ...any) error
+}
+
+const driverColumns = `driver_id, driver_code, first_name, last_name, start_date, truck_id, driver_type_id, active, photo_etag, version`
+
+// scanDriver reads a row selected with driverColumns; base is the origin used for the photo URL.
+func scanDriver(row rowScanner, d *Driver, base string) error {
+    var (
+        startDateNullable sql.NullTime
+        truckIDNullable   sql.NullInt64
+        typeIDNullable    sql.NullInt64
+        active            bool
+        photoETag         sql.NullString
+    )
+    if err := row.Scan(&d.DriverID, &d.DriverCode, &d.FirstName, &d.LastName, &startDateNullable, &truckIDNullable, &typeIDNullable, &active, &photoETag, &d.Version); err != nil {
+        return err
+    }
+    if startDateNullable.Valid {
+        d.StartDate = formatLocalDate(startDateNullable.Time)
+    }
+    if truckIDNullable.Valid {
+        val := int(truckIDNullable.Int64)
+        d.TruckID = &val
+    }
+    if typeIDNullable.Valid {
+        val := int(typeIDNullable.Int64)
+        d.DriverTypeID = &val
+    }
+    d.Active = &active
+    d.ProfilePic = photoURL(base, d.DriverID, photoETag)
+    return nil
+}
+
+const safetyEventColumns = `safety_event_id, driver_id, event_date, category_id, notes, bonus_score, p_i_score, bonus_period, dispute_status, version`
+
+func scanSafetyEvent(row rowScanner, e *SafetyEvent) error {
+    var (
+        dateVal       time.Time
+        notesNullable sql.NullString
+        disputeStatus sql.NullString
+    )
+    if err := row.Scan(&e.SafetyEventID, &e.DriverID, &dateVal, &e.CategoryID, &notesNullable, &e.BonusScore, &e.PIScore, &e.BonusPeriod, &disputeStatus, &e.Version); err != nil {
+        return err
+    }
+    e.EventDate = formatLocalDate(dateVal)
+    e.Notes = notesNullable.String
+    if disputeStatus.Valid {
+        val := disputeStatus.String
+        e.DisputeStatus = &val
+    }
+    return nil
+}
+
+const truckColumns = `truck_id, unit_number, year, status, version`
+
+func scanTruck(row rowScanner, t *Truck) error {
+    return row.Scan(&t.TruckID, &t.UnitNumber, &t.Year, &t.Status, &t.Version)
+}
+
+const scoreCardEventColumns = `scorecard_event_id, driver_id, event_date, sc_category_id, sc_score, notes, version`
+
+func scanScoreCardEvent(row rowScanner, e *ScoreCardEvent) error {
+    var dateVal time.Time
+    if err := row.Scan(&e.ScorecardEventID, &e.DriverID, &dateVal, &e.ScCategoryID, &e.ScScore, &e.Notes, &e.Version); err != nil {
+        return err
+    }
+    e.EventDate = formatLocalDate(dateVal)
+    return nil
+}
+
 // --- Bootstrap ---
 func bootstrap(c *gin.Context) {
     ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
@@ -55,16 +209,16 @@ func bootstrap(c *gin.Context) {
     )
 
     // Trucks
-    rows, err := queryRows(ctx, `SELECT truck_id, unit_number, year, status FROM trucks`)
+    rows, err := queryRows(ctx, `SELECT `+truckColumns+` FROM trucks`)
     if err != nil {
-        log.Printf("Bootstrap error (trucks): %v", err)
+        slog.ErrorContext(ctx, "bootstrap query failed", "table", "trucks", "err", err)
         c.JSON(http.StatusInternalServerError, APIError{Message: "failed to fetch trucks data"})
         return
     }
     defer rows.Close()
     for rows.Next() {
         var t Truck
-        if err := rows.Scan(&t.TruckID, &t.UnitNumber, &t.Year, &t.Status); err == nil {
+        if err := scanTruck(rows, &t); err == nil {
             trucks = append(trucks, t)
         }
     }
@@ -73,7 +227,7 @@ func bootstrap(c *gin.Context) {
     // Driver types
     rows, err = queryRows(ctx, `SELECT driver_type_id, driver_type FROM driver_type`)
     if err != nil {
-        log.Printf("Bootstrap error (driver_types): %v", err)
+        slog.ErrorContext(ctx, "bootstrap query failed", "table", "driver_types", "err", err)
         c.JSON(http.StatusInternalServerError, APIError{Message: "failed to fetch driver types data"})
         return
     }
@@ -87,37 +241,17 @@ func bootstrap(c *gin.Context) {
     rows.Close()
 
     // Drivers
-    rows, err = queryRows(ctx, `SELECT driver_id, driver_code, first_name, last_name, start_date, truck_id, driver_type_id, profile_pic FROM drivers`)
+    rows, err = queryRows(ctx, `SELECT `+driverColumns+` FROM drivers`)
     if err != nil {
-        log.Printf("Bootstrap error (drivers): %v", err)
+        slog.ErrorContext(ctx, "bootstrap query failed", "table", "drivers", "err", err)
         c.JSON(http.StatusInternalServerError, APIError{Message: "failed to fetch drivers data"})
         return
     }
     defer rows.Close()
+    base := apiBaseURL(c)
     for rows.Next() {
-        var (
-            d                 Driver
-            startDateNullable sql.NullTime
-            truckIDNullable   sql.NullInt64
-            typeIDNullable    sql.NullInt64
-            picNullable       sql.NullString
-        )
-        if err := rows.Scan(&d.DriverID, &d.DriverCode, &d.FirstName, &d.LastName, &startDateNullable, &truckIDNullable, &typeIDNullable, &picNullable); err == nil {
-            if startDateNullable.Valid {
-                d.StartDate = formatLocalDate(startDateNullable.Time)
-            }
-            if truckIDNullable.Valid {
-                val := int(truckIDNullable.Int64)
-                d.TruckID = &val
-            }
-            if typeIDNullable.Valid {
-                val := int(typeIDNullable.Int64)
-                d.DriverTypeID = &val
-            }
-            if picNullable.Valid {
-                val := picNullable.String
-                d.ProfilePic = &val
-            }
+        var d Driver
+        if err := scanDriver(rows, &d, base); err == nil {
             drivers = append(drivers, d)
         }
     }
@@ -126,7 +260,7 @@ func bootstrap(c *gin.Context) {
     // Safety categories
     rows, err = queryRows(ctx, `SELECT category_id, code, description, scoring_system, p_i_score FROM safety_categories`)
     if err != nil {
-        log.Printf("Bootstrap error (safety_categories): %v", err)
+        slog.ErrorContext(ctx, "bootstrap query failed", "table", "safety_categories", "err", err)
         c.JSON(http.StatusInternalServerError, APIError{Message: "failed to fetch safety categories data"})
         return
     }
@@ -142,7 +276,7 @@ func bootstrap(c *gin.Context) {
     // Scorecard metrics
     rows, err = queryRows(ctx, `SELECT sc_category_id, sc_category, sc_description, driver_type_id FROM scorecard_metrics`)
     if err != nil {
-        log.Printf("Bootstrap error (scorecard_metrics): %v", err)
+        slog.ErrorContext(ctx, "bootstrap query failed", "table", "scorecard_metrics", "err", err)
         c.JSON(http.StatusInternalServerError, APIError{Message: "failed to fetch scorecard metrics data"})
         return
     }
@@ -163,40 +297,32 @@ func bootstrap(c *gin.Context) {
     rows.Close()
 
     // Safety events
-    rows, err = queryRows(ctx, `SELECT safety_event_id, driver_id, event_date, category_id, notes, bonus_score, p_i_score, bonus_period FROM safety_events`)
+    rows, err = queryRows(ctx, `SELECT `+safetyEventColumns+` FROM safety_events`)
     if err != nil {
-        log.Printf("Bootstrap error (safety_events): %v", err)
+        slog.ErrorContext(ctx, "bootstrap query failed", "table", "safety_events", "err", err)
         c.JSON(http.StatusInternalServerError, APIError{Message: "failed to fetch safety events data"})
         return
     }
     defer rows.Close()
     for rows.Next() {
-        var (
-            e       SafetyEvent
-            dateVal time.Time
-        )
-        if err := rows.Scan(&e.SafetyEventID, &e.DriverID, &dateVal, &e.CategoryID, &e.Notes, &e.BonusScore, &e.PIScore, &e.BonusPeriod); err == nil {
-            e.EventDate = formatLocalDate(dateVal)
+        var e SafetyEvent
+        if err := scanSafetyEvent(rows, &e); err == nil {
             safetyEvents = append(safetyEvents, e)
         }
     }
     rows.Close()
 
     // Scorecard events
-    rows, err = queryRows(ctx, `SELECT scorecard_event_id, driver_id, event_date, sc_category_id, sc_score, notes FROM scorecard_events`)
+    rows, err = queryRows(ctx, `SELECT `+scoreCardEventColumns+` FROM scorecard_events`)
     if err != nil {
-        log.Printf("Bootstrap error (scorecard_events): %v", err)
+        slog.ErrorContext(ctx, "bootstrap query failed", "table", "scorecard_events", "err", err)
         c.JSON(http.StatusInternalServerError, APIError{Message: "failed to fetch scorecard events data"})
         return
     }
     defer rows.Close()
     for rows.Next() {
-        var (
-            e       ScoreCardEvent
-            dateVal time.Time
-        )
-        if err := rows.Scan(&e.ScorecardEventID, &e.DriverID, &dateVal, &e.ScCategoryID, &e.ScScore, &e.Notes); err == nil {
-            e.EventDate = formatLocalDate(dateVal)
+        var e ScoreCardEvent
+        if err := scanScoreCardEvent(rows, &e); err == nil {
             scoreCardEvents = append(scoreCardEvents, e)
         }
     }
@@ -217,40 +343,20 @@ func getDrivers(c *gin.Context) {
     ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
     defer cancel()
 
-    rows, err := queryRows(ctx, `SELECT driver_id, driver_code, first_name, last_name, start_date, truck_id, driver_type_id, profile_pic FROM drivers`)
+    rows, err := queryRows(ctx, `SELECT `+driverColumns+` FROM drivers`)
     if err != nil {
         c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
         return
     }
     defer rows.Close()
 
+    base := apiBaseURL(c)
     var drivers []Driver
     for rows.Next() {
-        var (
-            d                 Driver
-            startDateNullable sql.NullTime
-            truckIDNullable   sql.NullInt64
-            typeIDNullable    sql.NullInt64
-            picNullable       sql.NullString
-        )
-        if err := rows.Scan(&d.DriverID, &d.DriverCode, &d.FirstName, &d.LastName, &startDateNullable, &truckIDNullable, &typeIDNullable, &picNullable); err != nil {
+        var d Driver
+        if err := scanDriver(rows, &d, base); err != nil {
             continue
         }
-        if startDateNullable.Valid {
-            d.StartDate = formatLocalDate(startDateNullable.Time)
-        }
-        if truckIDNullable.Valid {
-            val := int(truckIDNullable.Int64)
-            d.TruckID = &val
-        }
-        if typeIDNullable.Valid {
-            val := int(typeIDNullable.Int64)
-            d.DriverTypeID = &val
-        }
-        if picNullable.Valid {
-            val := picNullable.String
-            d.ProfilePic = &val
-        }
         drivers = append(drivers, d)
     }
     c.JSON(http.StatusOK, drivers)
@@ -263,7 +369,18 @@ func createDriver(c *gin.Context) {
         return
     }
 
-    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    // A base64 data URL in profile_pic (from the setup form) is moved to the file store
+    var photo []byte
+    if isDataURL(d.ProfilePic) {
+        data, err := decodeDataURL(*d.ProfilePic)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+            return
+        }
+        photo = data
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
     defer cancel()
 
     var startDate sql.NullString
@@ -273,69 +390,194 @@ func createDriver(c *gin.Context) {
         }
     }
 
-    res, err := exec(ctx, `
-        INSERT INTO drivers (driver_code, first_name, last_name, start_date, truck_id, driver_type_id, profile_pic)
-        VALUES (?, ?, ?, ?, ?, ?, ?)`,
-        d.DriverCode, d.FirstName, d.LastName, startDate, d.TruckID, d.DriverTypeID, d.ProfilePic,
-    )
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+    if d.Active == nil {
+        active := true
+        d.Active = &active
+    }
+
+    err := inTx(ctx, func(ctx context.Context) error {
+        res, err := exec(ctx, `
+            INSERT INTO drivers (driver_code, first_name, last_name, start_date, truck_id, driver_type_id, active)
+            VALUES (?, ?, ?, ?, ?, ?, ?)`,
+            d.DriverCode, d.FirstName, d.LastName, startDate, d.TruckID, d.DriverTypeID, *d.Active,
+        )
+        if err != nil {
+            return err
+        }
+        id, _ := res.LastInsertId()
+        d.DriverID = int(id)
+        d.Version = 1
+        d.ProfilePic = nil
+        if photo != nil {
+            etag, err := savePhoto(ctx, d.DriverID, photo)
+            if err != nil {
+                photoError(c, err)
+                return errAnswered
+            }
+            d.ProfilePic = photoURL(apiBaseURL(c), d.DriverID, sql.NullString{String: etag, Valid: true})
+            d.Version++
+        }
+        if err := publishEvent(ctx, "driver.created", d); err != nil {
+            return err
+        }
+        if d.TruckID != nil {
+            return publishEvent(ctx, "truck.assigned", gin.H{"truck_id": *d.TruckID, "driver_id": d.DriverID})
+        }
+        return nil
+    })
+    if txFailed(c, err) {
         return
     }
-    id, _ := res.LastInsertId()
-    d.DriverID = int(id)
+    setETag(c, d.Version)
     c.JSON(http.StatusOK, d)
 }
 
 func updateDriver(c *gin.Context) {
     id := atoi(c.Param("id"))
+    version, ok := ifMatchVersion(c)
+    if !ok {
+        return
+    }
     var d Driver
     if err := c.ShouldBindJSON(&d); err != nil {
         c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
         return
     }
 
-    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    var photo []byte
+    if isDataURL(d.ProfilePic) {
+        data, err := decodeDataURL(*d.ProfilePic)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+            return
+        }
+        photo = data
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
     defer cancel()
 
-    // 1. Fetch current truck_id to see if assignment changed
-    var currentTruckID *int
-    _ = db.QueryRowContext(ctx, "SELECT truck_id FROM drivers WHERE driver_id=?", id).Scan(&currentTruckID)
+    err := inTx(ctx, func(ctx context.Context) error {
+        // 1. Fetch current truck_id to see if assignment changed
+        var currentTruckID *int
+        _ = queryRow(ctx, "SELECT truck_id FROM drivers WHERE driver_id=?", id).Scan(&currentTruckID)
+
+        // 2. Update the Driver, unless someone else changed it since the client read it
+        res, err := exec(ctx, `
+            UPDATE drivers 
+            SET driver_code=?, first_name=?, last_name=?, start_date=?, truck_id=?, driver_type_id=?, active=COALESCE(?, active), version=version+1
+            WHERE driver_id=? AND (? = 0 OR version = ?)`,
+            d.DriverCode, d.FirstName, d.LastName, d.StartDate, d.TruckID, d.DriverTypeID, d.Active, id, version, version,
+        )
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, APIError{Message: "Update failed"})
+            return errAnswered
+        }
+        if n, _ := res.RowsAffected(); n == 0 {
+            writeMissed(c, "driver", func() (any, int, error) {
+                current, err := loadDriver(ctx, id, apiBaseURL(c))
+                return current, current.Version, err
+            })
+            return errAnswered
+        }
 
-    // 2. Update the Driver
-    _, err := exec(ctx, `
-        UPDATE drivers 
-        SET driver_code=?, first_name=?, last_name=?, start_date=?, truck_id=?, driver_type_id=?, profile_pic=?
-        WHERE driver_id=?`,
-        d.DriverCode, d.FirstName, d.LastName, d.StartDate, d.TruckID, d.DriverTypeID, d.ProfilePic, id,
-    )
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, APIError{Message: "Update failed"})
-        return
-    }
+        // 3. Photo: a data URL replaces it, an empty value removes it, the existing URL keeps it
+        switch {
+        case photo != nil:
+            _, err = savePhoto(ctx, id, photo)
+        case d.ProfilePic == nil || strings.TrimSpace(*d.ProfilePic) == "":
+            err = removePhoto(ctx, id)
+        }
+        if err != nil {
+            photoError(c, err)
+            return errAnswered
+        }
+        var (
+            photoETag sql.NullString
+            active    bool
+        )
+        _ = queryRow(ctx, "SELECT photo_etag, active, version FROM drivers WHERE driver_id=?", id).Scan(&photoETag, &active, &d.Version)
+        d.Active = &active
+        d.ProfilePic = photoURL(apiBaseURL(c), id, photoETag)
 
-    if currentTruckID != nil && (d.TruckID == nil || *currentTruckID != *d.TruckID) {
-        _, _ = exec(ctx, "UPDATE trucks SET status='available' WHERE truck_id=?", *currentTruckID)
-    }
+        if currentTruckID != nil && (d.TruckID == nil || *currentTruckID != *d.TruckID) {
+            _, _ = exec(ctx, "UPDATE trucks SET status='available', version=version+1 WHERE truck_id=?", *currentTruckID)
+        }
 
-    if d.TruckID != nil {
-        _, _ = exec(ctx, "UPDATE trucks SET status='assigned' WHERE truck_id=?", *d.TruckID)
-    }
+        if d.TruckID != nil {
+            _, _ = exec(ctx, "UPDATE trucks SET status='assigned', version=version+1 WHERE truck_id=? AND status<>'assigned'", *d.TruckID)
+        }
 
-    d.DriverID = id
+        d.DriverID = id
+        if err := publishEvent(ctx, "driver.updated", d); err != nil {
+            return err
+        }
+        if currentTruckID != nil && (d.TruckID == nil || *currentTruckID != *d.TruckID) {
+            if err := publishEvent(ctx, "truck.unassigned", gin.H{"truck_id": *currentTruckID, "driver_id": id}); err != nil {
+                return err
+            }
+        }
+        if d.TruckID != nil && (currentTruckID == nil || *currentTruckID != *d.TruckID) {
+            return publishEvent(ctx, "truck.assigned", gin.H{"truck_id": *d.TruckID, "driver_id": id})
+        }
+        return nil
+    })
+    if txFailed(c, err) {
+        return
+    }
+    setETag(c, d.Version)
     c.JSON(http.StatusOK, d)
 }
 
 func deleteDriver(c *gin.Context) {
     id := c.Param("id")
+    version, ok := ifMatchVersion(c)
+    if !ok {
+        return
+    }
     ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
     defer cancel()
 
-    _, err := exec(ctx, `DELETE FROM drivers WHERE driver_id=?`, id)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+    sums := attachmentSums(ctx, `se.driver_id=? OR sce.driver_id=?`, id, id)
+    err := inTx(ctx, func(ctx context.Context) error {
+        // The photo and, through the cascade, the credential scans go once the
+        // delete commits.
+        var photo, thumb sql.NullString
+        err := queryRow(ctx, `SELECT photo_key, photo_thumb_key FROM drivers WHERE driver_id=?`, id).Scan(&photo, &thumb)
+        if err != nil && err != sql.ErrNoRows {
+            return err
+        }
+        rows, err := queryRows(ctx, `SELECT file_key FROM driver_credentials WHERE driver_id=? AND file_key IS NOT NULL`, id)
+        if err != nil {
+            return err
+        }
+        keys := []sql.NullString{photo, thumb}
+        for rows.Next() {
+            var k sql.NullString
+            if err := rows.Scan(&k); err == nil {
+                keys = append(keys, k)
+            }
+        }
+        rows.Close()
+
+        res, err := exec(ctx, `DELETE FROM drivers WHERE driver_id=? AND (? = 0 OR version = ?)`, id, version, version)
+        if err != nil {
+            return err
+        }
+        if n, _ := res.RowsAffected(); n == 0 {
+            writeMissed(c, "driver", func() (any, int, error) {
+                current, err := loadDriver(ctx, atoi(id), apiBaseURL(c))
+                return current, current.Version, err
+            })
+            return errAnswered
+        }
+        afterCommit(ctx, func() { deleteStoredFiles(ctx, keys...) })
+        return publishEvent(ctx, "driver.deleted", gin.H{"driver_id": atoi(id)})
+    })
+    if txFailed(c, err) {
         return
     }
+    releaseAttachmentFiles(ctx, sums)
     c.Status(http.StatusNoContent)
 }
 
@@ -345,9 +587,9 @@ func getDriverStats(c *gin.Context) {
     ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
     defer cancel()
 
-    row := db.QueryRowContext(ctx, `
+    row := queryRow(ctx, `
         SELECT COUNT(*) AS eventCount,
-               COALESCE(SUM(bonus_score),0) AS totalBonus,
+               COALESCE(SUM(CASE WHEN dispute_status='overturned' THEN 0 ELSE bonus_score END),0) AS totalBonus,
                COALESCE(SUM(p_i_score),0) AS totalPI
         FROM safety_events WHERE driver_id=?`, id)
 
@@ -358,15 +600,24 @@ func getDriverStats(c *gin.Context) {
         return
     }
 
+    expired, blocking, err := countExpiredCredentials(ctx, id)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+
     status := "Good"
-    if totalBonus > 5 {
+    if totalBonus > conf.Thresholds.BonusWarningPoints {
         status = "Warning"
     }
     c.JSON(http.StatusOK, gin.H{
-        "eventCount":      count,
-        "totalBonusScore": totalBonus,
-        "totalPIScore":    totalPI,
-        "status":          status,
+        "eventCount":         count,
+        "totalBonusScore":    totalBonus,
+        "totalPIScore":       totalPI,
+        "status":             status,
+        "expiredCredentials": expired,
+        "credentialsExpired": expired > 0,
+        "bonusEligible":      blocking == 0,
     })
 }
 
@@ -449,7 +700,7 @@ func getTrucks(c *gin.Context) {
     ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
     defer cancel()
 
-    rows, err := queryRows(ctx, `SELECT truck_id, unit_number, year, status FROM trucks`)
+    rows, err := queryRows(ctx, `SELECT `+truckColumns+` FROM trucks`)
     if err != nil {
         c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
         return
@@ -459,7 +710,7 @@ func getTrucks(c *gin.Context) {
     var trucks []Truck
     for rows.Next() {
         var t Truck
-        if err := rows.Scan(&t.TruckID, &t.UnitNumber, &t.Year, &t.Status); err != nil {
+        if err := scanTruck(rows, &t); err != nil {
             continue
         }
         trucks = append(trucks, t)
@@ -476,18 +727,29 @@ func createTruck(c *gin.Context) {
     ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
     defer cancel()
 
-    res, err := exec(ctx, `INSERT INTO trucks (unit_number, year, status) VALUES (?, ?, ?)`, t.UnitNumber, t.Year, t.Status)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+    err := inTx(ctx, func(ctx context.Context) error {
+        res, err := exec(ctx, `INSERT INTO trucks (unit_number, year, status) VALUES (?, ?, ?)`, t.UnitNumber, t.Year, t.Status)
+        if err != nil {
+            return err
+        }
+        id, _ := res.LastInsertId()
+        t.TruckID = int(id)
+        t.Version = 1
+        return publishEvent(ctx, "truck.created", t)
+    })
+    if txFailed(c, err) {
         return
     }
-    id, _ := res.LastInsertId()
-    t.TruckID = int(id)
+    setETag(c, t.Version)
     c.JSON(http.StatusOK, t)
 }
 
 func updateTruck(c *gin.Context) {
     id := atoi(c.Param("id"))
+    version, ok := ifMatchVersion(c)
+    if !ok {
+        return
+    }
     var t Truck
     if err := c.ShouldBindJSON(&t); err != nil {
         c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
@@ -496,87 +758,129 @@ func updateTruck(c *gin.Context) {
     ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
     defer cancel()
 
-    _, err := exec(ctx, `UPDATE trucks SET unit_number=?, year=?, status=? WHERE truck_id=?`, t.UnitNumber, t.Year, t.Status, id)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+    err := inTx(ctx, func(ctx context.Context) error {
+        res, err := exec(ctx, `UPDATE trucks SET unit_number=?, year=?, status=?, version=version+1 WHERE truck_id=? AND (? = 0 OR version = ?)`,
+            t.UnitNumber, t.Year, t.Status, id, version, version)
+        if err != nil {
+            return err
+        }
+        if n, _ := res.RowsAffected(); n == 0 {
+            writeMissed(c, "truck", func() (any, int, error) {
+                current, err := loadTruck(ctx, id)
+                return current, current.Version, err
+            })
+            return errAnswered
+        }
+        t.TruckID = id
+        _ = queryRow(ctx, `SELECT version FROM trucks WHERE truck_id=?`, id).Scan(&t.Version)
+        return publishEvent(ctx, "truck.updated", t)
+    })
+    if txFailed(c, err) {
         return
     }
-    t.TruckID = id
+    setETag(c, t.Version)
     c.JSON(http.StatusOK, t)
 }
 
 func deleteTruck(c *gin.Context) {
     id := c.Param("id")
+    version, ok := ifMatchVersion(c)
+    if !ok {
+        return
+    }
     ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
     defer cancel()
 
-    // Unassign drivers
-    _, _ = exec(ctx, `UPDATE drivers SET truck_id=NULL WHERE truck_id=?`, id)
-    _, err := exec(ctx, `DELETE FROM trucks WHERE truck_id=?`, id)
+    // Check the version before unassigning anyone
+    current, err := loadTruck(ctx, atoi(id))
+    if err == sql.ErrNoRows {
+        c.JSON(http.StatusNotFound, APIError{Message: "truck not found"})
+        return
+    }
     if err != nil {
         c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
         return
     }
-    c.Status(http.StatusNoContent)
-}
+    if version != 0 && current.Version != version {
+        preconditionFailed(c, "truck", current, current.Version)
+        return
+    }
 
-type AssignTruckRequest struct {
-    TruckID *int `json:"truck_id"`
+    err = inTx(ctx, func(ctx context.Context) error {
+        // Unassign drivers
+        _, _ = exec(ctx, `UPDATE drivers SET truck_id=NULL, version=version+1 WHERE truck_id=?`, id)
+        res, err := exec(ctx, `DELETE FROM trucks WHERE truck_id=? AND version=?`, id, current.Version)
+        if err != nil {
+            return err
+        }
+        if n, _ := res.RowsAffected(); n > 0 {
+            return publishEvent(ctx, "truck.deleted", gin.H{"truck_id": atoi(id)})
+        }
+        return nil
+    })
+    if txFailed(c, err) {
+        return
+    }
+    c.Status(http.StatusNoContent)
 }
 
 func assignDriverToTruckHandler(c *gin.Context) {
     driverID := c.Param("id")
-    
-    var req struct {
-        TruckID *int `json:"truck_id"`
-    }
+
+    var req AssignTruckRequest
 
     if err := c.ShouldBindJSON(&req); err != nil {
         c.JSON(400, gin.H{"error": "Invalid request payload"})
         return
     }
 
-    tx, err := db.Begin()
-    if err != nil {
-        c.JSON(500, gin.H{"error": "Failed to start transaction"})
-        return
-    }
+    err := inTx(c.Request.Context(), func(ctx context.Context) error {
+        // A. Identify the driver's CURRENT truck before we change it
+        var oldTruckID sql.NullInt64
+        queryRow(ctx, "SELECT truck_id FROM drivers WHERE driver_id = ?", driverID).Scan(&oldTruckID)
 
-    // A. Identify the driver's CURRENT truck before we change it
-    var oldTruckID sql.NullInt64
-    tx.QueryRow("SELECT truck_id FROM drivers WHERE driver_id = ?", driverID).Scan(&oldTruckID)
+        // B. Update the Driver (sets truck_id to NULL if req.TruckID is nil)
+        if _, err := exec(ctx, "UPDATE drivers SET truck_id = ?, version = version + 1 WHERE driver_id = ?", req.TruckID, driverID); err != nil {
+            c.JSON(500, gin.H{"error": "Failed to update driver record"})
+            return errAnswered
+        }
 
-    // B. Update the Driver (sets truck_id to NULL if req.TruckID is nil)
-    _, err = tx.Exec("UPDATE drivers SET truck_id = ? WHERE driver_id = ?", req.TruckID, driverID)
-    if err != nil {
-        tx.Rollback()
-        c.JSON(500, gin.H{"error": "Failed to update driver record"})
-        return
-    }
+        // C. If a NEW truck was assigned, mark it as 'assigned' and log history
+        if req.TruckID != nil {
+            exec(ctx, "UPDATE trucks SET status = 'assigned', version = version + 1 WHERE truck_id = ?", *req.TruckID)
 
-    // C. If a NEW truck was assigned, mark it as 'assigned' and log history
-    if req.TruckID != nil {
-        tx.Exec("UPDATE trucks SET status = 'assigned' WHERE truck_id = ?", *req.TruckID)
-        
-        _, _ = tx.Exec(`INSERT INTO truck_history (truck_id, driver_id, type, notes, date) 
-                        VALUES (?, ?, 'assignment', ?, ?)`,
-            *req.TruckID, driverID, fmt.Sprintf("Driver %s assigned via Driver Setup", driverID), time.Now().In(localTZ))
-    }
+            _, _ = exec(ctx, `INSERT INTO truck_history (truck_id, driver_id, type, notes, date) 
+                            VALUES (?, ?, 'assignment', ?, ?)`,
+                *req.TruckID, driverID, fmt.Sprintf("Driver %s assigned via Driver Setup", driverID), time.Now().In(localTZ))
+        }
 
-    // D. If the driver HAD a truck and it's different from the new one, mark the OLD one as 'available' and log history
-    if oldTruckID.Valid {
-        isDifferent := req.TruckID == nil || int64(*req.TruckID) != oldTruckID.Int64
-        if isDifferent {
-            tx.Exec("UPDATE trucks SET status = 'available' WHERE truck_id = ?", oldTruckID.Int64)
-            
-            _, _ = tx.Exec(`INSERT INTO truck_history (truck_id, driver_id, type, notes, date) 
-                            VALUES (?, NULL, 'status_change', ?, ?)`,
-                oldTruckID.Int64, fmt.Sprintf("Driver %s unassigned or moved to another unit", driverID), time.Now().In(localTZ))
+        // D. If the driver HAD a truck and it's different from the new one, mark the OLD one as 'available' and log history
+        if oldTruckID.Valid {
+            isDifferent := req.TruckID == nil || int64(*req.TruckID) != oldTruckID.Int64
+            if isDifferent {
+                exec(ctx, "UPDATE trucks SET status = 'available', version = version + 1 WHERE truck_id = ?", oldTruckID.Int64)
+
+                _, _ = exec(ctx, `INSERT INTO truck_history (truck_id, driver_id, type, notes, date) 
+                                VALUES (?, NULL, 'status_change', ?, ?)`,
+                    oldTruckID.Int64, fmt.Sprintf("Driver %s unassigned or moved to another unit", driverID), time.Now().In(localTZ))
+            }
         }
-    }
 
-    if err := tx.Commit(); err != nil {
-        c.JSON(500, gin.H{"error": "Transaction commit failed"})
+        if oldTruckID.Valid && (req.TruckID == nil || int64(*req.TruckID) != oldTruckID.Int64) {
+            if err := publishEvent(ctx, "truck.unassigned", gin.H{"truck_id": oldTruckID.Int64, "driver_id": atoi(driverID)}); err != nil {
+                return err
+            }
+        }
+        if req.TruckID != nil && (!oldTruckID.Valid || int64(*req.TruckID) != oldTruckID.Int64) {
+            return publishEvent(ctx, "truck.assigned", gin.H{"truck_id": *req.TruckID, "driver_id": atoi(driverID)})
+        }
+        return nil
+    })
+    if errors.Is(err, errAnswered) {
+        return
+    }
+    if err != nil {
+        c.JSON(500, gin.H{"error": "Transaction failed"})
         return
     }
 
@@ -586,12 +890,10 @@ func assignDriverToTruckHandler(c *gin.Context) {
 func assignTruckToDriver(c *gin.Context) {
     // Get Truck ID from URL parameter /trucks/:id/assign-driver
     truckID := atoi(c.Param("id"))
-    
+
     // Updated struct tag to "driver_id" to match standard frontend naming
-    var body struct {
-        DriverID *int `json:"driver_id"` 
-    }
-    
+    var body AssignDriverRequest
+
     if err := c.ShouldBindJSON(&body); err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
@@ -600,60 +902,77 @@ func assignTruckToDriver(c *gin.Context) {
     ctx, cancel := context.WithTimeout(c.Request.Context(), 8*time.Second)
     defer cancel()
 
-    // 1. Clear any driver currently assigned to this truck
-    _, _ = exec(ctx, `UPDATE drivers SET truck_id=NULL WHERE truck_id=?`, truckID)
-
-    var updatedDriver *Driver
-    if body.DriverID != nil {
-        // 2. Link new driver to this truck
-        if _, err := exec(ctx, `UPDATE drivers SET truck_id=? WHERE driver_id=?`, truckID, *body.DriverID); err != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-            return
+    var (
+        updatedDriver *Driver
+        t             Truck
+    )
+    err := inTx(ctx, func(ctx context.Context) error {
+        var previous []int
+        if rows, err := queryRows(ctx, `SELECT driver_id FROM drivers WHERE truck_id=?`, truckID); err == nil {
+            for rows.Next() {
+                var id int
+                if rows.Scan(&id) == nil {
+                    previous = append(previous, id)
+                }
+            }
+            rows.Close()
         }
 
-        // 3. Fetch updated driver details to return to frontend
-        row := db.QueryRowContext(ctx, `SELECT driver_id, driver_code, first_name, last_name, start_date, truck_id, driver_type_id, profile_pic FROM drivers WHERE driver_id=?`, *body.DriverID)
-        var d Driver
-        var (
-            startDateNullable sql.NullTime
-            truckIDNullable   sql.NullInt64
-            typeIDNullable    sql.NullInt64
-            picNullable       sql.NullString
-        )
-        
-        if err := row.Scan(&d.DriverID, &d.DriverCode, &d.FirstName, &d.LastName, &startDateNullable, &truckIDNullable, &typeIDNullable, &picNullable); err == nil {
-            if startDateNullable.Valid { d.StartDate = formatLocalDate(startDateNullable.Time) }
-            if truckIDNullable.Valid { 
-                val := int(truckIDNullable.Int64)
-                d.TruckID = &val 
+        // 1. Clear any driver currently assigned to this truck
+        _, _ = exec(ctx, `UPDATE drivers SET truck_id=NULL, version=version+1 WHERE truck_id=?`, truckID)
+
+        if body.DriverID != nil {
+            // 2. Link new driver to this truck
+            if _, err := exec(ctx, `UPDATE drivers SET truck_id=?, version=version+1 WHERE driver_id=?`, truckID, *body.DriverID); err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+                return errAnswered
             }
-            if typeIDNullable.Valid {
-                val := int(typeIDNullable.Int64)
-                d.DriverTypeID = &val
+
+            // 3. Fetch updated driver details to return to frontend
+            row := queryRow(ctx, `SELECT `+driverColumns+` FROM drivers WHERE driver_id=?`, *body.DriverID)
+            var d Driver
+            if err := scanDriver(row, &d, apiBaseURL(c)); err == nil {
+                updatedDriver = &d
             }
-            if picNullable.Valid { d.ProfilePic = &picNullable.String }
-            updatedDriver = &d
+
+            // 4. Update Truck Status
+            _, _ = exec(ctx, `UPDATE trucks SET status='assigned', version=version+1 WHERE truck_id=?`, truckID)
+
+            // 5. Log History for assignment
+            _, _ = exec(ctx, `INSERT INTO truck_history (truck_id, driver_id, type, notes, date) 
+                             VALUES (?, ?, 'assignment', ?, ?)`,
+                truckID, body.DriverID, fmt.Sprintf("Assigned driver ID %d", *body.DriverID), time.Now().In(localTZ))
+        } else {
+            // 6. Handle Unassignment: No driver provided
+            _, _ = exec(ctx, `UPDATE trucks SET status='available', version=version+1 WHERE truck_id=?`, truckID)
+            _, _ = exec(ctx, `INSERT INTO truck_history (truck_id, driver_id, type, notes, date) 
+                             VALUES (?, NULL, 'status_change', 'Unassigned driver', ?)`,
+                truckID, time.Now().In(localTZ))
         }
 
-        // 4. Update Truck Status
-        _, _ = exec(ctx, `UPDATE trucks SET status='assigned' WHERE truck_id=?`, truckID)
+        // 7. Fetch updated truck details to return to frontend
+        row := queryRow(ctx, `SELECT `+truckColumns+` FROM trucks WHERE truck_id=?`, truckID)
+        if err := scanTruck(row, &t); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return errAnswered
+        }
 
-        // 5. Log History for assignment
-        _, _ = exec(ctx, `INSERT INTO truck_history (truck_id, driver_id, type, notes, date) 
-                         VALUES (?, ?, 'assignment', ?, ?)`,
-            truckID, body.DriverID, fmt.Sprintf("Assigned driver ID %d", *body.DriverID), time.Now().In(localTZ))
-    } else {
-        // 6. Handle Unassignment: No driver provided
-        _, _ = exec(ctx, `UPDATE trucks SET status='available' WHERE truck_id=?`, truckID)
-        _, _ = exec(ctx, `INSERT INTO truck_history (truck_id, driver_id, type, notes, date) 
-                         VALUES (?, NULL, 'status_change', 'Unassigned driver', ?)`,
-            truckID, time.Now().In(localTZ))
+        for _, id := range previous {
+            if body.DriverID == nil || *body.DriverID != id {
+                if err := publishEvent(ctx, "truck.unassigned", gin.H{"truck_id": truckID, "driver_id": id}); err != nil {
+                    return err
+                }
+            }
+        }
+        if body.DriverID != nil && !slices.Contains(previous, *body.DriverID) {
+            return publishEvent(ctx, "truck.assigned", gin.H{"truck_id": truckID, "driver_id": *body.DriverID})
+        }
+        return nil
+    })
+    if errors.Is(err, errAnswered) {
+        return
     }
-
-    // 7. Fetch updated truck details to return to frontend
-    row := db.QueryRowContext(ctx, `SELECT truck_id, unit_number, year, status FROM trucks WHERE truck_id=?`, truckID)
-    var t Truck
-    if err := row.Scan(&t.TruckID, &t.UnitNumber, &t.Year, &t.Status); err != nil {
+    if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
     }
@@ -877,7 +1196,7 @@ func getSafetyEvents(c *gin.Context) {
     ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
     defer cancel()
 
-    rows, err := queryRows(ctx, `SELECT safety_event_id, driver_id, event_date, category_id, notes, bonus_score, p_i_score, bonus_period FROM safety_events`)
+    rows, err := queryRows(ctx, `SELECT `+safetyEventColumns+` FROM safety_events`)
     if err != nil {
         c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
         return
@@ -886,14 +1205,10 @@ func getSafetyEvents(c *gin.Context) {
 
     var events []SafetyEvent
     for rows.Next() {
-        var (
-            e       SafetyEvent
-            dateVal time.Time
-        )
-        if err := rows.Scan(&e.SafetyEventID, &e.DriverID, &dateVal, &e.CategoryID, &e.Notes, &e.BonusScore, &e.PIScore, &e.BonusPeriod); err != nil {
+        var e SafetyEvent
+        if err := scanSafetyEvent(rows, &e); err != nil {
             continue
         }
-        e.EventDate = formatLocalDate(dateVal)
         events = append(events, e)
     }
     c.JSON(http.StatusOK, events)
@@ -914,21 +1229,36 @@ func createSafetyEvent(c *gin.Context) {
     ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
     defer cancel()
 
-    res, err := exec(ctx, `
-      INSERT INTO safety_events (driver_id, event_date, category_id, notes, bonus_score, p_i_score, bonus_period)
-      VALUES (?, ?, ?, ?, ?, ?, ?)`,
-        e.DriverID, formatLocalDate(t), e.CategoryID, e.Notes, e.BonusScore, e.PIScore, e.BonusPeriod)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+    before := driverRiskPoints(ctx, e.DriverID)
+    err = inTx(ctx, func(ctx context.Context) error {
+        res, err := exec(ctx, `
+          INSERT INTO safety_events (driver_id, event_date, category_id, notes, bonus_score, p_i_score, bonus_period)
+          VALUES (?, ?, ?, ?, ?, ?, ?)`,
+            e.DriverID, formatLocalDate(t), e.CategoryID, e.Notes, e.BonusScore, e.PIScore, e.BonusPeriod)
+        if err != nil {
+            return err
+        }
+        id, _ := res.LastInsertId()
+        e.SafetyEventID = int(id)
+        e.DisputeStatus = nil
+        e.EventDate = formatLocalDate(t)
+        e.Version = 1
+        return publishEvent(ctx, "safety_event.created", e)
+    })
+    if txFailed(c, err) {
         return
     }
-    id, _ := res.LastInsertId()
-    e.SafetyEventID = int(id)
+    setETag(c, e.Version)
+    notifySafetyEvent(ctx, e, before, true)
     c.JSON(http.StatusOK, e)
 }
 
 func updateSafetyEvent(c *gin.Context) {
     id := atoi(c.Param("id"))
+    version, ok := ifMatchVersion(c)
+    if !ok {
+        return
+    }
     var e SafetyEvent
     if err := c.ShouldBindJSON(&e); err != nil {
         c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
@@ -944,27 +1274,70 @@ func updateSafetyEvent(c *gin.Context) {
     ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
     defer cancel()
 
-    _, err = exec(ctx, `
-      UPDATE safety_events SET driver_id=?, event_date=?, category_id=?, notes=?, bonus_score=?, p_i_score=?, bonus_period=? WHERE safety_event_id=?`,
-        e.DriverID, formatLocalDate(t), e.CategoryID, e.Notes, e.BonusScore, e.PIScore, e.BonusPeriod, id)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+    before := driverRiskPoints(ctx, e.DriverID)
+    err = inTx(ctx, func(ctx context.Context) error {
+        res, err := exec(ctx, `
+          UPDATE safety_events SET driver_id=?, event_date=?, category_id=?, notes=?, bonus_score=?, p_i_score=?, bonus_period=?, version=version+1
+          WHERE safety_event_id=? AND (? = 0 OR version = ?)`,
+            e.DriverID, formatLocalDate(t), e.CategoryID, e.Notes, e.BonusScore, e.PIScore, e.BonusPeriod, id, version, version)
+        if err != nil {
+            return err
+        }
+        if n, _ := res.RowsAffected(); n == 0 {
+            writeMissed(c, "safety event", func() (any, int, error) {
+                current, err := loadSafetyEvent(ctx, id)
+                return current, current.Version, err
+            })
+            return errAnswered
+        }
+        e.SafetyEventID = id
+        // dispute_status is owned by the dispute workflow, not by event edits
+        e.DisputeStatus = nil
+        var disputeStatus sql.NullString
+        if err := queryRow(ctx, `SELECT dispute_status, version FROM safety_events WHERE safety_event_id=?`, id).Scan(&disputeStatus, &e.Version); err == nil && disputeStatus.Valid {
+            e.DisputeStatus = &disputeStatus.String
+        }
+        e.EventDate = formatLocalDate(t)
+        return publishEvent(ctx, "safety_event.updated", e)
+    })
+    if txFailed(c, err) {
         return
     }
-    e.SafetyEventID = id
+    setETag(c, e.Version)
+    notifySafetyEvent(ctx, e, before, false)
     c.JSON(http.StatusOK, e)
 }
 
 func deleteSafetyEvent(c *gin.Context) {
     id := c.Param("id")
+    version, ok := ifMatchVersion(c)
+    if !ok {
+        return
+    }
     ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
     defer cancel()
 
-    _, err := exec(ctx, `DELETE FROM safety_events WHERE safety_event_id=?`, id)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+    var driverID int
+    _ = queryRow(ctx, `SELECT driver_id FROM safety_events WHERE safety_event_id=?`, id).Scan(&driverID)
+    sums := attachmentSums(ctx, `a.safety_event_id=?`, id)
+    err := inTx(ctx, func(ctx context.Context) error {
+        res, err := exec(ctx, `DELETE FROM safety_events WHERE safety_event_id=? AND (? = 0 OR version = ?)`, id, version, version)
+        if err != nil {
+            return err
+        }
+        if n, _ := res.RowsAffected(); n == 0 {
+            writeMissed(c, "safety event", func() (any, int, error) {
+                current, err := loadSafetyEvent(ctx, atoi(id))
+                return current, current.Version, err
+            })
+            return errAnswered
+        }
+        return publishEvent(ctx, "safety_event.deleted", gin.H{"safety_event_id": atoi(id), "driver_id": driverID})
+    })
+    if txFailed(c, err) {
         return
     }
+    releaseAttachmentFiles(ctx, sums)
     c.Status(http.StatusNoContent)
 }
 
@@ -974,7 +1347,7 @@ func getScoreCardEvents(c *gin.Context) {
     ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
     defer cancel()
 
-    rows, err := queryRows(ctx, `SELECT scorecard_event_id, driver_id, event_date, sc_category_id, sc_score, notes FROM scorecard_events`)
+    rows, err := queryRows(ctx, `SELECT `+scoreCardEventColumns+` FROM scorecard_events`)
     if err != nil {
         c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
         return
@@ -983,14 +1356,10 @@ func getScoreCardEvents(c *gin.Context) {
 
     var events []ScoreCardEvent
     for rows.Next() {
-        var (
-            e       ScoreCardEvent
-            dateVal time.Time
-        )
-        if err := rows.Scan(&e.ScorecardEventID, &e.DriverID, &dateVal, &e.ScCategoryID, &e.ScScore, &e.Notes); err != nil {
+        var e ScoreCardEvent
+        if err := scanScoreCardEvent(rows, &e); err != nil {
             continue
         }
-        e.EventDate = formatLocalDate(dateVal)
         events = append(events, e)
     }
     c.JSON(http.StatusOK, events)
@@ -1011,21 +1380,33 @@ func createScoreCardEvent(c *gin.Context) {
     ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
     defer cancel()
 
-    res, err := exec(ctx, `
-      INSERT INTO scorecard_events (driver_id, event_date, sc_category_id, sc_score, notes)
-      VALUES (?, ?, ?, ?, ?)`,
-        e.DriverID, formatLocalDate(t), e.ScCategoryID, e.ScScore, e.Notes)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+    err = inTx(ctx, func(ctx context.Context) error {
+        res, err := exec(ctx, `
+          INSERT INTO scorecard_events (driver_id, event_date, sc_category_id, sc_score, notes)
+          VALUES (?, ?, ?, ?, ?)`,
+            e.DriverID, formatLocalDate(t), e.ScCategoryID, e.ScScore, e.Notes)
+        if err != nil {
+            return err
+        }
+        id, _ := res.LastInsertId()
+        e.ScorecardEventID = int(id)
+        e.EventDate = formatLocalDate(t)
+        e.Version = 1
+        return publishEvent(ctx, "scorecard_event.created", e)
+    })
+    if txFailed(c, err) {
         return
     }
-    id, _ := res.LastInsertId()
-    e.ScorecardEventID = int(id)
+    setETag(c, e.Version)
     c.JSON(http.StatusOK, e)
 }
 
 func updateScoreCardEvent(c *gin.Context) {
     id := atoi(c.Param("id"))
+    version, ok := ifMatchVersion(c)
+    if !ok {
+        return
+    }
     var e ScoreCardEvent
     if err := c.ShouldBindJSON(&e); err != nil {
         c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
@@ -1040,27 +1421,63 @@ func updateScoreCardEvent(c *gin.Context) {
     ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
     defer cancel()
 
-    _, err = exec(ctx, `
-      UPDATE scorecard_events SET driver_id=?, event_date=?, sc_category_id=?, sc_score=?, notes=? WHERE scorecard_event_id=?`,
-        e.DriverID, formatLocalDate(t), e.ScCategoryID, e.ScScore, e.Notes, id)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+    err = inTx(ctx, func(ctx context.Context) error {
+        res, err := exec(ctx, `
+          UPDATE scorecard_events SET driver_id=?, event_date=?, sc_category_id=?, sc_score=?, notes=?, version=version+1
+          WHERE scorecard_event_id=? AND (? = 0 OR version = ?)`,
+            e.DriverID, formatLocalDate(t), e.ScCategoryID, e.ScScore, e.Notes, id, version, version)
+        if err != nil {
+            return err
+        }
+        if n, _ := res.RowsAffected(); n == 0 {
+            writeMissed(c, "scorecard event", func() (any, int, error) {
+                current, err := loadScoreCardEvent(ctx, id)
+                return current, current.Version, err
+            })
+            return errAnswered
+        }
+        e.ScorecardEventID = id
+        e.EventDate = formatLocalDate(t)
+        _ = queryRow(ctx, `SELECT version FROM scorecard_events WHERE scorecard_event_id=?`, id).Scan(&e.Version)
+        return publishEvent(ctx, "scorecard_event.updated", e)
+    })
+    if txFailed(c, err) {
         return
     }
-    e.ScorecardEventID = id
+    setETag(c, e.Version)
     c.JSON(http.StatusOK, e)
 }
 
 func deleteScoreCardEvent(c *gin.Context) {
     id := c.Param("id")
+    version, ok := ifMatchVersion(c)
+    if !ok {
+        return
+    }
     ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
     defer cancel()
 
-    _, err := exec(ctx, `DELETE FROM scorecard_events WHERE scorecard_event_id=?`, id)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+    var driverID int
+    _ = queryRow(ctx, `SELECT driver_id FROM scorecard_events WHERE scorecard_event_id=?`, id).Scan(&driverID)
+    sums := attachmentSums(ctx, `a.scorecard_event_id=?`, id)
+    err := inTx(ctx, func(ctx context.Context) error {
+        res, err := exec(ctx, `DELETE FROM scorecard_events WHERE scorecard_event_id=? AND (? = 0 OR version = ?)`, id, version, version)
+        if err != nil {
+            return err
+        }
+        if n, _ := res.RowsAffected(); n == 0 {
+            writeMissed(c, "scorecard event", func() (any, int, error) {
+                current, err := loadScoreCardEvent(ctx, atoi(id))
+                return current, current.Version, err
+            })
+            return errAnswered
+        }
+        return publishEvent(ctx, "scorecard_event.deleted", gin.H{"scorecard_event_id": atoi(id), "driver_id": driverID})
+    })
+    if txFailed(c, err) {
         return
     }
+    releaseAttachmentFiles(ctx, sums)
     c.Status(http.StatusNoContent)
 }
 
@@ -1106,67 +1523,31 @@ func deleteScoreCardEventsByFilter(c *gin.Context) {
         args = append(args, id)
     }
 
-    _, err = exec(ctx, fmt.Sprintf(`DELETE FROM scorecard_events WHERE driver_id=? AND event_date LIKE ? AND sc_category_id IN (%s)`, in), args...)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+    sums := attachmentSums(ctx, fmt.Sprintf(`sce.driver_id=? AND sce.event_date LIKE ? AND sce.sc_category_id IN (%s)`, in), args...)
+    err = inTx(ctx, func(ctx context.Context) error {
+        var deleted []int
+        if rows, err := queryRows(ctx, fmt.Sprintf(`SELECT scorecard_event_id FROM scorecard_events WHERE driver_id=? AND event_date LIKE ? AND sc_category_id IN (%s) FOR UPDATE`, in), args...); err == nil {
+            for rows.Next() {
+                var id int
+                if rows.Scan(&id) == nil {
+                    deleted = append(deleted, id)
+                }
+            }
+            rows.Close()
+        }
+        if _, err := exec(ctx, fmt.Sprintf(`DELETE FROM scorecard_events WHERE driver_id=? AND event_date LIKE ? AND sc_category_id IN (%s)`, in), args...); err != nil {
+            return err
+        }
+        for _, id := range deleted {
+            if err := publishEvent(ctx, "scorecard_event.deleted", gin.H{"scorecard_event_id": id, "driver_id": atoi(driverID)}); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    if txFailed(c, err) {
         return
     }
+    releaseAttachmentFiles(ctx, sums)
     c.Status(http.StatusNoContent)
 }
-
-// --- OpenAPI + Swagger ---
-
-func serveOpenAPI(c *gin.Context) {
-    // Minimal spec to visualize routes in Swagger UI; extend as needed.
-    openapi := `{
-  "openapi": "3.0.3",
-  "info": { "title": "DriverSafetyBonus API", "version": "1.0.0" },
-  "servers": [{ "url": "/api" }],
-  "paths": {
-    "/healthz": { "get": { "summary": "Healthcheck" } },
-    "/bootstrap": { "get": { "summary": "Initial data bootstrap" } },
-    "/drivers": { "get": { "summary": "List drivers" }, "post": { "summary": "Create driver" } },
-    "/drivers/{id}": { "put": { "summary": "Update driver" }, "delete": { "summary": "Delete driver" } },
-    "/drivers/{id}/stats": { "get": { "summary": "Driver stats" } },
-    "/driver-types": { "get": { "summary": "List driver types" }, "post": { "summary": "Create driver type" } },
-    "/driver-types/{id}": { "put": { "summary": "Update driver type" }, "delete": { "summary": "Delete driver type" } },
-    "/trucks": { "get": { "summary": "List trucks" }, "post": { "summary": "Create truck" } },
-    "/trucks/{id}": { "put": { "summary": "Update truck" }, "delete": { "summary": "Delete truck" } },
-    "/trucks/{id}/history": { "get": { "summary": "Truck history" } },
-    "/trucks/{id}/assign-driver": { "post": { "summary": "Assign driver to truck" } },
-    "/safety-categories": { "get": { "summary": "List safety categories" }, "post": { "summary": "Create safety category" } },
-    "/safety-categories/{id}": { "put": { "summary": "Update safety category" }, "delete": { "summary": "Delete safety category" } },
-    "/scorecard-metrics": { "get": { "summary": "List scorecard metrics" }, "post": { "summary": "Create scorecard metric" } },
-    "/scorecard-metrics/{id}": { "put": { "summary": "Update scorecard metric" }, "delete": { "summary": "Delete scorecard metric" } },
-    "/safety-events": { "get": { "summary": "List safety events" }, "post": { "summary": "Create safety event" } },
-    "/safety-events/{id}": { "put": { "summary": "Update safety event" }, "delete": { "summary": "Delete safety event" } },
-    "/scorecard-events": { "get": { "summary": "List scorecard events" }, "post": { "summary": "Create scorecard event" }, "delete": { "summary": "Bulk delete scorecard events by filter" } },
-    "/scorecard-events/{id}": { "put": { "summary": "Update scorecard event" }, "delete": { "summary": "Delete scorecard event" } }
-  }
-}`
-    c.Data(http.StatusOK, "application/json; charset=utf-8", []byte(openapi))
-}
-
-func serveSwaggerUI(c *gin.Context) {
-    html := `<!doctype html>
-<html>
-<head>
-  <meta charset="utf-8"/>
-  <title>DriverSafetyBonus API Docs</title>
-  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5.17.14/swagger-ui.css"/>
-</head>
-<body>
-<div id="swagger-ui"></div>
-<script src="https://unpkg.com/swagger-ui-dist@5.17.14/swagger-ui-bundle.js"></script>
-<script>
-window.onload = () => {
-  SwaggerUIBundle({
-    url: '/openapi.json',
-    dom_id: '#swagger-ui'
-  });
-};
-</script>
-</body>
-</html>`
-    c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
-}
\ No newline at end of file
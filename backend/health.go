@@ -0,0 +1,146 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// --- Liveness and readiness ---
+//
+// /livez answers as long as the process serves HTTP; restart the container when it
+// stops. /readyz runs every dependency check and answers 503 when any fails, so a
+// load balancer or orchestrator stops sending traffic without restarting anything.
+
+const readyCheckTimeout = 2 * time.Second
+
+type readyCheck struct {
+    name string
+    run  func(ctx context.Context) (detail string, err error)
+}
+
+var readyChecks = []readyCheck{
+    {"database", checkDatabase},
+    {"migrations", checkMigrations},
+    {"scheduler", checkScheduler},
+    {"filestore", checkFileStore},
+    {"outbox", checkOutbox},
+}
+
+// errSkipCheck marks a check that does not apply to this replica.
+var errSkipCheck = errors.New("skipped")
+
+// GET /livez
+func livez(c *gin.Context) {
+    c.JSON(http.StatusOK, HealthStatus{Status: "ok", Time: time.Now().In(localTZ).Format(time.RFC3339)})
+}
+
+// GET /readyz
+func readyz(c *gin.Context) {
+    res := Readiness{Status: "ready", Time: time.Now().In(localTZ).Format(time.RFC3339), Checks: map[string]HealthCheck{}}
+    var (
+        mu sync.Mutex
+        wg sync.WaitGroup
+    )
+    for _, rc := range readyChecks {
+        wg.Go(func() {
+            ctx, cancel := context.WithTimeout(c.Request.Context(), readyCheckTimeout)
+            defer cancel()
+            start := time.Now()
+            detail, err := rc.run(ctx)
+            hc := HealthCheck{Status: "ok", LatencyMs: millis(time.Since(start)), Detail: detail}
+            switch {
+            case err == errSkipCheck:
+                hc.Status = "skip"
+            case err != nil:
+                hc.Status, hc.Error = "fail", err.Error()
+            }
+            mu.Lock()
+            res.Checks[rc.name] = hc
+            mu.Unlock()
+        })
+    }
+    wg.Wait()
+    if shuttingDown.Load() {
+        res.Checks["server"] = HealthCheck{Status: "fail", Error: "shutting down"}
+    }
+
+    status := http.StatusOK
+    for _, hc := range res.Checks {
+        if hc.Status == "fail" {
+            res.Status, status = "unavailable", http.StatusServiceUnavailable
+        }
+    }
+    c.JSON(status, res)
+}
+
+func checkDatabase(ctx context.Context) (string, error) {
+    if err := db.PingContext(ctx); err != nil {
+        return "", err
+    }
+    s := db.Stats()
+    return fmt.Sprintf("%d of %d connections in use", s.InUse, s.MaxOpenConnections), nil
+}
+
+// checkMigrations looks in information_schema for every table and column the
+// schema upgrades create, so a database changed or restored behind the API's back
+// shows up too.
+func checkMigrations(ctx context.Context) (string, error) {
+    missing, err := missingSchema(ctx)
+    if err != nil {
+        return "", err
+    }
+    if len(missing) > 0 {
+        names := make([]string, len(missing))
+        for i, o := range missing {
+            names[i] = o.String()
+        }
+        return "missing " + strings.Join(names, ", "), fmt.Errorf("%d of %d upgraded tables and columns missing", len(missing), len(expectedSchema()))
+    }
+    return fmt.Sprintf("%d upgraded tables and columns present", len(expectedSchema())), nil
+}
+
+func checkScheduler(context.Context) (string, error) {
+    if !conf.Jobs.Enabled {
+        return "JOBS_ENABLED=false", errSkipCheck
+    }
+    if !schedulerRunning.Load() {
+        return "", fmt.Errorf("scheduler not running")
+    }
+    return fmt.Sprintf("%d jobs scheduled", len(scheduledJobs)), nil
+}
+
+// checkFileStore writes and removes a small object under health/.
+func checkFileStore(ctx context.Context) (string, error) {
+    if files == nil {
+        return "", fmt.Errorf("file store not configured")
+    }
+    key := "health/" + strings.ReplaceAll(jobRunnerID, ":", "-")
+    body := time.Now().UTC().Format(time.RFC3339Nano)
+    if err := files.Put(ctx, key, strings.NewReader(body), int64(len(body)), "text/plain"); err != nil {
+        return "", fmt.Errorf("write: %w", err)
+    }
+    if err := files.Delete(ctx, key); err != nil {
+        return "", fmt.Errorf("delete: %w", err)
+    }
+    return "writable", nil
+}
+
+func checkOutbox(ctx context.Context) (string, error) {
+    limit := conf.Thresholds.ReadyOutboxMax
+    var backlog int
+    if err := queryRow(ctx, `SELECT COUNT(*) FROM notification_outbox WHERE status IN ('pending','sending')`).Scan(&backlog); err != nil {
+        return "", err
+    }
+    detail := fmt.Sprintf("%d messages waiting (limit %d)", backlog, limit)
+    if backlog > limit {
+        return detail, fmt.Errorf("outbox backlog above %d", limit)
+    }
+    return detail, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "slices"
+    "testing"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/gin-gonic/gin"
+)
+
+func TestReadyz(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+    withFileStore(t)
+    prevConf := conf
+    conf.Jobs.Enabled = true
+    conf.Thresholds.ReadyOutboxMax = 100
+    defer func() { conf = prevConf }()
+    router := newRouter()
+
+    // information_schema rows for the upgraded schema, less those in missing
+    schemaRows := func(missing ...string) *sqlmock.Rows {
+        rows := sqlmock.NewRows([]string{"table_name", "column_name"})
+        for _, o := range expectedSchema() {
+            if slices.Contains(missing, o.String()) {
+                continue
+            }
+            column := o.column
+            if column == "" {
+                column = "id"
+            }
+            rows.AddRow(o.table, column)
+        }
+        return rows
+    }
+    ready := func(backlog int, missing ...string) (int, Readiness) {
+        t.Helper()
+        mock.MatchExpectationsInOrder(false)
+        mock.ExpectPing()
+        mock.ExpectQuery(`FROM information_schema.columns`).WillReturnRows(schemaRows(missing...))
+        mock.ExpectQuery(`FROM notification_outbox`).WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(backlog))
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+        var res Readiness
+        if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+            t.Fatal(err)
+        }
+        return w.Code, res
+    }
+
+    // The scheduler is not running in tests
+    code, res := ready(3)
+    if code != http.StatusServiceUnavailable || res.Status != "unavailable" || res.Checks["scheduler"].Status != "fail" {
+        t.Errorf("status %d %+v, want 503 for the scheduler", code, res)
+    }
+    for _, name := range []string{"database", "migrations", "filestore", "outbox"} {
+        if res.Checks[name].Status != "ok" {
+            t.Errorf("%s check = %+v, want ok", name, res.Checks[name])
+        }
+    }
+
+    conf.Jobs.Enabled = false
+    if code, res := ready(3); code != http.StatusOK || res.Checks["scheduler"].Status != "skip" {
+        t.Errorf("status %d %+v, want 200 with the scheduler skipped", code, res)
+    }
+    if code, res := ready(101); code != http.StatusServiceUnavailable || res.Checks["outbox"].Status != "fail" {
+        t.Errorf("status %d %+v, want 503 for the outbox backlog", code, res)
+    }
+    // A table or column an upgrade adds is gone (e.g. a restore from an old dump)
+    code, res = ready(3, "safety_events.dispute_status", "change_events")
+    if hc := res.Checks["migrations"]; code != http.StatusServiceUnavailable || hc.Status != "fail" || hc.Detail != "missing safety_events.dispute_status, change_events" {
+        t.Errorf("status %d, migrations %+v, want 503 naming what is missing", code, hc)
+    }
+
+    w := httptest.NewRecorder()
+    router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+    if w.Code != http.StatusOK {
+        t.Errorf("/livez = %d", w.Code)
+    }
+}
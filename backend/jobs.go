@@ -0,0 +1,301 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "os"
+    "sort"
+    "strconv"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/go-sql-driver/mysql"
+    "github.com/robfig/cron/v3"
+)
+
+const (
+    // A replica holds a job's lease while running it; a crashed replica's lease
+    // lapses after this long and another may take over.
+    // JOB_TIMEOUT (config) must stay below it.
+    jobLeaseTTL = 30 * time.Minute
+)
+
+var (
+    errJobBusy       = errors.New("job is already running")
+    errJobSlotTaken  = errors.New("scheduled run already started by another replica")
+    errJobNotFound   = errors.New("job not found")
+    jobRunnerID      = jobRunnerName()
+    scheduledJobs    []*scheduledJob
+    scheduledJobByID = map[string]*scheduledJob{}
+    jobsRunning      sync.WaitGroup
+)
+
+// scheduledJob is a task run by the in-process scheduler. run receives the time
+// the run is for: the schedule slot, or now for a manual trigger.
+type scheduledJob struct {
+    name        string
+    description string
+    spec        string
+    schedule    cron.Schedule
+    run         func(ctx context.Context, at time.Time) (string, error)
+}
+
+func jobRunnerName() string {
+    host, _ := os.Hostname()
+    return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// registerJob adds a job; spec is a standard 5-field cron expression in Winnipeg time.
+func registerJob(name, spec, description string, run func(ctx context.Context, at time.Time) (string, error)) {
+    sched, err := cron.ParseStandard(spec)
+    if err != nil {
+        panic(fmt.Sprintf("job %s: %v", name, err))
+    }
+    j := &scheduledJob{name: name, description: description, spec: spec, schedule: sched, run: run}
+    scheduledJobs = append(scheduledJobs, j)
+    scheduledJobByID[name] = j
+}
+
+// schedulerRunning is true while runScheduler is, for /readyz.
+var schedulerRunning atomic.Bool
+
+// runScheduler fires jobs at their scheduled times until ctx is cancelled. Every
+// replica runs it; the slot uniqueness in job_runs and the lease decide who works.
+func runScheduler(ctx context.Context) {
+    schedulerRunning.Store(true)
+    defer schedulerRunning.Store(false)
+    next := make(map[*scheduledJob]time.Time, len(scheduledJobs))
+    now := time.Now().In(localTZ)
+    for _, j := range scheduledJobs {
+        next[j] = j.schedule.Next(now)
+    }
+    for {
+        var soonest time.Time
+        for _, t := range next {
+            if soonest.IsZero() || t.Before(soonest) {
+                soonest = t
+            }
+        }
+        if soonest.IsZero() {
+            return
+        }
+        timer := time.NewTimer(time.Until(soonest))
+        select {
+        case <-ctx.Done():
+            timer.Stop()
+            return
+        case <-timer.C:
+        }
+        now := time.Now().In(localTZ)
+        for _, j := range scheduledJobs {
+            slot := next[j]
+            if slot.After(now) {
+                continue
+            }
+            next[j] = j.schedule.Next(now)
+            if _, err := startJob(j, "schedule", slot); err != nil && err != errJobBusy && err != errJobSlotTaken {
+                slog.WarnContext(ctx, "job not started", "job", j.name, "err", err)
+            }
+        }
+    }
+}
+
+// startJob takes the job's lease and records the run, then runs it in the background.
+func startJob(j *scheduledJob, trigger string, at time.Time) (int64, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    now := time.Now().In(localTZ)
+    if _, err := exec(ctx, `INSERT IGNORE INTO job_leases (job_name, holder, expires_at) VALUES (?, '', ?)`, j.name, now); err != nil {
+        return 0, err
+    }
+    res, err := exec(ctx, `
+        UPDATE job_leases SET holder=?, expires_at=?
+        WHERE job_name=? AND (expires_at <= ? OR holder='')`, jobRunnerID, now.Add(jobLeaseTTL), j.name, now)
+    if err != nil {
+        return 0, err
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        return 0, errJobBusy
+    }
+
+    var slot any
+    if trigger == "schedule" {
+        slot = at
+    }
+    res, err = exec(ctx, `
+        INSERT INTO job_runs (job_name, trigger_type, scheduled_for, started_at, status, runner)
+        VALUES (?, ?, ?, ?, 'running', ?)`, j.name, trigger, slot, now, jobRunnerID)
+    if err != nil {
+        releaseJobLease(j.name)
+        var me *mysql.MySQLError
+        if errors.As(err, &me) && me.Number == 1062 {
+            return 0, errJobSlotTaken
+        }
+        return 0, err
+    }
+    runID, _ := res.LastInsertId()
+
+    jobsRunning.Add(1)
+    go func() {
+        defer jobsRunning.Done()
+        defer releaseJobLease(j.name)
+        executeJob(j, runID, at)
+    }()
+    return runID, nil
+}
+
+func executeJob(j *scheduledJob, runID int64, at time.Time) {
+    ctx, cancel := context.WithTimeout(context.Background(), conf.Jobs.Timeout.Std())
+    defer cancel()
+
+    status := "succeeded"
+    msg, err := func() (msg string, err error) {
+        defer func() {
+            if r := recover(); r != nil {
+                err = fmt.Errorf("panic: %v", r)
+            }
+        }()
+        return j.run(ctx, at)
+    }()
+    if err != nil {
+        status, msg = "failed", err.Error()
+        slog.Warn("job failed", "job", j.name, "run_id", runID, "err", err)
+    }
+
+    done, cancelDone := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancelDone()
+    if _, err := exec(done, `UPDATE job_runs SET status=?, message=?, finished_at=? WHERE run_id=?`,
+        status, msg, time.Now().In(localTZ), runID); err != nil {
+        slog.Warn("job result not saved", "job", j.name, "run_id", runID, "err", err)
+    }
+}
+
+func releaseJobLease(name string) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+    if _, err := exec(ctx, `UPDATE job_leases SET holder='', expires_at=? WHERE job_name=? AND holder=?`,
+        time.Now().In(localTZ), name, jobRunnerID); err != nil {
+        slog.Warn("job lease not released", "job", name, "err", err)
+    }
+}
+
+const jobRunColumns = `run_id, job_name, trigger_type, scheduled_for, started_at, finished_at, status, COALESCE(message, ''), runner`
+
+func scanJobRun(row rowScanner, r *JobRun) error {
+    var (
+        scheduledFor sql.NullTime
+        startedAt    time.Time
+        finishedAt   sql.NullTime
+    )
+    if err := row.Scan(&r.RunID, &r.JobName, &r.Trigger, &scheduledFor, &startedAt, &finishedAt, &r.Status, &r.Message, &r.Runner); err != nil {
+        return err
+    }
+    r.StartedAt = startedAt.In(localTZ).Format(time.RFC3339)
+    if scheduledFor.Valid {
+        val := scheduledFor.Time.In(localTZ).Format(time.RFC3339)
+        r.ScheduledFor = &val
+    }
+    if finishedAt.Valid {
+        val := finishedAt.Time.In(localTZ).Format(time.RFC3339)
+        r.FinishedAt = &val
+    }
+    return nil
+}
+
+// --- Admin: jobs ---
+
+func getJobs(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    now := time.Now().In(localTZ)
+    out := make([]JobStatus, 0, len(scheduledJobs))
+    for _, j := range scheduledJobs {
+        st := JobStatus{Name: j.name, Description: j.description, Schedule: j.spec, NextRun: j.schedule.Next(now).Format(time.RFC3339)}
+
+        var holder string
+        var expires time.Time
+        err := queryRow(ctx, `SELECT holder, expires_at FROM job_leases WHERE job_name=?`, j.name).Scan(&holder, &expires)
+        if err == nil && holder != "" && expires.After(now) {
+            st.LeaseHolder = &holder
+        }
+
+        var last JobRun
+        err = scanJobRun(queryRow(ctx, `SELECT `+jobRunColumns+` FROM job_runs WHERE job_name=? ORDER BY started_at DESC, run_id DESC LIMIT 1`, j.name), &last)
+        if err == nil {
+            st.LastRun = &last
+        } else if err != sql.ErrNoRows {
+            c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+            return
+        }
+        out = append(out, st)
+    }
+    sort.Slice(out, func(a, b int) bool { return out[a].Name < out[b].Name })
+    c.JSON(http.StatusOK, out)
+}
+
+// GET /admin/jobs/:name/runs?limit=20
+func getJobRuns(c *gin.Context) {
+    name := c.Param("name")
+    if scheduledJobByID[name] == nil {
+        c.JSON(http.StatusNotFound, APIError{Message: errJobNotFound.Error()})
+        return
+    }
+    limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+    if err != nil || limit <= 0 || limit > 500 {
+        limit = 20
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    rows, err := queryRows(ctx, `SELECT `+jobRunColumns+` FROM job_runs WHERE job_name=? ORDER BY started_at DESC, run_id DESC LIMIT ?`, name, limit)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    runs := []JobRun{}
+    for rows.Next() {
+        var r JobRun
+        if err := scanJobRun(rows, &r); err != nil {
+            continue
+        }
+        runs = append(runs, r)
+    }
+    c.JSON(http.StatusOK, runs)
+}
+
+// POST /admin/jobs/:name/run starts the job now; poll /admin/jobs/:name/runs for the result.
+func triggerJob(c *gin.Context) {
+    j := scheduledJobByID[c.Param("name")]
+    if j == nil {
+        c.JSON(http.StatusNotFound, APIError{Message: errJobNotFound.Error()})
+        return
+    }
+    runID, err := startJob(j, "manual", time.Now().In(localTZ))
+    if err == errJobBusy {
+        c.JSON(http.StatusConflict, APIError{Message: err.Error()})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+    var r JobRun
+    if err := scanJobRun(queryRow(ctx, `SELECT `+jobRunColumns+` FROM job_runs WHERE run_id=?`, runID), &r); err != nil {
+        c.JSON(http.StatusAccepted, gin.H{"run_id": runID})
+        return
+    }
+    c.JSON(http.StatusAccepted, r)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "driver-safety-bonus/config"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/go-sql-driver/mysql"
+)
+
+// testJob is a job whose runs only count themselves.
+func testJob(runs *int) *scheduledJob {
+    return &scheduledJob{name: "test-job", run: func(ctx context.Context, at time.Time) (string, error) {
+        *runs++
+        return "ran", nil
+    }}
+}
+
+func expectLease(mock sqlmock.Sqlmock, taken bool) {
+    mock.ExpectExec(`INSERT IGNORE INTO job_leases`).WithArgs("test-job", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+    n := int64(1)
+    if taken {
+        n = 0
+    }
+    mock.ExpectExec(`UPDATE job_leases SET holder=\?, expires_at=\? WHERE job_name=\? AND \(expires_at <= \? OR holder=''\)`).
+        WithArgs(jobRunnerID, sqlmock.AnyArg(), "test-job", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, n))
+}
+
+func expectLeaseReleased(mock sqlmock.Sqlmock) {
+    mock.ExpectExec(`UPDATE job_leases SET holder='', expires_at=\? WHERE job_name=\? AND holder=\?`).
+        WithArgs(sqlmock.AnyArg(), "test-job", jobRunnerID).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// A job whose lease another replica holds is not started and nothing is recorded.
+func TestStartJobLeaseHeld(t *testing.T) {
+    mock := withMockDB(t)
+
+    runs := 0
+    expectLease(mock, true)
+    if _, err := startJob(testJob(&runs), "manual", time.Now()); err != errJobBusy {
+        t.Errorf("startJob = %v, want errJobBusy", err)
+    }
+    jobsRunning.Wait()
+    if runs != 0 {
+        t.Errorf("job ran %d times", runs)
+    }
+}
+
+// When another replica already recorded the scheduled slot, the lease is given back
+// and the job does not run again.
+func TestStartJobSlotTaken(t *testing.T) {
+    mock := withMockDB(t)
+
+    runs := 0
+    slot := time.Date(2025, 7, 1, 6, 0, 0, 0, time.UTC)
+    expectLease(mock, false)
+    mock.ExpectExec(`INSERT INTO job_runs`).WithArgs("test-job", "schedule", slot, sqlmock.AnyArg(), jobRunnerID).
+        WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+    expectLeaseReleased(mock)
+    if _, err := startJob(testJob(&runs), "schedule", slot); err != errJobSlotTaken {
+        t.Errorf("startJob = %v, want errJobSlotTaken", err)
+    }
+    jobsRunning.Wait()
+    if runs != 0 {
+        t.Errorf("job ran %d times", runs)
+    }
+}
+
+// A started job records its result and then releases the lease.
+func TestStartJobRunsAndReleases(t *testing.T) {
+    mock := withMockDB(t)
+    prevConf := conf
+    conf.Jobs.Timeout = config.Duration(time.Minute)
+    defer func() { conf = prevConf }()
+
+    runs := 0
+    expectLease(mock, false)
+    mock.ExpectExec(`INSERT INTO job_runs`).WithArgs("test-job", "manual", nil, sqlmock.AnyArg(), jobRunnerID).
+        WillReturnResult(sqlmock.NewResult(7, 1))
+    mock.ExpectExec(`UPDATE job_runs SET status=\?, message=\?, finished_at=\? WHERE run_id=\?`).
+        WithArgs("succeeded", "ran", sqlmock.AnyArg(), int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+    expectLeaseReleased(mock)
+
+    runID, err := startJob(testJob(&runs), "manual", time.Now())
+    jobsRunning.Wait()
+    if err != nil || runID != 7 || runs != 1 {
+        t.Errorf("startJob = %d, %v; ran %d times", runID, err, runs)
+    }
+}
+
+// The month's summaries are replaced in one transaction.
+func TestGenerateScorecardSummaries(t *testing.T) {
+    mock := withMockDB(t)
+
+    mock.ExpectBegin()
+    mock.ExpectExec(`DELETE FROM scorecard_summaries WHERE month=\?`).WithArgs("2025-06").WillReturnResult(sqlmock.NewResult(0, 4))
+    mock.ExpectExec(`INSERT INTO scorecard_summaries`).
+        WithArgs("2025-06", scorecardMaxStars, sqlmock.AnyArg(), "2025-06-01", "2025-06-30").WillReturnResult(sqlmock.NewResult(0, 5))
+    mock.ExpectCommit()
+    msg, err := generateScorecardSummaries(context.Background(), time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC))
+    if err != nil || msg != "2025-06: 5 driver/category summaries" {
+        t.Errorf("generateScorecardSummaries = %q, %v", msg, err)
+    }
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log/slog"
+    "net/http"
+    "os"
+    "regexp"
+    "runtime/debug"
+    "strings"
+    "sync/atomic"
+    "time"
+
+    "driver-safety-bonus/config"
+
+    "github.com/gin-gonic/gin"
+    "go.opentelemetry.io/otel/trace"
+)
+
+// setupLogging makes slog (and the standard log package) write one line per record
+// to stderr. LOG_FORMAT is json (default) or text; LOG_LEVEL is debug, info
+// (default), warn or error. Debug adds every SQL statement with its duration.
+func setupLogging(w io.Writer, cfg config.Logging) error {
+    var level slog.Level
+    if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+        return fmt.Errorf("LOG_LEVEL must be debug, info, warn or error: %q", cfg.Level)
+    }
+    opts := &slog.HandlerOptions{Level: level}
+    var h slog.Handler
+    switch strings.ToLower(cfg.Format) {
+    case "", "json":
+        h = slog.NewJSONHandler(w, opts)
+    case "text":
+        h = slog.NewTextHandler(w, opts)
+    default:
+        return fmt.Errorf("LOG_FORMAT must be json or text: %q", cfg.Format)
+    }
+    slog.SetDefault(slog.New(contextHandler{h}))
+    return nil
+}
+
+// fatal logs at error level and exits, for startup failures.
+func fatal(msg string, args ...any) {
+    slog.Error(msg, args...)
+    os.Exit(1)
+}
+
+// contextHandler adds the request id (and trace id when tracing) to records logged
+// with a request's context, so lines from handlers, notifications and webhooks can
+// be matched to the request.
+type contextHandler struct{ slog.Handler }
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+    if info := requestInfoFrom(ctx); info != nil {
+        r.AddAttrs(slog.String("request_id", info.id))
+    }
+    if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+        r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+    }
+    return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+    return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+    return contextHandler{h.Handler.WithGroup(name)}
+}
+
+func millis(d time.Duration) float64 {
+    return float64(d.Microseconds()) / 1000
+}
+
+// --- Request ids ---
+
+type requestInfoKey struct{}
+
+// requestInfo travels in the request context; the database driver adds to it.
+type requestInfo struct {
+    id        string
+    dbQueries atomic.Int64
+    dbTime    atomic.Int64 // nanoseconds
+}
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+    info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+    return info
+}
+
+// requestID is the id of the request ctx belongs to, or "".
+func requestID(ctx context.Context) string {
+    if info := requestInfoFrom(ctx); info != nil {
+        return info.id
+    }
+    return ""
+}
+
+// An incoming X-Request-ID (from a proxy or the client) is kept when it looks sane.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+func newRequestID() string {
+    b := make([]byte, 8)
+    _, _ = rand.Read(b)
+    return hex.EncodeToString(b)
+}
+
+// --- Request logging ---
+
+// logRequests is off for the admin CLI, whose calls go through the router in-process.
+var logRequests = true
+
+// requestLogger gives every request an id (X-Request-ID, also added to JSON error
+// bodies as request_id) and logs one line when it finishes with route, status,
+// latency, user and the time spent in the database.
+func requestLogger() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        start := time.Now()
+        id := c.GetHeader("X-Request-ID")
+        if !validRequestID.MatchString(id) {
+            id = newRequestID()
+        }
+        info := &requestInfo{id: id}
+        ctx := context.WithValue(c.Request.Context(), requestInfoKey{}, info)
+        c.Request = c.Request.WithContext(ctx)
+        c.Header("X-Request-ID", id)
+        ew := &errorBodyWriter{ResponseWriter: c.Writer, id: id}
+        c.Writer = ew
+
+        c.Next()
+
+        message := ew.flush()
+        if !logRequests {
+            return
+        }
+        status := c.Writer.Status()
+        route := c.FullPath()
+        level := slog.LevelInfo
+        switch {
+        case status >= 500:
+            level = slog.LevelError
+        case status >= 400:
+            level = slog.LevelWarn
+        case route == "/api/healthz" || route == "/livez" || route == "/readyz" || route == "/metrics":
+            level = slog.LevelDebug // probes and scrapes every few seconds
+        }
+        attrs := []slog.Attr{
+            slog.String("method", c.Request.Method),
+            slog.String("route", route),
+            slog.String("path", c.Request.URL.Path),
+            slog.Int("status", status),
+            slog.Float64("latency_ms", millis(time.Since(start))),
+            slog.Int("bytes", max(c.Writer.Size(), 0)),
+            slog.String("client_ip", c.ClientIP()),
+            slog.Int64("db_queries", info.dbQueries.Load()),
+            slog.Float64("db_ms", millis(time.Duration(info.dbTime.Load()))),
+        }
+        if user := requestUser(c); user != "" {
+            attrs = append(attrs, slog.String("user", user))
+        }
+        if message != "" {
+            attrs = append(attrs, slog.String("error", message))
+        }
+        if len(c.Errors) > 0 {
+            attrs = append(attrs, slog.String("errors", c.Errors.String()))
+        }
+        slog.LogAttrs(ctx, level, "request", attrs...)
+    }
+}
+
+// requestUser is who made the request: set by an auth middleware under "user", or
+// the X-Forwarded-User header of an authenticating proxy (oauth2-proxy and the like).
+func requestUser(c *gin.Context) string {
+    if u := c.GetString("user"); u != "" {
+        return u
+    }
+    return c.GetHeader("X-Forwarded-User")
+}
+
+// recoverPanics answers a panicking handler with a 500 APIError and logs the stack.
+func recoverPanics() gin.HandlerFunc {
+    return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+        slog.ErrorContext(c.Request.Context(), "panic", "panic", fmt.Sprint(err), "stack", string(debug.Stack()))
+        c.AbortWithStatusJSON(http.StatusInternalServerError, APIError{Message: "internal error"})
+    })
+}
+
+// errorBodyWriter holds back JSON error bodies (status 400 and up) so the request
+// id can be added as request_id; handlers keep writing plain APIError values.
+type errorBodyWriter struct {
+    gin.ResponseWriter
+    id  string
+    buf *bytes.Buffer
+}
+
+func (w *errorBodyWriter) holding() bool {
+    if w.buf != nil {
+        return true
+    }
+    if w.ResponseWriter.Status() < 400 || w.ResponseWriter.Written() ||
+        !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+        return false
+    }
+    w.buf = &bytes.Buffer{}
+    return true
+}
+
+func (w *errorBodyWriter) Write(b []byte) (int, error) {
+    if w.holding() {
+        return w.buf.Write(b)
+    }
+    return w.ResponseWriter.Write(b)
+}
+
+func (w *errorBodyWriter) WriteString(s string) (int, error) {
+    return w.Write([]byte(s))
+}
+
+func (w *errorBodyWriter) Written() bool {
+    return w.buf != nil || w.ResponseWriter.Written()
+}
+
+// Unwrap lets http.ResponseController reach the connection (deadlines, flushing).
+func (w *errorBodyWriter) Unwrap() http.ResponseWriter {
+    return w.ResponseWriter
+}
+
+func (w *errorBodyWriter) Size() int {
+    if w.buf != nil {
+        return w.buf.Len()
+    }
+    return w.ResponseWriter.Size()
+}
+
+// flush writes a held error body with request_id added and returns its message.
+func (w *errorBodyWriter) flush() string {
+    if w.buf == nil {
+        return ""
+    }
+    body := bytes.TrimSpace(w.buf.Bytes())
+    w.buf = nil
+    var e APIError
+    if json.Unmarshal(body, &e) == nil && len(body) > 1 && body[0] == '{' && e.RequestID == "" {
+        id, _ := json.Marshal(w.id)
+        field := append([]byte(`"request_id":`), id...)
+        if inner := bytes.TrimSpace(body[1 : len(body)-1]); len(inner) > 0 {
+            field = append([]byte(","), field...)
+        }
+        body = append(body[:len(body)-1:len(body)-1], append(field, '}')...)
+    }
+    w.ResponseWriter.Write(body)
+    return e.Message
+}
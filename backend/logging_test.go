@@ -0,0 +1,36 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/gin-gonic/gin"
+)
+
+func TestRequestIDInErrors(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+    router := newRouter()
+
+    // A sane incoming id is kept; otherwise a new one is made
+    for sent, keep := range map[string]bool{"trace-42": true, "bad id!": false} {
+        mock.ExpectQuery(`SELECT .+ FROM trucks WHERE truck_id=\?`).WithArgs(99).
+            WillReturnRows(sqlmock.NewRows(truckCols))
+        req := httptest.NewRequest(http.MethodGet, "/api/trucks/99", nil)
+        req.Header.Set("X-Request-ID", sent)
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, req)
+
+        id := w.Header().Get("X-Request-ID")
+        if id == "" || (id == sent) != keep {
+            t.Errorf("sent %q, got X-Request-ID %q", sent, id)
+        }
+        var body APIError
+        if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.RequestID != id || body.Message == "" {
+            t.Errorf("status %d body %s: want request_id %q", w.Code, w.Body, id)
+        }
+    }
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "crypto/tls"
+    "encoding/hex"
+    "fmt"
+    "log/slog"
+    "mime"
+    "net"
+    "net/mail"
+    "net/smtp"
+    "strings"
+    "time"
+
+    "driver-safety-bonus/config"
+)
+
+type MailMessage struct {
+    To      string
+    Subject string
+    Body    string // plain text
+}
+
+// MailTransport delivers one message. Returning an error leaves it in the outbox for a retry.
+type MailTransport interface {
+    Send(ctx context.Context, msg MailMessage) error
+}
+
+// newMailTransport uses SMTP when SMTP_HOST is set and otherwise logs
+// messages instead of sending them.
+func newMailTransport(cfg config.Mail) (MailTransport, error) {
+    if cfg.SMTPHost == "" {
+        return logTransport{}, nil
+    }
+    addr, err := mail.ParseAddress(cfg.From)
+    if err != nil {
+        return nil, fmt.Errorf("SMTP_FROM: %w", err)
+    }
+    t := &smtpTransport{
+        addr:     net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort),
+        host:     cfg.SMTPHost,
+        from:     addr,
+        username: cfg.Username,
+        password: cfg.Password,
+        startTLS: cfg.StartTLS,
+    }
+    switch t.startTLS {
+    case "":
+        t.startTLS = "auto"
+    case "auto", "always", "never":
+    default:
+        return nil, fmt.Errorf("SMTP_STARTTLS must be auto, always or never")
+    }
+    return t, nil
+}
+
+// logTransport stands in when SMTP_HOST is unset. Bodies can carry driver details,
+// so they are not logged.
+type logTransport struct{}
+
+func (logTransport) Send(ctx context.Context, msg MailMessage) error {
+    slog.InfoContext(ctx, "mail not sent, SMTP_HOST unset", "to", msg.To, "subject", msg.Subject)
+    return nil
+}
+
+type smtpTransport struct {
+    addr     string
+    host     string
+    from     *mail.Address
+    username string
+    password string
+    startTLS string // 'auto' uses STARTTLS when offered
+}
+
+func (t *smtpTransport) Send(ctx context.Context, msg MailMessage) error {
+    to, err := mail.ParseAddress(msg.To)
+    if err != nil {
+        return fmt.Errorf("recipient: %w", err)
+    }
+
+    var d net.Dialer
+    conn, err := d.DialContext(ctx, "tcp", t.addr)
+    if err != nil {
+        return err
+    }
+    if deadline, ok := ctx.Deadline(); ok {
+        conn.SetDeadline(deadline)
+    }
+    c, err := smtp.NewClient(conn, t.host)
+    if err != nil {
+        conn.Close()
+        return err
+    }
+    defer c.Close()
+
+    if ok, _ := c.Extension("STARTTLS"); ok && t.startTLS != "never" {
+        if err := c.StartTLS(&tls.Config{ServerName: t.host}); err != nil {
+            return err
+        }
+    } else if t.startTLS == "always" {
+        return fmt.Errorf("%s does not offer STARTTLS", t.addr)
+    }
+    if t.username != "" {
+        if err := c.Auth(smtp.PlainAuth("", t.username, t.password, t.host)); err != nil {
+            return err
+        }
+    }
+    if err := c.Mail(t.from.Address); err != nil {
+        return err
+    }
+    if err := c.Rcpt(to.Address); err != nil {
+        return err
+    }
+    w, err := c.Data()
+    if err != nil {
+        return err
+    }
+    if _, err := w.Write(buildMessage(t.from, to, msg)); err != nil {
+        return err
+    }
+    if err := w.Close(); err != nil {
+        return err
+    }
+    return c.Quit()
+}
+
+func buildMessage(from, to *mail.Address, msg MailMessage) []byte {
+    id := make([]byte, 12)
+    _, _ = rand.Read(id)
+    domain := "localhost"
+    if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+        domain = from.Address[at+1:]
+    }
+
+    var b bytes.Buffer
+    fmt.Fprintf(&b, "From: %s\r\n", from.String())
+    fmt.Fprintf(&b, "To: %s\r\n", to.String())
+    fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+    fmt.Fprintf(&b, "Date: %s\r\n", time.Now().In(localTZ).Format(time.RFC1123Z))
+    fmt.Fprintf(&b, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+    b.WriteString("MIME-Version: 1.0\r\n")
+    b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+    b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+    // SMTP wants CRLF line endings and no bare dot lines (handled by the data writer)
+    b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+    return b.Bytes()
+}
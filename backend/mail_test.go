@@ -0,0 +1,51 @@
+package main
+
+import (
+    "mime"
+    "net/mail"
+    "strings"
+    "testing"
+    "time"
+)
+
+// Non-ASCII subjects and names are encoded for the headers; the body is sent as
+// 8-bit UTF-8 with CRLF line endings.
+func TestBuildMessage(t *testing.T) {
+    prev := localTZ
+    localTZ = time.UTC
+    defer func() { localTZ = prev }()
+
+    from := &mail.Address{Name: "Safety Desk", Address: "safety@fleet.example"}
+    to := &mail.Address{Name: "Zoë O'Brien, Dispatch", Address: "zoe@example.com"}
+    raw := string(buildMessage(from, to, MailMessage{Subject: "Événement enregistré", Body: "Bonjour Zoë,\n\nLigne 2\r\n"}))
+
+    head, body, ok := strings.Cut(raw, "\r\n\r\n")
+    if !ok {
+        t.Fatalf("no header/body separator in %q", raw)
+    }
+    if body != "Bonjour Zoë,\r\n\r\nLigne 2\r\n" {
+        t.Errorf("body = %q", body)
+    }
+    msg, err := mail.ReadMessage(strings.NewReader(raw))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got, _ := msg.Header.AddressList("To"); len(got) != 1 || *got[0] != *to {
+        t.Errorf("To = %v, want %v", got, to)
+    }
+    if !strings.Contains(head, "Subject: =?utf-8?q?") {
+        t.Errorf("subject not encoded: %q", head)
+    }
+    var dec mime.WordDecoder
+    if subject, err := dec.DecodeHeader(msg.Header.Get("Subject")); err != nil || subject != "Événement enregistré" {
+        t.Errorf("Subject = %q (%v)", subject, err)
+    }
+    if id := msg.Header.Get("Message-Id"); !strings.HasSuffix(id, "@fleet.example>") {
+        t.Errorf("Message-ID = %q", id)
+    }
+    for _, line := range strings.Split(head, "\r\n") {
+        if strings.ContainsAny(line, "\r\n") || len(line) > 998 {
+            t.Errorf("bad header line %q", line)
+        }
+    }
+}
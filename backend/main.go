@@ -1,71 +1,183 @@
-
 // main.go
 package main
 
 import (
     "context"
     "database/sql"
-    "log"
+    "errors"
+    "fmt"
+    "log/slog"
+    "net"
     "net/http"
     "os"
+    "slices"
     "time"
 
+    "driver-safety-bonus/config"
+
     "github.com/gin-contrib/cors"
     "github.com/gin-gonic/gin"
-    _ "github.com/go-sql-driver/mysql"
+    "github.com/go-sql-driver/mysql"
 )
 
 var db *sql.DB
 var localTZ *time.Location
 
-func mustLoadLocation() *time.Location {
-    loc, err := time.LoadLocation("America/Winnipeg")
+// conf is the validated configuration (config.Load in main); tests run on defaults.
+var conf = config.Default()
+
+// GET /admin/config shows the configuration in effect, secrets redacted.
+func getConfig(c *gin.Context) {
+    c.JSON(http.StatusOK, conf.Redacted())
+}
+
+// connectDB opens conf.Database.DSN, trying up to attempts times while the database starts.
+func connectDB(attempts int) error {
+    dsn := conf.Database.DSN
+    if dsn == "" {
+        return errors.New("DB_DSN is required, e.g. safety_user:safety_password@tcp(db:3306)/driver_safety?parseTime=true")
+    }
+    cfg, err := mysql.ParseDSN(dsn)
+    if err != nil {
+        return err
+    }
+    connector, err := mysql.NewConnector(cfg)
     if err != nil {
-        log.Printf("WARN: failed loading America/Winnipeg, falling back to Local: %v", err)
-        return time.Local
+        return err
+    }
+    // Statements are timed per request (see dbdriver.go)
+    db = sql.OpenDB(observedConnector{connector})
+    db.SetConnMaxLifetime(conf.Database.ConnMaxLifetime.Std())
+    db.SetMaxIdleConns(conf.Database.MaxIdleConns)
+    db.SetMaxOpenConns(conf.Database.MaxOpenConns)
+    for i := 1; i <= attempts; i++ {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        err = db.PingContext(ctx)
+        cancel()
+        if err == nil {
+            return nil
+        }
+        if i < attempts {
+            slog.Warn("DB connection attempt failed, retrying", "attempt", i, "err", err)
+            time.Sleep(2 * time.Second)
+        }
     }
-    return loc
+    return err
+}
+
+// loadServices sets up what handlers need besides the database: the file store and
+// the payroll and notification templates. The server and the CLI both call it.
+func loadServices() error {
+    var err error
+    if files, err = newFileStore(conf.FileStore); err != nil {
+        return fmt.Errorf("file store: %w", err)
+    }
+    if err := loadPayrollTemplates(conf.Templates.PayrollFile); err != nil {
+        return fmt.Errorf("payroll templates: %w", err)
+    }
+    if err := loadNotificationTemplates(conf.Mail.TemplatesDir); err != nil {
+        return fmt.Errorf("notification templates: %w", err)
+    }
+    return nil
 }
 
 func main() {
-    localTZ = mustLoadLocation()
+    // Defaults, then CONFIG_FILE (YAML), then the environment (config/config.go)
+    var err error
+    if conf, err = config.Load(os.Getenv("CONFIG_FILE")); err != nil {
+        fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+        os.Exit(2)
+    }
+    if err := setupLogging(os.Stderr, conf.Logging); err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(2)
+    }
+    if localTZ, err = time.LoadLocation(conf.Timezone); err != nil {
+        fatal("timezone", "err", err)
+    }
+
+    // Admin commands (see cli.go); no arguments or "serve" runs the API
+    if len(os.Args) > 1 && os.Args[1] != "serve" {
+        os.Exit(runCLI(os.Args[1:], os.Stdout, os.Stderr))
+    }
+
+    // Traces of requests and their SQL statements (tracing.go)
+    stopTracing, err := setupTracing(context.Background(), os.Stdout)
+    if err != nil {
+        fatal("tracing", "err", err)
+    }
+    defer func() {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        _ = stopTracing(ctx) // send the spans still queued
+    }()
 
     // DB bootstrap with retries
-    dsn := os.Getenv("DB_DSN")
-    if dsn == "" {
-        log.Fatal("DB_DSN is required, e.g. safety_user:safety_password@tcp(db:3306)/driver_safety?parseTime=true")
+    if err := connectDB(conf.Database.ConnectAttempts); err != nil {
+        fatal("database unavailable", "err", err)
     }
-    var err error
-    for i := 1; i <= 20; i++ {
-        db, err = sql.Open("mysql", dsn)
-        if err == nil {
-            db.SetConnMaxLifetime(time.Minute * 3)
-            db.SetMaxIdleConns(10)
-            db.SetMaxOpenConns(100)
-            ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-            err = db.PingContext(ctx)
-            cancel()
-            if err == nil {
-                log.Println("Connected to database successfully")
-                break
-            }
-        }
-        log.Printf("DB connection attempt %d failed, retrying...", i)
-        time.Sleep(2 * time.Second)
+    slog.Info("connected to database")
+
+    // File store for photos and documents, payroll and email templates
+    if err := loadServices(); err != nil {
+        fatal("startup failed", "err", err)
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+    if err := upgradeSchema(ctx); err != nil {
+        fatal("schema upgrade failed", "err", err)
+    }
+    if err := migrateLegacyProfilePics(ctx); err != nil {
+        slog.Warn("profile picture migration failed", "err", err)
+    }
+    if err := migrateLegacyCredentialFiles(ctx); err != nil {
+        slog.Warn("credential file migration failed", "err", err)
+    }
+    cancel()
+
+    // Email notifications: queued in notification_outbox, delivered by the outbox worker
+    if mailer, err = newMailTransport(conf.Mail); err != nil {
+        fatal("mail transport", "err", err)
     }
+    bg := newBackground()
+    bg.run(runOutbox)
+    bg.run(runWebhooks)
+    bg.run(runChangeFeed)
+
+    // Scheduled jobs; set JOBS_ENABLED=false on replicas that should only serve requests
+    registerScheduledJobs()
+    if conf.Jobs.Enabled {
+        bg.run(runScheduler)
+    }
+
+    r := newRouter()
+
+    port := conf.Server.Port
+    ln, err := net.Listen("tcp", ":"+port)
+    if err != nil {
+        fatal("listen", "err", err)
+    }
+    slog.Info("DriverSafetyBonus API listening", "port", port, "tz", localTZ.String())
+    // Until SIGTERM, then a graceful shutdown (server.go)
+    if err := serve(newHTTPServer(r, conf.Server), ln, conf.Server.ShutdownDrainDelay.Std(), conf.Server.ShutdownTimeout.Std(), bg); err != nil {
+        fatal("server error", "err", err)
+    }
+    slog.Info("stopped")
+}
 
-    // Gin setup
+// newRouter registers middleware and every route.
+func newRouter() *gin.Engine {
     r := gin.New()
-    r.Use(gin.Logger(), gin.Recovery())
+    r.Use(traceRequests(), requestLogger(), requestMetrics(), recoverPanics())
 
-    // UPDATED CORS: More permissive for development to resolve 403 OPTIONS errors
+    // CORS origins from config; "*" (the default) allows the frontend from any local port
     r.Use(cors.New(cors.Config{
-        AllowAllOrigins:  true, // Allows frontend from any local port
+        AllowAllOrigins:  slices.Contains(conf.CORS.AllowedOrigins, "*"),
+        AllowOrigins:     slices.DeleteFunc(slices.Clone(conf.CORS.AllowedOrigins), func(o string) bool { return o == "*" }),
         AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-        AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With"},
-        ExposeHeaders:    []string{"Content-Length", "Content-Type"},
+        AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", "If-Match", "If-None-Match", "X-Request-ID", "traceparent", "tracestate"},
+        ExposeHeaders:    []string{"Content-Length", "Content-Type", "ETag", "X-Request-ID"},
         AllowCredentials: true,
-        MaxAge:           12 * time.Hour,
+        MaxAge:           conf.CORS.MaxAge.Std(),
     }))
 
     // Healthcheck
@@ -80,9 +192,17 @@ func main() {
         c.JSON(http.StatusOK, gin.H{"status": "ok", "time": now.Format(time.RFC3339)})
     })
 
-    // Lightweight OpenAPI JSON + Swagger UI via CDN
+    // Liveness and readiness with per-dependency checks (health.go)
+    r.GET("/livez", livez)
+    r.GET("/readyz", readyz)
+
+    // Prometheus scrape endpoint (metrics.go)
+    r.GET("/metrics", serveMetrics())
+
+    // Generated OpenAPI JSON + embedded Swagger UI
     r.GET("/openapi.json", serveOpenAPI)
-    r.GET("/swagger", serveSwaggerUI)
+    r.GET("/swagger", func(c *gin.Context) { c.Redirect(http.StatusMovedPermanently, "/swagger/") })
+    r.GET("/swagger/*filepath", serveSwaggerUI)
 
     // API routes
     api := r.Group("/api")
@@ -91,59 +211,151 @@ func main() {
         api.GET("/bootstrap", bootstrap)
 
         // Drivers
-        api.GET("/drivers", getDrivers)
+        api.GET("/drivers", exportable(getDrivers, driversExport))
         api.POST("/drivers", createDriver)
+        api.GET("/drivers/:id", getDriver)
         api.PUT("/drivers/:id", updateDriver)
+        api.PATCH("/drivers/:id", patchDriver)
         api.DELETE("/drivers/:id", deleteDriver)
         api.GET("/drivers/:id/stats", getDriverStats)
         api.POST("/drivers/:id/assign-truck", assignDriverToTruckHandler)
+        api.GET("/drivers/:id/statement.pdf", getDriverStatement)
+        api.GET("/drivers/:id/photo", getDriverPhoto)
+        api.PUT("/drivers/:id/photo", putDriverPhoto)
+        api.DELETE("/drivers/:id/photo", deleteDriverPhoto)
+
+        // Driver qualification file (credentials)
+        api.GET("/drivers/:id/credentials", getDriverCredentials)
+        api.POST("/drivers/:id/credentials", createDriverCredential)
+        api.PUT("/credentials/:id", updateDriverCredential)
+        api.DELETE("/credentials/:id", deleteDriverCredential)
+        api.GET("/credentials/:id/file", downloadCredentialFile)
+        api.PUT("/credentials/:id/file", uploadCredentialFile)
+        api.GET("/compliance/expiring", getExpiringCredentials)
 
         // Driver types
         api.GET("/driver-types", getDriverTypes)
         api.POST("/driver-types", createDriverType)
         api.PUT("/driver-types/:id", updateDriverType)
+        api.PATCH("/driver-types/:id", patchDriverType)
         api.DELETE("/driver-types/:id", deleteDriverType)
 
         // Trucks
-        api.GET("/trucks", getTrucks)
+        api.GET("/trucks", exportable(getTrucks, trucksExport))
         api.POST("/trucks", createTruck)
+        api.GET("/trucks/:id", getTruck)
         api.PUT("/trucks/:id", updateTruck)
+        api.PATCH("/trucks/:id", patchTruck)
         api.DELETE("/trucks/:id", deleteTruck)
-        api.GET("/trucks/:id/history", getTruckHistory)
+        api.GET("/trucks/:id/history", exportable(getTruckHistory, truckHistoryExport))
         api.POST("/trucks/:id/assign-driver", assignTruckToDriver)
 
         // Safety categories
         api.GET("/safety-categories", getSafetyCategories)
         api.POST("/safety-categories", createSafetyCategory)
         api.PUT("/safety-categories/:id", updateSafetyCategory)
+        api.PATCH("/safety-categories/:id", patchSafetyCategory)
         api.DELETE("/safety-categories/:id", deleteSafetyCategory)
 
         // Scorecard metrics (items)
         api.GET("/scorecard-metrics", getScorecardMetrics)
         api.POST("/scorecard-metrics", createScorecardMetric)
         api.PUT("/scorecard-metrics/:id", updateScorecardMetric)
+        api.PATCH("/scorecard-metrics/:id", patchScorecardMetric)
         api.DELETE("/scorecard-metrics/:id", deleteScorecardMetric)
 
         // Safety events
-        api.GET("/safety-events", getSafetyEvents)
+        api.GET("/safety-events", exportable(getSafetyEvents, safetyEventsExport))
         api.POST("/safety-events", createSafetyEvent)
+        api.GET("/safety-events/:id", getSafetyEvent)
         api.PUT("/safety-events/:id", updateSafetyEvent)
+        api.PATCH("/safety-events/:id", patchSafetyEvent)
         api.DELETE("/safety-events/:id", deleteSafetyEvent)
+        api.GET("/safety-events/:id/attachments", listAttachments("safety_event"))
+        api.POST("/safety-events/:id/attachments", uploadAttachments("safety_event"))
+        api.GET("/safety-events/:id/disputes", getSafetyEventDisputes)
+        api.POST("/safety-events/:id/disputes", openDispute)
+
+        // Disputes
+        api.GET("/disputes", getDisputes)
+        api.GET("/disputes/:id", getDispute)
+        api.POST("/disputes/:id/transition", transitionDispute)
 
         // Scorecard events
-        api.GET("/scorecard-events", getScoreCardEvents)
+        api.GET("/scorecard-events", exportable(getScoreCardEvents, scorecardEventsExport))
         api.POST("/scorecard-events", createScoreCardEvent)
+        api.GET("/scorecard-events/:id", getScoreCardEvent)
         api.PUT("/scorecard-events/:id", updateScoreCardEvent)
+        api.PATCH("/scorecard-events/:id", patchScoreCardEvent)
         api.DELETE("/scorecard-events/:id", deleteScoreCardEvent)
         api.DELETE("/scorecard-events", deleteScoreCardEventsByFilter)
-    }
+        api.GET("/scorecard-events/:id/attachments", listAttachments("scorecard_event"))
+        api.POST("/scorecard-events/:id/attachments", uploadAttachments("scorecard_event"))
 
-    port := os.Getenv("API_PORT")
-    if port == "" {
-        port = "8080"
-    }
-    log.Printf("DriverSafetyBonus API listening on :%s (TZ=%s)", port, localTZ.String())
-    if err := r.Run(":" + port); err != nil {
-        log.Fatalf("server error: %v", err)
+        // Evidence attachments
+        api.GET("/attachments/:id/download", downloadAttachment)
+        api.DELETE("/attachments/:id", deleteAttachment)
+
+        // Bonus periods & payroll export
+        api.GET("/bonus-periods", getBonusPeriods)
+        api.POST("/bonus-periods", createBonusPeriod)
+        api.POST("/bonus-periods/:id/close", bonusPeriodTransition("open", "closed"))
+        api.POST("/bonus-periods/:id/approve", bonusPeriodTransition("closed", "approved"))
+        api.GET("/bonus-periods/:id/lines", getBonusLines)
+        api.POST("/bonus-periods/:id/payroll-export", exportPayroll)
+        api.GET("/payroll-exports", getPayrollExports)
+        api.GET("/payroll-exports/:id/download", downloadPayrollExport)
+
+        // Driver statements (PDF)
+        api.GET("/statements.zip", getStatementsZip)
+
+        // Safety reports (chart-ready aggregates)
+        api.GET("/reports/safety/timeseries", getSafetyTimeseries)
+        api.GET("/reports/safety/by-category", getSafetyByCategory)
+        api.GET("/reports/safety/by-driver-type", getSafetyByDriverType)
+        api.GET("/reports/safety/by-truck", getSafetyByTruck)
+        api.GET("/reports/safety/top-offenders", getTopOffenders)
+        api.GET("/reports/safety/trend", getSafetyTrend)
+        api.GET("/reports/safety/inspections", getInspectionReport)
+
+        // Scorecard summaries and completion checklist
+        api.GET("/scorecards/summaries", getScorecardSummaries)
+        api.GET("/scorecards/missing", getMissingScorecards)
+
+        // Admin: configuration and scheduled jobs
+        api.GET("/admin/config", getConfig)
+        api.GET("/admin/jobs", getJobs)
+        api.GET("/admin/jobs/:name/runs", getJobRuns)
+        api.POST("/admin/jobs/:name/run", triggerJob)
+
+        // Email notifications
+        api.GET("/notification-users", getNotificationUsers)
+        api.POST("/notification-users", createNotificationUser)
+        api.PUT("/notification-users/:id", updateNotificationUser)
+        api.DELETE("/notification-users/:id", deleteNotificationUser)
+        api.GET("/notification-users/:id/preferences", getNotificationPreferences)
+        api.PUT("/notification-users/:id/preferences", updateNotificationPreferences)
+        api.GET("/notifications/outbox", getOutbox)
+        api.POST("/notifications/outbox/:id/retry", retryOutboxMessage)
+        api.POST("/notifications/test", sendTestNotification)
+
+        // Live change feed (Server-Sent Events)
+        api.GET("/stream", streamChanges)
+
+        // Outbound webhooks
+        api.GET("/webhooks", getWebhooks)
+        api.POST("/webhooks", createWebhook)
+        api.GET("/webhooks/event-types", getWebhookEventTypes)
+        api.PUT("/webhooks/:id", updateWebhook)
+        api.DELETE("/webhooks/:id", deleteWebhook)
+        api.POST("/webhooks/:id/ping", pingWebhook)
+        api.GET("/webhooks/:id/deliveries", getWebhookDeliveries)
+        api.POST("/webhooks/:id/replay", replayWebhookDeliveries)
+        api.GET("/webhooks/deliveries/:id", getWebhookDelivery)
+        api.POST("/webhooks/deliveries/:id/replay", replayWebhookDelivery)
     }
+
+    // Spec for /openapi.json: the routes above plus their apiDocs entries
+    openAPISpec = buildOpenAPI(r.Routes())
+    return r
 }
@@ -0,0 +1,200 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "log/slog"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/collectors"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics for GET /metrics (Prometheus text format). Request metrics are counted as
+// requests finish; database pool and domain numbers are read when scraped.
+var (
+    metricsRegistry = prometheus.NewRegistry()
+
+    httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "http_requests_total",
+        Help: "HTTP requests by method, route and status code.",
+    }, []string{"method", "route", "status"})
+    httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Name:    "http_request_duration_seconds",
+        Help:    "HTTP request latency by method and route.",
+        Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+    }, []string{"method", "route"})
+)
+
+func init() {
+    metricsRegistry.MustRegister(
+        collectors.NewGoCollector(),
+        collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+        httpRequests,
+        httpDuration,
+        dbStatsCollector{},
+        domainCollector{},
+    )
+}
+
+// requestMetrics counts requests by route template (/api/drivers/:id), so ids do
+// not make a series each; paths no route matches count as "unmatched".
+func requestMetrics() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        start := time.Now()
+        c.Next()
+        route := c.FullPath()
+        if route == "" {
+            route = "unmatched"
+        }
+        httpRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+        httpDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+    }
+}
+
+// serveMetrics is GET /metrics.
+func serveMetrics() gin.HandlerFunc {
+    return gin.WrapH(promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+}
+
+// --- Database pool ---
+
+var (
+    dbOpenDesc         = prometheus.NewDesc("db_connections_open", "Open database connections (in use plus idle).", nil, nil)
+    dbInUseDesc        = prometheus.NewDesc("db_connections_in_use", "Database connections in use.", nil, nil)
+    dbIdleDesc         = prometheus.NewDesc("db_connections_idle", "Idle database connections.", nil, nil)
+    dbMaxOpenDesc      = prometheus.NewDesc("db_connections_max_open", "Maximum open database connections (SetMaxOpenConns).", nil, nil)
+    dbWaitCountDesc    = prometheus.NewDesc("db_wait_count_total", "Times a query waited for a free connection.", nil, nil)
+    dbWaitDurationDesc = prometheus.NewDesc("db_wait_duration_seconds_total", "Time spent waiting for a free connection.", nil, nil)
+)
+
+// dbStatsCollector reads sql.DB stats at scrape time; the pool saturates when in
+// use reaches max open and the wait count climbs.
+type dbStatsCollector struct{}
+
+func (dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+    for _, d := range []*prometheus.Desc{dbOpenDesc, dbInUseDesc, dbIdleDesc, dbMaxOpenDesc, dbWaitCountDesc, dbWaitDurationDesc} {
+        ch <- d
+    }
+}
+
+func (dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+    if db == nil {
+        return
+    }
+    s := db.Stats()
+    ch <- prometheus.MustNewConstMetric(dbOpenDesc, prometheus.GaugeValue, float64(s.OpenConnections))
+    ch <- prometheus.MustNewConstMetric(dbInUseDesc, prometheus.GaugeValue, float64(s.InUse))
+    ch <- prometheus.MustNewConstMetric(dbIdleDesc, prometheus.GaugeValue, float64(s.Idle))
+    ch <- prometheus.MustNewConstMetric(dbMaxOpenDesc, prometheus.GaugeValue, float64(s.MaxOpenConnections))
+    ch <- prometheus.MustNewConstMetric(dbWaitCountDesc, prometheus.CounterValue, float64(s.WaitCount))
+    ch <- prometheus.MustNewConstMetric(dbWaitDurationDesc, prometheus.CounterValue, s.WaitDuration.Seconds())
+}
+
+// --- Domain gauges ---
+
+var (
+    activeDriversDesc    = prometheus.NewDesc("driver_safety_active_drivers", "Active drivers.", nil, nil)
+    openDisputesDesc     = prometheus.NewDesc("driver_safety_open_disputes", "Safety event disputes open or under review.", []string{"status"}, nil)
+    periodEventsDesc     = prometheus.NewDesc("driver_safety_period_events", "Safety events recorded in the current bonus period.", []string{"period"}, nil)
+    highRiskDesc         = prometheus.NewDesc("driver_safety_high_risk_drivers", "Active drivers above the high-risk threshold (thresholds.high_risk_points), as on the Dashboard.", nil, nil)
+    domainUpDesc         = prometheus.NewDesc("driver_safety_domain_metrics_up", "1 when the domain gauges could be read from the database.", nil, nil)
+    domainMetricsTimeout = 5 * time.Second
+)
+
+// domainCollector counts from the database on each scrape (a few indexed COUNTs).
+// When the database fails, only driver_safety_domain_metrics_up is reported, as 0.
+type domainCollector struct{}
+
+func (domainCollector) Describe(ch chan<- *prometheus.Desc) {
+    for _, d := range []*prometheus.Desc{activeDriversDesc, openDisputesDesc, periodEventsDesc, highRiskDesc, domainUpDesc} {
+        ch <- d
+    }
+}
+
+func (domainCollector) Collect(ch chan<- prometheus.Metric) {
+    if db == nil {
+        return
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), domainMetricsTimeout)
+    defer cancel()
+    metrics, err := domainMetrics(ctx)
+    if err != nil {
+        slog.WarnContext(ctx, "domain metrics not collected", "err", err)
+        ch <- prometheus.MustNewConstMetric(domainUpDesc, prometheus.GaugeValue, 0)
+        return
+    }
+    for _, m := range metrics {
+        ch <- m
+    }
+    ch <- prometheus.MustNewConstMetric(domainUpDesc, prometheus.GaugeValue, 1)
+}
+
+func domainMetrics(ctx context.Context) ([]prometheus.Metric, error) {
+    var out []prometheus.Metric
+    var active, highRisk int
+    if err := queryRow(ctx, `SELECT COUNT(*) FROM drivers WHERE active`).Scan(&active); err != nil {
+        return nil, err
+    }
+    out = append(out, prometheus.MustNewConstMetric(activeDriversDesc, prometheus.GaugeValue, float64(active)))
+
+    disputes := map[string]int{"open": 0, "under_review": 0}
+    rows, err := queryRows(ctx, `
+        SELECT status, COUNT(*) FROM safety_event_disputes
+        WHERE status IN ('open','under_review') GROUP BY status`)
+    if err != nil {
+        return nil, err
+    }
+    for rows.Next() {
+        var status string
+        var n int
+        if err := rows.Scan(&status, &n); err != nil {
+            rows.Close()
+            return nil, err
+        }
+        disputes[status] = n
+    }
+    rows.Close()
+    for status, n := range disputes {
+        out = append(out, prometheus.MustNewConstMetric(openDisputesDesc, prometheus.GaugeValue, float64(n), status))
+    }
+
+    // The bonus period covering today, or the calendar month when none is set up
+    today := time.Now().In(localTZ)
+    period := today.Format("2006-01")
+    from := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, localTZ)
+    to := from.AddDate(0, 1, -1)
+    var starts, ends time.Time
+    err = queryRow(ctx, `
+        SELECT period_key, starts_on, ends_on FROM bonus_periods
+        WHERE starts_on <= ? AND ends_on >= ? ORDER BY starts_on DESC LIMIT 1`,
+        today.Format("2006-01-02"), today.Format("2006-01-02")).Scan(&period, &starts, &ends)
+    switch {
+    case err == nil:
+        from, to = starts, ends
+    case err != sql.ErrNoRows:
+        return nil, err
+    }
+    var events int
+    if err := queryRow(ctx, `SELECT COUNT(*) FROM safety_events WHERE event_date BETWEEN ? AND ?`,
+        from.Format("2006-01-02"), to.Format("2006-01-02")).Scan(&events); err != nil {
+        return nil, err
+    }
+    out = append(out, prometheus.MustNewConstMetric(periodEventsDesc, prometheus.GaugeValue, float64(events), period))
+
+    // Same points as driverRiskPoints: all-time, overturned disputes excluded
+    if err := queryRow(ctx, `
+        SELECT COUNT(*) FROM (
+            SELECT se.driver_id FROM safety_events se
+            JOIN drivers d ON d.driver_id = se.driver_id AND d.active
+            GROUP BY se.driver_id
+            HAVING SUM(CASE WHEN se.dispute_status='overturned' THEN 0 ELSE se.bonus_score END) > ?
+        ) high_risk`, conf.Thresholds.HighRiskPoints).Scan(&highRisk); err != nil {
+        return nil, err
+    }
+    out = append(out, prometheus.MustNewConstMetric(highRiskDesc, prometheus.GaugeValue, float64(highRisk)))
+    return out, nil
+}
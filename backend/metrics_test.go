@@ -0,0 +1,48 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/gin-gonic/gin"
+)
+
+func TestMetrics(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+    router := newRouter()
+
+    mock.ExpectQuery(`SELECT .+ FROM trucks WHERE truck_id=\?`).WithArgs(99).
+        WillReturnRows(sqlmock.NewRows(truckCols))
+    router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/trucks/99", nil))
+
+    mock.ExpectQuery(`FROM drivers WHERE active`).WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(12))
+    mock.ExpectQuery(`FROM safety_event_disputes`).WillReturnRows(sqlmock.NewRows([]string{"status", "n"}).AddRow("open", 3))
+    mock.ExpectQuery(`FROM bonus_periods`).WillReturnRows(sqlmock.NewRows([]string{"period_key", "starts_on", "ends_on"}).
+        AddRow("2025-Q2", time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)))
+    mock.ExpectQuery(`FROM safety_events WHERE event_date BETWEEN`).WithArgs("2025-04-01", "2025-06-30").
+        WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(40))
+    mock.ExpectQuery(`HAVING SUM`).WithArgs(conf.Thresholds.HighRiskPoints).WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(2))
+    w := httptest.NewRecorder()
+    router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+    for _, want := range []string{
+        `http_requests_total{method="GET",route="/api/trucks/:id",status="404"}`,
+        `http_request_duration_seconds_count{method="GET",route="/api/trucks/:id"}`,
+        `db_connections_max_open `,
+        `driver_safety_active_drivers 12`,
+        `driver_safety_open_disputes{status="open"} 3`,
+        `driver_safety_open_disputes{status="under_review"} 0`,
+        `driver_safety_period_events{period="2025-Q2"} 40`,
+        `driver_safety_high_risk_drivers 2`,
+        `driver_safety_domain_metrics_up 1`,
+    } {
+        if !strings.Contains(w.Body.String(), want) {
+            t.Errorf("/metrics lacks %s", want)
+        }
+    }
+}
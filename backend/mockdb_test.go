@@ -0,0 +1,43 @@
+package main
+
+import (
+    "testing"
+    "time"
+
+    "github.com/DATA-DOG/go-sqlmock"
+)
+
+// withMockDB points db at a fresh sqlmock, with localTZ set to UTC, for the rest of
+// the test. Pings are monitored, so a test that pings must expect it. When the test
+// ends the expectations are checked and both globals restored. The mock is
+// registered under t.Name(), for tests that open their own connector on its driver.
+func withMockDB(t *testing.T) sqlmock.Sqlmock {
+    t.Helper()
+    mockDB, mock, err := sqlmock.NewWithDSN(t.Name(), sqlmock.MonitorPingsOption(true))
+    if err != nil {
+        t.Fatal(err)
+    }
+    prevDB, prevTZ := db, localTZ
+    db, localTZ = mockDB, time.UTC
+    t.Cleanup(func() {
+        if err := mock.ExpectationsWereMet(); err != nil {
+            t.Error(err)
+        }
+        mockDB.Close()
+        db, localTZ = prevDB, prevTZ
+    })
+    return mock
+}
+
+// withFileStore points files at an empty local store for the rest of the test.
+func withFileStore(t *testing.T) *localFileStore {
+    t.Helper()
+    store, err := newLocalFileStore(t.TempDir())
+    if err != nil {
+        t.Fatal(err)
+    }
+    prev := files
+    files = store
+    t.Cleanup(func() { files = prev })
+    return store
+}
@@ -0,0 +1,478 @@
+// Package model holds the JSON types of the DriverSafetyBonus API. The server and
+// the Go client (package client) share them, so both always agree on the wire format.
+package model
+
+import "encoding/json"
+
+type Truck struct {
+    TruckID    int    `json:"truck_id"`
+    UnitNumber string `json:"unit_number"`
+    Year       int    `json:"year"`
+    Status     string `json:"status" enum:"available,maintenance,assigned"`
+    Version    int    `json:"version"` // also sent as the ETag; send it back in If-Match to update or delete
+}
+
+type Driver struct {
+    DriverID     int     `json:"driver_id"`
+    DriverCode   string  `json:"driver_code"`
+    FirstName    string  `json:"first_name"`
+    LastName     string  `json:"last_name"`
+    StartDate    string  `json:"start_date"` // YYYY-MM-DD (Winnipeg local date)
+    TruckID      *int    `json:"truck_id"`
+    DriverTypeID *int    `json:"driver_type_id"`
+    Active       *bool   `json:"active"`      // defaults to true; inactive drivers are left out of batch statements
+    ProfilePic   *string `json:"profile_pic"` // photo URL; a base64 data URL is accepted on create/update
+    Version      int     `json:"version"`
+}
+
+type DriverType struct {
+    DriverTypeID int    `json:"driver_type_id"`
+    DriverType   string `json:"driver_type"`
+}
+
+type SafetyCategory struct {
+    CategoryID    int    `json:"category_id"`
+    Code          string `json:"code"`
+    Description   string `json:"description"`
+    ScoringSystem int    `json:"scoring_system"`
+    PIScore       int    `json:"p_i_score"`
+}
+
+type ScoreCardItem struct {
+    ScCategoryID  int    `json:"sc_category_id"`
+    ScCategory    string `json:"sc_category" enum:"SAFETY,MAINTENANCE,DISPATCH"`
+    ScDescription string `json:"sc_description"`
+    DriverTypeID  *int   `json:"driver_type_id"` // null for global
+}
+
+type SafetyEvent struct {
+    SafetyEventID int     `json:"safety_event_id"`
+    DriverID      int     `json:"driver_id"`
+    EventDate     string  `json:"event_date"` // YYYY-MM-DD (Winnipeg local date)
+    CategoryID    int     `json:"category_id"`
+    Notes         string  `json:"notes"`
+    BonusScore    int     `json:"bonus_score"`
+    PIScore       int     `json:"p_i_score"`
+    BonusPeriod   bool    `json:"bonus_period"`
+    DisputeStatus *string `json:"dispute_status" enum:"open,under_review,upheld,overturned"`
+    Version       int     `json:"version"`
+}
+
+type ScoreCardEvent struct {
+    ScorecardEventID int    `json:"scorecard_event_id"`
+    DriverID         int    `json:"driver_id"`
+    EventDate        string `json:"event_date"` // YYYY-MM-DD (Winnipeg local date)
+    ScCategoryID     int    `json:"sc_category_id"`
+    ScScore          int    `json:"sc_score"`
+    Notes            string `json:"notes"`
+    Version          int    `json:"version"`
+}
+
+type TruckHistoryEvent struct {
+    TruckHistoryID int     `json:"truck_history_id"`
+    TruckID        int     `json:"truck_id"`
+    DriverID       *int    `json:"driver_id"`
+    Date           string  `json:"date"` // ISO8601 Winnipeg local datetime
+    Type           string  `json:"type" enum:"assignment,maintenance,status_change"`
+    Notes          *string `json:"notes"`
+}
+
+type Attachment struct {
+    AttachmentID int     `json:"attachment_id"`
+    OwnerType    string  `json:"owner_type" enum:"safety_event,scorecard_event"`
+    OwnerID      int     `json:"owner_id"`
+    Kind         string  `json:"kind" enum:"file,link"` // a link is e.g. a dashcam clip reference
+    FileName     *string `json:"file_name"`
+    ContentType  *string `json:"content_type"`
+    SizeBytes    *int64  `json:"size_bytes"`
+    SHA256       *string `json:"sha256"`
+    URL          *string `json:"url"`
+    Description  string  `json:"description"`
+    UploadedAt   string  `json:"uploaded_at"` // ISO8601 Winnipeg local datetime
+}
+
+type DriverCredential struct {
+    CredentialID    int     `json:"credential_id"`
+    DriverID        int     `json:"driver_id"`
+    CredentialType  string  `json:"credential_type" enum:"license,medical,hazmat_tdg,border_card,other"`
+    Number          string  `json:"number"`
+    Jurisdiction    string  `json:"jurisdiction"`
+    IssueDate       string  `json:"issue_date"`   // YYYY-MM-DD (Winnipeg local date)
+    ExpiryDate      string  `json:"expiry_date"`  // YYYY-MM-DD (Winnipeg local date)
+    BlocksBonus     bool    `json:"blocks_bonus"` // expired credential makes the driver bonus-ineligible
+    FileName        *string `json:"file_name"`
+    FileContentType *string `json:"file_content_type"`
+}
+
+type ExpiringCredential struct {
+    DriverCredential
+    DriverCode    string `json:"driver_code"`
+    FirstName     string `json:"first_name"`
+    LastName      string `json:"last_name"`
+    DaysRemaining int    `json:"days_remaining"` // negative once expired
+}
+
+type SafetyEventDispute struct {
+    DisputeID       int                 `json:"dispute_id"`
+    SafetyEventID   int                 `json:"safety_event_id"`
+    Reason          string              `json:"reason"`
+    OpenedBy        string              `json:"opened_by"`
+    OpenedByRole    string              `json:"opened_by_role" enum:"driver,manager"`
+    Status          string              `json:"status" enum:"open,under_review,upheld,overturned"`
+    OpenedAt        string              `json:"opened_at"` // ISO8601 Winnipeg local datetime
+    Reviewer        *string             `json:"reviewer"`
+    ResolutionNotes *string             `json:"resolution_notes"`
+    ResolvedAt      *string             `json:"resolved_at"`
+    Transitions     []DisputeTransition `json:"transitions"`
+}
+
+type DisputeTransition struct {
+    TransitionID int     `json:"transition_id"`
+    FromStatus   *string `json:"from_status" enum:"open,under_review,upheld,overturned"`
+    ToStatus     string  `json:"to_status" enum:"open,under_review,upheld,overturned"`
+    Actor        string  `json:"actor"`
+    Notes        string  `json:"notes"`
+    ChangedAt    string  `json:"changed_at"` // ISO8601 Winnipeg local datetime
+}
+
+type BonusPeriod struct {
+    PeriodID   int     `json:"period_id"`
+    Period     string  `json:"period"`    // 'YYYY-MM' (month) or 'YYYY-Qn' (quarter)
+    StartsOn   string  `json:"starts_on"` // YYYY-MM-DD (Winnipeg local date)
+    EndsOn     string  `json:"ends_on"`   // YYYY-MM-DD, inclusive
+    Status     string  `json:"status" enum:"open,closed,approved"`
+    MaxPayout  float64 `json:"max_payout"`
+    ApprovedBy *string `json:"approved_by"`
+    ApprovedAt *string `json:"approved_at"`
+}
+
+// BonusLine is one driver's bonus outcome for a period.
+type BonusLine struct {
+    DriverID         int     `json:"driver_id"`
+    DriverCode       string  `json:"driver_code"`
+    FirstName        string  `json:"first_name"`
+    LastName         string  `json:"last_name"`
+    DriverType       string  `json:"driver_type"`
+    Period           string  `json:"period"`
+    SafetyPoints     int     `json:"safety_points"`
+    ScorecardPct     float64 `json:"scorecard_pct"`
+    Eligible         bool    `json:"eligible"`
+    IneligibleReason string  `json:"ineligible_reason,omitempty"`
+    Payout           float64 `json:"payout"`
+}
+
+type PayrollExport struct {
+    ExportID     int     `json:"export_id"`
+    PeriodID     int     `json:"period_id"`
+    Period       string  `json:"period"`
+    Template     string  `json:"template"`
+    Format       string  `json:"format" enum:"csv,fixed,json"`
+    Reissue      bool    `json:"reissue"`
+    Reason       *string `json:"reason"`
+    ExportedBy   string  `json:"exported_by"`
+    LineCount    int     `json:"line_count"`
+    TotalPayout  float64 `json:"total_payout"`
+    Checksum     string  `json:"checksum"`
+    ExportedAt   string  `json:"exported_at"` // ISO8601 Winnipeg local datetime
+    SupersededBy *int    `json:"superseded_by"`
+}
+
+// ReportSeries is a chart-ready result: one label per point on the x axis and one
+// data array per series, aligned with Labels.
+type ReportSeries struct {
+    From         string         `json:"from"` // YYYY-MM-DD, inclusive
+    To           string         `json:"to"`
+    Labels       []string       `json:"labels"`
+    Descriptions []string       `json:"descriptions,omitempty"` // long form of each label, e.g. category description
+    Series       []SeriesValues `json:"series"`
+}
+
+type SeriesValues struct {
+    Name string    `json:"name"`
+    Data []float64 `json:"data"`
+}
+
+type TopOffender struct {
+    DriverID   int    `json:"driver_id"`
+    DriverCode string `json:"driver_code"`
+    Name       string `json:"name"`
+    DriverType string `json:"driver_type"`
+    Events     int    `json:"events"`
+    Points     int    `json:"points"`
+}
+
+type PeriodTotals struct {
+    From   string `json:"from"`
+    To     string `json:"to"`
+    Events int    `json:"events"`
+    Points int    `json:"points"`
+}
+
+type SafetyTrend struct {
+    Current         PeriodTotals `json:"current"`
+    Prior           PeriodTotals `json:"prior"`
+    EventsChangePct *float64     `json:"events_change_pct"` // null when the prior period had none
+    PointsChangePct *float64     `json:"points_change_pct"`
+}
+
+type InspectionReport struct {
+    From     string       `json:"from"`
+    To       string       `json:"to"`
+    Passed   int          `json:"passed"`
+    Failed   int          `json:"failed"`
+    PassRate *float64     `json:"pass_rate"` // percent; null with no inspections
+    ByLevel  ReportSeries `json:"by_level"`
+}
+
+type JobRun struct {
+    RunID        int64   `json:"run_id"`
+    JobName      string  `json:"job_name"`
+    Trigger      string  `json:"trigger" enum:"schedule,manual"`
+    ScheduledFor *string `json:"scheduled_for"` // slot a scheduled run was for; null for manual runs
+    StartedAt    string  `json:"started_at"`    // ISO8601 Winnipeg local datetime
+    FinishedAt   *string `json:"finished_at"`
+    Status       string  `json:"status" enum:"running,succeeded,failed"`
+    Message      string  `json:"message"`
+    Runner       string  `json:"runner"` // host:pid of the replica that ran it
+}
+
+type JobStatus struct {
+    Name        string  `json:"name"`
+    Description string  `json:"description"`
+    Schedule    string  `json:"schedule"` // cron expression, Winnipeg time
+    NextRun     string  `json:"next_run"`
+    LeaseHolder *string `json:"lease_holder"` // replica currently running it, if any
+    LastRun     *JobRun `json:"last_run"`
+}
+
+type ScorecardSummary struct {
+    DriverID    int     `json:"driver_id"`
+    DriverCode  string  `json:"driver_code"`
+    FirstName   string  `json:"first_name"`
+    LastName    string  `json:"last_name"`
+    Month       string  `json:"month"` // YYYY-MM
+    ScCategory  string  `json:"sc_category" enum:"SAFETY,MAINTENANCE,DISPATCH"`
+    ItemsScored int     `json:"items_scored"`
+    Stars       int     `json:"stars"`
+    Possible    int     `json:"possible"`
+    Pct         float64 `json:"pct"`
+    GeneratedAt string  `json:"generated_at"`
+}
+
+// ScorecardChecklist is one driver's scorecard completion for a month.
+type ScorecardChecklist struct {
+    DriverID     int                    `json:"driver_id"`
+    DriverCode   string                 `json:"driver_code"`
+    FirstName    string                 `json:"first_name"`
+    LastName     string                 `json:"last_name"`
+    DriverTypeID *int                   `json:"driver_type_id"`
+    Applicable   int                    `json:"applicable"` // metrics that apply to the driver's type
+    Entered      int                    `json:"entered"`
+    Complete     bool                   `json:"complete"`
+    Missing      []MissingScorecardItem `json:"missing"`
+}
+
+type MissingScorecardItem struct {
+    ScCategoryID  int    `json:"sc_category_id"`
+    ScCategory    string `json:"sc_category" enum:"SAFETY,MAINTENANCE,DISPATCH"`
+    ScDescription string `json:"sc_description"`
+}
+
+// NotificationUser is an email recipient. Drivers (role 'driver', with driver_id set)
+// only receive notifications about themselves.
+type NotificationUser struct {
+    UserID   int    `json:"user_id"`
+    Email    string `json:"email"`
+    Name     string `json:"name"`
+    Role     string `json:"role" enum:"manager,supervisor,payroll,driver"`
+    DriverID *int   `json:"driver_id"`
+    Active   bool   `json:"active"`
+}
+
+type NotificationPreference struct {
+    EventType   string `json:"event_type"`
+    Description string `json:"description"`
+    Enabled     bool   `json:"enabled"`
+    Custom      bool   `json:"custom"` // false when the role default applies
+}
+
+type OutboxMessage struct {
+    OutboxID      int64   `json:"outbox_id"`
+    UserID        *int    `json:"user_id"`
+    Recipient     string  `json:"recipient"`
+    EventType     string  `json:"event_type"`
+    Subject       string  `json:"subject"`
+    Body          string  `json:"body"`
+    Status        string  `json:"status" enum:"pending,sending,sent,failed"`
+    Attempts      int     `json:"attempts"`
+    NextAttemptAt string  `json:"next_attempt_at"`
+    LastError     *string `json:"last_error"`
+    CreatedAt     string  `json:"created_at"`
+    SentAt        *string `json:"sent_at"`
+}
+
+// WebhookSubscription is an outside system that wants change events POSTed to it.
+// Secret is only returned when the subscription is created or the secret rotated.
+type WebhookSubscription struct {
+    SubscriptionID int      `json:"subscription_id"`
+    URL            string   `json:"url"`
+    Secret         string   `json:"secret,omitempty"`
+    EventTypes     []string `json:"event_types"` // e.g. ["safety_event.created", "truck.assigned"] or ["*"]
+    Description    string   `json:"description"`
+    Active         bool     `json:"active"`
+    CreatedAt      string   `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+    DeliveryID     int64            `json:"delivery_id"`
+    SubscriptionID int              `json:"subscription_id"`
+    EventID        string           `json:"event_id"`
+    EventType      string           `json:"event_type"`
+    Payload        json.RawMessage  `json:"payload"`
+    Status         string           `json:"status" enum:"pending,sending,delivered,failed"`
+    Attempts       int              `json:"attempts"`
+    NextAttemptAt  string           `json:"next_attempt_at"`
+    LastStatusCode *int             `json:"last_status_code"`
+    LastError      *string          `json:"last_error"`
+    ReplayOf       *int64           `json:"replay_of"`
+    CreatedAt      string           `json:"created_at"`
+    DeliveredAt    *string          `json:"delivered_at"`
+    History        []WebhookAttempt `json:"history,omitempty"`
+}
+
+type WebhookAttempt struct {
+    AttemptedAt  string  `json:"attempted_at"`
+    StatusCode   *int    `json:"status_code"`
+    DurationMs   int64   `json:"duration_ms"`
+    Error        *string `json:"error"`
+    ResponseBody string  `json:"response_body"`
+}
+
+// --- Request bodies (named so the OpenAPI spec can describe them) ---
+
+type AssignTruckRequest struct {
+    TruckID *int `json:"truck_id"` // null unassigns
+}
+
+type AssignDriverRequest struct {
+    DriverID *int `json:"driver_id"` // null unassigns
+}
+
+type LinkAttachmentRequest struct {
+    URL         string `json:"url"` // absolute http(s) URL, e.g. a dashcam clip
+    Description string `json:"description"`
+}
+
+type OpenDisputeRequest struct {
+    Reason       string `json:"reason"`
+    OpenedBy     string `json:"opened_by"`
+    OpenedByRole string `json:"opened_by_role" enum:"driver,manager"`
+}
+
+type DisputeTransitionRequest struct {
+    Status   string `json:"status" enum:"under_review,upheld,overturned"`
+    Reviewer string `json:"reviewer"`
+    Notes    string `json:"notes"`
+}
+
+type PeriodActionRequest struct {
+    Actor string `json:"actor"` // required to approve
+}
+
+type PayrollExportRequest struct {
+    ExportedBy string `json:"exported_by"`
+    Reissue    bool   `json:"reissue"`
+    Reason     string `json:"reason"` // required for a reissue
+}
+
+type WebhookReplayRequest struct {
+    Since  string `json:"since"`                          // RFC 3339
+    Status string `json:"status" enum:"delivered,failed"` // optional
+}
+
+// --- Responses built from several records ---
+
+type HealthStatus struct {
+    Status string `json:"status" enum:"ok,unhealthy"`
+    Time   string `json:"time,omitempty"`
+    Error  string `json:"error,omitempty"`
+}
+
+// Readiness is the /readyz answer: ready only when every check passes.
+type Readiness struct {
+    Status string                 `json:"status" enum:"ready,unavailable"`
+    Time   string                 `json:"time"`
+    Checks map[string]HealthCheck `json:"checks"` // database, migrations, scheduler, filestore, outbox; server while shutting down
+}
+
+type HealthCheck struct {
+    Status    string  `json:"status" enum:"ok,fail,skip"` // skip: not run on this replica (JOBS_ENABLED=false)
+    LatencyMs float64 `json:"latency_ms"`
+    Detail    string  `json:"detail,omitempty"`
+    Error     string  `json:"error,omitempty"`
+}
+
+type Bootstrap struct {
+    Trucks           []Truck          `json:"trucks"`
+    Drivers          []Driver         `json:"drivers"`
+    DriverTypes      []DriverType     `json:"driver_types"`
+    SafetyCategories []SafetyCategory `json:"safety_categories"`
+    ScorecardMetrics []ScoreCardItem  `json:"scorecard_metrics"`
+    SafetyEvents     []SafetyEvent    `json:"safety_events"`
+    ScorecardEvents  []ScoreCardEvent `json:"scorecard_events"`
+}
+
+type DriverStats struct {
+    EventCount         int    `json:"eventCount"`
+    TotalBonusScore    int    `json:"totalBonusScore"`
+    TotalPIScore       int    `json:"totalPIScore"`
+    Status             string `json:"status" enum:"Good,Warning"`
+    ExpiredCredentials int    `json:"expiredCredentials"`
+    CredentialsExpired bool   `json:"credentialsExpired"`
+    BonusEligible      bool   `json:"bonusEligible"`
+}
+
+type AssignTruckResult struct {
+    Status          string `json:"status"`
+    AssignedTruckID *int   `json:"assigned_truck_id"`
+}
+
+type AssignDriverResult struct {
+    Driver *Driver `json:"driver"`
+    Truck  Truck   `json:"truck"`
+}
+
+type PhotoResult struct {
+    ProfilePic string `json:"profile_pic"`
+}
+
+type CredentialFileResult struct {
+    FileName        string `json:"file_name"`
+    FileContentType string `json:"file_content_type"`
+    Size            int    `json:"size"`
+}
+
+type WebhookEventType struct {
+    EventType   string `json:"event_type"`
+    Description string `json:"description"`
+}
+
+type WebhookPingResult struct {
+    DeliveryID int64  `json:"delivery_id"`
+    EventID    string `json:"event_id"`
+}
+
+type WebhookReplayResult struct {
+    Queued int64 `json:"queued"`
+}
+
+// PreconditionFailed is the 412 body for a stale If-Match; Current is the record as stored now.
+type PreconditionFailed struct {
+    Message string `json:"message"`
+    Current any    `json:"current"`
+}
+
+type APIError struct {
+    Message   string `json:"message"`
+    RequestID string `json:"request_id,omitempty"` // same as the X-Request-ID header; quote it when reporting a problem
+}
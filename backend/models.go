@@ -1,73 +1,63 @@
 // models.go
 package main
 
-type Truck struct {
-    TruckID    int    `json:"truck_id"`
-    UnitNumber string `json:"unit_number"`
-    Year       int    `json:"year"`
-    Status     string `json:"status"` // "available" | "maintenance" | "assigned"
-}
-
-type Driver struct {
-    DriverID     int     `json:"driver_id"`
-    DriverCode   string  `json:"driver_code"`
-    FirstName    string  `json:"first_name"`
-    LastName     string  `json:"last_name"`
-    StartDate    string  `json:"start_date"` // YYYY-MM-DD (Winnipeg local date)
-    TruckID      *int    `json:"truck_id"`
-    DriverTypeID *int    `json:"driver_type_id"`
-    ProfilePic   *string `json:"profile_pic"`
-}
-
-type DriverType struct {
-    DriverTypeID int    `json:"driver_type_id"`
-    DriverType   string `json:"driver_type"`
-}
-
-type SafetyCategory struct {
-    CategoryID    int    `json:"category_id"`
-    Code          string `json:"code"`
-    Description   string `json:"description"`
-    ScoringSystem int    `json:"scoring_system"`
-    PIScore       int    `json:"p_i_score"`
-}
-
-type ScoreCardItem struct {
-    ScCategoryID  int    `json:"sc_category_id"`
-    ScCategory    string `json:"sc_category"`    // 'SAFETY' | 'MAINTENANCE' | 'DISPATCH'
-    ScDescription string `json:"sc_description"`
-    DriverTypeID  *int   `json:"driver_type_id"` // null for global
-}
-
-type SafetyEvent struct {
-    SafetyEventID int    `json:"safety_event_id"`
-    DriverID      int    `json:"driver_id"`
-    EventDate     string `json:"event_date"` // YYYY-MM-DD (Winnipeg local date)
-    CategoryID    int    `json:"category_id"`
-    Notes         string `json:"notes"`
-    BonusScore    int    `json:"bonus_score"`
-    PIScore       int    `json:"p_i_score"`
-    BonusPeriod   bool   `json:"bonus_period"`
-}
-
-type ScoreCardEvent struct {
-    ScorecardEventID int    `json:"scorecard_event_id"`
-    DriverID         int    `json:"driver_id"`
-    EventDate        string `json:"event_date"`     // YYYY-MM-DD (Winnipeg local date)
-    ScCategoryID     int    `json:"sc_category_id"`
-    ScScore          int    `json:"sc_score"`
-    Notes            string `json:"notes"`
-}
-
-type TruckHistoryEvent struct {
-    TruckHistoryID int     `json:"truck_history_id"`
-    TruckID        int     `json:"truck_id"`
-    DriverID       *int    `json:"driver_id"`
-    Date           string  `json:"date"` // ISO8601 Winnipeg local datetime
-    Type           string  `json:"type"` // 'assignment' | 'maintenance' | 'status_change'
-    Notes          *string `json:"notes"`
-}
-
-type APIError struct {
-    Message string `json:"message"`
-}
+import "driver-safety-bonus/model"
+
+// The API types live in package model so the Go client can use them too.
+type (
+    Truck                    = model.Truck
+    Driver                   = model.Driver
+    DriverType               = model.DriverType
+    SafetyCategory           = model.SafetyCategory
+    ScoreCardItem            = model.ScoreCardItem
+    SafetyEvent              = model.SafetyEvent
+    ScoreCardEvent           = model.ScoreCardEvent
+    TruckHistoryEvent        = model.TruckHistoryEvent
+    Attachment               = model.Attachment
+    DriverCredential         = model.DriverCredential
+    ExpiringCredential       = model.ExpiringCredential
+    SafetyEventDispute       = model.SafetyEventDispute
+    DisputeTransition        = model.DisputeTransition
+    BonusPeriod              = model.BonusPeriod
+    BonusLine                = model.BonusLine
+    PayrollExport            = model.PayrollExport
+    ReportSeries             = model.ReportSeries
+    SeriesValues             = model.SeriesValues
+    TopOffender              = model.TopOffender
+    PeriodTotals             = model.PeriodTotals
+    SafetyTrend              = model.SafetyTrend
+    InspectionReport         = model.InspectionReport
+    JobRun                   = model.JobRun
+    JobStatus                = model.JobStatus
+    ScorecardSummary         = model.ScorecardSummary
+    ScorecardChecklist       = model.ScorecardChecklist
+    MissingScorecardItem     = model.MissingScorecardItem
+    NotificationUser         = model.NotificationUser
+    NotificationPreference   = model.NotificationPreference
+    OutboxMessage            = model.OutboxMessage
+    WebhookSubscription      = model.WebhookSubscription
+    WebhookDelivery          = model.WebhookDelivery
+    WebhookAttempt           = model.WebhookAttempt
+    AssignTruckRequest       = model.AssignTruckRequest
+    AssignDriverRequest      = model.AssignDriverRequest
+    LinkAttachmentRequest    = model.LinkAttachmentRequest
+    OpenDisputeRequest       = model.OpenDisputeRequest
+    DisputeTransitionRequest = model.DisputeTransitionRequest
+    PeriodActionRequest      = model.PeriodActionRequest
+    PayrollExportRequest     = model.PayrollExportRequest
+    WebhookReplayRequest     = model.WebhookReplayRequest
+    HealthStatus             = model.HealthStatus
+    Readiness                = model.Readiness
+    HealthCheck              = model.HealthCheck
+    Bootstrap                = model.Bootstrap
+    DriverStats              = model.DriverStats
+    AssignTruckResult        = model.AssignTruckResult
+    AssignDriverResult       = model.AssignDriverResult
+    PhotoResult              = model.PhotoResult
+    CredentialFileResult     = model.CredentialFileResult
+    WebhookEventType         = model.WebhookEventType
+    WebhookPingResult        = model.WebhookPingResult
+    WebhookReplayResult      = model.WebhookReplayResult
+    PreconditionFailed       = model.PreconditionFailed
+    APIError                 = model.APIError
+)
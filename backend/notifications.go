@@ -0,0 +1,707 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "net/mail"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "text/template"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+const (
+    notifySafetyEventRecorded = "safety_event.recorded"
+    notifyDriverHighRisk      = "driver.high_risk"
+    notifyPeriodApproved      = "bonus_period.approved"
+    notifyScorecardsMissing   = "scorecards.missing"
+    notifyCredentialsExpiring = "credentials.expiring"
+    notifyTest                = "test"
+
+    outboxMaxAttempts = 8
+    outboxBatchSize   = 20
+    outboxPollEvery   = 15 * time.Second
+)
+
+type notificationType struct {
+    description string
+    aboutDriver bool     // driver-role users only get these, and only about themselves
+    roles       []string // roles subscribed by default
+}
+
+var notificationTypes = map[string]notificationType{
+    notifySafetyEventRecorded: {"A safety event was recorded against the driver", true, []string{"driver"}},
+    notifyDriverHighRisk:      {"A driver crossed into high risk", true, []string{"manager", "supervisor"}},
+    notifyPeriodApproved:      {"A bonus period was approved for payroll", false, []string{"payroll", "manager"}},
+    notifyScorecardsMissing:   {"Monthly scorecards still missing", false, []string{"supervisor"}},
+    notifyCredentialsExpiring: {"Driver credentials about to expire", false, []string{"manager", "supervisor"}},
+}
+
+// Built-in templates: a "Subject:" line, a blank line, then the body. A file named
+// <event_type>.tmpl in NOTIFY_TEMPLATE_DIR replaces the built-in one.
+var notificationTemplateText = map[string]string{
+    notifySafetyEventRecorded: `Subject: Safety event recorded on {{.Event.EventDate}}
+
+Hi {{.Recipient.Name}},
+
+A safety event was recorded for {{.Driver.Name}} ({{.Driver.Code}}):
+
+  Date:         {{.Event.EventDate}}
+  Category:     {{.Category.Code}} {{.Category.Description}}
+  Bonus points: {{.Event.BonusScore}}
+{{- if .Event.Notes}}
+  Notes:        {{.Event.Notes}}
+{{- end}}
+
+If you believe this is wrong you can ask your manager to open a dispute.
+`,
+    notifyDriverHighRisk: `Subject: {{.Driver.Name}} is now high risk ({{.Points}} points)
+
+Hi {{.Recipient.Name}},
+
+{{.Driver.Name}} ({{.Driver.Code}}) now has {{.Points}} safety points, above the high-risk
+threshold of {{.Threshold}}. The latest event was {{.Category.Code}} {{.Category.Description}} on {{.Event.EventDate}}.
+`,
+    notifyPeriodApproved: `Subject: Bonus period {{.Period.Period}} approved
+
+Hi {{.Recipient.Name}},
+
+Bonus period {{.Period.Period}} ({{.Period.StartsOn}} to {{.Period.EndsOn}}) was approved by {{.Approver}}
+and is ready for payroll export.
+
+  Drivers:          {{.Lines}}
+  Eligible drivers: {{.Eligible}}
+  Total payout:     ${{printf "%.2f" .Total}}
+`,
+    notifyScorecardsMissing: `Subject: {{len .Drivers}} drivers are missing scorecards for {{.Month}}
+
+Hi {{.Recipient.Name}},
+
+These drivers still have scorecard items to enter for {{.Month}}:
+{{range .Drivers}}
+  - {{.}}
+{{- end}}
+`,
+    notifyCredentialsExpiring: `Subject: {{len .Credentials}} driver credentials expiring soon
+
+Hi {{.Recipient.Name}},
+
+The following credentials expire within {{.Days}} days:
+{{range .Credentials}}
+  - {{.}}
+{{- end}}
+`,
+    notifyTest: `Subject: Test notification
+
+Hi {{.Recipient.Name}},
+
+This is a test message from the driver safety system. If you can read it, email delivery works.
+`,
+}
+
+type notificationTemplate struct {
+    subject *template.Template
+    body    *template.Template
+}
+
+var (
+    notificationTemplates = map[string]notificationTemplate{}
+    mailer                MailTransport
+    outboxWake            = make(chan struct{}, 1)
+)
+
+// loadNotificationTemplates parses the built-in templates and any overrides in dir.
+func loadNotificationTemplates(dir string) error {
+    for name, text := range notificationTemplateText {
+        if dir != "" {
+            if data, err := os.ReadFile(filepath.Join(dir, name+".tmpl")); err == nil {
+                text = string(data)
+            } else if !os.IsNotExist(err) {
+                return err
+            }
+        }
+        head, body, ok := strings.Cut(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n")
+        if !ok || !strings.HasPrefix(head, "Subject:") {
+            return fmt.Errorf("template %s must start with a Subject: line and a blank line", name)
+        }
+        subject, err := template.New(name + ".subject").Parse(strings.TrimSpace(strings.TrimPrefix(head, "Subject:")))
+        if err != nil {
+            return err
+        }
+        bodyTmpl, err := template.New(name).Parse(body)
+        if err != nil {
+            return err
+        }
+        notificationTemplates[name] = notificationTemplate{subject: subject, body: bodyTmpl}
+    }
+    return nil
+}
+
+func notificationDefault(role, eventType string) bool {
+    for _, r := range notificationTypes[eventType].roles {
+        if r == role {
+            return true
+        }
+    }
+    return false
+}
+
+type notificationDriver struct {
+    ID   int
+    Code string
+    Name string
+}
+
+func loadNotificationDriver(ctx context.Context, id int) (notificationDriver, error) {
+    d := notificationDriver{ID: id}
+    var first, last string
+    err := queryRow(ctx, `SELECT driver_code, first_name, last_name FROM drivers WHERE driver_id=?`, id).Scan(&d.Code, &first, &last)
+    d.Name = strings.TrimSpace(first + " " + last)
+    return d, err
+}
+
+// notify renders eventType for every subscribed recipient and queues the messages.
+// driverID is the driver the event is about (0 for fleet-wide events). Failures are
+// logged; a notification problem never fails the request that caused it.
+func notify(ctx context.Context, eventType string, driverID int, data map[string]any) {
+    if err := enqueueNotification(ctx, eventType, driverID, data, nil); err != nil {
+        slog.WarnContext(ctx, "notification not queued", "event", eventType, "err", err)
+    }
+}
+
+func enqueueNotification(ctx context.Context, eventType string, driverID int, data map[string]any, only *NotificationUser) error {
+    tmpl, ok := notificationTemplates[eventType]
+    if !ok {
+        return fmt.Errorf("no template for %s", eventType)
+    }
+
+    var recipients []NotificationUser
+    if only != nil {
+        recipients = []NotificationUser{*only}
+    } else {
+        rows, err := queryRows(ctx, `
+            SELECT u.user_id, u.email, u.name, u.role, u.driver_id, p.enabled
+            FROM notification_users u
+            LEFT JOIN notification_preferences p ON p.user_id = u.user_id AND p.event_type = ?
+            WHERE u.active = TRUE`, eventType)
+        if err != nil {
+            return err
+        }
+        for rows.Next() {
+            var (
+                u        NotificationUser
+                driverNo sql.NullInt64
+                enabled  sql.NullBool
+            )
+            if err := rows.Scan(&u.UserID, &u.Email, &u.Name, &u.Role, &driverNo, &enabled); err != nil {
+                continue
+            }
+            if u.Role == "driver" && (!notificationTypes[eventType].aboutDriver || !driverNo.Valid || int(driverNo.Int64) != driverID) {
+                continue
+            }
+            if enabled.Valid && !enabled.Bool || !enabled.Valid && !notificationDefault(u.Role, eventType) {
+                continue
+            }
+            recipients = append(recipients, u)
+        }
+        rows.Close()
+    }
+
+    now := time.Now().In(localTZ)
+    queued := 0
+    for _, u := range recipients {
+        vars := map[string]any{"Recipient": u}
+        for k, v := range data {
+            vars[k] = v
+        }
+        var subject, body strings.Builder
+        if err := tmpl.subject.Execute(&subject, vars); err != nil {
+            return err
+        }
+        if err := tmpl.body.Execute(&body, vars); err != nil {
+            return err
+        }
+        var userID any
+        if u.UserID != 0 {
+            userID = u.UserID
+        }
+        if _, err := exec(ctx, `
+            INSERT INTO notification_outbox (user_id, recipient, event_type, subject, body, status, attempts, next_attempt_at, created_at)
+            VALUES (?, ?, ?, ?, ?, 'pending', 0, ?, ?)`,
+            userID, (&mail.Address{Name: u.Name, Address: u.Email}).String(), eventType, subject.String(), body.String(), now, now); err != nil {
+            return err
+        }
+        queued++
+    }
+    if queued > 0 {
+        select {
+        case outboxWake <- struct{}{}:
+        default:
+        }
+    }
+    return nil
+}
+
+// driverRiskPoints is the driver's all-time safety points, as on the Dashboard.
+func driverRiskPoints(ctx context.Context, driverID int) int {
+    var points int
+    _ = queryRow(ctx, `
+        SELECT COALESCE(SUM(CASE WHEN dispute_status='overturned' THEN 0 ELSE bonus_score END), 0)
+        FROM safety_events WHERE driver_id=?`, driverID).Scan(&points)
+    return points
+}
+
+// notifySafetyEvent tells the driver about a new event and, when the event takes
+// them over the high-risk threshold, their managers. before is the driver's points
+// prior to the write.
+func notifySafetyEvent(ctx context.Context, e SafetyEvent, before int, created bool) {
+    driver, err := loadNotificationDriver(ctx, e.DriverID)
+    if err != nil {
+        slog.WarnContext(ctx, "safety event notification skipped", "safety_event_id", e.SafetyEventID, "err", err)
+        return
+    }
+    category := SafetyCategory{}
+    _ = queryRow(ctx, `SELECT code, description FROM safety_categories WHERE category_id=?`, e.CategoryID).Scan(&category.Code, &category.Description)
+    data := map[string]any{"Driver": driver, "Event": e, "Category": category}
+
+    if created {
+        notify(ctx, notifySafetyEventRecorded, e.DriverID, data)
+    }
+    after := driverRiskPoints(ctx, e.DriverID)
+    if before <= conf.Thresholds.HighRiskPoints && after > conf.Thresholds.HighRiskPoints {
+        data["Points"], data["Threshold"] = after, conf.Thresholds.HighRiskPoints
+        notify(ctx, notifyDriverHighRisk, e.DriverID, data)
+    }
+}
+
+// --- Outbox delivery ---
+
+// runOutbox delivers queued mail until ctx is cancelled. Replicas claim batches
+// with a lock that expires, so a crashed sender's messages are picked up again.
+func runOutbox(ctx context.Context) {
+    ticker := time.NewTicker(outboxPollEvery)
+    defer ticker.Stop()
+    for {
+        // A batch under way finishes even when ctx is cancelled (see serve)
+        for deliverOutboxBatch(context.WithoutCancel(ctx)) == outboxBatchSize {
+        }
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        case <-outboxWake:
+        }
+    }
+}
+
+func deliverOutboxBatch(parent context.Context) int {
+    ctx, cancel := context.WithTimeout(parent, 2*time.Minute)
+    defer cancel()
+
+    now := time.Now().In(localTZ)
+    if _, err := exec(ctx, `
+        UPDATE notification_outbox SET status='sending', locked_by=?, locked_until=?
+        WHERE (status='pending' AND next_attempt_at <= ?) OR (status='sending' AND locked_until < ?)
+        ORDER BY next_attempt_at, outbox_id
+        LIMIT ?`, jobRunnerID, now.Add(5*time.Minute), now, now, outboxBatchSize); err != nil {
+        slog.WarnContext(ctx, "outbox claim failed", "err", err)
+        return 0
+    }
+    rows, err := queryRows(ctx, `SELECT outbox_id, recipient, subject, body, attempts FROM notification_outbox WHERE status='sending' AND locked_by=?`, jobRunnerID)
+    if err != nil {
+        slog.WarnContext(ctx, "outbox read failed", "err", err)
+        return 0
+    }
+    type claimed struct {
+        id       int64
+        msg      MailMessage
+        attempts int
+    }
+    var batch []claimed
+    for rows.Next() {
+        var m claimed
+        if err := rows.Scan(&m.id, &m.msg.To, &m.msg.Subject, &m.msg.Body, &m.attempts); err == nil {
+            batch = append(batch, m)
+        }
+    }
+    rows.Close()
+
+    for _, m := range batch {
+        sendCtx, cancelSend := context.WithTimeout(ctx, 30*time.Second)
+        err := mailer.Send(sendCtx, m.msg)
+        cancelSend()
+        now := time.Now().In(localTZ)
+        if err == nil {
+            _, _ = exec(ctx, `UPDATE notification_outbox SET status='sent', attempts=attempts+1, sent_at=?, last_error=NULL, locked_by=NULL, locked_until=NULL WHERE outbox_id=?`, now, m.id)
+            continue
+        }
+        attempts := m.attempts + 1
+        status := "pending"
+        if attempts >= outboxMaxAttempts {
+            status = "failed"
+        }
+        slog.WarnContext(ctx, "mail delivery failed", "outbox_id", m.id, "to", m.msg.To, "attempt", attempts, "err", err)
+        _, _ = exec(ctx, `
+            UPDATE notification_outbox SET status=?, attempts=?, next_attempt_at=?, last_error=?, locked_by=NULL, locked_until=NULL
+            WHERE outbox_id=?`, status, attempts, now.Add(outboxBackoff(attempts)), err.Error(), m.id)
+    }
+    return len(batch)
+}
+
+// outboxBackoff doubles from one minute, capped at six hours.
+func outboxBackoff(attempts int) time.Duration {
+    d := time.Minute << (attempts - 1)
+    if attempts > 10 || d > 6*time.Hour {
+        return 6 * time.Hour
+    }
+    return d
+}
+
+// --- Notification users & preferences ---
+
+const notificationUserColumns = `user_id, email, name, role, driver_id, active`
+
+func scanNotificationUser(row rowScanner, u *NotificationUser) error {
+    var driverID sql.NullInt64
+    if err := row.Scan(&u.UserID, &u.Email, &u.Name, &u.Role, &driverID, &u.Active); err != nil {
+        return err
+    }
+    if driverID.Valid {
+        val := int(driverID.Int64)
+        u.DriverID = &val
+    }
+    return nil
+}
+
+func validateNotificationUser(u *NotificationUser) string {
+    u.Email = strings.TrimSpace(u.Email)
+    if addr, err := mail.ParseAddress(u.Email); err != nil || addr.Address != u.Email {
+        return "email must be a plain address like name@example.com"
+    }
+    if strings.TrimSpace(u.Name) == "" {
+        return "name is required"
+    }
+    switch u.Role {
+    case "manager", "supervisor", "payroll":
+        u.DriverID = nil
+    case "driver":
+        if u.DriverID == nil {
+            return "driver_id is required for the driver role"
+        }
+    default:
+        return "role must be manager, supervisor, payroll or driver"
+    }
+    return ""
+}
+
+func getNotificationUsers(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    rows, err := queryRows(ctx, `SELECT `+notificationUserColumns+` FROM notification_users ORDER BY name`)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    var users []NotificationUser
+    for rows.Next() {
+        var u NotificationUser
+        if err := scanNotificationUser(rows, &u); err != nil {
+            continue
+        }
+        users = append(users, u)
+    }
+    c.JSON(http.StatusOK, users)
+}
+
+func createNotificationUser(c *gin.Context) {
+    u := NotificationUser{Active: true}
+    if err := c.ShouldBindJSON(&u); err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    if msg := validateNotificationUser(&u); msg != "" {
+        c.JSON(http.StatusBadRequest, APIError{Message: msg})
+        return
+    }
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    res, err := exec(ctx, `INSERT INTO notification_users (email, name, role, driver_id, active) VALUES (?, ?, ?, ?, ?)`,
+        u.Email, u.Name, u.Role, u.DriverID, u.Active)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    id, _ := res.LastInsertId()
+    u.UserID = int(id)
+    c.JSON(http.StatusOK, u)
+}
+
+func updateNotificationUser(c *gin.Context) {
+    id := atoi(c.Param("id"))
+    var u NotificationUser
+    if err := c.ShouldBindJSON(&u); err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    if msg := validateNotificationUser(&u); msg != "" {
+        c.JSON(http.StatusBadRequest, APIError{Message: msg})
+        return
+    }
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    res, err := exec(ctx, `UPDATE notification_users SET email=?, name=?, role=?, driver_id=?, active=? WHERE user_id=?`,
+        u.Email, u.Name, u.Role, u.DriverID, u.Active, id)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    // MySQL counts only changed rows, so an unchanged user also reports 0
+    if n, _ := res.RowsAffected(); n == 0 {
+        var one int
+        err = queryRow(ctx, `SELECT 1 FROM notification_users WHERE user_id=?`, id).Scan(&one)
+        if err == sql.ErrNoRows {
+            c.JSON(http.StatusNotFound, APIError{Message: "notification user not found"})
+            return
+        }
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+            return
+        }
+    }
+    u.UserID = id
+    c.JSON(http.StatusOK, u)
+}
+
+func deleteNotificationUser(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    if _, err := exec(ctx, `DELETE FROM notification_users WHERE user_id=?`, c.Param("id")); err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    c.Status(http.StatusNoContent)
+}
+
+func loadNotificationPreferences(ctx context.Context, userID int) (NotificationUser, []NotificationPreference, error) {
+    var u NotificationUser
+    if err := scanNotificationUser(queryRow(ctx, `SELECT `+notificationUserColumns+` FROM notification_users WHERE user_id=?`, userID), &u); err != nil {
+        return u, nil, err
+    }
+    custom := map[string]bool{}
+    rows, err := queryRows(ctx, `SELECT event_type, enabled FROM notification_preferences WHERE user_id=?`, userID)
+    if err != nil {
+        return u, nil, err
+    }
+    for rows.Next() {
+        var (
+            t       string
+            enabled bool
+        )
+        if err := rows.Scan(&t, &enabled); err == nil {
+            custom[t] = enabled
+        }
+    }
+    rows.Close()
+
+    prefs := []NotificationPreference{}
+    for _, t := range []string{notifySafetyEventRecorded, notifyDriverHighRisk, notifyPeriodApproved, notifyScorecardsMissing, notifyCredentialsExpiring} {
+        nt := notificationTypes[t]
+        if u.Role == "driver" && !nt.aboutDriver {
+            continue
+        }
+        p := NotificationPreference{EventType: t, Description: nt.description, Enabled: notificationDefault(u.Role, t)}
+        if enabled, ok := custom[t]; ok {
+            p.Enabled, p.Custom = enabled, true
+        }
+        prefs = append(prefs, p)
+    }
+    return u, prefs, nil
+}
+
+func getNotificationPreferences(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    _, prefs, err := loadNotificationPreferences(ctx, atoi(c.Param("id")))
+    if err == sql.ErrNoRows {
+        c.JSON(http.StatusNotFound, APIError{Message: "notification user not found"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, prefs)
+}
+
+// PUT /notification-users/:id/preferences {"driver.high_risk": false, "scorecards.missing": null}
+// true/false overrides the role default; null goes back to it.
+func updateNotificationPreferences(c *gin.Context) {
+    id := atoi(c.Param("id"))
+    var body map[string]*bool
+    if err := c.ShouldBindJSON(&body); err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    for t := range body {
+        if _, ok := notificationTypes[t]; !ok {
+            c.JSON(http.StatusBadRequest, APIError{Message: fmt.Sprintf("unknown event type %q", t)})
+            return
+        }
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    for t, enabled := range body {
+        var err error
+        if enabled == nil {
+            _, err = exec(ctx, `DELETE FROM notification_preferences WHERE user_id=? AND event_type=?`, id, t)
+        } else {
+            _, err = exec(ctx, `
+                INSERT INTO notification_preferences (user_id, event_type, enabled) VALUES (?, ?, ?)
+                ON DUPLICATE KEY UPDATE enabled=VALUES(enabled)`, id, t, *enabled)
+        }
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+            return
+        }
+    }
+    _, prefs, err := loadNotificationPreferences(ctx, id)
+    if err == sql.ErrNoRows {
+        c.JSON(http.StatusNotFound, APIError{Message: "notification user not found"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, prefs)
+}
+
+// --- Outbox ---
+
+// GET /notifications/outbox?status=failed&limit=100&beforeId=
+//
+// Newest first; pass the last outbox_id of a page as beforeId for the next one.
+func getOutbox(c *gin.Context) {
+    limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+    if err != nil || limit <= 0 || limit > 1000 {
+        limit = 100
+    }
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    q := `SELECT outbox_id, user_id, recipient, event_type, subject, body, status, attempts, next_attempt_at, last_error, created_at, sent_at FROM notification_outbox`
+    var (
+        where []string
+        args  []any
+    )
+    if status := c.Query("status"); status != "" {
+        where = append(where, `status=?`)
+        args = append(args, status)
+    }
+    if before := c.Query("beforeId"); before != "" {
+        where = append(where, `outbox_id < ?`)
+        args = append(args, atoi(before))
+    }
+    if len(where) > 0 {
+        q += ` WHERE ` + strings.Join(where, ` AND `)
+    }
+    rows, err := queryRows(ctx, q+` ORDER BY outbox_id DESC LIMIT ?`, append(args, limit)...)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    out := []OutboxMessage{}
+    for rows.Next() {
+        var (
+            m                    OutboxMessage
+            userID               sql.NullInt64
+            lastError            sql.NullString
+            nextAttempt, created time.Time
+            sentAt               sql.NullTime
+        )
+        if err := rows.Scan(&m.OutboxID, &userID, &m.Recipient, &m.EventType, &m.Subject, &m.Body, &m.Status, &m.Attempts, &nextAttempt, &lastError, &created, &sentAt); err != nil {
+            continue
+        }
+        if userID.Valid {
+            val := int(userID.Int64)
+            m.UserID = &val
+        }
+        if lastError.Valid {
+            m.LastError = &lastError.String
+        }
+        m.NextAttemptAt = nextAttempt.In(localTZ).Format(time.RFC3339)
+        m.CreatedAt = created.In(localTZ).Format(time.RFC3339)
+        if sentAt.Valid {
+            val := sentAt.Time.In(localTZ).Format(time.RFC3339)
+            m.SentAt = &val
+        }
+        out = append(out, m)
+    }
+    c.JSON(http.StatusOK, out)
+}
+
+// POST /notifications/outbox/:id/retry puts a failed (or pending) message back at the front of the queue.
+func retryOutboxMessage(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    res, err := exec(ctx, `
+        UPDATE notification_outbox SET status='pending', next_attempt_at=?, attempts=LEAST(attempts, ?)
+        WHERE outbox_id=? AND status IN ('pending', 'failed')`, time.Now().In(localTZ), outboxMaxAttempts-1, c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        c.JSON(http.StatusConflict, APIError{Message: "message not found, already sent, or being sent"})
+        return
+    }
+    select {
+    case outboxWake <- struct{}{}:
+    default:
+    }
+    c.Status(http.StatusNoContent)
+}
+
+// POST /notifications/test {"email": "...", "name": "..."} queues a test message.
+func sendTestNotification(c *gin.Context) {
+    var u NotificationUser
+    if err := c.ShouldBindJSON(&u); err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    if u.Name == "" {
+        u.Name = u.Email
+    }
+    u.Role = "manager"
+    if msg := validateNotificationUser(&u); msg != "" {
+        c.JSON(http.StatusBadRequest, APIError{Message: msg})
+        return
+    }
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    if err := enqueueNotification(ctx, notifyTest, 0, nil, &u); err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    c.Status(http.StatusAccepted)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/gin-gonic/gin"
+)
+
+// withNotificationTemplates loads the templates from dir for the rest of the test.
+func withNotificationTemplates(t *testing.T, dir string) error {
+    t.Helper()
+    prev := notificationTemplates
+    notificationTemplates = map[string]notificationTemplate{}
+    t.Cleanup(func() { notificationTemplates = prev })
+    return loadNotificationTemplates(dir)
+}
+
+// A <event_type>.tmpl file replaces the built-in template; the others stay.
+func TestLoadNotificationTemplatesOverride(t *testing.T) {
+    dir := t.TempDir()
+    if err := os.WriteFile(filepath.Join(dir, "test.tmpl"), []byte("Subject: Hello {{.Recipient.Name}}\r\n\r\nCustom body\r\n"), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    if err := withNotificationTemplates(t, dir); err != nil {
+        t.Fatal(err)
+    }
+    if len(notificationTemplates) != len(notificationTemplateText) {
+        t.Errorf("%d templates loaded, want %d", len(notificationTemplates), len(notificationTemplateText))
+    }
+    var subject, body strings.Builder
+    vars := map[string]any{"Recipient": NotificationUser{Name: "Dana"}}
+    if err := notificationTemplates[notifyTest].subject.Execute(&subject, vars); err != nil {
+        t.Fatal(err)
+    }
+    if err := notificationTemplates[notifyTest].body.Execute(&body, vars); err != nil {
+        t.Fatal(err)
+    }
+    if subject.String() != "Hello Dana" || body.String() != "Custom body\n" {
+        t.Errorf("test template = %q / %q", subject.String(), body.String())
+    }
+}
+
+func TestLoadNotificationTemplatesInvalid(t *testing.T) {
+    for name, text := range map[string]string{
+        "no subject": "Hello\n\nbody",
+        "no body":    "Subject: Hi",
+        "bad syntax": "Subject: {{.Recipient.Name\n\nbody",
+    } {
+        dir := t.TempDir()
+        if err := os.WriteFile(filepath.Join(dir, notifyPeriodApproved+".tmpl"), []byte(text), 0o644); err != nil {
+            t.Fatal(err)
+        }
+        if err := withNotificationTemplates(t, dir); err == nil {
+            t.Errorf("%s: template accepted", name)
+        }
+    }
+}
+
+// Driver-role users only hear about themselves, and only for events about a
+// driver; everyone else follows their preference or the role default.
+func TestNotificationRecipients(t *testing.T) {
+    mock := withMockDB(t)
+    if err := withNotificationTemplates(t, ""); err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() {
+        select {
+        case <-outboxWake:
+        default:
+        }
+    })
+
+    userCols := []string{"user_id", "email", "name", "role", "driver_id", "enabled"}
+    data := map[string]any{
+        "Driver":    notificationDriver{ID: 3, Code: "D3", Name: "Cy Cole"},
+        "Points":    11,
+        "Threshold": 10,
+        "Category":  map[string]any{"Code": "SPD", "Description": "Speeding"},
+        "Event":     map[string]any{"EventDate": "2025-06-01"},
+    }
+    mock.ExpectQuery(`FROM notification_users u`).WithArgs(notifyDriverHighRisk).
+        WillReturnRows(sqlmock.NewRows(userCols).
+            AddRow(1, "mgr@example.com", "Mona", "manager", nil, nil).     // role default
+            AddRow(2, "sup@example.com", "Sam", "supervisor", nil, false). // opted out
+            AddRow(3, "pay@example.com", "Pat", "payroll", nil, nil).      // not a payroll event
+            AddRow(4, "cy@example.com", "Cy", "driver", 3, true).          // about themselves
+            AddRow(5, "di@example.com", "Di", "driver", 4, true).          // another driver
+            AddRow(6, "ed@example.com", "Ed", "driver", nil, true))        // no driver on record
+    for _, to := range []string{`"Mona" <mgr@example.com>`, `"Cy" <cy@example.com>`} {
+        mock.ExpectExec(`INSERT INTO notification_outbox`).
+            WithArgs(sqlmock.AnyArg(), to, notifyDriverHighRisk, "Cy Cole is now high risk (11 points)", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+            WillReturnResult(sqlmock.NewResult(1, 1))
+    }
+    if err := enqueueNotification(context.Background(), notifyDriverHighRisk, 3, data, nil); err != nil {
+        t.Fatal(err)
+    }
+
+    // Fleet-wide events never go to drivers, even ones who opted in
+    mock.ExpectQuery(`FROM notification_users u`).WithArgs(notifyScorecardsMissing).
+        WillReturnRows(sqlmock.NewRows(userCols).
+            AddRow(2, "sup@example.com", "Sam", "supervisor", nil, nil).
+            AddRow(4, "cy@example.com", "Cy", "driver", 3, true))
+    mock.ExpectExec(`INSERT INTO notification_outbox`).
+        WithArgs(2, `"Sam" <sup@example.com>`, notifyScorecardsMissing, "1 drivers are missing scorecards for 2025-06",
+            sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+        WillReturnResult(sqlmock.NewResult(2, 1))
+    err := enqueueNotification(context.Background(), notifyScorecardsMissing, 0, map[string]any{"Month": "2025-06", "Drivers": []string{"D3 Cy Cole"}}, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestOutboxBackoff(t *testing.T) {
+    for attempts, want := range map[int]time.Duration{
+        1:  time.Minute,
+        2:  2 * time.Minute,
+        5:  16 * time.Minute,
+        9:  256 * time.Minute,
+        10: 6 * time.Hour,
+        40: 6 * time.Hour,
+    } {
+        if got := outboxBackoff(attempts); got != want {
+            t.Errorf("outboxBackoff(%d) = %s, want %s", attempts, got, want)
+        }
+    }
+}
+
+// Updating a user that does not exist is a 404; an update that changes nothing is not.
+func TestUpdateNotificationUserMissing(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+
+    user := `{"email": "mgr@example.com", "name": "Mona", "role": "manager", "active": true}`
+    for _, tc := range []struct {
+        exists bool
+        want   int
+    }{{false, http.StatusNotFound}, {true, http.StatusOK}} {
+        mock.ExpectExec(`UPDATE notification_users SET`).WillReturnResult(sqlmock.NewResult(0, 0))
+        rows := sqlmock.NewRows([]string{"1"})
+        if tc.exists {
+            rows.AddRow(1)
+        }
+        mock.ExpectQuery(`SELECT 1 FROM notification_users WHERE user_id=\?`).WithArgs(9).WillReturnRows(rows)
+        if w := testWrite(http.MethodPut, "/api/notification-users/9", "", user); w.Code != tc.want {
+            t.Errorf("exists %v: update = %d %s, want %d", tc.exists, w.Code, w.Body, tc.want)
+        }
+    }
+}
@@ -0,0 +1,600 @@
+package main
+
+import (
+    "encoding"
+    "encoding/json"
+    "net/http"
+    "reflect"
+    "sort"
+    "strconv"
+    "strings"
+
+    "driver-safety-bonus/config"
+
+    "github.com/gin-gonic/gin"
+)
+
+// The spec at /openapi.json is generated rather than hand-written: paths and path
+// parameters come from the Gin route table, schemas from the Go structs (json tags
+// for names, pointers for nullable, `enum` tags for allowed values), and apiDocs
+// adds what the router can't know: summaries, query parameters and the request and
+// response types. openapi_test.go fails when a route has no apiDocs entry.
+
+var openAPISpec map[string]any
+
+type queryParam struct {
+    name     string
+    desc     string
+    typ      string // "string" (default) or "integer"
+    enum     []string
+    required bool
+}
+
+type routeDoc struct {
+    summary  string
+    op       string // operationId; defaults to the handler's name
+    query    []queryParam
+    body     any    // JSON request body (a zero value of the Go type)
+    upload   string // non-JSON request body: "image" or "multipart"
+    response any    // JSON response (a zero value of the Go type); nil for none
+    status   int    // success status; 200, or 204 when there's no response
+    produces string // non-JSON success content type (files, PDFs, SSE)
+    errors   []int  // statuses beyond 400/404/500, e.g. 409
+    etag     bool   // single-record GET: ETag and If-None-Match (304)
+    ifMatch  bool   // versioned write: If-Match required (412/428)
+    export   bool   // ?format=csv|xlsx spreadsheet download
+}
+
+var (
+    dateRangeParams = []queryParam{
+        {name: "from", desc: "First day, YYYY-MM-DD"},
+        {name: "to", desc: "Last day, YYYY-MM-DD"},
+    }
+    eventFilterParams = append(dateRangeParams[:2:2], queryParam{name: "driverId", typ: "integer", desc: "Only this driver's events"})
+    reportParams      = []queryParam{
+        {name: "from", desc: "First day, YYYY-MM-DD (defaults to 12 months before `to`)"},
+        {name: "to", desc: "Last day, YYYY-MM-DD (defaults to today)"},
+    }
+    periodParam   = queryParam{name: "period", desc: "YYYY-MM or YYYY-Qn; defaults to the current month"}
+    monthParam    = queryParam{name: "month", desc: "YYYY-MM; defaults to the current month"}
+    limitParam    = queryParam{name: "limit", typ: "integer", desc: "Maximum rows returned"}
+    beforeIDParam = queryParam{name: "beforeId", typ: "integer", desc: "Next page: rows older than this id (the last id of the previous page)"}
+    categoryEnum  = []string{"SAFETY", "MAINTENANCE", "DISPATCH"}
+)
+
+// apiDocs describes every route, keyed "METHOD /path" exactly as registered.
+var apiDocs = map[string]routeDoc{
+    "GET /api/healthz":       {summary: "Healthcheck (database ping)", op: "healthz", response: HealthStatus{}, errors: []int{http.StatusServiceUnavailable}},
+    "GET /livez":             {summary: "Liveness: the process is serving", response: HealthStatus{}},
+    "GET /readyz":            {summary: "Readiness: database, migrations, scheduler, file store and outbox checks", response: Readiness{}, errors: []int{http.StatusServiceUnavailable}},
+    "GET /openapi.json":      {summary: "This OpenAPI document", produces: "application/json"},
+    "GET /metrics":           {summary: "Prometheus metrics: requests by route, database pool, domain gauges", op: "metrics", produces: "text/plain"},
+    "GET /swagger":           {summary: "Redirects to /swagger/", op: "swaggerRedirect", status: http.StatusMovedPermanently},
+    "GET /swagger/*filepath": {summary: "Swagger UI for this API (page and embedded assets)", produces: "text/html"},
+    "GET /api/bootstrap":     {summary: "Everything the UI needs on first load", response: Bootstrap{}},
+
+    // Drivers
+    "GET /api/drivers":                   {summary: "List drivers", op: "getDrivers", response: []Driver{}, export: true},
+    "POST /api/drivers":                  {summary: "Create a driver; profile_pic may be a base64 data URL", body: Driver{}, response: Driver{}},
+    "GET /api/drivers/:id":               {summary: "Get a driver", response: Driver{}, etag: true},
+    "PUT /api/drivers/:id":               {summary: "Replace a driver", body: Driver{}, response: Driver{}, ifMatch: true, errors: []int{http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType}},
+    "PATCH /api/drivers/:id":             {summary: "Change some of a driver's fields (merge patch)", body: Driver{}, response: Driver{}, ifMatch: true, errors: []int{http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType}},
+    "DELETE /api/drivers/:id":            {summary: "Delete a driver", ifMatch: true},
+    "GET /api/drivers/:id/stats":         {summary: "Event count, bonus/PI totals and bonus eligibility", response: DriverStats{}},
+    "POST /api/drivers/:id/assign-truck": {summary: "Assign a truck to the driver (null unassigns); logs truck history", body: AssignTruckRequest{}, response: AssignTruckResult{}},
+    "GET /api/drivers/:id/statement.pdf": {summary: "Printable bonus statement", query: []queryParam{periodParam}, produces: "application/pdf"},
+    "GET /api/drivers/:id/photo": {
+        summary: "Driver photo", query: []queryParam{{name: "size", enum: []string{"thumb"}, desc: "256px thumbnail"}},
+        produces: "image/*", etag: true,
+    },
+    "PUT /api/drivers/:id/photo": {
+        summary: "Upload the driver photo (raw image body or multipart field `file`)", upload: "image", response: PhotoResult{}, ifMatch: true,
+        errors: []int{http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType},
+    },
+    "DELETE /api/drivers/:id/photo": {summary: "Remove the driver photo", ifMatch: true},
+
+    // Driver credentials
+    "GET /api/drivers/:id/credentials":  {summary: "List a driver's credentials", response: []DriverCredential{}},
+    "POST /api/drivers/:id/credentials": {summary: "Add a credential", body: DriverCredential{}, response: DriverCredential{}},
+    "PUT /api/credentials/:id":          {summary: "Update a credential", body: DriverCredential{}, response: DriverCredential{}},
+    "DELETE /api/credentials/:id":       {summary: "Delete a credential"},
+    "GET /api/credentials/:id/file":     {summary: "Download the scanned document", produces: "application/octet-stream"},
+    "PUT /api/credentials/:id/file": {
+        summary: "Upload the scanned document (multipart field `file`)", upload: "multipart", response: CredentialFileResult{},
+        errors: []int{http.StatusRequestEntityTooLarge},
+    },
+    "GET /api/compliance/expiring": {
+        summary: "Credentials expiring within the window (expired ones included)", response: []ExpiringCredential{},
+        query: []queryParam{{name: "days", typ: "integer", desc: "Window in days (default 30)"}},
+    },
+
+    // Driver types
+    "GET /api/driver-types":        {summary: "List driver types", response: []DriverType{}},
+    "POST /api/driver-types":       {summary: "Create a driver type", body: DriverType{}, response: DriverType{}},
+    "PUT /api/driver-types/:id":    {summary: "Replace a driver type", body: DriverType{}, response: DriverType{}},
+    "PATCH /api/driver-types/:id":  {summary: "Change some of a driver type's fields (merge patch)", body: DriverType{}, response: DriverType{}},
+    "DELETE /api/driver-types/:id": {summary: "Delete a driver type"},
+
+    // Trucks
+    "GET /api/trucks":                    {summary: "List trucks", op: "getTrucks", response: []Truck{}, export: true},
+    "POST /api/trucks":                   {summary: "Create a truck", body: Truck{}, response: Truck{}},
+    "GET /api/trucks/:id":                {summary: "Get a truck", response: Truck{}, etag: true},
+    "PUT /api/trucks/:id":                {summary: "Replace a truck", body: Truck{}, response: Truck{}, ifMatch: true},
+    "PATCH /api/trucks/:id":              {summary: "Change some of a truck's fields (merge patch)", body: Truck{}, response: Truck{}, ifMatch: true},
+    "DELETE /api/trucks/:id":             {summary: "Delete a truck (unassigns its driver)", ifMatch: true},
+    "GET /api/trucks/:id/history":        {summary: "Assignment and status history", op: "getTruckHistory", query: dateRangeParams, response: []TruckHistoryEvent{}, export: true},
+    "POST /api/trucks/:id/assign-driver": {summary: "Assign a driver to the truck (null unassigns); logs truck history", body: AssignDriverRequest{}, response: AssignDriverResult{}},
+
+    // Safety categories
+    "GET /api/safety-categories":        {summary: "List safety categories", response: []SafetyCategory{}},
+    "POST /api/safety-categories":       {summary: "Create a safety category", body: SafetyCategory{}, response: SafetyCategory{}},
+    "PUT /api/safety-categories/:id":    {summary: "Replace a safety category", body: SafetyCategory{}, response: SafetyCategory{}},
+    "PATCH /api/safety-categories/:id":  {summary: "Change some of a safety category's fields (merge patch)", body: SafetyCategory{}, response: SafetyCategory{}},
+    "DELETE /api/safety-categories/:id": {summary: "Delete a safety category"},
+
+    // Scorecard metrics
+    "GET /api/scorecard-metrics":        {summary: "List scorecard metrics", response: []ScoreCardItem{}},
+    "POST /api/scorecard-metrics":       {summary: "Create a scorecard metric", body: ScoreCardItem{}, response: ScoreCardItem{}},
+    "PUT /api/scorecard-metrics/:id":    {summary: "Replace a scorecard metric", body: ScoreCardItem{}, response: ScoreCardItem{}},
+    "PATCH /api/scorecard-metrics/:id":  {summary: "Change some of a scorecard metric's fields (merge patch)", body: ScoreCardItem{}, response: ScoreCardItem{}},
+    "DELETE /api/scorecard-metrics/:id": {summary: "Delete a scorecard metric"},
+
+    // Safety events
+    "GET /api/safety-events":                  {summary: "List safety events", op: "getSafetyEvents", query: eventFilterParams, response: []SafetyEvent{}, export: true},
+    "POST /api/safety-events":                 {summary: "Record a safety event", body: SafetyEvent{}, response: SafetyEvent{}},
+    "GET /api/safety-events/:id":              {summary: "Get a safety event", response: SafetyEvent{}, etag: true},
+    "PUT /api/safety-events/:id":              {summary: "Replace a safety event", body: SafetyEvent{}, response: SafetyEvent{}, ifMatch: true},
+    "PATCH /api/safety-events/:id":            {summary: "Change some of a safety event's fields (merge patch)", body: SafetyEvent{}, response: SafetyEvent{}, ifMatch: true},
+    "DELETE /api/safety-events/:id":           {summary: "Delete a safety event", ifMatch: true},
+    "GET /api/safety-events/:id/attachments":  {summary: "List evidence attached to a safety event", op: "getSafetyEventAttachments", response: []Attachment{}},
+    "POST /api/safety-events/:id/attachments": {summary: "Attach files (multipart field `file`, repeatable) or a link (JSON)", op: "addSafetyEventAttachments", upload: "multipart", body: LinkAttachmentRequest{}, response: []Attachment{}, errors: []int{http.StatusRequestEntityTooLarge}},
+    "GET /api/safety-events/:id/disputes":     {summary: "Disputes raised against a safety event", response: []SafetyEventDispute{}},
+    "POST /api/safety-events/:id/disputes":    {summary: "Dispute a safety event", body: OpenDisputeRequest{}, response: SafetyEventDispute{}, errors: []int{http.StatusConflict}},
+
+    // Disputes
+    "GET /api/disputes": {
+        summary: "List disputes", response: []SafetyEventDispute{},
+        query: []queryParam{{name: "status", enum: []string{"open", "under_review", "upheld", "overturned"}}, {name: "driverId", typ: "integer"}},
+    },
+    "GET /api/disputes/:id":             {summary: "Get a dispute with its transition history", response: SafetyEventDispute{}},
+    "POST /api/disputes/:id/transition": {summary: "Move a dispute to under_review, upheld or overturned", body: DisputeTransitionRequest{}, response: SafetyEventDispute{}, errors: []int{http.StatusConflict}},
+
+    // Scorecard events
+    "GET /api/scorecard-events":                  {summary: "List scorecard events", op: "getScoreCardEvents", query: eventFilterParams, response: []ScoreCardEvent{}, export: true},
+    "POST /api/scorecard-events":                 {summary: "Record a scorecard event", body: ScoreCardEvent{}, response: ScoreCardEvent{}},
+    "GET /api/scorecard-events/:id":              {summary: "Get a scorecard event", response: ScoreCardEvent{}, etag: true},
+    "PUT /api/scorecard-events/:id":              {summary: "Replace a scorecard event", body: ScoreCardEvent{}, response: ScoreCardEvent{}, ifMatch: true},
+    "PATCH /api/scorecard-events/:id":            {summary: "Change some of a scorecard event's fields (merge patch)", body: ScoreCardEvent{}, response: ScoreCardEvent{}, ifMatch: true},
+    "DELETE /api/scorecard-events/:id":           {summary: "Delete a scorecard event", ifMatch: true},
+    "GET /api/scorecard-events/:id/attachments":  {summary: "List evidence attached to a scorecard event", op: "getScoreCardEventAttachments", response: []Attachment{}},
+    "POST /api/scorecard-events/:id/attachments": {summary: "Attach files (multipart field `file`, repeatable) or a link (JSON)", op: "addScoreCardEventAttachments", upload: "multipart", body: LinkAttachmentRequest{}, response: []Attachment{}, errors: []int{http.StatusRequestEntityTooLarge}},
+    "DELETE /api/scorecard-events": {
+        summary: "Delete a driver's scorecard events for a period and category",
+        query: []queryParam{
+            {name: "driverId", typ: "integer", required: true},
+            {name: "datePrefix", required: true, desc: "YYYY, YYYY-MM or YYYY-MM-DD"},
+            {name: "category", required: true, enum: categoryEnum},
+        },
+    },
+
+    // Attachments
+    "GET /api/attachments/:id/download": {summary: "Download an attached file (links redirect with 302)", produces: "application/octet-stream"},
+    "DELETE /api/attachments/:id":       {summary: "Remove an attachment"},
+
+    // Bonus periods & payroll
+    "GET /api/bonus-periods":              {summary: "List bonus periods", response: []BonusPeriod{}},
+    "POST /api/bonus-periods":             {summary: "Open a bonus period", body: BonusPeriod{}, response: BonusPeriod{}, errors: []int{http.StatusConflict}},
+    "POST /api/bonus-periods/:id/close":   {summary: "Close an open period", op: "closeBonusPeriod", body: PeriodActionRequest{}, response: BonusPeriod{}, errors: []int{http.StatusConflict}},
+    "POST /api/bonus-periods/:id/approve": {summary: "Approve a closed period (locks it)", op: "approveBonusPeriod", body: PeriodActionRequest{}, response: BonusPeriod{}, errors: []int{http.StatusConflict}},
+    "GET /api/bonus-periods/:id/lines":    {summary: "Each driver's bonus outcome for the period", response: []BonusLine{}},
+    "POST /api/bonus-periods/:id/payroll-export": {
+        summary: "Export an approved period for payroll", body: PayrollExportRequest{},
+        query:    []queryParam{{name: "template", desc: "Payroll template name (default csv)"}},
+        produces: "application/octet-stream", errors: []int{http.StatusConflict},
+    },
+    "GET /api/payroll-exports":              {summary: "Payroll export log", query: []queryParam{{name: "periodId", typ: "integer"}}, response: []PayrollExport{}},
+    "GET /api/payroll-exports/:id/download": {summary: "Download a past payroll file", produces: "application/octet-stream"},
+
+    // Statements
+    "GET /api/statements.zip": {summary: "Statements for every active driver", query: []queryParam{periodParam}, produces: "application/zip"},
+
+    // Reports
+    "GET /api/reports/safety/timeseries": {
+        summary: "Events and points per week or month", response: ReportSeries{},
+        query: append(reportParams[:2:2], queryParam{name: "interval", enum: []string{"week", "month"}}),
+    },
+    "GET /api/reports/safety/by-category":    {summary: "Events and points by safety category", op: "getSafetyByCategory", query: reportParams, response: ReportSeries{}},
+    "GET /api/reports/safety/by-driver-type": {summary: "Events and points by driver type", op: "getSafetyByDriverType", query: reportParams, response: ReportSeries{}},
+    "GET /api/reports/safety/by-truck":       {summary: "Events and points by truck", op: "getSafetyByTruck", query: reportParams, response: ReportSeries{}},
+    "GET /api/reports/safety/top-offenders":  {summary: "Drivers with the most points", query: append(reportParams[:2:2], limitParam), response: []TopOffender{}},
+    "GET /api/reports/safety/trend":          {summary: "This period against the one before", query: reportParams, response: SafetyTrend{}},
+    "GET /api/reports/safety/inspections":    {summary: "Inspection pass rate by level", query: reportParams, response: InspectionReport{}},
+
+    // Scorecards
+    "GET /api/scorecards/summaries": {summary: "Monthly scorecard percentages per driver and category", query: []queryParam{monthParam}, response: []ScorecardSummary{}},
+    "GET /api/scorecards/missing":   {summary: "Scorecard completion checklist", query: []queryParam{monthParam}, response: []ScorecardChecklist{}},
+
+    // Admin: configuration and jobs
+    "GET /api/admin/config":          {summary: "Configuration in effect, secrets redacted", response: config.Config{}},
+    "GET /api/admin/jobs":            {summary: "Scheduled jobs with next and last run", response: []JobStatus{}},
+    "GET /api/admin/jobs/:name/runs": {summary: "Recent runs of a job", query: []queryParam{limitParam}, response: []JobRun{}},
+    "POST /api/admin/jobs/:name/run": {summary: "Run a job now", response: JobRun{}, status: http.StatusAccepted, errors: []int{http.StatusConflict}},
+
+    // Notifications
+    "GET /api/notification-users":                 {summary: "List email recipients", response: []NotificationUser{}},
+    "POST /api/notification-users":                {summary: "Add an email recipient", body: NotificationUser{}, response: NotificationUser{}},
+    "PUT /api/notification-users/:id":             {summary: "Update an email recipient", body: NotificationUser{}, response: NotificationUser{}},
+    "DELETE /api/notification-users/:id":          {summary: "Remove an email recipient"},
+    "GET /api/notification-users/:id/preferences": {summary: "Which notifications the recipient gets", response: []NotificationPreference{}},
+    "PUT /api/notification-users/:id/preferences": {summary: "Override role defaults (true/false), or null to reset", body: map[string]*bool{}, response: []NotificationPreference{}},
+    "GET /api/notifications/outbox": {
+        summary: "Queued and sent email", response: []OutboxMessage{},
+        query: []queryParam{{name: "status", enum: []string{"pending", "sending", "sent", "failed"}}, limitParam, beforeIDParam},
+    },
+    "POST /api/notifications/outbox/:id/retry": {summary: "Send a failed message again"},
+    "POST /api/notifications/test":             {summary: "Queue a test message", body: NotificationUser{}, status: http.StatusAccepted},
+
+    // Live updates
+    "GET /api/stream": {
+        summary: "Server-Sent Events feed of entity changes", produces: "text/event-stream",
+        query: []queryParam{
+            {name: "types", desc: "Comma-separated: driver, truck, safety_event, scorecard_event"},
+            {name: "driverId", typ: "integer", desc: "Only changes about this driver"},
+            {name: "lastEventId", typ: "integer", desc: "Resume after this change (same as the Last-Event-ID header)"},
+        },
+    },
+
+    // Webhooks
+    "GET /api/webhooks":             {summary: "List webhook subscriptions", response: []WebhookSubscription{}},
+    "POST /api/webhooks":            {summary: "Subscribe a URL; the response carries the signing secret", body: WebhookSubscription{}, response: WebhookSubscription{}},
+    "GET /api/webhooks/event-types": {summary: "Event types a subscription can ask for", response: []WebhookEventType{}},
+    "PUT /api/webhooks/:id":         {summary: "Update a subscription; secret \"rotate\" issues a new one", body: WebhookSubscription{}, response: WebhookSubscription{}},
+    "DELETE /api/webhooks/:id":      {summary: "Remove a subscription"},
+    "POST /api/webhooks/:id/ping":   {summary: "Send a ping event", response: WebhookPingResult{}, status: http.StatusAccepted},
+    "GET /api/webhooks/:id/deliveries": {
+        summary: "Delivery log for a subscription", response: []WebhookDelivery{},
+        query: []queryParam{{name: "status", enum: []string{"pending", "sending", "delivered", "failed"}}, {name: "eventType"}, limitParam, beforeIDParam},
+    },
+    "POST /api/webhooks/:id/replay":            {summary: "Re-send deliveries created since a time", body: WebhookReplayRequest{}, response: WebhookReplayResult{}, status: http.StatusAccepted},
+    "GET /api/webhooks/deliveries/:id":         {summary: "A delivery with its attempt history", response: WebhookDelivery{}},
+    "POST /api/webhooks/deliveries/:id/replay": {summary: "Re-send one delivery", response: WebhookDelivery{}, status: http.StatusAccepted},
+}
+
+// buildOpenAPI turns the registered routes into an OpenAPI 3.0 document. Routes
+// without an apiDocs entry are left out (and fail openapi_test.go).
+func buildOpenAPI(routes gin.RoutesInfo) map[string]any {
+    schemas := &schemaSet{defs: map[string]any{}}
+    errorRef := schemas.of(reflect.TypeOf(APIError{}))
+    paths := map[string]any{}
+
+    sort.Slice(routes, func(a, b int) bool {
+        if routes[a].Path != routes[b].Path {
+            return routes[a].Path < routes[b].Path
+        }
+        return routes[a].Method < routes[b].Method
+    })
+    for _, rt := range routes {
+        doc, ok := apiDocs[rt.Method+" "+rt.Path]
+        if !ok {
+            continue
+        }
+        path, params := openAPIPath(rt.Path)
+        for _, q := range doc.query {
+            params = append(params, q.spec())
+        }
+        if doc.export {
+            params = append(params, queryParam{name: "format", enum: []string{"json", "csv", "xlsx"}, desc: "csv or xlsx downloads a spreadsheet"}.spec())
+        }
+        if doc.ifMatch {
+            params = append(params, map[string]any{
+                "name": "If-Match", "in": "header", "required": true, "schema": map[string]any{"type": "string"},
+                "description": "ETag (version) the change is based on, or * to skip the check",
+            })
+        }
+        if doc.etag {
+            params = append(params, map[string]any{"name": "If-None-Match", "in": "header", "schema": map[string]any{"type": "string"}})
+        }
+
+        op := map[string]any{
+            "operationId": doc.operationID(rt.Handler),
+            "summary":     doc.summary,
+            "tags":        []string{openAPITag(rt.Path)},
+        }
+        if len(params) > 0 {
+            op["parameters"] = params
+        }
+        if body := doc.requestBody(schemas, rt.Method); body != nil {
+            op["requestBody"] = body
+        }
+
+        responses := map[string]any{}
+        success := map[string]any{"description": http.StatusText(doc.successStatus())}
+        content := map[string]any{}
+        if doc.response != nil {
+            content["application/json"] = map[string]any{"schema": schemas.of(reflect.TypeOf(doc.response))}
+        }
+        if doc.produces != "" {
+            content[doc.produces] = map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}
+        }
+        if doc.export {
+            content["text/csv"] = map[string]any{"schema": map[string]any{"type": "string"}}
+            content["application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"] = map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}
+        }
+        if len(content) > 0 {
+            success["content"] = content
+        }
+        if doc.etag || doc.ifMatch {
+            success["headers"] = map[string]any{"ETag": map[string]any{"schema": map[string]any{"type": "string"}}}
+        }
+        responses[statusKey(doc.successStatus())] = success
+
+        errorStatuses := append([]int{http.StatusBadRequest, http.StatusInternalServerError}, doc.errors...)
+        if strings.Contains(rt.Path, ":") {
+            errorStatuses = append(errorStatuses, http.StatusNotFound)
+        }
+        if doc.ifMatch {
+            errorStatuses = append(errorStatuses, http.StatusPreconditionRequired)
+            responses[statusKey(http.StatusPreconditionFailed)] = map[string]any{
+                "description": "Changed by someone else; body carries the current record",
+                "content":     map[string]any{"application/json": map[string]any{"schema": schemas.of(reflect.TypeOf(PreconditionFailed{}))}},
+            }
+        }
+        if doc.etag {
+            responses[statusKey(http.StatusNotModified)] = map[string]any{"description": http.StatusText(http.StatusNotModified)}
+        }
+        for _, s := range errorStatuses {
+            responses[statusKey(s)] = map[string]any{
+                "description": http.StatusText(s),
+                "content":     map[string]any{"application/json": map[string]any{"schema": errorRef}},
+            }
+        }
+        op["responses"] = responses
+
+        item, _ := paths[path].(map[string]any)
+        if item == nil {
+            item = map[string]any{}
+            paths[path] = item
+        }
+        item[strings.ToLower(rt.Method)] = op
+    }
+
+    return map[string]any{
+        "openapi": "3.0.3",
+        "info": map[string]any{
+            "title":       "DriverSafetyBonus API",
+            "version":     "1.0.0",
+            "description": "Dates are America/Winnipeg local dates (YYYY-MM-DD); timestamps are RFC 3339.",
+        },
+        "servers": []any{map[string]any{"url": "/"}},
+        "paths":   paths,
+        "components": map[string]any{
+            "schemas": schemas.defs,
+            // Declared for Swagger UI's "Authorize"; nothing checks tokens yet, so no
+            // operation requires it. Add a top-level "security" once auth lands.
+            "securitySchemes": map[string]any{
+                "bearerAuth": map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+            },
+        },
+    }
+}
+
+func (q queryParam) spec() map[string]any {
+    schema := map[string]any{"type": "string"}
+    if q.typ != "" {
+        schema["type"] = q.typ
+    }
+    if len(q.enum) > 0 {
+        schema["enum"] = q.enum
+    }
+    p := map[string]any{"name": q.name, "in": "query", "schema": schema}
+    if q.desc != "" {
+        p["description"] = q.desc
+    }
+    if q.required {
+        p["required"] = true
+    }
+    return p
+}
+
+func (d routeDoc) successStatus() int {
+    switch {
+    case d.status != 0:
+        return d.status
+    case d.response == nil && d.produces == "":
+        return http.StatusNoContent
+    }
+    return http.StatusOK
+}
+
+// operationID is the handler's function name unless the doc names one (closures
+// such as exportable(...) and reportBreakdown(...) have no useful name).
+func (d routeDoc) operationID(handler string) string {
+    if d.op != "" {
+        return d.op
+    }
+    return handler[strings.LastIndex(handler, ".")+1:]
+}
+
+func (d routeDoc) requestBody(schemas *schemaSet, method string) map[string]any {
+    content := map[string]any{}
+    if d.body != nil {
+        mime := "application/json"
+        if method == http.MethodPatch {
+            mime = "application/merge-patch+json"
+        }
+        content[mime] = map[string]any{"schema": schemas.of(reflect.TypeOf(d.body))}
+    }
+    switch d.upload {
+    case "image":
+        content["image/*"] = map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}
+        fallthrough
+    case "multipart":
+        content["multipart/form-data"] = map[string]any{"schema": map[string]any{
+            "type":       "object",
+            "properties": map[string]any{"file": map[string]any{"type": "string", "format": "binary"}},
+        }}
+    }
+    if len(content) == 0 {
+        return nil
+    }
+    return map[string]any{"required": true, "content": content}
+}
+
+// openAPIPath converts /drivers/:id (or /swagger/*filepath) to /drivers/{id} and lists
+// the path parameters.
+func openAPIPath(p string) (string, []any) {
+    var params []any
+    parts := strings.Split(p, "/")
+    for i, part := range parts {
+        if !strings.HasPrefix(part, ":") && !strings.HasPrefix(part, "*") {
+            continue
+        }
+        name := part[1:]
+        typ := "string"
+        if name == "id" {
+            typ = "integer"
+        }
+        params = append(params, map[string]any{"name": name, "in": "path", "required": true, "schema": map[string]any{"type": typ}})
+        parts[i] = "{" + name + "}"
+    }
+    return strings.Join(parts, "/"), params
+}
+
+// openAPITag groups operations by their first segment under /api, e.g. "safety-events".
+func openAPITag(p string) string {
+    if p == "/metrics" || p == "/livez" || p == "/readyz" {
+        return "common"
+    }
+    rest, ok := strings.CutPrefix(p, "/api/")
+    if !ok {
+        return "docs"
+    }
+    tag, _, _ := strings.Cut(rest, "/")
+    switch tag {
+    case "healthz", "bootstrap":
+        return "common"
+    case "statements.zip":
+        return "drivers"
+    }
+    return tag
+}
+
+func statusKey(status int) string {
+    return strconv.Itoa(status)
+}
+
+// --- Schemas from Go types ---
+
+type schemaSet struct {
+    defs map[string]any
+}
+
+var (
+    rawMessageType    = reflect.TypeOf(json.RawMessage{})
+    textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// of returns the schema for t; named structs go into components and are referenced.
+func (s *schemaSet) of(t reflect.Type) map[string]any {
+    if t == rawMessageType {
+        return map[string]any{"description": "Any JSON value"}
+    }
+    if t.Kind() != reflect.Pointer && t.Kind() != reflect.Struct && t.Implements(textMarshalerType) {
+        return map[string]any{"type": "string"} // e.g. config.Duration, written as "30s"
+    }
+    switch t.Kind() {
+    case reflect.Pointer:
+        inner := s.of(t.Elem())
+        if _, isRef := inner["$ref"]; isRef {
+            return map[string]any{"allOf": []any{inner}, "nullable": true}
+        }
+        inner["nullable"] = true
+        return inner
+    case reflect.Bool:
+        return map[string]any{"type": "boolean"}
+    case reflect.Int, reflect.Int32:
+        return map[string]any{"type": "integer"}
+    case reflect.Int64:
+        return map[string]any{"type": "integer", "format": "int64"}
+    case reflect.Float32, reflect.Float64:
+        return map[string]any{"type": "number"}
+    case reflect.String:
+        return map[string]any{"type": "string"}
+    case reflect.Slice, reflect.Array:
+        return map[string]any{"type": "array", "items": s.of(t.Elem())}
+    case reflect.Map:
+        return map[string]any{"type": "object", "additionalProperties": s.of(t.Elem())}
+    case reflect.Interface:
+        return map[string]any{}
+    case reflect.Struct:
+        if t.Name() == "" || !isExported(t.Name()) {
+            return s.object(t)
+        }
+        if _, done := s.defs[t.Name()]; !done {
+            s.defs[t.Name()] = nil // reserve first: types may refer to themselves
+            s.defs[t.Name()] = s.object(t)
+        }
+        return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+    }
+    return map[string]any{}
+}
+
+func (s *schemaSet) object(t reflect.Type) map[string]any {
+    props := map[string]any{}
+    s.addFields(t, props)
+    return map[string]any{"type": "object", "properties": props}
+}
+
+func (s *schemaSet) addFields(t reflect.Type, props map[string]any) {
+    for i := 0; i < t.NumField(); i++ {
+        f := t.Field(i)
+        tag := f.Tag.Get("json")
+        if f.Anonymous && tag == "" {
+            s.addFields(f.Type, props) // embedded struct: its fields are promoted
+            continue
+        }
+        name, _, _ := strings.Cut(tag, ",")
+        if name == "-" || !f.IsExported() {
+            continue
+        }
+        if name == "" {
+            name = f.Name
+        }
+        field := s.of(f.Type)
+        if enum := f.Tag.Get("enum"); enum != "" {
+            var values []any
+            for _, v := range strings.Split(enum, ",") {
+                values = append(values, v)
+            }
+            if f.Type.Kind() == reflect.Pointer {
+                values = append(values, nil)
+            }
+            field["enum"] = values
+        }
+        if format := formatFor(name); format != "" && field["type"] == "string" {
+            field["format"] = format
+        }
+        props[name] = field
+    }
+}
+
+// formatFor infers a string format from the field naming used across the models.
+func formatFor(name string) string {
+    switch {
+    case strings.HasSuffix(name, "_date"), name == "starts_on", name == "ends_on":
+        return "date"
+    case strings.HasSuffix(name, "_at"):
+        return "date-time"
+    }
+    return ""
+}
+
+func isExported(name string) bool {
+    return name[0] >= 'A' && name[0] <= 'Z'
+}
+
+// --- Handlers ---
+
+func serveOpenAPI(c *gin.Context) {
+    c.JSON(http.StatusOK, openAPISpec)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+    "encoding/json"
+    "regexp"
+    "strings"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+)
+
+func testSpec(t *testing.T) (gin.RoutesInfo, map[string]any) {
+    t.Helper()
+    gin.SetMode(gin.TestMode)
+    r := newRouter()
+    return r.Routes(), openAPISpec
+}
+
+// Every registered route must be in the spec; add an apiDocs entry for new routes.
+func TestOpenAPICoversEveryRoute(t *testing.T) {
+    routes, spec := testSpec(t)
+    paths := spec["paths"].(map[string]any)
+    for _, rt := range routes {
+        path, _ := openAPIPath(rt.Path)
+        item, _ := paths[path].(map[string]any)
+        if _, ok := item[strings.ToLower(rt.Method)]; !ok {
+            t.Errorf("%s %s is registered but missing from the OpenAPI spec (add it to apiDocs)", rt.Method, rt.Path)
+        }
+    }
+}
+
+// apiDocs entries for routes that no longer exist would silently document nothing.
+func TestOpenAPIDocsMatchRoutes(t *testing.T) {
+    routes, _ := testSpec(t)
+    registered := map[string]bool{}
+    for _, rt := range routes {
+        registered[rt.Method+" "+rt.Path] = true
+    }
+    for key := range apiDocs {
+        if !registered[key] {
+            t.Errorf("apiDocs has %q but no such route is registered", key)
+        }
+    }
+}
+
+func TestOpenAPIOperationIDsUnique(t *testing.T) {
+    _, spec := testSpec(t)
+    seen := map[string]string{}
+    for path, item := range spec["paths"].(map[string]any) {
+        for method, op := range item.(map[string]any) {
+            id := op.(map[string]any)["operationId"].(string)
+            where := strings.ToUpper(method) + " " + path
+            if other, dup := seen[id]; dup {
+                t.Errorf("operationId %q used by both %s and %s", id, other, where)
+            }
+            seen[id] = where
+        }
+    }
+}
+
+func TestOpenAPIRefsResolve(t *testing.T) {
+    _, spec := testSpec(t)
+    raw, err := json.Marshal(spec)
+    if err != nil {
+        t.Fatalf("spec does not marshal: %v", err)
+    }
+    schemas := spec["components"].(map[string]any)["schemas"].(map[string]any)
+    for _, m := range regexp.MustCompile(`"#/components/schemas/(\w+)"`).FindAllStringSubmatch(string(raw), -1) {
+        if _, ok := schemas[m[1]]; !ok {
+            t.Errorf("$ref to undefined schema %s", m[1])
+        }
+    }
+    truck := schemas["Truck"].(map[string]any)["properties"].(map[string]any)["status"].(map[string]any)
+    if len(truck["enum"].([]any)) != 3 {
+        t.Errorf("Truck.status enum = %v", truck["enum"])
+    }
+}
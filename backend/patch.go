@@ -0,0 +1,584 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "reflect"
+    "slices"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// PATCH routes take a JSON Merge Patch (RFC 7386): only the fields in the body are
+// changed, null clears a nullable field, and anything left out keeps its value.
+// Side effects (truck status, truck history, notifications, webhooks) run only for
+// fields whose value actually changed, so resending a field as-is is harmless.
+
+// mergePatch applies the request body to a copy of current. It returns the patched
+// copy and the fields whose value changed. Read-only fields (ids, version, workflow
+// state) may be sent but are ignored. When it returns false the 400 has been written.
+func mergePatch[T any](c *gin.Context, current T, readOnly ...string) (T, map[string]bool, bool) {
+    var next T
+    raw, err := io.ReadAll(c.Request.Body)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return next, nil, false
+    }
+    var patch map[string]json.RawMessage
+    if err := json.Unmarshal(raw, &patch); err != nil || patch == nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: "body must be a JSON object (merge patch)"})
+        return next, nil, false
+    }
+
+    fields := jsonFields(reflect.TypeOf(current))
+    for name, value := range patch {
+        kind, ok := fields[name]
+        if !ok {
+            c.JSON(http.StatusBadRequest, APIError{Message: fmt.Sprintf("unknown field %q", name)})
+            return next, nil, false
+        }
+        if slices.Contains(readOnly, name) {
+            delete(patch, name)
+            continue
+        }
+        if bytes.Equal(bytes.TrimSpace(value), []byte("null")) && kind != reflect.Pointer {
+            c.JSON(http.StatusBadRequest, APIError{Message: name + " cannot be null"})
+            return next, nil, false
+        }
+    }
+
+    // Round-trip through JSON so next shares no pointers with current
+    before, _ := json.Marshal(current)
+    _ = json.Unmarshal(before, &next)
+    body, _ := json.Marshal(patch)
+    if err := json.Unmarshal(body, &next); err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return next, nil, false
+    }
+
+    var was, now map[string]json.RawMessage
+    after, _ := json.Marshal(next)
+    _ = json.Unmarshal(before, &was)
+    _ = json.Unmarshal(after, &now)
+    changed := map[string]bool{}
+    for name := range patch {
+        if !bytes.Equal(was[name], now[name]) {
+            changed[name] = true
+        }
+    }
+    return next, changed, true
+}
+
+// jsonFields maps a struct's JSON field names to their kinds.
+func jsonFields(t reflect.Type) map[string]reflect.Kind {
+    out := map[string]reflect.Kind{}
+    for i := 0; i < t.NumField(); i++ {
+        f := t.Field(i)
+        name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+        if name == "" || name == "-" {
+            continue
+        }
+        out[name] = f.Type.Kind()
+    }
+    return out
+}
+
+// patchColumn is a column a PATCH may set; the JSON field has the column's name.
+type patchColumn struct {
+    name  string
+    value any
+}
+
+// patchAssignments builds "col=?, ..." for the changed columns, in the order given.
+func patchAssignments(changed map[string]bool, cols []patchColumn) (string, []any) {
+    var set []string
+    var args []any
+    for _, col := range cols {
+        if changed[col.name] {
+            set = append(set, col.name+"=?")
+            args = append(args, col.value)
+        }
+    }
+    return strings.Join(set, ", "), args
+}
+
+// patchVersion is the version a PATCH is based on: If-Match when given, else the
+// version just read (so a concurrent write between read and update still fails).
+// When it returns false the 412 has been written.
+func patchVersion(c *gin.Context, what string, ifMatch int, current any, version int) (int, bool) {
+    if ifMatch != 0 && ifMatch != version {
+        preconditionFailed(c, what, current, version)
+        return 0, false
+    }
+    return version, true
+}
+
+// lookupError writes the 404/500 for a record that could not be read.
+func lookupError(c *gin.Context, what string, err error) {
+    if err == sql.ErrNoRows {
+        c.JSON(http.StatusNotFound, APIError{Message: what + " not found"})
+        return
+    }
+    c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+}
+
+// --- Drivers ---
+
+func patchDriver(c *gin.Context) {
+    id := atoi(c.Param("id"))
+    ifMatch, ok := ifMatchVersion(c)
+    if !ok {
+        return
+    }
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+    defer cancel()
+
+    base := apiBaseURL(c)
+    current, err := loadDriver(ctx, id, base)
+    if err != nil {
+        lookupError(c, "driver", err)
+        return
+    }
+    version, ok := patchVersion(c, "driver", ifMatch, current, current.Version)
+    if !ok {
+        return
+    }
+    d, changed, ok := mergePatch(c, current, "driver_id", "version")
+    if !ok {
+        return
+    }
+    if changed["active"] && d.Active == nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: "active cannot be null"})
+        return
+    }
+    var startDate sql.NullString
+    if changed["start_date"] && strings.TrimSpace(d.StartDate) != "" {
+        t, err := parseLocalDate(d.StartDate)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, APIError{Message: "invalid start_date"})
+            return
+        }
+        startDate = sql.NullString{String: formatLocalDate(t), Valid: true}
+    }
+    // Photo: a data URL replaces it, null or "" removes it, any other URL keeps it
+    var photo []byte
+    removePic := false
+    if changed["profile_pic"] {
+        switch {
+        case isDataURL(d.ProfilePic):
+            if photo, err = decodeDataURL(*d.ProfilePic); err != nil {
+                c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+                return
+            }
+        case d.ProfilePic == nil || strings.TrimSpace(*d.ProfilePic) == "":
+            removePic = current.ProfilePic != nil
+        }
+    }
+
+    set, args := patchAssignments(changed, []patchColumn{
+        {"driver_code", d.DriverCode},
+        {"first_name", d.FirstName},
+        {"last_name", d.LastName},
+        {"start_date", startDate},
+        {"truck_id", d.TruckID},
+        {"driver_type_id", d.DriverTypeID},
+        {"active", d.Active},
+    })
+    truckChanged := changed["truck_id"]
+    if set == "" && photo == nil && !removePic {
+        // Nothing changed: no write, no version bump, no events
+        setETag(c, current.Version)
+        c.JSON(http.StatusOK, current)
+        return
+    }
+
+    err = inTx(ctx, func(ctx context.Context) error {
+        if set != "" {
+            res, err := exec(ctx, `UPDATE drivers SET `+set+`, version=version+1 WHERE driver_id=? AND version=?`, append(args, id, version)...)
+            if err != nil {
+                return err
+            }
+            if n, _ := res.RowsAffected(); n == 0 {
+                writeMissed(c, "driver", func() (any, int, error) {
+                    current, err := loadDriver(ctx, id, base)
+                    return current, current.Version, err
+                })
+                return errAnswered
+            }
+
+            if truckChanged {
+                now := time.Now().In(localTZ)
+                if current.TruckID != nil {
+                    _, _ = exec(ctx, `UPDATE trucks SET status='available', version=version+1 WHERE truck_id=?`, *current.TruckID)
+                    _, _ = exec(ctx, `INSERT INTO truck_history (truck_id, driver_id, type, notes, date)
+                                      VALUES (?, NULL, 'status_change', ?, ?)`,
+                        *current.TruckID, fmt.Sprintf("Driver %d unassigned or moved to another unit", id), now)
+                }
+                if d.TruckID != nil {
+                    _, _ = exec(ctx, `UPDATE trucks SET status='assigned', version=version+1 WHERE truck_id=?`, *d.TruckID)
+                    _, _ = exec(ctx, `INSERT INTO truck_history (truck_id, driver_id, type, notes, date)
+                                      VALUES (?, ?, 'assignment', ?, ?)`,
+                        *d.TruckID, id, fmt.Sprintf("Driver %d assigned via driver update", id), now)
+                }
+            }
+        } else {
+            // Photo-only patch: still honour the version the client based it on
+            var now int
+            if err := queryRow(ctx, `SELECT version FROM drivers WHERE driver_id=? FOR UPDATE`, id).Scan(&now); err != nil || now != version {
+                writeMissed(c, "driver", func() (any, int, error) {
+                    current, err := loadDriver(ctx, id, base)
+                    return current, current.Version, err
+                })
+                return errAnswered
+            }
+        }
+
+        var err error
+        switch {
+        case photo != nil:
+            _, err = savePhoto(ctx, id, photo)
+        case removePic:
+            err = removePhoto(ctx, id)
+        }
+        if err != nil {
+            photoError(c, err)
+            return errAnswered
+        }
+
+        if d, err = loadDriver(ctx, id, base); err != nil {
+            lookupError(c, "driver", err)
+            return errAnswered
+        }
+        if err := publishEvent(ctx, "driver.updated", d); err != nil {
+            return err
+        }
+        if truckChanged && current.TruckID != nil {
+            if err := publishEvent(ctx, "truck.unassigned", gin.H{"truck_id": *current.TruckID, "driver_id": id}); err != nil {
+                return err
+            }
+        }
+        if truckChanged && d.TruckID != nil {
+            return publishEvent(ctx, "truck.assigned", gin.H{"truck_id": *d.TruckID, "driver_id": id})
+        }
+        return nil
+    })
+    if txFailed(c, err) {
+        return
+    }
+    setETag(c, d.Version)
+    c.JSON(http.StatusOK, d)
+}
+
+// --- Trucks ---
+
+func patchTruck(c *gin.Context) {
+    id := atoi(c.Param("id"))
+    ifMatch, ok := ifMatchVersion(c)
+    if !ok {
+        return
+    }
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    current, err := loadTruck(ctx, id)
+    if err != nil {
+        lookupError(c, "truck", err)
+        return
+    }
+    version, ok := patchVersion(c, "truck", ifMatch, current, current.Version)
+    if !ok {
+        return
+    }
+    t, changed, ok := mergePatch(c, current, "truck_id", "version")
+    if !ok {
+        return
+    }
+    set, args := patchAssignments(changed, []patchColumn{
+        {"unit_number", t.UnitNumber},
+        {"year", t.Year},
+        {"status", t.Status},
+    })
+    if set == "" {
+        setETag(c, current.Version)
+        c.JSON(http.StatusOK, current)
+        return
+    }
+
+    err = inTx(ctx, func(ctx context.Context) error {
+        res, err := exec(ctx, `UPDATE trucks SET `+set+`, version=version+1 WHERE truck_id=? AND version=?`, append(args, id, version)...)
+        if err != nil {
+            return err
+        }
+        if n, _ := res.RowsAffected(); n == 0 {
+            writeMissed(c, "truck", func() (any, int, error) {
+                current, err := loadTruck(ctx, id)
+                return current, current.Version, err
+            })
+            return errAnswered
+        }
+        if changed["status"] {
+            kind := "status_change"
+            if t.Status == "maintenance" {
+                kind = "maintenance"
+            }
+            _, _ = exec(ctx, `INSERT INTO truck_history (truck_id, driver_id, type, notes, date) VALUES (?, NULL, ?, ?, ?)`,
+                id, kind, fmt.Sprintf("Status changed from %s to %s", current.Status, t.Status), time.Now().In(localTZ))
+        }
+        t.Version = version + 1
+        return publishEvent(ctx, "truck.updated", t)
+    })
+    if txFailed(c, err) {
+        return
+    }
+    setETag(c, t.Version)
+    c.JSON(http.StatusOK, t)
+}
+
+// --- Safety events ---
+
+func patchSafetyEvent(c *gin.Context) {
+    id := atoi(c.Param("id"))
+    ifMatch, ok := ifMatchVersion(c)
+    if !ok {
+        return
+    }
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    current, err := loadSafetyEvent(ctx, id)
+    if err != nil {
+        lookupError(c, "safety event", err)
+        return
+    }
+    version, ok := patchVersion(c, "safety event", ifMatch, current, current.Version)
+    if !ok {
+        return
+    }
+    // dispute_status is owned by the dispute workflow, not by event edits
+    e, changed, ok := mergePatch(c, current, "safety_event_id", "dispute_status", "version")
+    if !ok {
+        return
+    }
+    if changed["event_date"] {
+        t, err := parseLocalDate(e.EventDate)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, APIError{Message: "invalid event_date"})
+            return
+        }
+        e.EventDate = formatLocalDate(t)
+    }
+    set, args := patchAssignments(changed, []patchColumn{
+        {"driver_id", e.DriverID},
+        {"event_date", e.EventDate},
+        {"category_id", e.CategoryID},
+        {"notes", e.Notes},
+        {"bonus_score", e.BonusScore},
+        {"p_i_score", e.PIScore},
+        {"bonus_period", e.BonusPeriod},
+    })
+    if set == "" {
+        setETag(c, current.Version)
+        c.JSON(http.StatusOK, current)
+        return
+    }
+
+    // Risk alerts only when something that counts towards the driver's points moved
+    scoring := changed["driver_id"] || changed["bonus_score"] || changed["p_i_score"] || changed["event_date"]
+    before := 0
+    if scoring {
+        before = driverRiskPoints(ctx, e.DriverID)
+    }
+    err = inTx(ctx, func(ctx context.Context) error {
+        res, err := exec(ctx, `UPDATE safety_events SET `+set+`, version=version+1 WHERE safety_event_id=? AND version=?`, append(args, id, version)...)
+        if err != nil {
+            return err
+        }
+        if n, _ := res.RowsAffected(); n == 0 {
+            writeMissed(c, "safety event", func() (any, int, error) {
+                current, err := loadSafetyEvent(ctx, id)
+                return current, current.Version, err
+            })
+            return errAnswered
+        }
+        e.Version = version + 1
+        return publishEvent(ctx, "safety_event.updated", e)
+    })
+    if txFailed(c, err) {
+        return
+    }
+    setETag(c, e.Version)
+    if scoring {
+        notifySafetyEvent(ctx, e, before, false)
+    }
+    c.JSON(http.StatusOK, e)
+}
+
+// --- Scorecard events ---
+
+func patchScoreCardEvent(c *gin.Context) {
+    id := atoi(c.Param("id"))
+    ifMatch, ok := ifMatchVersion(c)
+    if !ok {
+        return
+    }
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    current, err := loadScoreCardEvent(ctx, id)
+    if err != nil {
+        lookupError(c, "scorecard event", err)
+        return
+    }
+    version, ok := patchVersion(c, "scorecard event", ifMatch, current, current.Version)
+    if !ok {
+        return
+    }
+    e, changed, ok := mergePatch(c, current, "scorecard_event_id", "version")
+    if !ok {
+        return
+    }
+    if changed["event_date"] {
+        t, err := parseLocalDate(e.EventDate)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, APIError{Message: "invalid event_date"})
+            return
+        }
+        e.EventDate = formatLocalDate(t)
+    }
+    set, args := patchAssignments(changed, []patchColumn{
+        {"driver_id", e.DriverID},
+        {"event_date", e.EventDate},
+        {"sc_category_id", e.ScCategoryID},
+        {"sc_score", e.ScScore},
+        {"notes", e.Notes},
+    })
+    if set == "" {
+        setETag(c, current.Version)
+        c.JSON(http.StatusOK, current)
+        return
+    }
+
+    err = inTx(ctx, func(ctx context.Context) error {
+        res, err := exec(ctx, `UPDATE scorecard_events SET `+set+`, version=version+1 WHERE scorecard_event_id=? AND version=?`, append(args, id, version)...)
+        if err != nil {
+            return err
+        }
+        if n, _ := res.RowsAffected(); n == 0 {
+            writeMissed(c, "scorecard event", func() (any, int, error) {
+                current, err := loadScoreCardEvent(ctx, id)
+                return current, current.Version, err
+            })
+            return errAnswered
+        }
+        e.Version = version + 1
+        return publishEvent(ctx, "scorecard_event.updated", e)
+    })
+    if txFailed(c, err) {
+        return
+    }
+    setETag(c, e.Version)
+    c.JSON(http.StatusOK, e)
+}
+
+// --- Lookups (driver types, safety categories, scorecard metrics) ---
+// These have no version, so PATCH needs no If-Match.
+
+func patchDriverType(c *gin.Context) {
+    id := atoi(c.Param("id"))
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    var current DriverType
+    err := queryRow(ctx, `SELECT driver_type_id, driver_type FROM driver_type WHERE driver_type_id=?`, id).
+        Scan(&current.DriverTypeID, &current.DriverType)
+    if err != nil {
+        lookupError(c, "driver type", err)
+        return
+    }
+    dt, changed, ok := mergePatch(c, current, "driver_type_id")
+    if !ok {
+        return
+    }
+    if set, args := patchAssignments(changed, []patchColumn{{"driver_type", dt.DriverType}}); set != "" {
+        if _, err := exec(ctx, `UPDATE driver_type SET `+set+` WHERE driver_type_id=?`, append(args, id)...); err != nil {
+            c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+            return
+        }
+    }
+    c.JSON(http.StatusOK, dt)
+}
+
+func patchSafetyCategory(c *gin.Context) {
+    id := atoi(c.Param("id"))
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    var current SafetyCategory
+    err := queryRow(ctx, `SELECT category_id, code, description, scoring_system, p_i_score FROM safety_categories WHERE category_id=?`, id).
+        Scan(&current.CategoryID, &current.Code, &current.Description, &current.ScoringSystem, &current.PIScore)
+    if err != nil {
+        lookupError(c, "safety category", err)
+        return
+    }
+    sc, changed, ok := mergePatch(c, current, "category_id")
+    if !ok {
+        return
+    }
+    set, args := patchAssignments(changed, []patchColumn{
+        {"code", sc.Code},
+        {"description", sc.Description},
+        {"scoring_system", sc.ScoringSystem},
+        {"p_i_score", sc.PIScore},
+    })
+    if set != "" {
+        if _, err := exec(ctx, `UPDATE safety_categories SET `+set+` WHERE category_id=?`, append(args, id)...); err != nil {
+            c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+            return
+        }
+    }
+    c.JSON(http.StatusOK, sc)
+}
+
+func patchScorecardMetric(c *gin.Context) {
+    id := atoi(c.Param("id"))
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    var (
+        current        ScoreCardItem
+        driverTypeNull sql.NullInt64
+    )
+    err := queryRow(ctx, `SELECT sc_category_id, sc_category, sc_description, driver_type_id FROM scorecard_metrics WHERE sc_category_id=?`, id).
+        Scan(&current.ScCategoryID, &current.ScCategory, &current.ScDescription, &driverTypeNull)
+    if err != nil {
+        lookupError(c, "scorecard metric", err)
+        return
+    }
+    if driverTypeNull.Valid {
+        val := int(driverTypeNull.Int64)
+        current.DriverTypeID = &val
+    }
+    m, changed, ok := mergePatch(c, current, "sc_category_id")
+    if !ok {
+        return
+    }
+    set, args := patchAssignments(changed, []patchColumn{
+        {"sc_category", m.ScCategory},
+        {"sc_description", m.ScDescription},
+        {"driver_type_id", m.DriverTypeID},
+    })
+    if set != "" {
+        if _, err := exec(ctx, `UPDATE scorecard_metrics SET `+set+` WHERE sc_category_id=?`, append(args, id)...); err != nil {
+            c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+            return
+        }
+    }
+    c.JSON(http.StatusOK, m)
+}
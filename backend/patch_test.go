@@ -0,0 +1,108 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/gin-gonic/gin"
+)
+
+var driverCols = []string{"driver_id", "driver_code", "first_name", "last_name", "start_date", "truck_id", "driver_type_id", "active", "photo_etag", "version"}
+
+// testPatch sends a merge patch based on version to the router.
+func testPatch(path string, version int, body string) *httptest.ResponseRecorder {
+    req := httptest.NewRequest(http.MethodPatch, path, strings.NewReader(body))
+    req.Header.Set("If-Match", etagFor(version))
+    w := httptest.NewRecorder()
+    newRouter().ServeHTTP(w, req)
+    return w
+}
+
+// Fields resent with their current value are left out of the UPDATE.
+func TestPatchWritesOnlyChangedFields(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+
+    mock.ExpectQuery(`SELECT .+ FROM trucks WHERE truck_id=\?`).WithArgs(7).
+        WillReturnRows(sqlmock.NewRows(truckCols).AddRow(7, "T-07", 2021, "available", 3))
+    mock.ExpectBegin()
+    mock.ExpectExec(`UPDATE trucks SET year=\?, version=version\+1 WHERE truck_id=\? AND version=\?`).WithArgs(2022, 7, 3).
+        WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectQuery(`FROM webhook_subscriptions`).WillReturnRows(sqlmock.NewRows([]string{"subscription_id", "event_types"}))
+    mock.ExpectExec(`INSERT INTO change_events`).WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectCommit()
+
+    w := testPatch("/api/trucks/7", 3, `{"unit_number": "T-07", "year": 2022, "status": "available", "version": 1}`)
+    if w.Code != http.StatusOK || w.Header().Get("ETag") != `"4"` {
+        t.Errorf("patch = %d %s, ETag %s", w.Code, w.Body, w.Header().Get("ETag"))
+    }
+}
+
+func TestPatchNullOnRequiredField(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+
+    mock.ExpectQuery(`SELECT .+ FROM drivers WHERE driver_id=\?`).WithArgs(1).
+        WillReturnRows(sqlmock.NewRows(driverCols).AddRow(1, "D1", "Ann", "Able", nil, nil, nil, true, nil, 4))
+    w := testPatch("/api/drivers/1", 4, `{"first_name": null}`)
+    if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "first_name cannot be null") {
+        t.Errorf("patch = %d %s", w.Code, w.Body)
+    }
+}
+
+// A patch that only removes the photo still fails when the driver changed since
+// the version it was based on, and touches nothing.
+func TestPatchPhotoOnlyHonoursVersion(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+
+    mock.ExpectQuery(`SELECT .+ FROM drivers WHERE driver_id=\?`).WithArgs(1).
+        WillReturnRows(sqlmock.NewRows(driverCols).AddRow(1, "D1", "Ann", "Able", nil, nil, nil, true, "0123456789abcdef", 4))
+    mock.ExpectBegin()
+    mock.ExpectQuery(`SELECT version FROM drivers WHERE driver_id=\? FOR UPDATE`).WithArgs(1).
+        WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(5))
+    mock.ExpectQuery(`SELECT .+ FROM drivers WHERE driver_id=\?`).WithArgs(1).
+        WillReturnRows(sqlmock.NewRows(driverCols).AddRow(1, "D1", "Ann", "Abel", nil, nil, nil, true, "0123456789abcdef", 5))
+    mock.ExpectRollback()
+
+    w := testPatch("/api/drivers/1", 4, `{"profile_pic": null}`)
+    if w.Code != http.StatusPreconditionFailed || w.Header().Get("ETag") != `"5"` {
+        t.Errorf("patch = %d %s, ETag %s", w.Code, w.Body, w.Header().Get("ETag"))
+    }
+}
+
+// Moving a driver to another truck frees the old one, assigns the new one and
+// records both in the truck history, in the same transaction as the update.
+func TestPatchDriverTruckWritesHistory(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+
+    start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+    mock.ExpectQuery(`SELECT .+ FROM drivers WHERE driver_id=\?`).WithArgs(1).
+        WillReturnRows(sqlmock.NewRows(driverCols).AddRow(1, "D1", "Ann", "Able", start, 3, nil, true, nil, 4))
+    mock.ExpectBegin()
+    mock.ExpectExec(`UPDATE drivers SET truck_id=\?, version=version\+1 WHERE driver_id=\? AND version=\?`).WithArgs(9, 1, 4).
+        WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectExec(`UPDATE trucks SET status='available'`).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectExec(`INSERT INTO truck_history .+'status_change'`).
+        WithArgs(3, "Driver 1 unassigned or moved to another unit", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectExec(`UPDATE trucks SET status='assigned'`).WithArgs(9).WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectExec(`INSERT INTO truck_history .+'assignment'`).
+        WithArgs(9, 1, "Driver 1 assigned via driver update", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(2, 1))
+    mock.ExpectQuery(`SELECT .+ FROM drivers WHERE driver_id=\?`).WithArgs(1).
+        WillReturnRows(sqlmock.NewRows(driverCols).AddRow(1, "D1", "Ann", "Able", start, 9, nil, true, nil, 5))
+    for range []string{"driver.updated", "truck.unassigned", "truck.assigned"} {
+        mock.ExpectQuery(`FROM webhook_subscriptions`).WillReturnRows(sqlmock.NewRows([]string{"subscription_id", "event_types"}))
+        mock.ExpectExec(`INSERT INTO change_events`).WillReturnResult(sqlmock.NewResult(1, 1))
+    }
+    mock.ExpectCommit()
+
+    w := testPatch("/api/drivers/1", 4, `{"truck_id": 9, "first_name": "Ann"}`)
+    if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"truck_id":9`) {
+        t.Errorf("patch = %d %s", w.Code, w.Body)
+    }
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/csv"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// PayrollField is one output column: Field names a BonusLine value, Header is the
+// CSV heading / JSON key, and Width/Align apply to fixed-width output.
+type PayrollField struct {
+    Field  string `json:"field"`
+    Header string `json:"header"`
+    Width  int    `json:"width"`
+    Align  string `json:"align"` // 'left' (default) | 'right'
+}
+
+type PayrollTemplate struct {
+    Name   string         `json:"name"`
+    Format string         `json:"format"` // 'csv' | 'fixed' | 'json'
+    Fields []PayrollField `json:"fields"`
+}
+
+var defaultPayrollFields = []PayrollField{
+    {Field: "driver_code", Header: "driver_code", Width: 10},
+    {Field: "name", Header: "name", Width: 40},
+    {Field: "driver_type", Header: "driver_type", Width: 20},
+    {Field: "period", Header: "period", Width: 7},
+    {Field: "safety_points", Header: "safety_points", Width: 6, Align: "right"},
+    {Field: "scorecard_pct", Header: "scorecard_pct", Width: 6, Align: "right"},
+    {Field: "payout", Header: "payout", Width: 12, Align: "right"},
+}
+
+// Built-in templates; PAYROLL_TEMPLATES_FILE may add or override them with a JSON array.
+var payrollTemplates = map[string]PayrollTemplate{
+    "csv":   {Name: "csv", Format: "csv", Fields: defaultPayrollFields},
+    "fixed": {Name: "fixed", Format: "fixed", Fields: defaultPayrollFields},
+    "json":  {Name: "json", Format: "json", Fields: defaultPayrollFields},
+}
+
+var payrollFieldNames = map[string]bool{
+    "driver_id": true, "driver_code": true, "first_name": true, "last_name": true, "name": true,
+    "driver_type": true, "period": true, "safety_points": true, "scorecard_pct": true,
+    "eligible": true, "payout": true, "payout_cents": true,
+}
+
+func loadPayrollTemplates(path string) error {
+    if path == "" {
+        return nil
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return err
+    }
+    var custom []PayrollTemplate
+    if err := json.Unmarshal(data, &custom); err != nil {
+        return fmt.Errorf("%s: %w", path, err)
+    }
+    for _, t := range custom {
+        if t.Name == "" || len(t.Fields) == 0 {
+            return fmt.Errorf("%s: template needs a name and at least one field", path)
+        }
+        if _, ok := payrollFormats[t.Format]; !ok {
+            return fmt.Errorf("%s: template %q has unknown format %q", path, t.Name, t.Format)
+        }
+        for _, f := range t.Fields {
+            if !payrollFieldNames[f.Field] {
+                return fmt.Errorf("%s: template %q uses unknown field %q", path, t.Name, f.Field)
+            }
+            if t.Format == "fixed" && f.Width <= 0 {
+                return fmt.Errorf("%s: template %q field %q needs a width", path, t.Name, f.Field)
+            }
+        }
+        payrollTemplates[t.Name] = t
+    }
+    return nil
+}
+
+func payrollValue(l BonusLine, field string) any {
+    switch field {
+    case "driver_id":
+        return l.DriverID
+    case "driver_code":
+        return l.DriverCode
+    case "first_name":
+        return l.FirstName
+    case "last_name":
+        return l.LastName
+    case "name":
+        return strings.TrimSpace(l.LastName + ", " + l.FirstName)
+    case "driver_type":
+        return l.DriverType
+    case "period":
+        return l.Period
+    case "safety_points":
+        return l.SafetyPoints
+    case "scorecard_pct":
+        return l.ScorecardPct
+    case "eligible":
+        return l.Eligible
+    case "payout":
+        return l.Payout
+    case "payout_cents":
+        return int64(l.Payout*100 + 0.5)
+    }
+    return nil
+}
+
+func payrollText(v any) string {
+    switch t := v.(type) {
+    case float64:
+        return strconv.FormatFloat(t, 'f', 2, 64)
+    default:
+        return fmt.Sprint(t)
+    }
+}
+
+// errPayrollTooWide reports a number that does not fit its fixed-width column.
+// Cutting it would send payroll a different amount, so the export fails instead.
+var errPayrollTooWide = errors.New("value does not fit the template")
+
+// renderPayroll formats the lines with the template and returns the body and content type.
+func renderPayroll(t PayrollTemplate, lines []BonusLine) ([]byte, string, error) {
+    var buf bytes.Buffer
+    switch t.Format {
+    case "csv":
+        w := csv.NewWriter(&buf)
+        header := make([]string, len(t.Fields))
+        for i, f := range t.Fields {
+            header[i] = spreadsheetText(f.Header)
+        }
+        _ = w.Write(header)
+        for _, l := range lines {
+            rec := make([]string, len(t.Fields))
+            for i, f := range t.Fields {
+                v := payrollValue(l, f.Field)
+                rec[i] = payrollText(v)
+                if _, text := v.(string); text {
+                    rec[i] = spreadsheetText(rec[i])
+                }
+            }
+            _ = w.Write(rec)
+        }
+        w.Flush()
+        return buf.Bytes(), payrollFormats["csv"].contentType, w.Error()
+    case "fixed":
+        for _, l := range lines {
+            for _, f := range t.Fields {
+                value := payrollValue(l, f.Field)
+                v := []rune(payrollText(value))
+                if len(v) > f.Width {
+                    if _, text := value.(string); !text {
+                        return nil, "", fmt.Errorf("%w: %s of driver %s is %s, wider than %d", errPayrollTooWide, f.Field, l.DriverCode, string(v), f.Width)
+                    }
+                    v = v[:f.Width] // names and codes are cut to fit
+                }
+                pad := strings.Repeat(" ", f.Width-len(v))
+                if f.Align == "right" {
+                    buf.WriteString(pad + string(v))
+                } else {
+                    buf.WriteString(string(v) + pad)
+                }
+            }
+            buf.WriteString("\r\n")
+        }
+        return buf.Bytes(), payrollFormats["fixed"].contentType, nil
+    case "json":
+        out := make([]map[string]any, 0, len(lines))
+        for _, l := range lines {
+            rec := make(map[string]any, len(t.Fields))
+            for _, f := range t.Fields {
+                rec[f.Header] = payrollValue(l, f.Field)
+            }
+            out = append(out, rec)
+        }
+        data, err := json.MarshalIndent(out, "", "  ")
+        return data, payrollFormats["json"].contentType, err
+    }
+    return nil, "", fmt.Errorf("unknown format %q", t.Format)
+}
+
+var payrollFormats = map[string]struct{ ext, contentType string }{
+    "csv":   {"csv", "text/csv; charset=utf-8"},
+    "fixed": {"txt", "text/plain; charset=utf-8"},
+    "json":  {"json", "application/json; charset=utf-8"},
+}
+
+func payrollFileKey(exportID int, format string) string {
+    return fmt.Sprintf("payroll/export-%d.%s", exportID, payrollFormats[format].ext)
+}
+
+const payrollExportColumns = `pe.export_id, pe.period_id, bp.period_key, pe.template, pe.format, pe.reissue, pe.reason, pe.exported_by, pe.line_count, pe.total_payout, pe.checksum, pe.exported_at, pe.superseded_by`
+
+func scanPayrollExport(row rowScanner, e *PayrollExport) error {
+    var (
+        reason       sql.NullString
+        exportedAt   time.Time
+        supersededBy sql.NullInt64
+    )
+    if err := row.Scan(&e.ExportID, &e.PeriodID, &e.Period, &e.Template, &e.Format, &e.Reissue, &reason, &e.ExportedBy, &e.LineCount, &e.TotalPayout, &e.Checksum, &exportedAt, &supersededBy); err != nil {
+        return err
+    }
+    if reason.Valid {
+        e.Reason = &reason.String
+    }
+    e.ExportedAt = exportedAt.In(localTZ).Format(time.RFC3339)
+    if supersededBy.Valid {
+        val := int(supersededBy.Int64)
+        e.SupersededBy = &val
+    }
+    return nil
+}
+
+// --- Payroll export ---
+
+// POST /bonus-periods/:id/payroll-export?template=csv
+// Body: {"exported_by": "...", "reissue": false, "reason": "..."}
+// The period must be approved. Each period is exported once; a later export needs
+// reissue=true and a reason, and supersedes the earlier batch.
+func exportPayroll(c *gin.Context) {
+    periodID := atoi(c.Param("id"))
+    tmplName := c.DefaultQuery("template", "csv")
+    tmpl, ok := payrollTemplates[tmplName]
+    if !ok {
+        c.JSON(http.StatusBadRequest, APIError{Message: fmt.Sprintf("unknown payroll template %q", tmplName)})
+        return
+    }
+    var body PayrollExportRequest
+    if err := c.ShouldBindJSON(&body); err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    if strings.TrimSpace(body.ExportedBy) == "" {
+        c.JSON(http.StatusBadRequest, APIError{Message: "exported_by is required"})
+        return
+    }
+    if body.Reissue && strings.TrimSpace(body.Reason) == "" {
+        c.JSON(http.StatusBadRequest, APIError{Message: "a reason is required to re-issue an export"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+    defer cancel()
+
+    var (
+        periodKey   string
+        exportID    int
+        data        []byte
+        contentType string
+        stored      bool
+    )
+    err := inTx(ctx, func(ctx context.Context) error {
+        // Lock the period so concurrent exports serialize on it
+        var status string
+        err := queryRow(ctx, `SELECT status, period_key FROM bonus_periods WHERE period_id=? FOR UPDATE`, periodID).Scan(&status, &periodKey)
+        if err == sql.ErrNoRows {
+            c.JSON(http.StatusNotFound, APIError{Message: "bonus period not found"})
+            return errAnswered
+        }
+        if err != nil {
+            return err
+        }
+        if status != "approved" {
+            c.JSON(http.StatusConflict, APIError{Message: "bonus period " + periodKey + " is " + status + "; only approved periods can be exported"})
+            return errAnswered
+        }
+
+        var previous sql.NullInt64
+        err = queryRow(ctx, `SELECT export_id FROM payroll_exports WHERE period_id=? AND superseded_by IS NULL`, periodID).Scan(&previous)
+        if err != nil && err != sql.ErrNoRows {
+            return err
+        }
+        if previous.Valid && !body.Reissue {
+            c.JSON(http.StatusConflict, APIError{Message: fmt.Sprintf("period %s was already exported as batch %d; set reissue=true with a reason to export again", periodKey, previous.Int64)})
+            return errAnswered
+        }
+
+        p, err := loadBonusPeriod(ctx, periodID)
+        if err != nil {
+            return err
+        }
+        // The lines frozen at approval, so a re-issue pays exactly what was approved
+        lines, err := periodLines(ctx, p, 0)
+        if err != nil {
+            return err
+        }
+        if data, contentType, err = renderPayroll(tmpl, lines); errors.Is(err, errPayrollTooWide) {
+            c.JSON(http.StatusUnprocessableEntity, APIError{Message: fmt.Sprintf("template %s: %v", tmpl.Name, err)})
+            return errAnswered
+        }
+        if err != nil {
+            return err
+        }
+        total := 0.0
+        for _, l := range lines {
+            total += l.Payout
+        }
+        sum := sha256.Sum256(data)
+
+        var reason any
+        if body.Reissue {
+            reason = body.Reason
+        }
+        res, err := exec(ctx, `
+            INSERT INTO payroll_exports (period_id, template, format, reissue, reason, exported_by, line_count, total_payout, checksum, exported_at)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+            periodID, tmpl.Name, tmpl.Format, body.Reissue, reason, body.ExportedBy, len(lines), total, hex.EncodeToString(sum[:]), time.Now().In(localTZ))
+        if err != nil {
+            return err
+        }
+        id, _ := res.LastInsertId()
+        exportID = int(id)
+        if previous.Valid {
+            if _, err := exec(ctx, `UPDATE payroll_exports SET superseded_by=? WHERE export_id=?`, exportID, previous.Int64); err != nil {
+                return err
+            }
+        }
+        // Keep the exact file so the batch can be downloaded again without re-issuing
+        if err := files.Put(ctx, payrollFileKey(exportID, tmpl.Format), bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+            return err
+        }
+        stored = true
+        return nil
+    })
+    if err != nil && stored {
+        if derr := files.Delete(context.Background(), payrollFileKey(exportID, tmpl.Format)); derr != nil {
+            slog.WarnContext(ctx, "failed removing uncommitted payroll file", "export_id", exportID, "err", derr)
+        }
+    }
+    if txFailed(c, err) {
+        return
+    }
+
+    c.Header("X-Export-Id", strconv.Itoa(exportID))
+    c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="payroll-%s-%d.%s"`, periodKey, exportID, payrollFormats[tmpl.Format].ext))
+    c.Data(http.StatusOK, contentType, data)
+}
+
+// GET /payroll-exports?periodId=
+func getPayrollExports(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    q := `SELECT ` + payrollExportColumns + ` FROM payroll_exports pe JOIN bonus_periods bp ON bp.period_id = pe.period_id`
+    var args []any
+    if periodID := c.Query("periodId"); periodID != "" {
+        q += ` WHERE pe.period_id=?`
+        args = append(args, periodID)
+    }
+    rows, err := queryRows(ctx, q+` ORDER BY pe.exported_at DESC, pe.export_id DESC`, args...)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    var exports []PayrollExport
+    for rows.Next() {
+        var e PayrollExport
+        if err := scanPayrollExport(rows, &e); err != nil {
+            continue
+        }
+        exports = append(exports, e)
+    }
+    c.JSON(http.StatusOK, exports)
+}
+
+// GET /payroll-exports/:id/download returns the stored file for an earlier batch.
+func downloadPayrollExport(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+    defer cancel()
+
+    var e PayrollExport
+    row := queryRow(ctx, `SELECT `+payrollExportColumns+` FROM payroll_exports pe JOIN bonus_periods bp ON bp.period_id = pe.period_id WHERE pe.export_id=?`, c.Param("id"))
+    if err := scanPayrollExport(row, &e); err != nil {
+        if err == sql.ErrNoRows {
+            c.JSON(http.StatusNotFound, APIError{Message: "payroll export not found"})
+            return
+        }
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    key := payrollFileKey(e.ExportID, e.Format)
+    r, info, err := files.Get(ctx, key)
+    if err == ErrFileNotFound {
+        c.JSON(http.StatusNotFound, APIError{Message: "payroll file missing from store"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    defer r.Close()
+    c.DataFromReader(http.StatusOK, info.Size, payrollFormats[e.Format].contentType, r, map[string]string{
+        "X-Export-Id":         strconv.Itoa(e.ExportID),
+        "Content-Disposition": fmt.Sprintf(`attachment; filename="payroll-%s-%d.%s"`, e.Period, e.ExportID, payrollFormats[e.Format].ext),
+    })
+}
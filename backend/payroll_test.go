@@ -0,0 +1,85 @@
+package main
+
+import (
+    "errors"
+    "strings"
+    "testing"
+)
+
+var payrollLines = []BonusLine{
+    {DriverID: 1, DriverCode: "D1", FirstName: "Ann", LastName: "Able", DriverType: "OTR", Period: "2025-Q2", SafetyPoints: 2, ScorecardPct: 80, Eligible: true, Payout: 412.5},
+    {DriverID: 2, DriverCode: "D2", FirstName: "Bo", LastName: "Baker-Brown", DriverType: "Local", Period: "2025-Q2", SafetyPoints: 11, ScorecardPct: 55.25, Payout: 0},
+}
+
+var payrollTestFields = []PayrollField{
+    {Field: "driver_code", Header: "Code", Width: 4},
+    {Field: "name", Header: "Name", Width: 8},
+    {Field: "payout_cents", Header: "Cents", Width: 6, Align: "right"},
+    {Field: "eligible", Header: "OK", Width: 5},
+}
+
+func TestRenderPayroll(t *testing.T) {
+    for _, tc := range []struct {
+        format, contentType, want string
+    }{
+        {"csv", "text/csv; charset=utf-8", "Code,Name,Cents,OK\nD1,\"Able, Ann\",41250,true\nD2,\"Baker-Brown, Bo\",0,false\n"},
+        // Values are cut to the width and padded on the aligned side
+        {"fixed", "text/plain; charset=utf-8", "D1  Able, An 41250true \r\nD2  Baker-Br     0false\r\n"},
+        {"json", "application/json; charset=utf-8", `[
+  {
+    "Cents": 41250,
+    "Code": "D1",
+    "Name": "Able, Ann",
+    "OK": true
+  },
+  {
+    "Cents": 0,
+    "Code": "D2",
+    "Name": "Baker-Brown, Bo",
+    "OK": false
+  }
+]`},
+    } {
+        body, contentType, err := renderPayroll(PayrollTemplate{Name: "t", Format: tc.format, Fields: payrollTestFields}, payrollLines)
+        if err != nil || contentType != tc.contentType || string(body) != tc.want {
+            t.Errorf("%s = %q (%s, %v)\nwant %q", tc.format, body, contentType, err, tc.want)
+        }
+    }
+    if _, _, err := renderPayroll(PayrollTemplate{Format: "xml", Fields: payrollTestFields}, payrollLines); err == nil {
+        t.Error("unknown format accepted")
+    }
+}
+
+// Payouts are written with two decimals, not as Go prints floats.
+func TestRenderPayrollDefaultCSV(t *testing.T) {
+    body, _, err := renderPayroll(payrollTemplates["csv"], payrollLines[:1])
+    want := "driver_code,name,driver_type,period,safety_points,scorecard_pct,payout\nD1,\"Able, Ann\",OTR,2025-Q2,2,80.00,412.50\n"
+    if err != nil || string(body) != want {
+        t.Errorf("csv = %q, want %q", body, want)
+    }
+}
+
+// A payout too wide for its column fails rather than being cut to a different amount.
+func TestRenderPayrollFixedOverflow(t *testing.T) {
+    tmpl := PayrollTemplate{Name: "narrow", Format: "fixed", Fields: []PayrollField{
+        {Field: "driver_code", Width: 4},
+        {Field: "payout", Width: 6, Align: "right"},
+    }}
+    lines := []BonusLine{{DriverCode: "D1", Payout: 99.5}, {DriverCode: "D2", Payout: 1234.56}}
+    _, _, err := renderPayroll(tmpl, lines)
+    if !errors.Is(err, errPayrollTooWide) || !strings.Contains(err.Error(), "payout of driver D2 is 1234.56") {
+        t.Errorf("err = %v", err)
+    }
+}
+
+// Names that would start a spreadsheet formula are written as text.
+func TestRenderPayrollCSVFormula(t *testing.T) {
+    line := payrollLines[0]
+    line.LastName, line.FirstName = "=HYPERLINK(\"http://x\")", "Ann"
+    line.DriverCode = "@D1"
+    body, _, err := renderPayroll(PayrollTemplate{Format: "csv", Fields: payrollTestFields}, []BonusLine{line})
+    want := "Code,Name,Cents,OK\n'@D1,\"'=HYPERLINK(\"\"http://x\"\"), Ann\",41250,true\n"
+    if err != nil || string(body) != want {
+        t.Errorf("csv = %q, want %q", body, want)
+    }
+}
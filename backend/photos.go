@@ -0,0 +1,411 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "image"
+    _ "image/gif"
+    "image/jpeg"
+    "image/png"
+    "io"
+    "log/slog"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "golang.org/x/image/draw"
+    _ "golang.org/x/image/webp"
+)
+
+const (
+    maxPhotoBytes   = 10 << 20 // 10 MiB
+    maxPhotoPixels  = 40e6     // decoded size limit; a small file can declare a huge image
+    thumbnailEdge   = 256      // longest side of the generated thumbnail, in pixels
+    photoURLETagLen = 12
+)
+
+var photoExtensions = map[string]string{
+    "image/jpeg": "jpg",
+    "image/png":  "png",
+    "image/gif":  "gif",
+    "image/webp": "webp",
+}
+
+var (
+    errUnsupportedPhoto   = errors.New("photo must be a JPEG, PNG, GIF or WebP image")
+    errPhotoTooLarge      = fmt.Errorf("photo exceeds %d MiB", maxPhotoBytes>>20)
+    errPhotoTooManyPixels = fmt.Errorf("photo exceeds %d megapixels", int(maxPhotoPixels/1e6))
+)
+
+// apiBaseURL is the externally visible origin used to build photo URLs.
+func apiBaseURL(c *gin.Context) string {
+    if base := conf.Server.PublicURL; base != "" {
+        return strings.TrimRight(base, "/")
+    }
+    scheme := "http"
+    if c.Request.TLS != nil {
+        scheme = "https"
+    }
+    if p := c.GetHeader("X-Forwarded-Proto"); p != "" {
+        scheme = p
+    }
+    host := c.Request.Host
+    if h := c.GetHeader("X-Forwarded-Host"); h != "" {
+        host = h
+    }
+    return scheme + "://" + host
+}
+
+// photoURL returns the versioned photo URL for a driver, or nil when there is no photo.
+func photoURL(base string, driverID int, etag sql.NullString) *string {
+    if !etag.Valid || etag.String == "" {
+        return nil
+    }
+    v := etag.String
+    if len(v) > photoURLETagLen {
+        v = v[:photoURLETagLen]
+    }
+    u := fmt.Sprintf("%s/api/drivers/%d/photo?v=%s", base, driverID, v)
+    return &u
+}
+
+// decodeDataURL accepts "data:image/png;base64,...." or a bare base64 string.
+func decodeDataURL(s string) ([]byte, error) {
+    s = strings.TrimSpace(s)
+    if strings.HasPrefix(s, "data:") {
+        i := strings.Index(s, ",")
+        if i < 0 || !strings.Contains(s[:i], ";base64") {
+            return nil, errors.New("profile_pic must be a base64 data URL")
+        }
+        s = s[i+1:]
+    }
+    data, err := base64.StdEncoding.DecodeString(s)
+    if err != nil {
+        return nil, fmt.Errorf("profile_pic is not valid base64: %w", err)
+    }
+    return data, nil
+}
+
+func isDataURL(s *string) bool {
+    return s != nil && strings.HasPrefix(strings.TrimSpace(*s), "data:")
+}
+
+// makeThumbnail scales the image to fit within thumbnailEdge. PNG and GIF sources
+// keep transparency by staying PNG; everything else becomes JPEG.
+func makeThumbnail(data []byte, contentType string) ([]byte, string, error) {
+    // Check the declared dimensions before decoding allocates for them
+    cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+    if err != nil {
+        return nil, "", errUnsupportedPhoto
+    }
+    if float64(cfg.Width)*float64(cfg.Height) > maxPhotoPixels {
+        return nil, "", errPhotoTooManyPixels
+    }
+    src, _, err := image.Decode(bytes.NewReader(data))
+    if err != nil {
+        return nil, "", errUnsupportedPhoto
+    }
+    b := src.Bounds()
+    w, h := b.Dx(), b.Dy()
+    if w > thumbnailEdge || h > thumbnailEdge {
+        if w >= h {
+            h = h * thumbnailEdge / w
+            w = thumbnailEdge
+        } else {
+            w = w * thumbnailEdge / h
+            h = thumbnailEdge
+        }
+    }
+    dst := image.NewRGBA(image.Rect(0, 0, max(w, 1), max(h, 1)))
+    draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Over, nil)
+
+    var buf bytes.Buffer
+    if contentType == "image/png" || contentType == "image/gif" {
+        if err := png.Encode(&buf, dst); err != nil {
+            return nil, "", err
+        }
+        return buf.Bytes(), "image/png", nil
+    }
+    if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+        return nil, "", err
+    }
+    return buf.Bytes(), "image/jpeg", nil
+}
+
+// savePhoto stores the original and a thumbnail in the file store and points the
+// driver row at them, removing whatever photo was there before.
+func savePhoto(ctx context.Context, driverID int, data []byte) (string, error) {
+    if len(data) > maxPhotoBytes {
+        return "", errPhotoTooLarge
+    }
+    contentType := http.DetectContentType(data)
+    ext, ok := photoExtensions[contentType]
+    if !ok {
+        return "", errUnsupportedPhoto
+    }
+    thumb, thumbType, err := makeThumbnail(data, contentType)
+    if err != nil {
+        return "", err
+    }
+
+    sum := sha256.Sum256(data)
+    etag := hex.EncodeToString(sum[:])
+    prefix := fmt.Sprintf("photos/driver-%d/%s", driverID, etag[:16])
+    key := prefix + "." + ext
+    thumbKey := prefix + "-thumb." + photoExtensions[thumbType]
+
+    var oldKey, oldThumbKey sql.NullString
+    err = queryRow(ctx, `SELECT photo_key, photo_thumb_key FROM drivers WHERE driver_id=?`, driverID).Scan(&oldKey, &oldThumbKey)
+    if err != nil {
+        return "", err
+    }
+
+    if err := files.Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+        return "", err
+    }
+    if err := files.Put(ctx, thumbKey, bytes.NewReader(thumb), int64(len(thumb)), thumbType); err != nil {
+        return "", err
+    }
+    _, err = exec(ctx, `
+        UPDATE drivers SET version=version+IF(photo_etag <=> ?, 0, 1),
+            photo_key=?, photo_thumb_key=?, photo_content_type=?, photo_thumb_content_type=?, photo_etag=?, profile_pic=NULL
+        WHERE driver_id=?`, etag, key, thumbKey, contentType, thumbType, etag, driverID)
+    if err != nil {
+        return "", err
+    }
+
+    afterCommit(ctx, func() {
+        for _, old := range []sql.NullString{oldKey, oldThumbKey} {
+            if old.Valid && old.String != key && old.String != thumbKey {
+                if err := files.Delete(ctx, old.String); err != nil {
+                    slog.WarnContext(ctx, "failed removing old photo", "key", old.String, "err", err)
+                }
+            }
+        }
+    })
+    return etag, nil
+}
+
+func removePhoto(ctx context.Context, driverID int) error {
+    var key, thumbKey sql.NullString
+    err := queryRow(ctx, `SELECT photo_key, photo_thumb_key FROM drivers WHERE driver_id=?`, driverID).Scan(&key, &thumbKey)
+    if err != nil {
+        return err
+    }
+    if _, err := exec(ctx, `
+        UPDATE drivers SET version=version+IF(photo_etag IS NULL AND profile_pic IS NULL, 0, 1),
+            photo_key=NULL, photo_thumb_key=NULL, photo_content_type=NULL, photo_thumb_content_type=NULL, photo_etag=NULL, profile_pic=NULL
+        WHERE driver_id=?`, driverID); err != nil {
+        return err
+    }
+    afterCommit(ctx, func() { deleteStoredFiles(ctx, key, thumbKey) })
+    return nil
+}
+
+func photoError(c *gin.Context, err error) {
+    switch err {
+    case sql.ErrNoRows:
+        c.JSON(http.StatusNotFound, APIError{Message: "driver not found"})
+    case errUnsupportedPhoto:
+        c.JSON(http.StatusUnsupportedMediaType, APIError{Message: err.Error()})
+    case errPhotoTooLarge, errPhotoTooManyPixels:
+        c.JSON(http.StatusRequestEntityTooLarge, APIError{Message: err.Error()})
+    default:
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+    }
+}
+
+// --- Driver photo endpoints ---
+
+// PUT /drivers/:id/photo accepts either a raw image body or a multipart "file" field.
+func putDriverPhoto(c *gin.Context) {
+    id := atoi(c.Param("id"))
+    version, ok := ifMatchVersion(c)
+    if !ok {
+        return
+    }
+    c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxPhotoBytes+1<<20)
+
+    var (
+        data []byte
+        err  error
+    )
+    if strings.HasPrefix(c.ContentType(), "multipart/") {
+        fh, ferr := c.FormFile("file")
+        if ferr != nil {
+            c.JSON(http.StatusBadRequest, APIError{Message: "multipart field 'file' is required"})
+            return
+        }
+        f, ferr := fh.Open()
+        if ferr != nil {
+            c.JSON(http.StatusBadRequest, APIError{Message: ferr.Error()})
+            return
+        }
+        defer f.Close()
+        data, err = io.ReadAll(f)
+    } else {
+        data, err = io.ReadAll(c.Request.Body)
+    }
+    if err != nil {
+        c.JSON(http.StatusRequestEntityTooLarge, APIError{Message: err.Error()})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+    defer cancel()
+
+    d, ok := changePhoto(c, ctx, id, version, func(ctx context.Context) error {
+        _, err := savePhoto(ctx, id, data)
+        return err
+    })
+    if !ok {
+        return
+    }
+    setETag(c, d.Version)
+    c.JSON(http.StatusOK, gin.H{"profile_pic": d.ProfilePic})
+}
+
+// changePhoto runs change in a transaction once the driver is locked at the version
+// the client based it on (any version for If-Match: *), then publishes the driver
+// as driver.updated. It answers the request itself when it returns false.
+func changePhoto(c *gin.Context, ctx context.Context, id, version int, change func(ctx context.Context) error) (Driver, bool) {
+    var d Driver
+    err := inTx(ctx, func(ctx context.Context) error {
+        var now int
+        err := queryRow(ctx, `SELECT version FROM drivers WHERE driver_id=? FOR UPDATE`, id).Scan(&now)
+        if err == sql.ErrNoRows {
+            c.JSON(http.StatusNotFound, APIError{Message: "driver not found"})
+            return errAnswered
+        }
+        if err != nil {
+            return err
+        }
+        if version != 0 && now != version {
+            writeMissed(c, "driver", func() (any, int, error) {
+                current, err := loadDriver(ctx, id, apiBaseURL(c))
+                return current, current.Version, err
+            })
+            return errAnswered
+        }
+        if err := change(ctx); err != nil {
+            photoError(c, err)
+            return errAnswered
+        }
+        if d, err = loadDriver(ctx, id, apiBaseURL(c)); err != nil {
+            return err
+        }
+        return publishEvent(ctx, "driver.updated", d)
+    })
+    return d, !txFailed(c, err)
+}
+
+// GET /drivers/:id/photo?size=thumb serves the stored image with ETag revalidation.
+func getDriverPhoto(c *gin.Context) {
+    id := c.Param("id")
+    thumb := c.Query("size") == "thumb"
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+    defer cancel()
+
+    var key, thumbKey, contentType, thumbType, etag sql.NullString
+    err := queryRow(ctx, `
+        SELECT photo_key, photo_thumb_key, photo_content_type, photo_thumb_content_type, photo_etag
+        FROM drivers WHERE driver_id=?`, id).Scan(&key, &thumbKey, &contentType, &thumbType, &etag)
+    if err == sql.ErrNoRows || (err == nil && !key.Valid) {
+        c.JSON(http.StatusNotFound, APIError{Message: "no photo on record"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+
+    tag := `"` + etag.String + `"`
+    if thumb {
+        key, contentType, tag = thumbKey, thumbType, `"`+etag.String+`-thumb"`
+    }
+    c.Header("ETag", tag)
+    c.Header("Cache-Control", "no-cache")
+    if match := c.GetHeader("If-None-Match"); match != "" && (match == tag || match == "W/"+tag || match == "*") {
+        c.Status(http.StatusNotModified)
+        return
+    }
+
+    r, info, err := files.Get(ctx, key.String)
+    if err == ErrFileNotFound {
+        c.JSON(http.StatusNotFound, APIError{Message: "photo file missing from store"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    defer r.Close()
+    c.DataFromReader(http.StatusOK, info.Size, contentType.String, r, nil)
+}
+
+func deleteDriverPhoto(c *gin.Context) {
+    id := atoi(c.Param("id"))
+    version, ok := ifMatchVersion(c)
+    if !ok {
+        return
+    }
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+    defer cancel()
+
+    d, ok := changePhoto(c, ctx, id, version, func(ctx context.Context) error { return removePhoto(ctx, id) })
+    if !ok {
+        return
+    }
+    setETag(c, d.Version)
+    c.Status(http.StatusNoContent)
+}
+
+// --- One-time migration of base64 profile_pic values ---
+
+// migrateLegacyProfilePics moves any base64 profile_pic written before the file
+// store existed into the store (the photo columns come from schemaUpgrades). Rows
+// are cleared as they are migrated, so re-running it is a no-op.
+func migrateLegacyProfilePics(ctx context.Context) error {
+    rows, err := queryRows(ctx, `SELECT driver_id FROM drivers WHERE profile_pic IS NOT NULL AND profile_pic <> '' AND photo_key IS NULL`)
+    if err != nil {
+        return err
+    }
+    var ids []int
+    for rows.Next() {
+        var id int
+        if err := rows.Scan(&id); err == nil {
+            ids = append(ids, id)
+        }
+    }
+    rows.Close()
+
+    migrated := 0
+    for _, id := range ids {
+        var pic string
+        if err := queryRow(ctx, `SELECT profile_pic FROM drivers WHERE driver_id=?`, id).Scan(&pic); err != nil {
+            return err
+        }
+        data, err := decodeDataURL(pic)
+        if err == nil {
+            _, err = savePhoto(ctx, id, data)
+        }
+        if err != nil {
+            // Leave the row untouched so the data is not lost; it will be retried next start
+            slog.WarnContext(ctx, "profile_pic migration skipped driver", "driver_id", id, "err", err)
+            continue
+        }
+        migrated++
+    }
+    if len(ids) > 0 {
+        slog.InfoContext(ctx, "migrated legacy profile pictures to the file store", "migrated", migrated, "total", len(ids))
+    }
+    return nil
+}
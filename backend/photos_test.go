@@ -0,0 +1,106 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/binary"
+    "hash/crc32"
+    "image"
+    "image/png"
+    "net/http"
+    "strings"
+    "testing"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/gin-gonic/gin"
+)
+
+// A tiny PNG whose header claims a huge image is refused before it is decoded.
+func TestThumbnailPixelLimit(t *testing.T) {
+    var buf bytes.Buffer
+    if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+        t.Fatal(err)
+    }
+    data := buf.Bytes()
+    // IHDR follows the 8-byte signature: length, type, width, height, ..., CRC
+    ihdr := data[8+8 : 8+8+13]
+    binary.BigEndian.PutUint32(ihdr[0:], 50000)
+    binary.BigEndian.PutUint32(ihdr[4:], 50000)
+    binary.BigEndian.PutUint32(data[8+8+13:], crc32.ChecksumIEEE(data[8+4:8+8+13]))
+
+    if _, _, err := makeThumbnail(data, "image/png"); err != errPhotoTooManyPixels {
+        t.Errorf("err = %v, want %v", err, errPhotoTooManyPixels)
+    }
+    if _, _, err := makeThumbnail(nil, "image/png"); err != errUnsupportedPhoto {
+        t.Errorf("empty upload: %v", err)
+    }
+}
+
+// Deleting a driver removes its photo and credential scans once the delete commits.
+func TestDeleteDriverRemovesFiles(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+    store := withFileStore(t)
+
+    ctx := context.Background()
+    keys := []string{"photos/driver-3/ab.jpg", "photos/driver-3/ab-thumb.jpg", "credentials/8/cd"}
+    for _, k := range keys {
+        if err := store.Put(ctx, k, strings.NewReader("x"), 1, "application/octet-stream"); err != nil {
+            t.Fatal(err)
+        }
+    }
+    mock.ExpectQuery(`FROM attachments`).WillReturnRows(sqlmock.NewRows([]string{"sha256"}))
+    mock.ExpectBegin()
+    mock.ExpectQuery(`SELECT photo_key, photo_thumb_key FROM drivers WHERE driver_id=\?`).WithArgs("3").
+        WillReturnRows(sqlmock.NewRows([]string{"photo_key", "photo_thumb_key"}).AddRow(keys[0], keys[1]))
+    mock.ExpectQuery(`SELECT file_key FROM driver_credentials WHERE driver_id=\?`).WithArgs("3").
+        WillReturnRows(sqlmock.NewRows([]string{"file_key"}).AddRow(keys[2]))
+    mock.ExpectExec(`DELETE FROM drivers WHERE driver_id=\?`).WithArgs("3", 4, 4).WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectQuery(`FROM webhook_subscriptions`).WillReturnRows(sqlmock.NewRows([]string{"subscription_id", "event_types"}))
+    mock.ExpectExec(`INSERT INTO change_events`).WithArgs("driver.deleted", 3, sqlmock.AnyArg(), sqlmock.AnyArg()).
+        WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectCommit()
+
+    if w := testWrite(http.MethodDelete, "/api/drivers/3", `"4"`, ""); w.Code != http.StatusNoContent {
+        t.Fatalf("delete = %d %s", w.Code, w.Body)
+    }
+    for _, k := range keys {
+        if _, _, err := store.Get(ctx, k); err != ErrFileNotFound {
+            t.Errorf("%s still stored: %v", k, err)
+        }
+    }
+}
+
+// Removing the photo is a versioned write: a stale If-Match changes nothing, a
+// current one bumps the version and publishes the driver.
+func TestDeleteDriverPhotoVersioned(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+    withFileStore(t)
+
+    mock.ExpectBegin()
+    mock.ExpectQuery(`SELECT version FROM drivers WHERE driver_id=\? FOR UPDATE`).WithArgs(1).
+        WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(5))
+    mock.ExpectQuery(`SELECT .+ FROM drivers WHERE driver_id=\?`).WithArgs(1).
+        WillReturnRows(sqlmock.NewRows(driverCols).AddRow(1, "D1", "Ann", "Able", nil, nil, nil, true, "0123456789abcdef", 5))
+    mock.ExpectRollback()
+    if w := testWrite(http.MethodDelete, "/api/drivers/1/photo", `"4"`, ""); w.Code != http.StatusPreconditionFailed || w.Header().Get("ETag") != `"5"` {
+        t.Errorf("stale delete = %d %s, ETag %s", w.Code, w.Body, w.Header().Get("ETag"))
+    }
+
+    mock.ExpectBegin()
+    mock.ExpectQuery(`SELECT version FROM drivers WHERE driver_id=\? FOR UPDATE`).WithArgs(1).
+        WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(5))
+    mock.ExpectQuery(`SELECT photo_key, photo_thumb_key FROM drivers`).WithArgs(1).
+        WillReturnRows(sqlmock.NewRows([]string{"photo_key", "photo_thumb_key"}).AddRow("photos/driver-1/01.jpg", "photos/driver-1/01-thumb.jpg"))
+    mock.ExpectExec(`UPDATE drivers SET version=version\+IF`).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+    mock.ExpectQuery(`SELECT .+ FROM drivers WHERE driver_id=\?`).WithArgs(1).
+        WillReturnRows(sqlmock.NewRows(driverCols).AddRow(1, "D1", "Ann", "Able", nil, nil, nil, true, nil, 6))
+    mock.ExpectQuery(`FROM webhook_subscriptions`).WillReturnRows(sqlmock.NewRows([]string{"subscription_id", "event_types"}))
+    mock.ExpectExec(`INSERT INTO change_events`).WithArgs("driver.updated", 1, sqlmock.AnyArg(), sqlmock.AnyArg()).
+        WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectCommit()
+    if w := testWrite(http.MethodDelete, "/api/drivers/1/photo", `"5"`, ""); w.Code != http.StatusNoContent || w.Header().Get("ETag") != `"6"` {
+        t.Errorf("delete = %d %s, ETag %s", w.Code, w.Body, w.Header().Get("ETag"))
+    }
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "math"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// Reports count safety events that still stand: overturned disputes are left out
+// of both the event count and the points, matching the Dashboard and bonus totals.
+const countedSafetyEvent = `(se.dispute_status IS NULL OR se.dispute_status <> 'overturned')`
+
+// Inspection outcomes are recorded as safety categories; level is the CVSA level.
+var inspectionCodes = map[string]struct {
+    level  int
+    passed bool
+}{
+    "P00003": {1, true},
+    "P00004": {2, true},
+    "P00005": {3, true},
+    "P00006": {1, false},
+    "P00007": {2, false},
+    "P00008": {3, false},
+}
+
+// reportRange reads ?from=&to= (YYYY-MM-DD, inclusive). The default is the twelve
+// months ending today.
+func reportRange(c *gin.Context) (from, to time.Time, err error) {
+    now := time.Now().In(localTZ)
+    to = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, localTZ)
+    from = time.Date(now.Year(), now.Month()-11, 1, 0, 0, 0, 0, localTZ)
+    if s := c.Query("to"); s != "" {
+        if to, err = parseLocalDate(s); err != nil {
+            return from, to, fmt.Errorf("to must be YYYY-MM-DD")
+        }
+    }
+    if s := c.Query("from"); s != "" {
+        if from, err = parseLocalDate(s); err != nil {
+            return from, to, fmt.Errorf("from must be YYYY-MM-DD")
+        }
+    }
+    if from.After(to) {
+        return from, to, fmt.Errorf("from must not be after to")
+    }
+    return from, to, nil
+}
+
+func reportLimit(c *gin.Context, def, max int) int {
+    n, err := strconv.Atoi(c.Query("limit"))
+    if err != nil || n <= 0 {
+        return def
+    }
+    if n > max {
+        return max
+    }
+    return n
+}
+
+// bucketLabel names the week ("2025-W07", ISO) or month ("2025-02") a date falls in.
+func bucketLabel(t time.Time, interval string) string {
+    if interval == "week" {
+        y, w := t.ISOWeek()
+        return fmt.Sprintf("%d-W%02d", y, w)
+    }
+    return t.Format("2006-01")
+}
+
+// bucketLabels lists every bucket between from and to so series have no gaps.
+func bucketLabels(from, to time.Time, interval string) []string {
+    var labels []string
+    seen := map[string]bool{}
+    step := func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+    start := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, localTZ)
+    if interval == "week" {
+        step = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+        start = from.AddDate(0, 0, -((int(from.Weekday()) + 6) % 7)) // back to Monday
+    }
+    for t := start; !t.After(to); t = step(t) {
+        if l := bucketLabel(t, interval); !seen[l] {
+            seen[l] = true
+            labels = append(labels, l)
+        }
+    }
+    return labels
+}
+
+func pctChange(now, before int) *float64 {
+    if before == 0 {
+        return nil
+    }
+    v := math.Round(float64(now-before)/math.Abs(float64(before))*1000) / 10
+    return &v
+}
+
+func safetyTotals(ctx context.Context, from, to time.Time) (PeriodTotals, error) {
+    t := PeriodTotals{From: formatLocalDate(from), To: formatLocalDate(to)}
+    err := queryRow(ctx, `
+        SELECT COUNT(*), COALESCE(SUM(se.bonus_score), 0)
+        FROM safety_events se
+        WHERE se.event_date BETWEEN ? AND ? AND `+countedSafetyEvent, t.From, t.To).Scan(&t.Events, &t.Points)
+    return t, err
+}
+
+// safetyBreakdown groups counted events in the range by keyExpr (labelled with
+// descExpr's long form) into an events series and a points series.
+func safetyBreakdown(ctx context.Context, from, to time.Time, joins, keyExpr, descExpr string) (ReportSeries, error) {
+    r := ReportSeries{From: formatLocalDate(from), To: formatLocalDate(to), Labels: []string{}}
+    rows, err := queryRows(ctx, `
+        SELECT `+keyExpr+`, `+descExpr+`, COUNT(*), COALESCE(SUM(se.bonus_score), 0)
+        FROM safety_events se
+        `+joins+`
+        WHERE se.event_date BETWEEN ? AND ? AND `+countedSafetyEvent+`
+        GROUP BY 1, 2
+        ORDER BY 4 DESC, 3 DESC, 1`, r.From, r.To)
+    if err != nil {
+        return r, err
+    }
+    defer rows.Close()
+
+    events := SeriesValues{Name: "events", Data: []float64{}}
+    points := SeriesValues{Name: "points", Data: []float64{}}
+    for rows.Next() {
+        var (
+            label, desc string
+            n, pts      int
+        )
+        if err := rows.Scan(&label, &desc, &n, &pts); err != nil {
+            return r, err
+        }
+        r.Labels = append(r.Labels, label)
+        r.Descriptions = append(r.Descriptions, desc)
+        events.Data = append(events.Data, float64(n))
+        points.Data = append(points.Data, float64(pts))
+    }
+    r.Series = []SeriesValues{events, points}
+    return r, rows.Err()
+}
+
+func reportBreakdown(name, joins, keyExpr, descExpr string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        from, to, err := reportRange(c)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+            return
+        }
+        ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+        defer cancel()
+
+        r, err := safetyBreakdown(ctx, from, to, joins, keyExpr, descExpr)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+            return
+        }
+        respondReport(c, name, r)
+    }
+}
+
+// --- Reports ---
+
+// GET /reports/safety/timeseries?interval=week|month&from=&to=
+func getSafetyTimeseries(c *gin.Context) {
+    interval := c.DefaultQuery("interval", "month")
+    if interval != "week" && interval != "month" {
+        c.JSON(http.StatusBadRequest, APIError{Message: "interval must be 'week' or 'month'"})
+        return
+    }
+    from, to, err := reportRange(c)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+    defer cancel()
+
+    r := ReportSeries{From: formatLocalDate(from), To: formatLocalDate(to), Labels: bucketLabels(from, to, interval)}
+    index := make(map[string]int, len(r.Labels))
+    for i, l := range r.Labels {
+        index[l] = i
+    }
+    events := SeriesValues{Name: "events", Data: make([]float64, len(r.Labels))}
+    points := SeriesValues{Name: "points", Data: make([]float64, len(r.Labels))}
+
+    rows, err := queryRows(ctx, `
+        SELECT DATE_FORMAT(se.event_date, '%Y-%m-%d'), COUNT(*), COALESCE(SUM(se.bonus_score), 0)
+        FROM safety_events se
+        WHERE se.event_date BETWEEN ? AND ? AND `+countedSafetyEvent+`
+        GROUP BY se.event_date`, r.From, r.To)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var (
+            day    string
+            n, pts int
+        )
+        if err := rows.Scan(&day, &n, &pts); err != nil {
+            continue
+        }
+        t, err := parseLocalDate(day)
+        if err != nil {
+            continue
+        }
+        if i, ok := index[bucketLabel(t, interval)]; ok {
+            events.Data[i] += float64(n)
+            points.Data[i] += float64(pts)
+        }
+    }
+    r.Series = []SeriesValues{events, points}
+    respondReport(c, "safety-"+interval+"ly", r)
+}
+
+// GET /reports/safety/top-offenders?from=&to=&limit=10 ranks drivers by points.
+func getTopOffenders(c *gin.Context) {
+    from, to, err := reportRange(c)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+    defer cancel()
+
+    rows, err := queryRows(ctx, `
+        SELECT d.driver_id, d.driver_code, CONCAT(d.first_name, ' ', d.last_name), COALESCE(dt.driver_type, ''),
+               COUNT(*), COALESCE(SUM(se.bonus_score), 0) AS points
+        FROM safety_events se
+        JOIN drivers d ON d.driver_id = se.driver_id
+        LEFT JOIN driver_type dt ON dt.driver_type_id = d.driver_type_id
+        WHERE se.event_date BETWEEN ? AND ? AND `+countedSafetyEvent+`
+        GROUP BY d.driver_id, d.driver_code, d.first_name, d.last_name, dt.driver_type
+        HAVING points > 0
+        ORDER BY points DESC, COUNT(*) DESC, d.last_name
+        LIMIT ?`, formatLocalDate(from), formatLocalDate(to), reportLimit(c, 10, 100))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    offenders := []TopOffender{}
+    for rows.Next() {
+        var o TopOffender
+        if err := rows.Scan(&o.DriverID, &o.DriverCode, &o.Name, &o.DriverType, &o.Events, &o.Points); err != nil {
+            continue
+        }
+        offenders = append(offenders, o)
+    }
+    respondReport(c, "top-offenders", offenders)
+}
+
+// GET /reports/safety/trend?from=&to= compares the range with the equally long range before it.
+func getSafetyTrend(c *gin.Context) {
+    from, to, err := reportRange(c)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+    defer cancel()
+
+    days := int(math.Round(to.Sub(from).Hours()/24)) + 1
+    priorTo := from.AddDate(0, 0, -1)
+    priorFrom := priorTo.AddDate(0, 0, -(days - 1))
+
+    var t SafetyTrend
+    if t.Current, err = safetyTotals(ctx, from, to); err == nil {
+        t.Prior, err = safetyTotals(ctx, priorFrom, priorTo)
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    t.EventsChangePct = pctChange(t.Current.Events, t.Prior.Events)
+    t.PointsChangePct = pctChange(t.Current.Points, t.Prior.Points)
+    respondReport(c, "safety-trend", t)
+}
+
+// GET /reports/safety/inspections?from=&to= gives the pass/fail ratio overall and per level.
+func getInspectionReport(c *gin.Context) {
+    from, to, err := reportRange(c)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+    defer cancel()
+
+    r := InspectionReport{From: formatLocalDate(from), To: formatLocalDate(to)}
+    r.ByLevel = ReportSeries{
+        From:   r.From,
+        To:     r.To,
+        Labels: []string{"Level 1", "Level 2", "Level 3"},
+        Series: []SeriesValues{{Name: "passed", Data: make([]float64, 3)}, {Name: "failed", Data: make([]float64, 3)}},
+    }
+
+    rows, err := queryRows(ctx, `
+        SELECT sc.code, COUNT(*)
+        FROM safety_events se
+        JOIN safety_categories sc ON sc.category_id = se.category_id
+        WHERE se.event_date BETWEEN ? AND ? AND `+countedSafetyEvent+`
+          AND sc.code IN ('P00003', 'P00004', 'P00005', 'P00006', 'P00007', 'P00008')
+        GROUP BY sc.code`, r.From, r.To)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var (
+            code string
+            n    int
+        )
+        if err := rows.Scan(&code, &n); err != nil {
+            continue
+        }
+        ic, ok := inspectionCodes[code]
+        if !ok {
+            continue
+        }
+        if ic.passed {
+            r.Passed += n
+            r.ByLevel.Series[0].Data[ic.level-1] += float64(n)
+        } else {
+            r.Failed += n
+            r.ByLevel.Series[1].Data[ic.level-1] += float64(n)
+        }
+    }
+    if total := r.Passed + r.Failed; total > 0 {
+        rate := math.Round(float64(r.Passed)/float64(total)*1000) / 10
+        r.PassRate = &rate
+    }
+    respondReport(c, "inspections", r)
+}
+
+var (
+    getSafetyByCategory = reportBreakdown("safety-by-category",
+        `JOIN safety_categories sc ON sc.category_id = se.category_id`,
+        `sc.code`, `sc.description`)
+    getSafetyByDriverType = reportBreakdown("safety-by-driver-type",
+        `JOIN drivers d ON d.driver_id = se.driver_id
+         LEFT JOIN driver_type dt ON dt.driver_type_id = d.driver_type_id`,
+        `COALESCE(dt.driver_type, 'Unassigned')`, `COALESCE(dt.driver_type, 'Unassigned')`)
+    // The truck is the one the driver was last assigned to on or before the event
+    // date according to truck history, falling back to their current truck.
+    getSafetyByTruck = reportBreakdown("safety-by-truck",
+        `JOIN drivers d ON d.driver_id = se.driver_id
+         LEFT JOIN trucks t ON t.truck_id = COALESCE(
+             (SELECT th.truck_id FROM truck_history th
+              WHERE th.driver_id = se.driver_id AND th.type = 'assignment' AND DATE(th.date) <= se.event_date
+              ORDER BY th.date DESC, th.truck_history_id DESC LIMIT 1),
+             d.truck_id)`,
+        `COALESCE(t.unit_number, 'No truck')`, `COALESCE(CONCAT(t.unit_number, ' (', t.year, ')'), 'No truck')`)
+)
@@ -0,0 +1,356 @@
+package main
+
+import (
+    "context"
+    "regexp"
+    "slices"
+    "strings"
+)
+
+// Tables and columns added after the first release, run in order at startup.
+// init.sql only runs against an empty volume and creates just the original
+// tables, so new and existing databases both get these here. Every statement
+// must be idempotent (IF NOT EXISTS), and a table must be created before any
+// ALTER of it.
+var schemaUpgrades = []string{
+    `ALTER TABLE drivers ADD COLUMN IF NOT EXISTS active BOOLEAN NOT NULL DEFAULT TRUE AFTER driver_type_id`,
+    // Driver photos live in the file store; the row keeps the keys and a content hash
+    `ALTER TABLE drivers ADD COLUMN IF NOT EXISTS photo_key VARCHAR(255) NULL`,
+    `ALTER TABLE drivers ADD COLUMN IF NOT EXISTS photo_thumb_key VARCHAR(255) NULL`,
+    `ALTER TABLE drivers ADD COLUMN IF NOT EXISTS photo_content_type VARCHAR(100) NULL`,
+    `ALTER TABLE drivers ADD COLUMN IF NOT EXISTS photo_thumb_content_type VARCHAR(100) NULL`,
+    `ALTER TABLE drivers ADD COLUMN IF NOT EXISTS photo_etag CHAR(64) NULL`,
+    // Driver credentials (qualification file: licenses, medicals, certifications)
+    `CREATE TABLE IF NOT EXISTS driver_credentials (
+        credential_id     INT AUTO_INCREMENT PRIMARY KEY,
+        driver_id         INT NOT NULL,
+        credential_type   ENUM('license','medical','hazmat_tdg','border_card','other') NOT NULL,
+        number            VARCHAR(100) NOT NULL DEFAULT '',
+        jurisdiction      VARCHAR(100) NOT NULL DEFAULT '',
+        issue_date        DATE NULL,
+        expiry_date       DATE NULL,
+        blocks_bonus      BOOLEAN NOT NULL DEFAULT TRUE,
+        expiry_flagged_at DATETIME NULL, -- set by the flag-expiring-credentials job; cleared when expiry_date changes
+        file_name         VARCHAR(255) NULL,
+        file_content_type VARCHAR(100) NULL,
+        file_key          VARCHAR(255) NULL, -- scanned document in the file store
+        file_size         BIGINT NULL,
+        created_at        TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at        TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+        CONSTRAINT fk_dc_driver
+          FOREIGN KEY (driver_id) REFERENCES drivers(driver_id) ON DELETE CASCADE ON UPDATE CASCADE,
+        INDEX idx_dc_driver (driver_id),
+        INDEX idx_dc_expiry (expiry_date)
+    ) ENGINE=InnoDB`,
+    // Evidence attachments (files live in the file store, keyed by checksum)
+    `CREATE TABLE IF NOT EXISTS attachments (
+        attachment_id      INT AUTO_INCREMENT PRIMARY KEY,
+        safety_event_id    INT NULL,
+        scorecard_event_id INT NULL,
+        kind               ENUM('file','link') NOT NULL DEFAULT 'file',
+        file_name          VARCHAR(255) NULL,
+        content_type       VARCHAR(100) NULL,
+        size_bytes         BIGINT NULL,
+        sha256             CHAR(64) NULL,
+        storage_key        VARCHAR(255) NULL,
+        url                VARCHAR(2048) NULL,
+        description        VARCHAR(500) NOT NULL DEFAULT '',
+        uploaded_at        TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        CONSTRAINT fk_att_safety_event
+          FOREIGN KEY (safety_event_id) REFERENCES safety_events(safety_event_id) ON DELETE CASCADE ON UPDATE CASCADE,
+        CONSTRAINT fk_att_scorecard_event
+          FOREIGN KEY (scorecard_event_id) REFERENCES scorecard_events(scorecard_event_id) ON DELETE CASCADE ON UPDATE CASCADE,
+        CONSTRAINT chk_att_owner
+          CHECK ((safety_event_id IS NULL) <> (scorecard_event_id IS NULL)),
+        INDEX idx_att_safety_event (safety_event_id),
+        INDEX idx_att_scorecard_event (scorecard_event_id),
+        INDEX idx_att_sha256 (sha256)
+    ) ENGINE=InnoDB`,
+    // Status of the latest dispute, kept on the event for filtering and bonus scoring
+    `ALTER TABLE safety_events ADD COLUMN IF NOT EXISTS dispute_status ENUM('open','under_review','upheld','overturned') NULL AFTER bonus_period`,
+    // Safety event disputes (driver/manager appeals; overturned events stop counting toward bonus_score)
+    `CREATE TABLE IF NOT EXISTS safety_event_disputes (
+        dispute_id       INT AUTO_INCREMENT PRIMARY KEY,
+        safety_event_id  INT NOT NULL,
+        reason           TEXT NOT NULL,
+        opened_by        VARCHAR(100) NOT NULL,
+        opened_by_role   ENUM('driver','manager') NOT NULL,
+        status           ENUM('open','under_review','upheld','overturned') NOT NULL DEFAULT 'open',
+        opened_at        DATETIME NOT NULL,
+        reviewer         VARCHAR(100) NULL,
+        resolution_notes TEXT NULL,
+        resolved_at      DATETIME NULL,
+        CONSTRAINT fk_sed_event
+          FOREIGN KEY (safety_event_id) REFERENCES safety_events(safety_event_id) ON DELETE CASCADE ON UPDATE CASCADE,
+        INDEX idx_sed_event (safety_event_id),
+        INDEX idx_sed_status (status)
+    ) ENGINE=InnoDB`,
+    `CREATE TABLE IF NOT EXISTS safety_event_dispute_transitions (
+        transition_id INT AUTO_INCREMENT PRIMARY KEY,
+        dispute_id    INT NOT NULL,
+        from_status   ENUM('open','under_review','upheld','overturned') NULL,
+        to_status     ENUM('open','under_review','upheld','overturned') NOT NULL,
+        actor         VARCHAR(100) NOT NULL,
+        notes         TEXT,
+        changed_at    DATETIME NOT NULL,
+        CONSTRAINT fk_sedt_dispute
+          FOREIGN KEY (dispute_id) REFERENCES safety_event_disputes(dispute_id) ON DELETE CASCADE ON UPDATE CASCADE,
+        INDEX idx_sedt_dispute (dispute_id, changed_at)
+    ) ENGINE=InnoDB`,
+    // Bonus periods: open -> closed -> approved; only approved periods go to payroll
+    `CREATE TABLE IF NOT EXISTS bonus_periods (
+        period_id     INT AUTO_INCREMENT PRIMARY KEY,
+        period_key    VARCHAR(7) NOT NULL UNIQUE,
+        starts_on     DATE NOT NULL,
+        ends_on       DATE NOT NULL,
+        status        ENUM('open','closed','approved') NOT NULL DEFAULT 'open',
+        max_payout    DECIMAL(10,2) NOT NULL DEFAULT 0,
+        closed_at     DATETIME NULL,
+        approved_by   VARCHAR(100) NULL,
+        approved_at   DATETIME NULL,
+        created_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    ) ENGINE=InnoDB`,
+    // Each driver's bonus as frozen when the period was approved; exports and statements read these
+    `CREATE TABLE IF NOT EXISTS bonus_period_lines (
+        period_id         INT NOT NULL,
+        driver_id         INT NOT NULL,
+        driver_code       VARCHAR(50) NOT NULL,
+        first_name        VARCHAR(100) NOT NULL,
+        last_name         VARCHAR(100) NOT NULL,
+        driver_type       VARCHAR(100) NOT NULL,
+        safety_points     INT NOT NULL,
+        scorecard_pct     DECIMAL(5,1) NOT NULL,
+        eligible          BOOLEAN NOT NULL,
+        ineligible_reason VARCHAR(100) NULL,
+        payout            DECIMAL(10,2) NOT NULL,
+        PRIMARY KEY (period_id, driver_id),
+        CONSTRAINT fk_bpl_period
+          FOREIGN KEY (period_id) REFERENCES bonus_periods(period_id) ON DELETE CASCADE
+    ) ENGINE=InnoDB`,
+    // Payroll export batches; a re-issue supersedes the previous batch for the period
+    `CREATE TABLE IF NOT EXISTS payroll_exports (
+        export_id     INT AUTO_INCREMENT PRIMARY KEY,
+        period_id     INT NOT NULL,
+        template      VARCHAR(50) NOT NULL,
+        format        ENUM('csv','fixed','json') NOT NULL,
+        reissue       BOOLEAN NOT NULL DEFAULT FALSE,
+        reason        VARCHAR(500) NULL,
+        exported_by   VARCHAR(100) NOT NULL,
+        line_count    INT NOT NULL,
+        total_payout  DECIMAL(12,2) NOT NULL,
+        checksum      CHAR(64) NOT NULL,
+        exported_at   DATETIME NOT NULL,
+        superseded_by INT NULL,
+        CONSTRAINT fk_pe_period
+          FOREIGN KEY (period_id) REFERENCES bonus_periods(period_id) ON DELETE RESTRICT ON UPDATE CASCADE,
+        CONSTRAINT fk_pe_superseded_by
+          FOREIGN KEY (superseded_by) REFERENCES payroll_exports(export_id) ON DELETE SET NULL,
+        INDEX idx_pe_period (period_id, superseded_by)
+    ) ENGINE=InnoDB`,
+    // Scheduled jobs: one row per run; scheduled runs are unique per slot so replicas don't double-run
+    `CREATE TABLE IF NOT EXISTS job_runs (
+        run_id        BIGINT AUTO_INCREMENT PRIMARY KEY,
+        job_name      VARCHAR(64) NOT NULL,
+        trigger_type  ENUM('schedule','manual') NOT NULL,
+        scheduled_for DATETIME NULL,
+        started_at    DATETIME NOT NULL,
+        finished_at   DATETIME NULL,
+        status        ENUM('running','succeeded','failed') NOT NULL DEFAULT 'running',
+        message       TEXT,
+        runner        VARCHAR(128) NOT NULL,
+        UNIQUE KEY uq_job_slot (job_name, scheduled_for),
+        INDEX idx_job_started (job_name, started_at)
+    ) ENGINE=InnoDB`,
+    // Job leases: the replica holding an unexpired lease is the only one running that job
+    `CREATE TABLE IF NOT EXISTS job_leases (
+        job_name   VARCHAR(64) PRIMARY KEY,
+        holder     VARCHAR(128) NOT NULL,
+        expires_at DATETIME NOT NULL
+    ) ENGINE=InnoDB`,
+    // Monthly scorecard summaries, generated by the scorecard-summaries job
+    `CREATE TABLE IF NOT EXISTS scorecard_summaries (
+        driver_id     INT NOT NULL,
+        month         CHAR(7) NOT NULL, -- YYYY-MM
+        sc_category   ENUM('SAFETY','MAINTENANCE','DISPATCH') NOT NULL,
+        items_scored  INT NOT NULL,
+        stars         INT NOT NULL,
+        possible      INT NOT NULL,
+        generated_at  DATETIME NOT NULL,
+        PRIMARY KEY (driver_id, month, sc_category),
+        CONSTRAINT fk_ss_driver
+          FOREIGN KEY (driver_id) REFERENCES drivers(driver_id) ON DELETE CASCADE ON UPDATE CASCADE,
+        INDEX idx_ss_month (month)
+    ) ENGINE=InnoDB`,
+    // Notification recipients and their per-event preferences (no row = role default)
+    `CREATE TABLE IF NOT EXISTS notification_users (
+        user_id    INT AUTO_INCREMENT PRIMARY KEY,
+        email      VARCHAR(255) NOT NULL UNIQUE,
+        name       VARCHAR(200) NOT NULL,
+        role       ENUM('manager','supervisor','payroll','driver') NOT NULL,
+        driver_id  INT NULL,
+        active     BOOLEAN NOT NULL DEFAULT TRUE,
+        CONSTRAINT fk_nu_driver
+          FOREIGN KEY (driver_id) REFERENCES drivers(driver_id) ON DELETE CASCADE ON UPDATE CASCADE
+    ) ENGINE=InnoDB`,
+    `CREATE TABLE IF NOT EXISTS notification_preferences (
+        user_id    INT NOT NULL,
+        event_type VARCHAR(64) NOT NULL,
+        enabled    BOOLEAN NOT NULL,
+        PRIMARY KEY (user_id, event_type),
+        CONSTRAINT fk_np_user
+          FOREIGN KEY (user_id) REFERENCES notification_users(user_id) ON DELETE CASCADE
+    ) ENGINE=InnoDB`,
+    // Email outbox: rendered messages waiting for (or done with) delivery
+    `CREATE TABLE IF NOT EXISTS notification_outbox (
+        outbox_id       BIGINT AUTO_INCREMENT PRIMARY KEY,
+        user_id         INT NULL,
+        recipient       VARCHAR(255) NOT NULL,
+        event_type      VARCHAR(64) NOT NULL,
+        subject         VARCHAR(255) NOT NULL,
+        body            TEXT NOT NULL,
+        status          ENUM('pending','sending','sent','failed') NOT NULL DEFAULT 'pending',
+        attempts        INT NOT NULL DEFAULT 0,
+        next_attempt_at DATETIME NOT NULL,
+        locked_by       VARCHAR(128) NULL,
+        locked_until    DATETIME NULL,
+        last_error      TEXT,
+        created_at      DATETIME NOT NULL,
+        sent_at         DATETIME NULL,
+        CONSTRAINT fk_no_user
+          FOREIGN KEY (user_id) REFERENCES notification_users(user_id) ON DELETE SET NULL,
+        INDEX idx_no_due (status, next_attempt_at)
+    ) ENGINE=InnoDB`,
+    // Outbound webhooks: subscriptions, the delivery queue and a log of every attempt
+    `CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+        subscription_id INT AUTO_INCREMENT PRIMARY KEY,
+        url             VARCHAR(2048) NOT NULL,
+        secret          VARCHAR(128) NOT NULL,
+        event_types     TEXT NOT NULL,               -- comma separated, '*' for all
+        description     VARCHAR(255) NOT NULL DEFAULT '',
+        active          BOOLEAN NOT NULL DEFAULT TRUE,
+        created_at      DATETIME NOT NULL
+    ) ENGINE=InnoDB`,
+    `CREATE TABLE IF NOT EXISTS webhook_deliveries (
+        delivery_id      BIGINT AUTO_INCREMENT PRIMARY KEY,
+        subscription_id  INT NOT NULL,
+        event_id         VARCHAR(40) NOT NULL,
+        event_type       VARCHAR(64) NOT NULL,
+        payload          MEDIUMTEXT NOT NULL,
+        status           ENUM('pending','sending','delivered','failed') NOT NULL DEFAULT 'pending',
+        attempts         INT NOT NULL DEFAULT 0,
+        next_attempt_at  DATETIME NOT NULL,
+        locked_by        VARCHAR(128) NULL,
+        locked_until     DATETIME NULL,
+        last_status_code INT NULL,
+        last_error       TEXT,
+        replay_of        BIGINT NULL,
+        created_at       DATETIME NOT NULL,
+        delivered_at     DATETIME NULL,
+        CONSTRAINT fk_wd_subscription
+          FOREIGN KEY (subscription_id) REFERENCES webhook_subscriptions(subscription_id) ON DELETE CASCADE,
+        INDEX idx_wd_due (status, next_attempt_at),
+        INDEX idx_wd_sub (subscription_id, created_at)
+    ) ENGINE=InnoDB`,
+    `CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+        attempt_id    BIGINT AUTO_INCREMENT PRIMARY KEY,
+        delivery_id   BIGINT NOT NULL,
+        attempted_at  DATETIME NOT NULL,
+        status_code   INT NULL,
+        duration_ms   INT NOT NULL,
+        error         TEXT,
+        response_body TEXT,
+        CONSTRAINT fk_wda_delivery
+          FOREIGN KEY (delivery_id) REFERENCES webhook_deliveries(delivery_id) ON DELETE CASCADE
+    ) ENGINE=InnoDB`,
+    // Recent entity changes for GET /api/stream (kept 48 hours for Last-Event-ID resume)
+    `CREATE TABLE IF NOT EXISTS change_events (
+        change_id  BIGINT AUTO_INCREMENT PRIMARY KEY,
+        event_type VARCHAR(64) NOT NULL,
+        driver_id  INT NULL,
+        payload    MEDIUMTEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        INDEX idx_ce_created (created_at)
+    ) ENGINE=InnoDB`,
+    `ALTER TABLE driver_credentials ADD COLUMN IF NOT EXISTS expiry_flagged_at DATETIME NULL AFTER blocks_bonus`,
+    `ALTER TABLE driver_credentials ADD COLUMN IF NOT EXISTS file_key VARCHAR(255) NULL AFTER file_content_type`,
+    `ALTER TABLE driver_credentials ADD COLUMN IF NOT EXISTS file_size BIGINT NULL AFTER file_key`,
+    `ALTER TABLE drivers ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1`,
+    `ALTER TABLE trucks ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1`,
+    `ALTER TABLE safety_events ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1`,
+    `ALTER TABLE scorecard_events ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1`,
+}
+
+func upgradeSchema(ctx context.Context) error {
+    for _, stmt := range schemaUpgrades {
+        if _, err := exec(ctx, stmt); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+var (
+    createTableRe = regexp.MustCompile(`(?i)CREATE TABLE IF NOT EXISTS (\w+)`)
+    addColumnRe   = regexp.MustCompile(`(?i)^ALTER TABLE (\w+) ADD COLUMN IF NOT EXISTS (\w+)`)
+)
+
+// schemaObject is a table, or one of its columns when column is set.
+type schemaObject struct{ table, column string }
+
+func (o schemaObject) String() string {
+    if o.column == "" {
+        return o.table
+    }
+    return o.table + "." + o.column
+}
+
+// expectedSchema lists the tables and columns schemaUpgrades creates.
+func expectedSchema() []schemaObject {
+    var out []schemaObject
+    for _, stmt := range schemaUpgrades {
+        if m := createTableRe.FindStringSubmatch(stmt); m != nil {
+            out = append(out, schemaObject{table: m[1]})
+        } else if m := addColumnRe.FindStringSubmatch(stmt); m != nil {
+            out = append(out, schemaObject{table: m[1], column: m[2]})
+        }
+    }
+    return out
+}
+
+// missingSchema reads information_schema for the tables and columns of
+// expectedSchema and returns those the database lacks.
+func missingSchema(ctx context.Context) ([]schemaObject, error) {
+    expected := expectedSchema()
+    var tables []any
+    for _, o := range expected {
+        if !slices.Contains(tables, any(o.table)) {
+            tables = append(tables, o.table)
+        }
+    }
+    rows, err := queryRows(ctx, `
+        SELECT table_name, column_name FROM information_schema.columns
+        WHERE table_schema = DATABASE() AND table_name IN (?`+strings.Repeat(",?", len(tables)-1)+`)`, tables...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    present := map[schemaObject]bool{}
+    for rows.Next() {
+        var table, column string
+        if err := rows.Scan(&table, &column); err != nil {
+            return nil, err
+        }
+        present[schemaObject{table: table}] = true
+        present[schemaObject{table: table, column: column}] = true
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+    var missing []schemaObject
+    for _, o := range expected {
+        if !present[o] {
+            missing = append(missing, o)
+        }
+    }
+    return missing, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+    "os"
+    "regexp"
+    "testing"
+)
+
+var (
+    alterTableRe = regexp.MustCompile(`(?i)^ALTER TABLE (\w+)`)
+    referencesRe = regexp.MustCompile(`(?i)REFERENCES (\w+)\(`)
+)
+
+// init.sql only runs on an empty volume, so an upgrade may only touch the tables
+// init.sql creates or an earlier upgrade created; foreign keys are checked at runtime.
+func TestSchemaUpgradesCreateBeforeUse(t *testing.T) {
+    initSQL, err := os.ReadFile("../db/init.sql")
+    if err != nil {
+        t.Fatal(err)
+    }
+    known := map[string]bool{}
+    for _, m := range createTableRe.FindAllStringSubmatch(string(initSQL), -1) {
+        known[m[1]] = true
+    }
+    for i, stmt := range schemaUpgrades {
+        if m := alterTableRe.FindStringSubmatch(stmt); m != nil && !known[m[1]] {
+            t.Errorf("upgrade %d alters %s before it is created", i, m[1])
+        }
+        var created string
+        if m := createTableRe.FindStringSubmatch(stmt); m != nil {
+            created = m[1]
+            if known[created] {
+                t.Errorf("upgrade %d creates %s, which init.sql or an earlier upgrade already creates", i, created)
+            }
+        }
+        for _, m := range referencesRe.FindAllStringSubmatch(stmt, -1) {
+            if !known[m[1]] && m[1] != created {
+                t.Errorf("upgrade %d references %s before it is created", i, m[1])
+            }
+        }
+        if created != "" {
+            known[created] = true
+        }
+    }
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// loadScorecardChecklist lists, for every active driver employed by the end of the
+// month, which applicable scorecard metrics (global ones plus those for the
+// driver's type) have no event in that month.
+func loadScorecardChecklist(ctx context.Context, month time.Time) ([]ScorecardChecklist, error) {
+    start := formatLocalDate(month)
+    end := formatLocalDate(month.AddDate(0, 1, -1))
+    rows, err := queryRows(ctx, `
+        SELECT d.driver_id, d.driver_code, d.first_name, d.last_name, d.driver_type_id,
+               m.sc_category_id, m.sc_category, m.sc_description,
+               EXISTS (SELECT 1 FROM scorecard_events e
+                       WHERE e.driver_id = d.driver_id AND e.sc_category_id = m.sc_category_id
+                         AND e.event_date BETWEEN ? AND ?)
+        FROM drivers d
+        JOIN scorecard_metrics m ON m.driver_type_id IS NULL OR m.driver_type_id = d.driver_type_id
+        WHERE d.active = TRUE AND (d.start_date IS NULL OR d.start_date <= ?)
+        ORDER BY d.last_name, d.first_name, d.driver_id,
+                 FIELD(m.sc_category, 'SAFETY', 'MAINTENANCE', 'DISPATCH'), m.sc_category_id`, start, end, end)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    out := []ScorecardChecklist{}
+    for rows.Next() {
+        var (
+            d       ScorecardChecklist
+            typeID  sql.NullInt64
+            item    MissingScorecardItem
+            entered bool
+        )
+        if err := rows.Scan(&d.DriverID, &d.DriverCode, &d.FirstName, &d.LastName, &typeID, &item.ScCategoryID, &item.ScCategory, &item.ScDescription, &entered); err != nil {
+            return nil, err
+        }
+        if len(out) == 0 || out[len(out)-1].DriverID != d.DriverID {
+            if typeID.Valid {
+                val := int(typeID.Int64)
+                d.DriverTypeID = &val
+            }
+            d.Missing = []MissingScorecardItem{}
+            out = append(out, d)
+        }
+        cur := &out[len(out)-1]
+        cur.Applicable++
+        if entered {
+            cur.Entered++
+        } else {
+            cur.Missing = append(cur.Missing, item)
+        }
+    }
+    for i := range out {
+        out[i].Complete = len(out[i].Missing) == 0
+    }
+    return out, rows.Err()
+}
+
+// --- Scorecard completion ---
+
+// GET /scorecards/missing?month=YYYY-MM (defaults to the current month)
+func getMissingScorecards(c *gin.Context) {
+    now := time.Now().In(localTZ)
+    month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, localTZ)
+    if v := c.Query("month"); v != "" {
+        t, err := time.ParseInLocation("2006-01", v, localTZ)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, APIError{Message: "month must be YYYY-MM"})
+            return
+        }
+        month = t
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+    defer cancel()
+
+    list, err := loadScorecardChecklist(ctx, month)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, list)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "log/slog"
+    "net"
+    "net/http"
+    "os"
+    "os/signal"
+    "sync"
+    "sync/atomic"
+    "syscall"
+    "time"
+
+    "driver-safety-bonus/config"
+)
+
+// newHTTPServer applies the server timeouts from config (HTTP_*_TIMEOUT); /stream
+// is exempt from the write timeout.
+func newHTTPServer(h http.Handler, cfg config.Server) *http.Server {
+    srv := &http.Server{
+        Handler:           h,
+        ReadHeaderTimeout: cfg.ReadHeaderTimeout.Std(),
+        ReadTimeout:       cfg.ReadTimeout.Std(),
+        WriteTimeout:      cfg.WriteTimeout.Std(),
+        IdleTimeout:       cfg.IdleTimeout.Std(),
+        ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+    }
+    // Open /stream connections would hold up Shutdown forever
+    srv.RegisterOnShutdown(closeStreams)
+    return srv
+}
+
+// shuttingDown turns /readyz to 503 as soon as SIGTERM arrives; serve keeps accepting
+// requests for the drain delay so a load balancer can stop routing here first.
+var shuttingDown atomic.Bool
+
+// background runs the workers stopped at shutdown: scheduler, outbox, webhooks and
+// the change feed.
+type background struct {
+    ctx  context.Context
+    stop context.CancelFunc
+    wg   sync.WaitGroup
+}
+
+func newBackground() *background {
+    b := &background{}
+    b.ctx, b.stop = context.WithCancel(context.Background())
+    return b
+}
+
+func (b *background) run(fn func(context.Context)) {
+    b.wg.Go(func() { fn(b.ctx) })
+}
+
+// serve runs srv on ln until SIGTERM or SIGINT, then shuts down in order: report
+// not-ready for drainDelay (SHUTDOWN_DRAIN_DELAY) while still serving; stop accepting
+// connections and let in-flight requests finish; stop the scheduler and workers and
+// wait for running jobs; deliver mail and webhooks queued meanwhile; close the DB
+// pool. The steps after the delay share the timeout (SHUTDOWN_TIMEOUT); whatever is still queued
+// then stays in the database for the next start.
+func serve(srv *http.Server, ln net.Listener, drainDelay, timeout time.Duration, bg *background) error {
+    signals, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+    defer stopSignals()
+
+    failed := make(chan error, 1)
+    go func() {
+        if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+            failed <- err
+        }
+    }()
+    select {
+    case err := <-failed:
+        return err
+    case <-signals.Done():
+    }
+    stopSignals() // a second signal kills the process as usual
+    shuttingDown.Store(true)
+    slog.Info("shutting down", "drain_delay", drainDelay.String(), "timeout", timeout.String())
+    // Keep serving while load balancers see /readyz fail and route elsewhere
+    time.Sleep(drainDelay)
+
+    ctx, cancel := context.WithTimeout(context.Background(), timeout)
+    defer cancel()
+    start := time.Now()
+    step := func(name string, fn func() error) {
+        if err := fn(); err != nil {
+            slog.Warn("shutdown step incomplete", "step", name, "err", err)
+            return
+        }
+        slog.Info("shutdown step done", "step", name, "elapsed_ms", millis(time.Since(start)))
+    }
+
+    step("drain requests", func() error { return srv.Shutdown(ctx) })
+    step("stop workers", func() error {
+        bg.stop()
+        return waitGroup(ctx, &bg.wg)
+    })
+    step("finish jobs", func() error { return waitGroup(ctx, &jobsRunning) })
+    step("flush outbox", func() error { return flushOutbound(ctx) })
+    step("close database", db.Close)
+    return nil
+}
+
+// waitGroup waits for wg or gives up at ctx's deadline.
+func waitGroup(ctx context.Context, wg *sync.WaitGroup) error {
+    done := make(chan struct{})
+    go func() {
+        wg.Wait()
+        close(done)
+    }()
+    select {
+    case <-done:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// flushOutbound delivers the mail and webhooks that are due, including those queued
+// by the last requests, once the workers have stopped.
+func flushOutbound(ctx context.Context) error {
+    for deliverOutboxBatch(ctx) == outboxBatchSize && ctx.Err() == nil {
+    }
+    for deliverWebhookBatch(ctx) == webhookBatchSize && ctx.Err() == nil {
+    }
+    return ctx.Err()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+    "context"
+    "io"
+    "net"
+    "net/http"
+    "os"
+    "syscall"
+    "testing"
+    "time"
+
+    "driver-safety-bonus/config"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/gin-gonic/gin"
+)
+
+// SIGTERM keeps serving through the drain delay, lets the request under way finish,
+// stops the workers, flushes the outbound queues and closes the database.
+func TestGracefulShutdown(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+    defer shuttingDown.Store(false)
+    mock.ExpectExec(`UPDATE notification_outbox SET status='sending'`).WillReturnResult(sqlmock.NewResult(0, 0))
+    mock.ExpectQuery(`FROM notification_outbox`).WillReturnRows(sqlmock.NewRows([]string{"outbox_id", "recipient", "subject", "body", "attempts"}))
+    mock.ExpectExec(`UPDATE webhook_deliveries SET status='sending'`).WillReturnResult(sqlmock.NewResult(0, 0))
+    mock.ExpectQuery(`FROM webhook_deliveries`).WillReturnRows(sqlmock.NewRows([]string{"delivery_id", "event_type", "payload", "attempts", "url", "secret"}))
+    mock.ExpectClose()
+
+    started := make(chan struct{})
+    slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/late" {
+            io.WriteString(w, "still serving")
+            return
+        }
+        close(started)
+        time.Sleep(200 * time.Millisecond)
+        io.WriteString(w, "saved")
+    })
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    bg := newBackground()
+    workerStopped := make(chan struct{})
+    bg.run(func(ctx context.Context) {
+        <-ctx.Done()
+        close(workerStopped)
+    })
+    cfg := config.Default().Server
+    cfg.WriteTimeout = config.Duration(time.Second)
+    served := make(chan error, 1)
+    go func() { served <- serve(newHTTPServer(slow, cfg), ln, 500*time.Millisecond, 5*time.Second, bg) }()
+
+    body := make(chan string, 1)
+    go func() {
+        resp, err := http.Get("http://" + ln.Addr().String() + "/")
+        if err != nil {
+            body <- err.Error()
+            return
+        }
+        b, _ := io.ReadAll(resp.Body)
+        resp.Body.Close()
+        body <- string(b)
+    }()
+    <-started
+    self, _ := os.FindProcess(os.Getpid())
+    if err := self.Signal(syscall.SIGTERM); err != nil {
+        t.Fatal(err)
+    }
+
+    if got := <-body; got != "saved" {
+        t.Errorf("in-flight request got %q", got)
+    }
+    // Not ready, but new requests are still answered during the drain delay
+    for !shuttingDown.Load() {
+        time.Sleep(10 * time.Millisecond)
+    }
+    resp, err := http.Get("http://" + ln.Addr().String() + "/late")
+    if err != nil {
+        t.Fatalf("request during drain delay: %v", err)
+    }
+    resp.Body.Close()
+    select {
+    case err := <-served:
+        if err != nil {
+            t.Fatal(err)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatal("serve did not return after SIGTERM")
+    }
+    select {
+    case <-workerStopped:
+    default:
+        t.Error("worker context not cancelled")
+    }
+}
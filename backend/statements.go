@@ -0,0 +1,467 @@
+package main
+
+import (
+    "archive/zip"
+    "bytes"
+    "context"
+    "database/sql"
+    "fmt"
+    "io"
+    "log/slog"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/jung-kurt/gofpdf"
+)
+
+// driverStatement is everything printed on one driver's monthly/quarterly statement.
+type driverStatement struct {
+    Driver       Driver
+    DriverType   string
+    TruckUnit    string
+    Photo        []byte
+    PhotoType    string
+    Period       BonusPeriod
+    PeriodSetUp  bool // false when no bonus_periods row exists yet; payout is then not shown
+    Months       []time.Time
+    SafetyEvents []statementSafetyEvent
+    Scorecard    []statementMetric
+    Bonus        BonusLine
+}
+
+type statementSafetyEvent struct {
+    EventDate     string
+    Code          string
+    Description   string
+    Points        int
+    BonusPeriod   bool
+    DisputeStatus string
+}
+
+// statementMetric is one scorecard_metrics item with the stars given in each month (-1 = not scored).
+type statementMetric struct {
+    Category    string
+    Description string
+    Stars       []int
+}
+
+// statementPeriod resolves ?period= to the stored bonus period, or to bare bounds
+// if the period has not been opened yet. Defaults to the current month.
+func statementPeriod(ctx context.Context, key string) (BonusPeriod, bool, error) {
+    key = strings.ToUpper(strings.TrimSpace(key))
+    if key == "" {
+        key = time.Now().In(localTZ).Format("2006-01")
+    }
+    start, end, err := periodBounds(key)
+    if err != nil {
+        return BonusPeriod{}, false, err
+    }
+    var p BonusPeriod
+    err = scanBonusPeriod(queryRow(ctx, `SELECT `+bonusPeriodColumns+` FROM bonus_periods WHERE period_key=?`, key), &p)
+    if err == sql.ErrNoRows {
+        return BonusPeriod{Period: key, StartsOn: formatLocalDate(start), EndsOn: formatLocalDate(end), Status: "open"}, false, nil
+    }
+    return p, err == nil, err
+}
+
+func loadStatement(ctx context.Context, driverID int, p BonusPeriod, setUp bool) (*driverStatement, error) {
+    st := &driverStatement{Period: p, PeriodSetUp: setUp}
+
+    var photoKey, photoType sql.NullString
+    err := scanDriver(queryRow(ctx, `SELECT `+driverColumns+` FROM drivers WHERE driver_id=?`, driverID), &st.Driver, "")
+    if err != nil {
+        return nil, err
+    }
+    _ = queryRow(ctx, `
+        SELECT COALESCE(dt.driver_type, ''), COALESCE(t.unit_number, ''), d.photo_thumb_key, d.photo_thumb_content_type
+        FROM drivers d
+        LEFT JOIN driver_type dt ON dt.driver_type_id = d.driver_type_id
+        LEFT JOIN trucks t ON t.truck_id = d.truck_id
+        WHERE d.driver_id=?`, driverID).Scan(&st.DriverType, &st.TruckUnit, &photoKey, &photoType)
+    if photoKey.Valid {
+        if r, _, err := files.Get(ctx, photoKey.String); err == nil {
+            st.Photo, _ = io.ReadAll(r)
+            st.PhotoType = photoType.String
+            r.Close()
+        }
+    }
+
+    // Safety events in the period, including overturned ones (shown struck from the total)
+    rows, err := queryRows(ctx, `
+        SELECT se.event_date, sc.code, sc.description, se.bonus_score, se.bonus_period, COALESCE(se.dispute_status, '')
+        FROM safety_events se
+        JOIN safety_categories sc ON sc.category_id = se.category_id
+        WHERE se.driver_id=? AND se.event_date BETWEEN ? AND ?
+        ORDER BY se.event_date, se.safety_event_id`, driverID, p.StartsOn, p.EndsOn)
+    if err != nil {
+        return nil, err
+    }
+    for rows.Next() {
+        var (
+            e         statementSafetyEvent
+            eventDate time.Time
+        )
+        if err := rows.Scan(&eventDate, &e.Code, &e.Description, &e.Points, &e.BonusPeriod, &e.DisputeStatus); err != nil {
+            continue
+        }
+        e.EventDate = formatLocalDate(eventDate)
+        st.SafetyEvents = append(st.SafetyEvents, e)
+    }
+    rows.Close()
+
+    // Scorecard grid: every metric that applies to the driver's type, one column per month
+    start, _ := parseLocalDate(p.StartsOn)
+    end, _ := parseLocalDate(p.EndsOn)
+    for m := start; !m.After(end); m = m.AddDate(0, 1, 0) {
+        st.Months = append(st.Months, m)
+    }
+    rows, err = queryRows(ctx, `
+        SELECT sm.sc_category_id, sm.sc_category, sm.sc_description
+        FROM scorecard_metrics sm
+        WHERE sm.driver_type_id IS NULL OR sm.driver_type_id = ?
+        ORDER BY FIELD(sm.sc_category, 'SAFETY', 'MAINTENANCE', 'DISPATCH'), sm.sc_category_id`, st.Driver.DriverTypeID)
+    if err != nil {
+        return nil, err
+    }
+    index := map[int]int{}
+    for rows.Next() {
+        var (
+            id int
+            m  statementMetric
+        )
+        if err := rows.Scan(&id, &m.Category, &m.Description); err != nil {
+            continue
+        }
+        m.Stars = make([]int, len(st.Months))
+        for i := range m.Stars {
+            m.Stars[i] = -1
+        }
+        index[id] = len(st.Scorecard)
+        st.Scorecard = append(st.Scorecard, m)
+    }
+    rows.Close()
+
+    rows, err = queryRows(ctx, `
+        SELECT sc_category_id, YEAR(event_date), MONTH(event_date), ROUND(AVG(sc_score))
+        FROM scorecard_events
+        WHERE driver_id=? AND event_date BETWEEN ? AND ?
+        GROUP BY sc_category_id, YEAR(event_date), MONTH(event_date)`, driverID, p.StartsOn, p.EndsOn)
+    if err != nil {
+        return nil, err
+    }
+    for rows.Next() {
+        var metricID, year, month, stars int
+        if err := rows.Scan(&metricID, &year, &month, &stars); err != nil {
+            continue
+        }
+        i, ok := index[metricID]
+        if !ok {
+            continue
+        }
+        for col, m := range st.Months {
+            if m.Year() == year && int(m.Month()) == month {
+                st.Scorecard[i].Stars[col] = stars
+            }
+        }
+    }
+    rows.Close()
+
+    lines, err := periodLines(ctx, p, driverID)
+    if err != nil {
+        return nil, err
+    }
+    if len(lines) > 0 {
+        st.Bonus = lines[0]
+    }
+    return st, nil
+}
+
+// renderStatement lays the statement out on Letter paper.
+func renderStatement(st *driverStatement, w io.Writer) error {
+    pdf := gofpdf.New("P", "mm", "Letter", "")
+    tr := pdf.UnicodeTranslatorFromDescriptor("") // cp1252, covers accented names
+    pdf.SetMargins(15, 15, 15)
+    pdf.SetAutoPageBreak(true, 15)
+    pdf.SetFooterFunc(func() {
+        pdf.SetY(-12)
+        pdf.SetFont("Helvetica", "I", 8)
+        pdf.SetTextColor(120, 120, 120)
+        pdf.CellFormat(0, 5, fmt.Sprintf("Generated %s  -  page %d", time.Now().In(localTZ).Format("2006-01-02 15:04"), pdf.PageNo()), "", 0, "C", false, 0, "")
+        pdf.SetTextColor(0, 0, 0)
+    })
+    pdf.AddPage()
+
+    // Header & profile
+    pdf.SetFont("Helvetica", "B", 16)
+    pdf.CellFormat(0, 8, "Driver Safety & Bonus Statement", "", 1, "L", false, 0, "")
+    pdf.SetFont("Helvetica", "", 11)
+    pdf.CellFormat(0, 6, fmt.Sprintf("Period %s  (%s to %s)", st.Period.Period, st.Period.StartsOn, st.Period.EndsOn), "", 1, "L", false, 0, "")
+    pdf.Ln(3)
+
+    top := pdf.GetY()
+    if len(st.Photo) > 0 {
+        imgType := map[string]string{"image/jpeg": "JPG", "image/png": "PNG"}[st.PhotoType]
+        if imgType != "" {
+            pdf.RegisterImageOptionsReader("photo", gofpdf.ImageOptions{ImageType: imgType}, bytes.NewReader(st.Photo))
+            if pdf.Ok() {
+                pdf.ImageOptions("photo", 170, top, 30, 0, false, gofpdf.ImageOptions{ImageType: imgType}, 0, "")
+            } else {
+                pdf.ClearError()
+            }
+        }
+    }
+    d := st.Driver
+    profile := [][2]string{
+        {"Driver", d.LastName + ", " + d.FirstName},
+        {"Driver code", d.DriverCode},
+        {"Driver type", orDash(st.DriverType)},
+        {"Start date", orDash(d.StartDate)},
+        {"Truck unit", orDash(st.TruckUnit)},
+    }
+    for _, kv := range profile {
+        pdf.SetFont("Helvetica", "B", 10)
+        pdf.CellFormat(30, 6, kv[0], "", 0, "L", false, 0, "")
+        pdf.SetFont("Helvetica", "", 10)
+        pdf.CellFormat(0, 6, tr(kv[1]), "", 1, "L", false, 0, "")
+    }
+    if pdf.GetY() < top+38 && len(st.Photo) > 0 {
+        pdf.SetY(top + 38)
+    }
+    pdf.Ln(4)
+
+    // Safety events
+    pdfSection(pdf, "Safety Events")
+    cols := []float64{22, 20, 103, 16, 24}
+    pdfTableHeader(pdf, cols, []string{"Date", "Code", "Description", "Points", "Dispute"})
+    pdf.SetFont("Helvetica", "", 9)
+    points := 0
+    for _, e := range st.SafetyEvents {
+        counted := e.BonusPeriod && e.DisputeStatus != "overturned"
+        if counted {
+            points += e.Points
+        }
+        pts := fmt.Sprintf("%d", e.Points)
+        if !counted {
+            pts = "(" + pts + ")"
+        }
+        pdf.CellFormat(cols[0], 6, e.EventDate, "1", 0, "L", false, 0, "")
+        pdf.CellFormat(cols[1], 6, e.Code, "1", 0, "L", false, 0, "")
+        pdf.CellFormat(cols[2], 6, pdfTruncate(pdf, tr(e.Description), cols[2]), "1", 0, "L", false, 0, "")
+        pdf.CellFormat(cols[3], 6, pts, "1", 0, "R", false, 0, "")
+        pdf.CellFormat(cols[4], 6, strings.ReplaceAll(e.DisputeStatus, "_", " "), "1", 1, "L", false, 0, "")
+    }
+    if len(st.SafetyEvents) == 0 {
+        pdf.CellFormat(185, 6, "No safety events in this period.", "1", 1, "C", false, 0, "")
+    }
+    pdf.SetFont("Helvetica", "B", 9)
+    pdf.CellFormat(cols[0]+cols[1]+cols[2], 6, "Total bonus points", "1", 0, "R", false, 0, "")
+    pdf.CellFormat(cols[3], 6, fmt.Sprintf("%d", points), "1", 0, "R", false, 0, "")
+    pdf.CellFormat(cols[4], 6, "", "1", 1, "L", false, 0, "")
+    pdf.SetFont("Helvetica", "I", 8)
+    pdf.CellFormat(0, 5, "Points in parentheses are outside the bonus period or overturned on dispute and are not counted.", "", 1, "L", false, 0, "")
+    pdf.Ln(4)
+
+    // Scorecard grid
+    pdfSection(pdf, "Scorecard")
+    monthW := 18.0
+    descW := 185 - monthW*float64(len(st.Months))
+    header := []string{"Item"}
+    widths := []float64{descW}
+    for _, m := range st.Months {
+        header = append(header, m.Format("Jan 2006"))
+        widths = append(widths, monthW)
+    }
+    earned, possible := 0, 0
+    category := ""
+    for _, m := range st.Scorecard {
+        if m.Category != category {
+            category = m.Category
+            pdf.SetFont("Helvetica", "B", 9)
+            pdf.CellFormat(0, 6, category, "", 1, "L", false, 0, "")
+            pdfTableHeader(pdf, widths, header)
+        }
+        pdf.SetFont("Helvetica", "", 9)
+        pdf.CellFormat(descW, 6, pdfTruncate(pdf, tr(m.Description), descW), "1", 0, "L", false, 0, "")
+        for i, stars := range m.Stars {
+            txt := "-"
+            if stars >= 0 {
+                txt = fmt.Sprintf("%d / %d", stars, scorecardMaxStars)
+                earned += stars
+                possible += scorecardMaxStars
+            }
+            ln := 0
+            if i == len(m.Stars)-1 {
+                ln = 1
+            }
+            pdf.CellFormat(monthW, 6, txt, "1", ln, "C", false, 0, "")
+        }
+    }
+    pdf.SetFont("Helvetica", "B", 9)
+    pdf.CellFormat(descW, 6, "Stars earned", "1", 0, "R", false, 0, "")
+    pdf.CellFormat(monthW*float64(len(st.Months)), 6, fmt.Sprintf("%d / %d  (%.1f%%)", earned, possible, st.Bonus.ScorecardPct), "1", 1, "C", false, 0, "")
+    pdf.Ln(4)
+
+    // Bonus outcome
+    pdfSection(pdf, "Bonus Outcome")
+    pdf.SetFont("Helvetica", "", 10)
+    outcome := "Eligible"
+    if !st.Bonus.Eligible {
+        outcome = "Not eligible - " + st.Bonus.IneligibleReason
+    }
+    rows := [][2]string{
+        {"Safety points", fmt.Sprintf("%d (limit %d)", st.Bonus.SafetyPoints, conf.Thresholds.BonusWarningPoints)},
+        {"Scorecard", fmt.Sprintf("%.1f%%", st.Bonus.ScorecardPct)},
+        {"Outcome", outcome},
+    }
+    if st.PeriodSetUp {
+        rows = append(rows,
+            [2]string{"Maximum payout", fmt.Sprintf("$%.2f", st.Period.MaxPayout)},
+            [2]string{"Bonus payout", fmt.Sprintf("$%.2f", st.Bonus.Payout)},
+            [2]string{"Period status", st.Period.Status})
+    } else {
+        rows = append(rows, [2]string{"Bonus payout", "Not yet calculated - the bonus period has not been opened"})
+    }
+    for _, kv := range rows {
+        pdf.SetFont("Helvetica", "B", 10)
+        pdf.CellFormat(40, 6, kv[0], "", 0, "L", false, 0, "")
+        pdf.SetFont("Helvetica", "", 10)
+        pdf.CellFormat(0, 6, kv[1], "", 1, "L", false, 0, "")
+    }
+
+    return pdf.Output(w)
+}
+
+func pdfSection(pdf *gofpdf.Fpdf, title string) {
+    pdf.SetFont("Helvetica", "B", 12)
+    pdf.SetFillColor(230, 236, 245)
+    pdf.CellFormat(0, 7, title, "", 1, "L", true, 0, "")
+    pdf.Ln(1)
+}
+
+func pdfTableHeader(pdf *gofpdf.Fpdf, widths []float64, titles []string) {
+    pdf.SetFont("Helvetica", "B", 9)
+    pdf.SetFillColor(245, 245, 245)
+    for i, t := range titles {
+        ln := 0
+        if i == len(titles)-1 {
+            ln = 1
+        }
+        pdf.CellFormat(widths[i], 6, t, "1", ln, "C", true, 0, "")
+    }
+}
+
+// pdfTruncate shortens s with an ellipsis so it fits in a cell of width w.
+func pdfTruncate(pdf *gofpdf.Fpdf, s string, w float64) string {
+    if pdf.GetStringWidth(s) <= w-2 {
+        return s
+    }
+    r := []rune(s)
+    for len(r) > 0 && pdf.GetStringWidth(string(r)+"...") > w-2 {
+        r = r[:len(r)-1]
+    }
+    return string(r) + "..."
+}
+
+func orDash(s string) string {
+    if strings.TrimSpace(s) == "" {
+        return "-"
+    }
+    return s
+}
+
+// --- Statements ---
+
+// GET /drivers/:id/statement.pdf?period=YYYY-MM|YYYY-Qn
+func getDriverStatement(c *gin.Context) {
+    driverID := atoi(c.Param("id"))
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+    defer cancel()
+
+    p, setUp, err := statementPeriod(ctx, c.Query("period"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    st, err := loadStatement(ctx, driverID, p, setUp)
+    if err == sql.ErrNoRows {
+        c.JSON(http.StatusNotFound, APIError{Message: "driver not found"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    var buf bytes.Buffer
+    if err := renderStatement(st, &buf); err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, statementFileName(st)))
+    c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
+
+// statementsZipTimeout bounds a statements.zip download; it replaces
+// HTTP_WRITE_TIMEOUT, which a large fleet's zip can outlast.
+const statementsZipTimeout = 10 * time.Minute
+
+// GET /statements.zip?period= streams one PDF per active driver.
+func getStatementsZip(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), statementsZipTimeout)
+    defer cancel()
+    _ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(statementsZipTimeout))
+
+    p, setUp, err := statementPeriod(ctx, c.Query("period"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    rows, err := queryRows(ctx, `SELECT driver_id FROM drivers WHERE active = TRUE ORDER BY last_name, first_name, driver_code`)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    var ids []int
+    for rows.Next() {
+        var id int
+        if err := rows.Scan(&id); err == nil {
+            ids = append(ids, id)
+        }
+    }
+    rows.Close()
+
+    // Headers go out before the first PDF, so later failures can only be logged
+    c.Header("Content-Type", "application/zip")
+    c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="statements-%s.zip"`, p.Period))
+    c.Status(http.StatusOK)
+    zw := zip.NewWriter(c.Writer)
+    for _, id := range ids {
+        st, err := loadStatement(ctx, id, p, setUp)
+        if err != nil {
+            slog.WarnContext(ctx, "statement skipped", "driver_id", id, "err", err)
+            continue
+        }
+        f, err := zw.Create(statementFileName(st))
+        if err != nil {
+            slog.WarnContext(ctx, "statements zip aborted", "err", err)
+            return
+        }
+        if err := renderStatement(st, f); err != nil {
+            slog.WarnContext(ctx, "statement failed", "driver_id", id, "err", err)
+        }
+    }
+    if err := zw.Close(); err != nil {
+        slog.WarnContext(ctx, "statements zip close failed", "err", err)
+    }
+}
+
+func statementFileName(st *driverStatement) string {
+    code := strings.Map(func(r rune) rune {
+        if r == '/' || r == '\\' || r == '"' {
+            return '_'
+        }
+        return r
+    }, st.Driver.DriverCode)
+    return fmt.Sprintf("statement-%s-%s.pdf", code, st.Period.Period)
+}
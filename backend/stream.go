@@ -0,0 +1,393 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "log/slog"
+    "math"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+const (
+    // How often the feed looks for changes written by other replicas
+    changeFeedPollEvery = time.Second
+    // Changes kept for Last-Event-ID resume; older clients are told to reload
+    changeRetention  = 48 * time.Hour
+    streamKeepalive  = 25 * time.Second
+    streamClientBuf  = 256
+    streamCatchUpMax = 5000
+)
+
+// Event type prefixes (the entity before the dot) sent on /stream.
+var streamEntities = map[string]bool{"driver": true, "truck": true, "safety_event": true, "scorecard_event": true}
+
+type changeEvent struct {
+    id        int64
+    eventType string
+    driverID  sql.NullInt64
+    payload   []byte
+}
+
+// streamClient is one open /stream connection. The feed drops a client whose
+// buffer fills up; its browser reconnects and catches up from the database.
+type streamClient struct {
+    events  chan changeEvent
+    dropped chan struct{}
+}
+
+func (cl *streamClient) offer(changes []changeEvent) bool {
+    for _, e := range changes {
+        select {
+        case cl.events <- e:
+        default:
+            return false
+        }
+    }
+    return true
+}
+
+// changeFeed fans changes out to the open streams on this replica. Every change is
+// stored in change_events first, so streams see writes made on any replica. mark is
+// the change_id up to which every change has been handed out, in order.
+var changeFeed = struct {
+    sync.Mutex
+    clients map[*streamClient]struct{}
+    wake    chan struct{}
+    mark    int64
+    started bool
+}{clients: map[*streamClient]struct{}{}, wake: make(chan struct{}, 1)}
+
+// eventDriverID is the driver a change is about, used for per-driver stream filters.
+func eventDriverID(data any) *int {
+    switch v := data.(type) {
+    case Driver:
+        return &v.DriverID
+    case SafetyEvent:
+        return &v.DriverID
+    case ScoreCardEvent:
+        return &v.DriverID
+    case gin.H:
+        if id, ok := v["driver_id"].(int); ok {
+            return &id
+        }
+    }
+    return nil
+}
+
+// recordChange stores a change for /stream. Only entity changes are kept.
+func recordChange(ctx context.Context, env webhookEnvelope) error {
+    entity, _, _ := strings.Cut(env.Type, ".")
+    if !streamEntities[entity] {
+        return nil
+    }
+    payload, err := json.Marshal(env)
+    if err != nil {
+        return err
+    }
+    if _, err := exec(ctx, `INSERT INTO change_events (event_type, driver_id, payload, created_at) VALUES (?, ?, ?, ?)`,
+        env.Type, eventDriverID(env.Data), payload, time.Now().In(localTZ)); err != nil {
+        return err
+    }
+    afterCommit(ctx, func() {
+        select {
+        case changeFeed.wake <- struct{}{}:
+        default:
+        }
+    })
+    return nil
+}
+
+func loadChanges(ctx context.Context, after int64, limit int) ([]changeEvent, error) {
+    return loadChangesUpTo(ctx, after, math.MaxInt64, limit)
+}
+
+func loadChangesUpTo(ctx context.Context, after, upTo int64, limit int) ([]changeEvent, error) {
+    rows, err := queryRows(ctx, `SELECT change_id, event_type, driver_id, payload FROM change_events WHERE change_id > ? AND change_id <= ? ORDER BY change_id LIMIT ?`, after, upTo, limit)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    var out []changeEvent
+    for rows.Next() {
+        var e changeEvent
+        if err := rows.Scan(&e.id, &e.eventType, &e.driverID, &e.payload); err == nil {
+            out = append(out, e)
+        }
+    }
+    return out, rows.Err()
+}
+
+// runChangeFeed reads new changes once per replica and hands them to every open stream.
+//
+// change_id is assigned when a change is inserted, but transactions commit in any
+// order, so a lower id can become visible after a higher one. Changes after a
+// missing id are held back until it commits, but only for one poll cycle: an id
+// whose transaction rolled back never shows up, and waiting longer would freeze
+// every stream. A change that commits later than that is skipped by live streams;
+// it is still in change_events for clients that resume from before it.
+func runChangeFeed(ctx context.Context) {
+    var last int64
+    for {
+        q, cancel := context.WithTimeout(ctx, 5*time.Second)
+        err := queryRow(q, `SELECT COALESCE(MAX(change_id), 0) FROM change_events`).Scan(&last)
+        cancel()
+        if err == nil {
+            break
+        }
+        slog.WarnContext(ctx, "change feed start failed", "err", err)
+        select {
+        case <-ctx.Done():
+            return
+        case <-time.After(5 * time.Second):
+        }
+    }
+    changeFeed.Lock()
+    changeFeed.mark, changeFeed.started = last, true
+    changeFeed.Unlock()
+
+    cur := feedCursor{last: last}
+    ticker := time.NewTicker(changeFeedPollEvery)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        case <-changeFeed.wake:
+        }
+        q, cancel := context.WithTimeout(ctx, 5*time.Second)
+        changes, err := loadChanges(q, cur.last, 1000)
+        cancel()
+        if err != nil {
+            slog.WarnContext(ctx, "change feed read failed", "err", err)
+            continue
+        }
+        if ready := cur.advance(ctx, changes, time.Now()); len(ready) > 0 {
+            publishChanges(ready, cur.last)
+        }
+    }
+}
+
+// feedCursor is how far the feed has read: every change_id up to last.
+type feedCursor struct {
+    last     int64
+    gapSince time.Time // when the feed first found last+1 missing
+}
+
+// advance takes the changes after c.last, in change_id order, and returns those that
+// can go out now: the run without a missing id before it.
+func (c *feedCursor) advance(ctx context.Context, changes []changeEvent, now time.Time) []changeEvent {
+    var out []changeEvent
+    for {
+        ready := 0
+        for ready < len(changes) && changes[ready].id == c.last+1+int64(ready) {
+            ready++
+        }
+        if ready > 0 {
+            c.last, c.gapSince = changes[ready-1].id, time.Time{}
+            out = append(out, changes[:ready]...)
+            changes = changes[ready:]
+        }
+        if len(changes) == 0 {
+            return out
+        }
+        if c.gapSince.IsZero() {
+            c.gapSince = now
+        }
+        if now.Sub(c.gapSince) <= changeFeedPollEvery {
+            return out
+        }
+        slog.WarnContext(ctx, "change feed skipped change ids that never committed", "from", c.last+1, "to", changes[0].id-1)
+        c.last, c.gapSince = changes[0].id-1, time.Time{}
+    }
+}
+
+// publishChanges hands changes to every open stream and moves the mark to last.
+func publishChanges(changes []changeEvent, last int64) {
+    changeFeed.Lock()
+    defer changeFeed.Unlock()
+    changeFeed.mark = last
+    for cl := range changeFeed.clients {
+        if !cl.offer(changes) {
+            close(cl.dropped)
+            delete(changeFeed.clients, cl)
+        }
+    }
+}
+
+func pruneChangeEvents(ctx context.Context, at time.Time) (string, error) {
+    res, err := exec(ctx, `DELETE FROM change_events WHERE created_at < ?`, at.Add(-changeRetention))
+    if err != nil {
+        return "", err
+    }
+    n, _ := res.RowsAffected()
+    return fmt.Sprintf("removed %d changes", n), nil
+}
+
+// streamFilter narrows a stream to some entities and/or one driver's records. The
+// filter is chosen by the caller; limiting a stream to what its user may see waits
+// on authentication, as the API has no user identity to scope by yet.
+type streamFilter struct {
+    entities map[string]bool // nil = all
+    driverID int             // 0 = all drivers
+}
+
+func (f streamFilter) match(e changeEvent) bool {
+    entity, _, _ := strings.Cut(e.eventType, ".")
+    if f.entities != nil && !f.entities[entity] {
+        return false
+    }
+    if f.driverID != 0 {
+        // trucks have no driver of their own; assignments do
+        return e.driverID.Valid && int(e.driverID.Int64) == f.driverID
+    }
+    return true
+}
+
+// streamsClosing ends every stream at shutdown; EventSource clients reconnect (to
+// another replica, or this one once restarted) with Last-Event-ID.
+var (
+    streamsClosing   = make(chan struct{})
+    closeStreamsOnce sync.Once
+)
+
+func closeStreams() {
+    closeStreamsOnce.Do(func() { close(streamsClosing) })
+}
+
+// GET /stream?types=safety_event,scorecard_event&driverId=12
+//
+// Server-Sent Events: one "event: <type>" per change with the webhook envelope as
+// data and the change number as id. Reconnecting with Last-Event-ID (or ?lastEventId=)
+// replays what was missed; if that is older than the retained history a "reset" event
+// tells the client to reload everything.
+func streamChanges(c *gin.Context) {
+    var filter streamFilter
+    if types := c.Query("types"); types != "" {
+        filter.entities = map[string]bool{}
+        for _, t := range strings.Split(types, ",") {
+            t = strings.TrimSuffix(strings.TrimSpace(t), "s")
+            if !streamEntities[t] {
+                c.JSON(http.StatusBadRequest, APIError{Message: fmt.Sprintf("unknown type %q (driver, truck, safety_event, scorecard_event)", t)})
+                return
+            }
+            filter.entities[t] = true
+        }
+    }
+    if id := c.Query("driverId"); id != "" {
+        if filter.driverID = atoi(id); filter.driverID <= 0 {
+            c.JSON(http.StatusBadRequest, APIError{Message: "invalid driverId"})
+            return
+        }
+    }
+    lastID := c.GetHeader("Last-Event-ID")
+    if lastID == "" {
+        lastID = c.Query("lastEventId")
+    }
+    var sent int64 = -1
+    if lastID != "" {
+        n, err := strconv.ParseInt(lastID, 10, 64)
+        if err != nil || n < 0 {
+            c.JSON(http.StatusBadRequest, APIError{Message: "invalid Last-Event-ID"})
+            return
+        }
+        sent = n
+    }
+
+    // Join the live feed before reading the backlog: the feed sends everything after
+    // its mark, the backlog is read up to it
+    cl := &streamClient{events: make(chan changeEvent, streamClientBuf), dropped: make(chan struct{})}
+    changeFeed.Lock()
+    changeFeed.clients[cl] = struct{}{}
+    mark, started := changeFeed.mark, changeFeed.started
+    changeFeed.Unlock()
+    defer func() {
+        changeFeed.Lock()
+        delete(changeFeed.clients, cl)
+        changeFeed.Unlock()
+    }()
+
+    ctx := c.Request.Context()
+    var backlog []changeEvent
+    reset := false
+    q, cancel := context.WithTimeout(ctx, 10*time.Second)
+    if !started {
+        // The feed is still starting and will begin after the current newest change
+        if err := queryRow(q, `SELECT COALESCE(MAX(change_id), 0) FROM change_events`).Scan(&mark); err != nil {
+            cancel()
+            c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+            return
+        }
+    }
+    if sent < 0 {
+        sent = mark
+    } else if sent < mark {
+        var oldest sql.NullInt64
+        _ = queryRow(q, `SELECT MIN(change_id) FROM change_events`).Scan(&oldest)
+        var err error
+        if backlog, err = loadChangesUpTo(q, sent, mark, streamCatchUpMax+1); err != nil {
+            cancel()
+            c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+            return
+        }
+        reset = (oldest.Valid && oldest.Int64 > sent+1) || len(backlog) > streamCatchUpMax
+    }
+    cancel()
+
+    w := c.Writer
+    // Streams stay open for hours: no HTTP_WRITE_TIMEOUT
+    _ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+    h := w.Header()
+    h.Set("Content-Type", "text/event-stream")
+    h.Set("Cache-Control", "no-cache")
+    h.Set("Connection", "keep-alive")
+    h.Set("X-Accel-Buffering", "no") // nginx: don't buffer the stream
+    w.WriteHeader(http.StatusOK)
+    fmt.Fprint(w, "retry: 3000\n\n")
+
+    send := func(e changeEvent) {
+        if e.id <= sent {
+            return
+        }
+        sent = e.id
+        if filter.match(e) {
+            fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.id, e.eventType, e.payload)
+        }
+    }
+    if reset {
+        // Too far behind to replay: the client reloads, then continues from here
+        sent = mark
+        fmt.Fprintf(w, "id: %d\nevent: reset\ndata: {}\n\n", mark)
+    } else {
+        for _, e := range backlog {
+            send(e)
+        }
+    }
+    w.Flush()
+
+    keepalive := time.NewTicker(streamKeepalive)
+    defer keepalive.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-cl.dropped:
+            return
+        case <-streamsClosing:
+            return
+        case e := <-cl.events:
+            send(e)
+        case <-keepalive.C:
+            fmt.Fprint(w, ": keepalive\n\n")
+        }
+        w.Flush()
+    }
+}
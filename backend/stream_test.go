@@ -0,0 +1,48 @@
+package main
+
+import (
+    "context"
+    "slices"
+    "testing"
+    "time"
+)
+
+func changeIDs(changes []changeEvent) []int64 {
+    ids := []int64{}
+    for _, e := range changes {
+        ids = append(ids, e.id)
+    }
+    return ids
+}
+
+// A change whose transaction commits within a poll of a later one still goes out,
+// in order; an id still missing after that (rolled back) is skipped.
+func TestFeedCursorWaitsForLateCommits(t *testing.T) {
+    ctx := context.Background()
+    at := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+    cur := feedCursor{last: 10}
+    ids := func(ids ...int64) []changeEvent {
+        var out []changeEvent
+        for _, id := range ids {
+            out = append(out, changeEvent{id: id})
+        }
+        return out
+    }
+    for _, step := range []struct {
+        read     []int64
+        after    time.Duration
+        want     []int64
+        wantLast int64
+    }{
+        {read: []int64{11, 13, 14}, want: []int64{11}, wantLast: 11}, // 12 not committed yet
+        {read: []int64{13, 14}, after: 500 * time.Millisecond, want: []int64{}, wantLast: 11},
+        {read: []int64{12, 13, 14, 16}, after: time.Second, want: []int64{12, 13, 14}, wantLast: 14}, // 15 is missing now
+        {read: []int64{16}, after: 2 * time.Second, want: []int64{}, wantLast: 14},
+        {read: []int64{16, 17}, after: 2*time.Second + changeFeedPollEvery + time.Millisecond, want: []int64{16, 17}, wantLast: 17}, // 15 rolled back
+    } {
+        got := cur.advance(ctx, ids(step.read...), at.Add(step.after))
+        if g := changeIDs(got); !slices.Equal(g, step.want) || cur.last != step.wantLast {
+            t.Errorf("after %v reading %v: sent %v, last %d; want %v, last %d", step.after, step.read, g, cur.last, step.want, step.wantLast)
+        }
+    }
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+    "embed"
+    "io/fs"
+    "net/http"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+// Swagger UI is served from files embedded in the binary (see swagger-ui/README.md)
+// so the docs work on networks without internet access.
+
+//go:embed swagger-ui/swagger-ui-bundle.js swagger-ui/swagger-ui.css swagger-ui/favicon-32x32.png swagger-ui/favicon-16x16.png
+var swaggerAssets embed.FS
+
+var swaggerFiles = http.FileServer(http.FS(mustSub(swaggerAssets, "swagger-ui")))
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+    sub, err := fs.Sub(fsys, dir)
+    if err != nil {
+        panic(err)
+    }
+    return sub
+}
+
+// persistAuthorization keeps a pasted bearer token across reloads; "Authorize"
+// appears because the spec declares the bearerAuth (JWT) scheme.
+const swaggerIndex = `<!doctype html>
+<html>
+<head>
+  <meta charset="utf-8"/>
+  <title>DriverSafetyBonus API Docs</title>
+  <link rel="stylesheet" href="swagger-ui.css"/>
+  <link rel="icon" type="image/png" href="favicon-32x32.png" sizes="32x32"/>
+  <link rel="icon" type="image/png" href="favicon-16x16.png" sizes="16x16"/>
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="swagger-ui-bundle.js"></script>
+<script>
+window.onload = () => {
+  window.ui = SwaggerUIBundle({
+    url: '/openapi.json',
+    dom_id: '#swagger-ui',
+    deepLinking: true,
+    persistAuthorization: true
+  });
+};
+</script>
+</body>
+</html>`
+
+// GET /swagger/*filepath: the UI page at /swagger/, its assets below it.
+func serveSwaggerUI(c *gin.Context) {
+    file := strings.TrimPrefix(c.Param("filepath"), "/")
+    if file == "" || file == "index.html" {
+        c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerIndex))
+        return
+    }
+    // Assets only change with the binary
+    c.Header("Cache-Control", "public, max-age=86400")
+    c.Request.URL.Path = "/" + file
+    swaggerFiles.ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "log/slog"
+    "math"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+func registerScheduledJobs() {
+    registerJob("close-bonus-periods", "5 0 1 * *",
+        "Close open bonus periods once their month or quarter has ended", closeEndedBonusPeriods)
+    registerJob("scorecard-summaries", "30 0 1 * *",
+        "Summarise last month's scorecard stars per driver and category", generateScorecardSummaries)
+    registerJob("missing-scorecard-reminders", "0 8 25 * *",
+        "Remind supervisors of active drivers with scorecard items missing this month", remindMissingScorecards)
+    registerJob("flag-expiring-credentials", "0 6 * * *",
+        fmt.Sprintf("Flag credentials expiring within %d days", conf.Thresholds.CredentialExpiryDays), flagExpiringCredentials)
+    registerJob("prune-change-events", "15 3 * * *",
+        "Remove /stream change history older than 48 hours", pruneChangeEvents)
+}
+
+func localDay(t time.Time) time.Time {
+    t = t.In(localTZ)
+    return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, localTZ)
+}
+
+// closeEndedBonusPeriods moves every open period whose last day is before at to closed.
+func closeEndedBonusPeriods(ctx context.Context, at time.Time) (string, error) {
+    rows, err := queryRows(ctx, `SELECT period_id, period_key FROM bonus_periods WHERE status='open' AND ends_on < ? ORDER BY starts_on`, formatLocalDate(localDay(at)))
+    if err != nil {
+        return "", err
+    }
+    type period struct {
+        id  int
+        key string
+    }
+    var due []period
+    for rows.Next() {
+        var p period
+        if err := rows.Scan(&p.id, &p.key); err == nil {
+            due = append(due, p)
+        }
+    }
+    rows.Close()
+
+    var closed []string
+    for _, p := range due {
+        if _, err := setBonusPeriodStatus(ctx, p.id, "open", "closed", "scheduler"); err != nil {
+            return "", fmt.Errorf("closing %s: %w", p.key, err)
+        }
+        closed = append(closed, p.key)
+    }
+    if len(closed) == 0 {
+        return "no periods to close", nil
+    }
+    return "closed " + strings.Join(closed, ", "), nil
+}
+
+// generateScorecardSummaries rolls up the month before at into scorecard_summaries.
+// Re-running replaces that month's rows.
+func generateScorecardSummaries(ctx context.Context, at time.Time) (string, error) {
+    first := time.Date(at.In(localTZ).Year(), at.In(localTZ).Month(), 1, 0, 0, 0, 0, localTZ).AddDate(0, -1, 0)
+    month := first.Format("2006-01")
+    now := time.Now().In(localTZ)
+
+    var n int64
+    err := inTx(ctx, func(ctx context.Context) error {
+        if _, err := exec(ctx, `DELETE FROM scorecard_summaries WHERE month=?`, month); err != nil {
+            return err
+        }
+        res, err := exec(ctx, `
+            INSERT INTO scorecard_summaries (driver_id, month, sc_category, items_scored, stars, possible, generated_at)
+            SELECT e.driver_id, ?, m.sc_category, COUNT(*), SUM(e.sc_score), COUNT(*) * ?, ?
+            FROM scorecard_events e
+            JOIN scorecard_metrics m ON m.sc_category_id = e.sc_category_id
+            WHERE e.event_date BETWEEN ? AND ?
+            GROUP BY e.driver_id, m.sc_category`,
+            month, scorecardMaxStars, now, formatLocalDate(first), formatLocalDate(first.AddDate(0, 1, -1)))
+        if err != nil {
+            return err
+        }
+        n, _ = res.RowsAffected()
+        return nil
+    })
+    if err != nil {
+        return "", err
+    }
+    return fmt.Sprintf("%s: %d driver/category summaries", month, n), nil
+}
+
+func remindMissingScorecards(ctx context.Context, at time.Time) (string, error) {
+    month := time.Date(at.In(localTZ).Year(), at.In(localTZ).Month(), 1, 0, 0, 0, 0, localTZ)
+    list, err := loadScorecardChecklist(ctx, month)
+    if err != nil {
+        return "", err
+    }
+    var missing []string
+    for _, d := range list {
+        if !d.Complete {
+            missing = append(missing, fmt.Sprintf("%s %s %s (%d of %d items missing)", d.DriverCode, d.FirstName, d.LastName, len(d.Missing), d.Applicable))
+        }
+    }
+    if len(missing) == 0 {
+        return month.Format("2006-01") + ": all scorecards entered", nil
+    }
+    msg := fmt.Sprintf("%s: %d drivers missing scorecards: %s", month.Format("2006-01"), len(missing), strings.Join(missing, "; "))
+    slog.InfoContext(ctx, "scorecard reminder", "message", msg)
+    notify(ctx, notifyScorecardsMissing, 0, map[string]any{"Month": month.Format("2006-01"), "Drivers": missing})
+    return msg, nil
+}
+
+// flagExpiringCredentials stamps expiry_flagged_at on credentials entering the warning
+// window so each is reported once; editing the expiry date clears the flag.
+func flagExpiringCredentials(ctx context.Context, at time.Time) (string, error) {
+    today := localDay(at)
+    cutoff := formatLocalDate(today.AddDate(0, 0, conf.Thresholds.CredentialExpiryDays))
+    rows, err := queryRows(ctx, `
+        SELECT dc.credential_id, dc.credential_type, DATE_FORMAT(dc.expiry_date, '%Y-%m-%d'), d.driver_code, d.first_name, d.last_name
+        FROM driver_credentials dc
+        JOIN drivers d ON d.driver_id = dc.driver_id
+        WHERE dc.expiry_date IS NOT NULL AND dc.expiry_date <= ? AND dc.expiry_flagged_at IS NULL
+        ORDER BY dc.expiry_date`, cutoff)
+    if err != nil {
+        return "", err
+    }
+    var (
+        ids   []any
+        notes []string
+    )
+    for rows.Next() {
+        var (
+            id                             int
+            credType, expiry, code, fn, ln string
+        )
+        if err := rows.Scan(&id, &credType, &expiry, &code, &fn, &ln); err != nil {
+            continue
+        }
+        expiryDay, _ := parseLocalDate(expiry)
+        days := int(math.Round(expiryDay.Sub(today).Hours() / 24))
+        ids = append(ids, id)
+        notes = append(notes, fmt.Sprintf("%s %s %s %s (%d days)", code, fn, ln, credType, days))
+    }
+    rows.Close()
+    if len(ids) == 0 {
+        return "no newly expiring credentials", nil
+    }
+    args := append([]any{time.Now().In(localTZ)}, ids...)
+    if _, err := exec(ctx, `UPDATE driver_credentials SET expiry_flagged_at=? WHERE credential_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)`, args...); err != nil {
+        return "", err
+    }
+    notify(ctx, notifyCredentialsExpiring, 0, map[string]any{"Days": conf.Thresholds.CredentialExpiryDays, "Credentials": notes})
+    return fmt.Sprintf("flagged %d: %s", len(ids), strings.Join(notes, "; ")), nil
+}
+
+// --- Scorecard summaries ---
+
+// GET /scorecards/summaries?month=YYYY-MM (defaults to last month)
+func getScorecardSummaries(c *gin.Context) {
+    month := c.Query("month")
+    if month == "" {
+        now := time.Now().In(localTZ)
+        month = time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, localTZ).Format("2006-01")
+    }
+    if _, err := time.ParseInLocation("2006-01", month, localTZ); err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: "month must be YYYY-MM"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    rows, err := queryRows(ctx, `
+        SELECT s.driver_id, d.driver_code, d.first_name, d.last_name, s.month, s.sc_category, s.items_scored, s.stars, s.possible, s.generated_at
+        FROM scorecard_summaries s
+        JOIN drivers d ON d.driver_id = s.driver_id
+        WHERE s.month=?
+        ORDER BY d.last_name, d.first_name, FIELD(s.sc_category, 'SAFETY', 'MAINTENANCE', 'DISPATCH')`, month)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    out := []ScorecardSummary{}
+    for rows.Next() {
+        var (
+            s           ScorecardSummary
+            generatedAt time.Time
+        )
+        if err := rows.Scan(&s.DriverID, &s.DriverCode, &s.FirstName, &s.LastName, &s.Month, &s.ScCategory, &s.ItemsScored, &s.Stars, &s.Possible, &generatedAt); err != nil {
+            continue
+        }
+        if s.Possible > 0 {
+            s.Pct = math.Round(float64(s.Stars)/float64(s.Possible)*1000) / 10
+        }
+        s.GeneratedAt = generatedAt.In(localTZ).Format(time.RFC3339)
+        out = append(out, s)
+    }
+    c.JSON(http.StatusOK, out)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+    "go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+    "go.opentelemetry.io/otel/propagation"
+    "go.opentelemetry.io/otel/sdk/resource"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+    "go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "driver-safety-bonus"
+
+// setupTracing installs the OpenTelemetry tracer provider. OTEL_TRACES_EXPORTER
+// lists the exporters: otlp (OTLP over HTTP to OTEL_EXPORTER_OTLP_ENDPOINT, by
+// default http://localhost:4318), stdout (spans as JSON on stdout, for local
+// debugging) or none. It defaults to otlp when an endpoint is set and to none
+// otherwise. The other standard OTEL_* variables (OTEL_SERVICE_NAME,
+// OTEL_TRACES_SAMPLER, OTEL_EXPORTER_OTLP_HEADERS, ...) apply as usual.
+// The returned function flushes spans still queued.
+func setupTracing(ctx context.Context, stdout io.Writer) (func(context.Context) error, error) {
+    otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+    exporters := os.Getenv("OTEL_TRACES_EXPORTER")
+    if exporters == "" && (os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "") {
+        exporters = "otlp"
+    }
+    var opts []sdktrace.TracerProviderOption
+    for _, name := range strings.Split(exporters, ",") {
+        var (
+            exp sdktrace.SpanExporter
+            err error
+        )
+        switch strings.TrimSpace(name) {
+        case "", "none":
+            continue
+        case "otlp":
+            exp, err = otlptracehttp.New(ctx)
+        case "stdout", "console":
+            exp, err = stdouttrace.New(stdouttrace.WithWriter(stdout))
+        default:
+            return nil, fmt.Errorf("OTEL_TRACES_EXPORTER: unknown exporter %q (otlp, stdout or none)", name)
+        }
+        if err != nil {
+            return nil, fmt.Errorf("trace exporter %s: %w", name, err)
+        }
+        opts = append(opts, sdktrace.WithBatcher(exp))
+    }
+    if len(opts) == 0 {
+        return func(context.Context) error { return nil }, nil
+    }
+
+    res, err := resource.New(ctx,
+        resource.WithSchemaURL(semconv.SchemaURL),
+        resource.WithAttributes(semconv.ServiceName("driver-safety-bonus-api")),
+        resource.WithTelemetrySDK(),
+        resource.WithHost(),
+        resource.WithFromEnv(), // OTEL_SERVICE_NAME, OTEL_RESOURCE_ATTRIBUTES
+    )
+    if err != nil && !errors.Is(err, resource.ErrPartialResource) {
+        return nil, err
+    }
+    tp := sdktrace.NewTracerProvider(append(opts, sdktrace.WithResource(res))...)
+    otel.SetTracerProvider(tp)
+    return tp.Shutdown, nil
+}
+
+// traceRequests starts a server span per request, named by route template
+// ("GET /api/drivers/:id") and continuing a caller's W3C traceparent. Handlers
+// pass c.Request.Context() down, so their SQL statements become child spans.
+func traceRequests() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+        route := c.FullPath()
+        name := c.Request.Method + " " + route
+        if route == "" {
+            name = c.Request.Method
+        }
+        ctx, span := otel.Tracer(tracerName).Start(ctx, name,
+            trace.WithSpanKind(trace.SpanKindServer),
+            trace.WithAttributes(
+                semconv.HTTPRequestMethodKey.String(c.Request.Method),
+                semconv.HTTPRoute(route),
+                semconv.URLPath(c.Request.URL.Path),
+                semconv.ClientAddress(c.ClientIP()),
+                semconv.UserAgentOriginal(c.Request.UserAgent()),
+            ))
+        defer span.End()
+        c.Request = c.Request.WithContext(ctx)
+
+        c.Next()
+
+        status := c.Writer.Status()
+        span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+        if id := c.Writer.Header().Get("X-Request-ID"); id != "" {
+            span.SetAttributes(attribute.String("request.id", id))
+        }
+        if status >= 500 {
+            span.SetStatus(codes.Error, fmt.Sprintf("%d %s", status, c.Errors.String()))
+        }
+    }
+}
+
+// traceQuery records a finished statement as a client span under the request's
+// span, back-dated to when it started. Statements outside a trace (scheduled jobs,
+// workers) are not traced.
+func traceQuery(ctx context.Context, query string, start time.Time, err error, attrs ...attribute.KeyValue) {
+    if !trace.SpanContextFromContext(ctx).IsValid() {
+        return
+    }
+    op, summary := querySummary(query)
+    _, span := otel.Tracer(tracerName).Start(ctx, summary, trace.WithTimestamp(start),
+        trace.WithSpanKind(trace.SpanKindClient),
+        trace.WithAttributes(append([]attribute.KeyValue{
+            semconv.DBSystemNameMySQL,
+            semconv.DBOperationName(op),
+            semconv.DBQuerySummary(summary),
+            semconv.DBQueryText(compactSQL(query)),
+        }, attrs...)...))
+    if err != nil {
+        span.RecordError(err)
+        span.SetStatus(codes.Error, err.Error())
+    }
+    span.End()
+}
+
+// querySummary names a statement by operation and first table, e.g. "SELECT
+// trucks" or "UPDATE safety_events".
+func querySummary(query string) (op, summary string) {
+    words := strings.Fields(query)
+    if len(words) == 0 {
+        return "", "SQL"
+    }
+    op = strings.ToUpper(words[0])
+    after := map[string]string{"SELECT": "FROM", "DELETE": "FROM", "INSERT": "INTO", "REPLACE": "INTO", "UPDATE": "UPDATE"}[op]
+    if after == "" {
+        return op, op
+    }
+    for i, w := range words[:len(words)-1] {
+        if strings.EqualFold(w, after) && (op != "UPDATE" || i == 0) {
+            table := strings.Trim(words[i+1], "`,;")
+            if table != "" && !strings.HasPrefix(table, "(") {
+                return op, op + " " + table
+            }
+            break
+        }
+    }
+    return op, op
+}
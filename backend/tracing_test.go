@@ -0,0 +1,88 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "database/sql/driver"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/DATA-DOG/go-sqlmock"
+    "github.com/gin-gonic/gin"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/propagation"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// dsnConnector opens sqlmock connections, so tests can go through observedConnector.
+type dsnConnector struct {
+    dsn string
+    drv driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) { return c.drv.Open(c.dsn) }
+func (c dsnConnector) Driver() driver.Driver                        { return c.drv }
+
+func TestTraceRequestAndQueries(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    mock := withMockDB(t)
+    traced := sql.OpenDB(observedConnector{dsnConnector{t.Name(), db.Driver()}})
+    defer traced.Close()
+    db = traced
+
+    spans := tracetest.NewSpanRecorder()
+    prevTP, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+    otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+    otel.SetTextMapPropagator(propagation.TraceContext{})
+    defer func() {
+        otel.SetTracerProvider(prevTP)
+        otel.SetTextMapPropagator(prevProp)
+    }()
+
+    mock.ExpectQuery(`SELECT .+ FROM trucks WHERE truck_id=\?`).WithArgs(7).
+        WillReturnRows(sqlmock.NewRows(truckCols).AddRow(7, "T-07", 2021, "available", 3))
+    req := httptest.NewRequest(http.MethodGet, "/api/trucks/7", nil)
+    req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+    w := httptest.NewRecorder()
+    newRouter().ServeHTTP(w, req)
+    if w.Code != http.StatusOK {
+        t.Fatalf("status %d: %s", w.Code, w.Body)
+    }
+
+    ended := spans.Ended()
+    if len(ended) != 2 {
+        t.Fatalf("got %d spans, want the SQL and the request span", len(ended))
+    }
+    query, server := ended[0], ended[1]
+    if server.Name() != "GET /api/trucks/:id" || server.Parent().SpanID().String() != "00f067aa0ba902b7" ||
+        server.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+        t.Errorf("request span %q parent %s trace %s", server.Name(), server.Parent().SpanID(), server.SpanContext().TraceID())
+    }
+    if query.Name() != "SELECT trucks" || query.Parent().SpanID() != server.SpanContext().SpanID() {
+        t.Errorf("query span %q is not a child of the request span", query.Name())
+    }
+    attrs := map[string]any{}
+    for _, a := range query.Attributes() {
+        attrs[string(a.Key)] = a.Value.AsInterface()
+    }
+    if attrs["db.response.returned_rows"] != int64(1) || attrs["db.system.name"] != "mysql" {
+        t.Errorf("query span attributes %v", attrs)
+    }
+}
+
+func TestQuerySummary(t *testing.T) {
+    for query, want := range map[string]string{
+        "SELECT d.driver_id FROM drivers d WHERE d.active":               "SELECT drivers",
+        "\n        SELECT COUNT(*) FROM (SELECT 1 FROM safety_events) x": "SELECT",
+        "INSERT IGNORE INTO job_leases (job_name) VALUES (?)":            "INSERT job_leases",
+        "UPDATE `trucks` SET status=? WHERE truck_id=?":                  "UPDATE trucks",
+        "DELETE FROM attachments WHERE attachment_id=?":                  "DELETE attachments",
+        "SHOW FULL TABLES": "SHOW",
+    } {
+        if _, got := querySummary(query); got != want {
+            t.Errorf("querySummary(%q) = %q, want %q", query, got, want)
+        }
+    }
+}
@@ -0,0 +1,778 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "net"
+    "net/http"
+    "net/netip"
+    "net/url"
+    "sort"
+    "strconv"
+    "strings"
+    "syscall"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+const (
+    webhookMaxAttempts = 12
+    webhookBatchSize   = 20
+    webhookPollEvery   = 10 * time.Second
+    webhookTimeout     = 10 * time.Second
+    // Bytes of the receiver's response body kept in the delivery log
+    webhookResponseKeep = 1024
+)
+
+// Events a subscription can ask for; "*" subscribes to all of them.
+var webhookEventTypes = map[string]string{
+    "driver.created":          "A driver was added",
+    "driver.updated":          "A driver was edited",
+    "driver.deleted":          "A driver was removed",
+    "truck.created":           "A truck was added",
+    "truck.updated":           "A truck was edited",
+    "truck.deleted":           "A truck was removed",
+    "truck.assigned":          "A driver was assigned to a truck",
+    "truck.unassigned":        "A driver was taken off a truck",
+    "safety_event.created":    "A safety event was recorded",
+    "safety_event.updated":    "A safety event was edited",
+    "safety_event.deleted":    "A safety event was removed",
+    "scorecard_event.created": "A scorecard score was entered",
+    "scorecard_event.updated": "A scorecard score was edited",
+    "scorecard_event.deleted": "A scorecard score was removed",
+    "bonus_period.locked":     "A bonus period was approved and can no longer change",
+}
+
+var webhookWake = make(chan struct{}, 1)
+
+// webhookEnvelope is the JSON body POSTed to subscribers (and the data of /stream
+// events). id stays the same when a
+// delivery is retried or replayed, so receivers can drop duplicates.
+type webhookEnvelope struct {
+    ID         string `json:"id"`
+    Type       string `json:"type"`
+    OccurredAt string `json:"occurred_at"`
+    Data       any    `json:"data"`
+}
+
+func newEventID() string {
+    b := make([]byte, 12)
+    _, _ = rand.Read(b)
+    return "evt_" + hex.EncodeToString(b)
+}
+
+// publishEvent records a change for every interested webhook subscription and for
+// the /stream change feed. Call it inside the inTx that makes the change: the
+// deliveries and the change_events row commit with the write, and an error rolls
+// all of it back.
+func publishEvent(ctx context.Context, eventType string, data any) error {
+    env := webhookEnvelope{ID: newEventID(), Type: eventType, OccurredAt: time.Now().In(localTZ).Format(time.RFC3339), Data: data}
+    return inTx(ctx, func(ctx context.Context) error {
+        if err := enqueueWebhooks(ctx, env); err != nil {
+            return fmt.Errorf("queue %s webhooks: %w", eventType, err)
+        }
+        if err := recordChange(ctx, env); err != nil {
+            return fmt.Errorf("record %s change: %w", eventType, err)
+        }
+        return nil
+    })
+}
+
+func enqueueWebhooks(ctx context.Context, env webhookEnvelope) error {
+    rows, err := queryRows(ctx, `SELECT subscription_id, event_types FROM webhook_subscriptions WHERE active = TRUE`)
+    if err != nil {
+        return err
+    }
+    var targets []int
+    for rows.Next() {
+        var (
+            id    int
+            types string
+        )
+        if err := rows.Scan(&id, &types); err != nil {
+            rows.Close()
+            return err
+        }
+        if webhookWants(types, env.Type) {
+            targets = append(targets, id)
+        }
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return err
+    }
+    if len(targets) == 0 {
+        return nil
+    }
+
+    payload, err := json.Marshal(env)
+    if err != nil {
+        return err
+    }
+    now := time.Now().In(localTZ)
+    for _, id := range targets {
+        if _, err := exec(ctx, `
+            INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at)
+            VALUES (?, ?, ?, ?, 'pending', 0, ?, ?)`, id, env.ID, env.Type, payload, now, now); err != nil {
+            return err
+        }
+    }
+    afterCommit(ctx, wakeWebhooks)
+    return nil
+}
+
+func webhookWants(types, eventType string) bool {
+    for _, t := range strings.Split(types, ",") {
+        if t == "*" || t == eventType {
+            return true
+        }
+    }
+    return false
+}
+
+func wakeWebhooks() {
+    select {
+    case webhookWake <- struct{}{}:
+    default:
+    }
+}
+
+// signWebhook returns the X-Webhook-Signature value: HMAC-SHA256 over "<timestamp>.<body>".
+func signWebhook(secret string, timestamp int64, body []byte) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    fmt.Fprintf(mac, "%d.", timestamp)
+    mac.Write(body)
+    return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// --- Delivery ---
+
+var webhookClient = &http.Client{
+    Timeout: webhookTimeout,
+    Transport: &http.Transport{
+        Proxy:                 nil, // the dial checks below must see the receiver's address
+        DialContext:           dialWebhook,
+        TLSHandshakeTimeout:   webhookTimeout,
+        ResponseHeaderTimeout: webhookTimeout,
+        MaxIdleConnsPerHost:   2,
+        IdleConnTimeout:       90 * time.Second,
+    },
+    // A redirect would resend the payload somewhere the subscriber did not register
+    CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+// --- Receiver addresses ---
+//
+// The API has no auth and keeps part of each response, so a subscription must not
+// reach the API's own network: loopback, private, link-local (cloud metadata at
+// 169.254.169.254) and similar addresses are refused when a subscription is saved
+// and again at connect time, after DNS, so a name cannot later resolve inward.
+// WEBHOOK_ALLOWED_HOSTS lists internal receivers that are meant to be reachable.
+
+var errWebhookTargetBlocked = errors.New("receiver address is loopback, private or link-local (allow it with WEBHOOK_ALLOWED_HOSTS)")
+
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// internalAddr reports whether ip is not on the public internet.
+func internalAddr(ip netip.Addr) bool {
+    ip = ip.Unmap()
+    return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+        ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip)
+}
+
+// webhookHostAllowed reports whether host (a name or IP) is on WEBHOOK_ALLOWED_HOSTS.
+func webhookHostAllowed(host string) bool {
+    ip, ipErr := netip.ParseAddr(host)
+    for _, allowed := range conf.Webhooks.AllowedHosts {
+        if strings.EqualFold(allowed, host) {
+            return true
+        }
+        if p, err := netip.ParsePrefix(allowed); err == nil && ipErr == nil && p.Contains(ip.Unmap()) {
+            return true
+        }
+        if a, err := netip.ParseAddr(allowed); err == nil && ipErr == nil && a.Unmap() == ip.Unmap() {
+            return true
+        }
+    }
+    return false
+}
+
+// dialWebhook connects to a receiver, refusing internal addresses unless allowed.
+// The check runs in Control, on the address actually dialled.
+func dialWebhook(ctx context.Context, network, addr string) (net.Conn, error) {
+    host, _, err := net.SplitHostPort(addr)
+    if err != nil {
+        return nil, err
+    }
+    d := net.Dialer{Timeout: webhookTimeout}
+    if !webhookHostAllowed(host) {
+        d.Control = func(_, address string, _ syscall.RawConn) error {
+            ap, err := netip.ParseAddrPort(address)
+            if err != nil {
+                return err
+            }
+            if internalAddr(ap.Addr()) && !webhookHostAllowed(ap.Addr().String()) {
+                return errWebhookTargetBlocked
+            }
+            return nil
+        }
+    }
+    return d.DialContext(ctx, network, addr)
+}
+
+// checkWebhookTarget refuses a URL whose host is, or resolves to, an internal
+// address. A name that does not resolve yet is accepted; delivery checks again.
+func checkWebhookTarget(ctx context.Context, u *url.URL) error {
+    host := u.Hostname()
+    if webhookHostAllowed(host) {
+        return nil
+    }
+    if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+        return errWebhookTargetBlocked
+    }
+    var ips []netip.Addr
+    if ip, err := netip.ParseAddr(host); err == nil {
+        ips = append(ips, ip)
+    } else if resolved, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host); err == nil {
+        ips = resolved
+    }
+    for _, ip := range ips {
+        if internalAddr(ip) && !webhookHostAllowed(ip.String()) {
+            return errWebhookTargetBlocked
+        }
+    }
+    return nil
+}
+
+// runWebhooks delivers queued webhooks until ctx is cancelled. Batches are claimed
+// with an expiring lock, the same way the mail outbox is.
+func runWebhooks(ctx context.Context) {
+    ticker := time.NewTicker(webhookPollEvery)
+    defer ticker.Stop()
+    for {
+        // A batch under way finishes even when ctx is cancelled (see serve)
+        for deliverWebhookBatch(context.WithoutCancel(ctx)) == webhookBatchSize {
+        }
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        case <-webhookWake:
+        }
+    }
+}
+
+func deliverWebhookBatch(parent context.Context) int {
+    ctx, cancel := context.WithTimeout(parent, 5*time.Minute)
+    defer cancel()
+
+    now := time.Now().In(localTZ)
+    if _, err := exec(ctx, `
+        UPDATE webhook_deliveries SET status='sending', locked_by=?, locked_until=?
+        WHERE (status='pending' AND next_attempt_at <= ?) OR (status='sending' AND locked_until < ?)
+        ORDER BY next_attempt_at, delivery_id
+        LIMIT ?`, jobRunnerID, now.Add(5*time.Minute), now, now, webhookBatchSize); err != nil {
+        slog.WarnContext(ctx, "webhook claim failed", "err", err)
+        return 0
+    }
+    rows, err := queryRows(ctx, `
+        SELECT d.delivery_id, d.event_type, d.payload, d.attempts, s.url, s.secret
+        FROM webhook_deliveries d
+        JOIN webhook_subscriptions s ON s.subscription_id = d.subscription_id
+        WHERE d.status='sending' AND d.locked_by=?`, jobRunnerID)
+    if err != nil {
+        slog.WarnContext(ctx, "webhook read failed", "err", err)
+        return 0
+    }
+    type claimed struct {
+        id                     int64
+        eventType, url, secret string
+        payload                []byte
+        attempts               int
+    }
+    var batch []claimed
+    for rows.Next() {
+        var d claimed
+        if err := rows.Scan(&d.id, &d.eventType, &d.payload, &d.attempts, &d.url, &d.secret); err == nil {
+            batch = append(batch, d)
+        }
+    }
+    rows.Close()
+
+    for _, d := range batch {
+        code, body, elapsed, err := postWebhook(ctx, d.url, d.secret, d.eventType, d.id, d.payload)
+        now := time.Now().In(localTZ)
+        var statusCode any
+        if code != 0 {
+            statusCode = code
+        }
+        var errText any
+        if err != nil {
+            errText = err.Error()
+        }
+        _, _ = exec(ctx, `
+            INSERT INTO webhook_delivery_attempts (delivery_id, attempted_at, status_code, duration_ms, error, response_body)
+            VALUES (?, ?, ?, ?, ?, ?)`, d.id, now, statusCode, elapsed.Milliseconds(), errText, body)
+
+        attempts := d.attempts + 1
+        if err == nil {
+            _, _ = exec(ctx, `
+                UPDATE webhook_deliveries SET status='delivered', attempts=?, last_status_code=?, last_error=NULL, delivered_at=?, locked_by=NULL, locked_until=NULL
+                WHERE delivery_id=?`, attempts, code, now, d.id)
+            continue
+        }
+        status := "pending"
+        if attempts >= webhookMaxAttempts {
+            status = "failed"
+        }
+        _, _ = exec(ctx, `
+            UPDATE webhook_deliveries SET status=?, attempts=?, next_attempt_at=?, last_status_code=?, last_error=?, locked_by=NULL, locked_until=NULL
+            WHERE delivery_id=?`, status, attempts, now.Add(webhookBackoff(attempts)), statusCode, err.Error(), d.id)
+    }
+    return len(batch)
+}
+
+// postWebhook sends one signed delivery. Anything but a 2xx response is an error.
+func postWebhook(ctx context.Context, target, secret, eventType string, deliveryID int64, payload []byte) (int, string, time.Duration, error) {
+    ts := time.Now().Unix()
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(payload))
+    if err != nil {
+        return 0, "", 0, err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("User-Agent", "DriverSafetyBonus-Webhooks/1")
+    req.Header.Set("X-Webhook-Event", eventType)
+    req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(deliveryID, 10))
+    req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(ts, 10))
+    req.Header.Set("X-Webhook-Signature", signWebhook(secret, ts, payload))
+
+    start := time.Now()
+    resp, err := webhookClient.Do(req)
+    if err != nil {
+        return 0, "", time.Since(start), err
+    }
+    defer resp.Body.Close()
+    body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseKeep))
+    elapsed := time.Since(start)
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        return resp.StatusCode, string(body), elapsed, fmt.Errorf("receiver answered %s", resp.Status)
+    }
+    return resp.StatusCode, string(body), elapsed, nil
+}
+
+// webhookBackoff doubles from 30 seconds, capped at 12 hours; 12 attempts span about a day.
+func webhookBackoff(attempts int) time.Duration {
+    d := 30 * time.Second << (attempts - 1)
+    if attempts > 12 || d > 12*time.Hour {
+        return 12 * time.Hour
+    }
+    return d
+}
+
+// --- Subscriptions ---
+
+const webhookColumns = `subscription_id, url, secret, event_types, description, active, created_at`
+
+func scanWebhook(row rowScanner, w *WebhookSubscription) error {
+    var (
+        types     string
+        createdAt time.Time
+    )
+    if err := row.Scan(&w.SubscriptionID, &w.URL, &w.Secret, &types, &w.Description, &w.Active, &createdAt); err != nil {
+        return err
+    }
+    w.EventTypes = strings.Split(types, ",")
+    w.CreatedAt = createdAt.In(localTZ).Format(time.RFC3339)
+    return nil
+}
+
+func validateWebhook(ctx context.Context, w *WebhookSubscription) string {
+    u, err := url.Parse(strings.TrimSpace(w.URL))
+    if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+        return "url must be an absolute http(s) URL"
+    }
+    if err := checkWebhookTarget(ctx, u); err != nil {
+        return "url: " + err.Error()
+    }
+    w.URL = u.String()
+    if len(w.EventTypes) == 0 {
+        return "event_types is required (use [\"*\"] for all events)"
+    }
+    seen := map[string]bool{}
+    var types []string
+    for _, t := range w.EventTypes {
+        t = strings.TrimSpace(t)
+        if _, ok := webhookEventTypes[t]; !ok && t != "*" {
+            return fmt.Sprintf("unknown event type %q", t)
+        }
+        if !seen[t] {
+            seen[t] = true
+            types = append(types, t)
+        }
+    }
+    sort.Strings(types)
+    w.EventTypes = types
+    return ""
+}
+
+func newWebhookSecret() string {
+    b := make([]byte, 24)
+    _, _ = rand.Read(b)
+    return "whsec_" + hex.EncodeToString(b)
+}
+
+// GET /webhooks/event-types
+func getWebhookEventTypes(c *gin.Context) {
+    out := make([]gin.H, 0, len(webhookEventTypes))
+    for t, desc := range webhookEventTypes {
+        out = append(out, gin.H{"event_type": t, "description": desc})
+    }
+    sort.Slice(out, func(a, b int) bool { return out[a]["event_type"].(string) < out[b]["event_type"].(string) })
+    c.JSON(http.StatusOK, out)
+}
+
+// Secrets are only returned when a subscription is created or its secret rotated.
+func getWebhooks(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    rows, err := queryRows(ctx, `SELECT `+webhookColumns+` FROM webhook_subscriptions ORDER BY subscription_id`)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    subs := []WebhookSubscription{}
+    for rows.Next() {
+        var w WebhookSubscription
+        if err := scanWebhook(rows, &w); err != nil {
+            continue
+        }
+        w.Secret = ""
+        subs = append(subs, w)
+    }
+    c.JSON(http.StatusOK, subs)
+}
+
+// POST /webhooks {"url", "event_types", "description", "secret"?}; a secret is generated when omitted.
+func createWebhook(c *gin.Context) {
+    w := WebhookSubscription{Active: true}
+    if err := c.ShouldBindJSON(&w); err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    if msg := validateWebhook(c.Request.Context(), &w); msg != "" {
+        c.JSON(http.StatusBadRequest, APIError{Message: msg})
+        return
+    }
+    if w.Secret == "" {
+        w.Secret = newWebhookSecret()
+    }
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    res, err := exec(ctx, `INSERT INTO webhook_subscriptions (url, secret, event_types, description, active, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+        w.URL, w.Secret, strings.Join(w.EventTypes, ","), w.Description, w.Active, time.Now().In(localTZ))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    id, _ := res.LastInsertId()
+    if err := scanWebhook(queryRow(ctx, `SELECT `+webhookColumns+` FROM webhook_subscriptions WHERE subscription_id=?`, id), &w); err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, w)
+}
+
+// PUT /webhooks/:id; an empty secret keeps the current one, "rotate" generates a new one.
+func updateWebhook(c *gin.Context) {
+    id := atoi(c.Param("id"))
+    var w WebhookSubscription
+    if err := c.ShouldBindJSON(&w); err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    if msg := validateWebhook(c.Request.Context(), &w); msg != "" {
+        c.JSON(http.StatusBadRequest, APIError{Message: msg})
+        return
+    }
+    if w.Secret == "rotate" {
+        w.Secret = newWebhookSecret()
+    }
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    _, err := exec(ctx, `
+        UPDATE webhook_subscriptions SET url=?, secret=IF(? = '', secret, ?), event_types=?, description=?, active=?
+        WHERE subscription_id=?`, w.URL, w.Secret, w.Secret, strings.Join(w.EventTypes, ","), w.Description, w.Active, id)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    rotated := w.Secret
+    err = scanWebhook(queryRow(ctx, `SELECT `+webhookColumns+` FROM webhook_subscriptions WHERE subscription_id=?`, id), &w)
+    if err == sql.ErrNoRows {
+        c.JSON(http.StatusNotFound, APIError{Message: "webhook not found"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    if rotated == "" {
+        w.Secret = ""
+    }
+    c.JSON(http.StatusOK, w)
+}
+
+func deleteWebhook(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    if _, err := exec(ctx, `DELETE FROM webhook_subscriptions WHERE subscription_id=?`, c.Param("id")); err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    c.Status(http.StatusNoContent)
+}
+
+// POST /webhooks/:id/ping queues a "ping" event for this subscription only.
+func pingWebhook(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    id := atoi(c.Param("id"))
+    env := webhookEnvelope{ID: newEventID(), Type: "ping", OccurredAt: time.Now().In(localTZ).Format(time.RFC3339), Data: gin.H{"subscription_id": id}}
+    payload, _ := json.Marshal(env)
+    now := time.Now().In(localTZ)
+    res, err := exec(ctx, `
+        INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at)
+        SELECT subscription_id, ?, 'ping', ?, 'pending', 0, ?, ? FROM webhook_subscriptions WHERE subscription_id=?`,
+        env.ID, payload, now, now, id)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        c.JSON(http.StatusNotFound, APIError{Message: "webhook not found"})
+        return
+    }
+    deliveryID, _ := res.LastInsertId()
+    wakeWebhooks()
+    c.JSON(http.StatusAccepted, gin.H{"delivery_id": deliveryID, "event_id": env.ID})
+}
+
+// --- Deliveries ---
+
+const webhookDeliveryColumns = `delivery_id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+    last_status_code, last_error, replay_of, created_at, delivered_at`
+
+func scanWebhookDelivery(row rowScanner, d *WebhookDelivery) error {
+    var (
+        payload              []byte
+        nextAttempt, created time.Time
+        code                 sql.NullInt64
+        lastError            sql.NullString
+        replayOf             sql.NullInt64
+        deliveredAt          sql.NullTime
+    )
+    if err := row.Scan(&d.DeliveryID, &d.SubscriptionID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts, &nextAttempt,
+        &code, &lastError, &replayOf, &created, &deliveredAt); err != nil {
+        return err
+    }
+    d.Payload = json.RawMessage(payload)
+    d.NextAttemptAt = nextAttempt.In(localTZ).Format(time.RFC3339)
+    d.CreatedAt = created.In(localTZ).Format(time.RFC3339)
+    if code.Valid {
+        val := int(code.Int64)
+        d.LastStatusCode = &val
+    }
+    if lastError.Valid {
+        d.LastError = &lastError.String
+    }
+    if replayOf.Valid {
+        d.ReplayOf = &replayOf.Int64
+    }
+    if deliveredAt.Valid {
+        val := deliveredAt.Time.In(localTZ).Format(time.RFC3339)
+        d.DeliveredAt = &val
+    }
+    return nil
+}
+
+// GET /webhooks/:id/deliveries?status=failed&eventType=&limit=50&beforeId=
+//
+// Newest first; pass the last delivery_id of a page as beforeId for the next one.
+func getWebhookDeliveries(c *gin.Context) {
+    limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+    if err != nil || limit <= 0 || limit > 500 {
+        limit = 50
+    }
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    q := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE subscription_id=?`
+    args := []any{c.Param("id")}
+    if status := c.Query("status"); status != "" {
+        q += ` AND status=?`
+        args = append(args, status)
+    }
+    if t := c.Query("eventType"); t != "" {
+        q += ` AND event_type=?`
+        args = append(args, t)
+    }
+    if before := c.Query("beforeId"); before != "" {
+        q += ` AND delivery_id < ?`
+        args = append(args, atoi(before))
+    }
+    rows, err := queryRows(ctx, q+` ORDER BY delivery_id DESC LIMIT ?`, append(args, limit)...)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    out := []WebhookDelivery{}
+    for rows.Next() {
+        var d WebhookDelivery
+        if err := scanWebhookDelivery(rows, &d); err != nil {
+            continue
+        }
+        out = append(out, d)
+    }
+    c.JSON(http.StatusOK, out)
+}
+
+// GET /webhooks/deliveries/:id includes every attempt with the receiver's response.
+func getWebhookDelivery(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    var d WebhookDelivery
+    err := scanWebhookDelivery(queryRow(ctx, `SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries WHERE delivery_id=?`, c.Param("id")), &d)
+    if err == sql.ErrNoRows {
+        c.JSON(http.StatusNotFound, APIError{Message: "delivery not found"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+
+    rows, err := queryRows(ctx, `
+        SELECT attempted_at, status_code, duration_ms, error, COALESCE(response_body, '')
+        FROM webhook_delivery_attempts WHERE delivery_id=? ORDER BY attempt_id`, d.DeliveryID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    defer rows.Close()
+    d.History = []WebhookAttempt{}
+    for rows.Next() {
+        var (
+            a         WebhookAttempt
+            at        time.Time
+            code      sql.NullInt64
+            errorText sql.NullString
+        )
+        if err := rows.Scan(&at, &code, &a.DurationMs, &errorText, &a.ResponseBody); err != nil {
+            continue
+        }
+        a.AttemptedAt = at.In(localTZ).Format(time.RFC3339)
+        if code.Valid {
+            val := int(code.Int64)
+            a.StatusCode = &val
+        }
+        if errorText.Valid {
+            a.Error = &errorText.String
+        }
+        d.History = append(d.History, a)
+    }
+    c.JSON(http.StatusOK, d)
+}
+
+// POST /webhooks/deliveries/:id/replay sends the same event (same id and payload)
+// again as a new delivery, using the subscription's current URL and secret.
+func replayWebhookDelivery(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    now := time.Now().In(localTZ)
+    res, err := exec(ctx, `
+        INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at, replay_of, created_at)
+        SELECT subscription_id, event_id, event_type, payload, 'pending', 0, ?, delivery_id, ? FROM webhook_deliveries WHERE delivery_id=?`,
+        now, now, c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    if n, _ := res.RowsAffected(); n == 0 {
+        c.JSON(http.StatusNotFound, APIError{Message: "delivery not found"})
+        return
+    }
+    id, _ := res.LastInsertId()
+    wakeWebhooks()
+
+    var d WebhookDelivery
+    if err := scanWebhookDelivery(queryRow(ctx, `SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries WHERE delivery_id=?`, id), &d); err != nil {
+        c.JSON(http.StatusAccepted, gin.H{"delivery_id": id})
+        return
+    }
+    c.JSON(http.StatusAccepted, d)
+}
+
+// POST /webhooks/:id/replay {"since": "2026-03-01T00:00:00-06:00", "status": "failed"}
+// re-sends every delivery to this subscription created since then (optionally only
+// those with the given status), e.g. after the receiver was down.
+func replayWebhookDeliveries(c *gin.Context) {
+    var body WebhookReplayRequest
+    if err := c.ShouldBindJSON(&body); err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: err.Error()})
+        return
+    }
+    since, err := time.Parse(time.RFC3339, body.Since)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, APIError{Message: "since must be an RFC 3339 timestamp"})
+        return
+    }
+    switch body.Status {
+    case "", "delivered", "failed":
+    default:
+        c.JSON(http.StatusBadRequest, APIError{Message: "status must be delivered or failed"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+    defer cancel()
+
+    // Only the original of each event is copied, and only once it is finished with
+    now := time.Now().In(localTZ)
+    res, err := exec(ctx, `
+        INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at, replay_of, created_at)
+        SELECT subscription_id, event_id, event_type, payload, 'pending', 0, ?, delivery_id, ?
+        FROM webhook_deliveries
+        WHERE subscription_id=? AND created_at >= ? AND replay_of IS NULL AND status IN ('delivered', 'failed')
+          AND (? = '' OR status = ?)
+        ORDER BY delivery_id`,
+        now, now, c.Param("id"), since.In(localTZ), body.Status, body.Status)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, APIError{Message: err.Error()})
+        return
+    }
+    n, _ := res.RowsAffected()
+    wakeWebhooks()
+    c.JSON(http.StatusAccepted, gin.H{"queued": n})
+}
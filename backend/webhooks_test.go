@@ -0,0 +1,105 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "driver-safety-bonus/client"
+
+    "github.com/DATA-DOG/go-sqlmock"
+)
+
+// Subscriptions may not point at the API's own network unless allowed.
+func TestWebhookTargets(t *testing.T) {
+    prev := conf
+    defer func() { conf = prev }()
+
+    for url, wantOK := range map[string]bool{
+        "http://127.0.0.1:8080/api/drivers":        false,
+        "http://localhost/hook":                    false,
+        "http://[::1]/hook":                        false,
+        "http://169.254.169.254/latest/meta-data/": false,
+        "http://10.1.2.3/hook":                     false,
+        "http://192.168.0.10/hook":                 false,
+        "http://[::ffff:127.0.0.1]/hook":           false,
+        "https://93.184.216.34/hook":               true,
+    } {
+        w := WebhookSubscription{URL: url, EventTypes: []string{"*"}}
+        if msg := validateWebhook(context.Background(), &w); (msg == "") != wantOK {
+            t.Errorf("%s: got %q, want accepted=%v", url, msg, wantOK)
+        }
+    }
+
+    conf.Webhooks.AllowedHosts = []string{"10.0.0.0/8", "receiver.internal"}
+    for _, url := range []string{"http://10.1.2.3/hook", "http://receiver.internal/hook"} {
+        w := WebhookSubscription{URL: url, EventTypes: []string{"*"}}
+        if msg := validateWebhook(context.Background(), &w); msg != "" {
+            t.Errorf("%s on the allowlist: %q", url, msg)
+        }
+    }
+}
+
+// The check is repeated when connecting, so a name that later resolves inward is
+// still refused.
+func TestPostWebhookRefusesInternalAddress(t *testing.T) {
+    prev := conf
+    defer func() { conf = prev }()
+    var hits int
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        hits++
+        w.Write([]byte("internal secret"))
+    }))
+    defer srv.Close()
+
+    _, body, _, err := postWebhook(context.Background(), srv.URL, "whsec_x", "ping", 1, []byte(`{}`))
+    if !errors.Is(err, errWebhookTargetBlocked) || body != "" || hits != 0 {
+        t.Fatalf("err %v, body %q, hits %d; want the dial refused", err, body, hits)
+    }
+
+    conf.Webhooks.AllowedHosts = []string{"127.0.0.1"}
+    code, body, _, err := postWebhook(context.Background(), srv.URL, "whsec_x", "ping", 1, []byte(`{}`))
+    if err != nil || code != http.StatusOK || body != "internal secret" {
+        t.Errorf("allowed receiver: code %d, body %q, err %v", code, body, err)
+    }
+}
+
+// A write and the deliveries and /stream change it publishes commit together.
+func TestCreateTruckPublishesInItsTransaction(t *testing.T) {
+    api, mock, _ := testAPI(t)
+    mock.ExpectBegin()
+    mock.ExpectExec(`INSERT INTO trucks`).WithArgs("T-09", 2024, "available").
+        WillReturnResult(sqlmock.NewResult(9, 1))
+    mock.ExpectQuery(`SELECT subscription_id, event_types FROM webhook_subscriptions`).
+        WillReturnRows(sqlmock.NewRows([]string{"subscription_id", "event_types"}).
+            AddRow(1, "truck.created").AddRow(2, "driver.updated"))
+    mock.ExpectExec(`INSERT INTO webhook_deliveries`).WithArgs(1, sqlmock.AnyArg(), "truck.created", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+        WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectExec(`INSERT INTO change_events`).WithArgs("truck.created", nil, sqlmock.AnyArg(), sqlmock.AnyArg()).
+        WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectCommit()
+
+    tr, err := api.CreateTruck(context.Background(), Truck{UnitNumber: "T-09", Year: 2024, Status: "available"})
+    if err != nil || tr.TruckID != 9 {
+        t.Fatalf("CreateTruck = %+v, %v", tr, err)
+    }
+}
+
+// If the change can't be recorded, the write is rolled back with its deliveries.
+func TestCreateTruckRollsBackWhenPublishFails(t *testing.T) {
+    api, mock, _ := testAPI(t)
+    mock.ExpectBegin()
+    mock.ExpectExec(`INSERT INTO trucks`).WillReturnResult(sqlmock.NewResult(9, 1))
+    mock.ExpectQuery(`SELECT subscription_id, event_types FROM webhook_subscriptions`).
+        WillReturnRows(sqlmock.NewRows([]string{"subscription_id", "event_types"}).AddRow(1, "*"))
+    mock.ExpectExec(`INSERT INTO webhook_deliveries`).WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectExec(`INSERT INTO change_events`).WillReturnError(errors.New("table is full"))
+    mock.ExpectRollback()
+
+    _, err := api.CreateTruck(context.Background(), Truck{UnitNumber: "T-09", Year: 2024, Status: "available"})
+    if client.StatusCode(err) != http.StatusInternalServerError {
+        t.Fatalf("err = %v, want 500", err)
+    }
+}
@@ -9,6 +9,7 @@ CREATE TABLE IF NOT EXISTS trucks (
   unit_number  VARCHAR(50) NOT NULL UNIQUE,
   year         INT NOT NULL,
   status       ENUM('available','maintenance','assigned') NOT NULL DEFAULT 'available',
+  version      INT NOT NULL DEFAULT 1, -- bumped on every write; the API's ETag
   created_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
   updated_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
 ) ENGINE=InnoDB;
@@ -28,7 +29,14 @@ CREATE TABLE IF NOT EXISTS drivers (
   start_date     DATE,
   truck_id       INT NULL,
   driver_type_id INT NULL,
-  profile_pic    LONGTEXT,
+  active         BOOLEAN NOT NULL DEFAULT TRUE,
+  profile_pic    LONGTEXT, -- legacy base64 photo; migrated to the file store at API startup
+  photo_key                VARCHAR(255) NULL,
+  photo_thumb_key          VARCHAR(255) NULL,
+  photo_content_type       VARCHAR(100) NULL,
+  photo_thumb_content_type VARCHAR(100) NULL,
+  photo_etag               CHAR(64) NULL,
+  version        INT NOT NULL DEFAULT 1,
   CONSTRAINT fk_driver_truck
     FOREIGN KEY (truck_id) REFERENCES trucks(truck_id) ON DELETE SET NULL ON UPDATE CASCADE,
   CONSTRAINT fk_driver_type
@@ -82,6 +90,8 @@ CREATE TABLE IF NOT EXISTS safety_events (
   bonus_score     INT NOT NULL DEFAULT 0,
   p_i_score       INT NOT NULL DEFAULT 0,
   bonus_period    BOOLEAN NOT NULL DEFAULT TRUE,
+  dispute_status  ENUM('open','under_review','upheld','overturned') NULL, -- status of the latest dispute
+  version         INT NOT NULL DEFAULT 1,
   CONSTRAINT fk_se_driver
     FOREIGN KEY (driver_id) REFERENCES drivers(driver_id) ON DELETE CASCADE ON UPDATE CASCADE,
   CONSTRAINT fk_se_category
@@ -99,6 +109,7 @@ CREATE TABLE IF NOT EXISTS scorecard_events (
   sc_category_id     INT NOT NULL,
   sc_score           INT NOT NULL,
   notes              VARCHAR(500),
+  version            INT NOT NULL DEFAULT 1,
   CONSTRAINT fk_sce_driver
     FOREIGN KEY (driver_id) REFERENCES drivers(driver_id) ON DELETE CASCADE ON UPDATE CASCADE,
   CONSTRAINT fk_sce_metric
@@ -107,6 +118,9 @@ CREATE TABLE IF NOT EXISTS scorecard_events (
   INDEX idx_sce_category (sc_category_id)
 ) ENGINE=InnoDB;
 
+-- Tables added since (driver credentials onward) are created by the API at
+-- startup, so existing databases get them too: see schemaUpgrades in backend/schema.go.
+
 SET FOREIGN_KEY_CHECKS = 1;
 
 -- Seed data (idempotent)
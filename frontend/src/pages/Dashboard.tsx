@@ -30,7 +30,7 @@ const Dashboard = () => {
   
   const avgBonusScore = useMemo(() => {
     if (totalEvents === 0) return 0;
-    const totalScore = events.reduce((s, e) => s + (Number(e.bonus_score) || 0), 0);
+    const totalScore = events.reduce((s, e) => s + (e.dispute_status === 'overturned' ? 0 : (Number(e.bonus_score) || 0)), 0);
     return (totalScore / totalEvents).toFixed(1);
   }, [events, totalEvents]);
 
@@ -42,7 +42,7 @@ const Dashboard = () => {
       // FIX: Since db.getDriverStats doesn't exist in the store, 
       // we calculate it locally using standardized keys
       const driverEvents = events.filter(e => e.driver_id === driver.driver_id);
-      const score = driverEvents.reduce((sum, e) => sum + (e.bonus_score || 0), 0);
+      const score = driverEvents.reduce((sum, e) => sum + (e.dispute_status === 'overturned' ? 0 : (e.bonus_score || 0)), 0);
       
       if (score > 10) high++;
       else if (score > 5) med++;
@@ -41,7 +41,7 @@ const Drivers = () => {
     // Adding || [] ensures we don't crash if the backend sends null
     const events = (db.safety_events || []).filter(e => e.driver_id === driverId);
     
-    const totalBonusScore = events.reduce((sum, event) => sum + (event.bonus_score || 0), 0);
+    const totalBonusScore = events.reduce((sum, event) => sum + (event.dispute_status === 'overturned' ? 0 : (event.bonus_score || 0)), 0);
     
     // Logic remains: status shifts to 'Warning' if they accumulate more than 5 points
     const status = totalBonusScore > 5 ? 'Warning' : 'Good';  
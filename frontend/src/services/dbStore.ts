@@ -6,6 +6,16 @@ import {
 
 type Id = number;
 type Listener = () => void;
+// A record version for If-Match; '*' writes whatever version is stored
+type Version = number | '*';
+
+// Thrown for non-2xx responses; body is the parsed JSON error (APIError, or
+// { message, current } for 412 Precondition Failed).
+export class ApiError extends Error {
+  constructor(public status: number, public body: any) {
+    super(body?.message || `API Error: ${status}`);
+  }
+}
 
 // 1. Centralized HTTP client
 class HttpClient {
@@ -19,18 +29,30 @@ class HttpClient {
     method: 'GET' | 'POST' | 'PUT' | 'PATCH' | 'DELETE',
     path: string,
     body?: unknown,
+    version?: Version,
   ): Promise<T> {
     const url = `${this.baseUrl}${path}`;
     console.log(`Attempting ${method} request to: ${url}`); // <--- ADD THIS LOG
 
     try {
+      const headers: Record<string, string> = {
+        'Content-Type': method === 'PATCH' ? 'application/merge-patch+json' : 'application/json',
+      };
+      // Updates and deletes must name the version they were based on. Without one the
+      // write is refused here rather than sent as '*', which overwrites any version
+      // and has to be asked for explicitly.
+      if (method === 'PUT' || method === 'PATCH' || method === 'DELETE') {
+        if (!version) throw new Error(`${method} ${path}: the record's version is unknown; reload it before saving`);
+        headers['If-Match'] = version === '*' ? '*' : `"${version}"`;
+      }
       const res = await fetch(url, {
         method,
-        headers: { 'Content-Type': 'application/json' },
+        headers,
         body: body ? JSON.stringify(body) : undefined,
       });
       
-      if (!res.ok) throw new Error(`API Error: ${res.status} ${res.statusText}`);
+      if (!res.ok) throw new ApiError(res.status, await res.json().catch(() => null));
+      if (res.status === 204) return undefined as T;
       return res.json();
     } catch (error) {
       console.error("Fetch implementation error:", error); // <--- ADD THIS LOG
@@ -40,8 +62,9 @@ class HttpClient {
 
   get<T>(path: string) { return this.request<T>('GET', path); }
   post<T>(path: string, body: unknown) { return this.request<T>('POST', path, body); }
-  put<T>(path: string, body: unknown) { return this.request<T>('PUT', path, body); }
-  delete<T>(path: string) { return this.request<T>('DELETE', path); }
+  put<T>(path: string, body: unknown, version?: Version) { return this.request<T>('PUT', path, body, version); }
+  patch<T>(path: string, body: unknown, version?: Version) { return this.request<T>('PATCH', path, body, version); }
+  delete<T>(path: string, version?: Version) { return this.request<T>('DELETE', path, undefined, version); }
 }
 
 // 2. The Store
@@ -58,17 +81,54 @@ export class DBStore implements DBStoreState {
 
   private listeners: Set<Listener> = new Set();
   private http = new HttpClient('http://localhost:8080/api');
+  private stream?: EventSource;
 
   async init() {
     console.log("LOG: dbStore.init() was triggered by the component.");
     try {
       const data = await this.http.get<any>('/bootstrap');
       this.applyBootstrap(data);
+      this.connectStream();
     } catch (err) {
       console.error("Store init failed:", err);
     }
   }
 
+  // Live updates: the API pushes every driver/truck/event change over SSE so edits
+  // made by someone else show up without a reload. EventSource reconnects by itself
+  // and sends Last-Event-ID, so nothing is missed while the connection is down.
+  private connectStream() {
+    if (this.stream || typeof EventSource === 'undefined') return;
+    this.stream = new EventSource('http://localhost:8080/api/stream');
+
+    const on = (type: string, apply: (data: any) => void) => {
+      this.stream!.addEventListener(type, (e) => {
+        apply(JSON.parse((e as MessageEvent).data).data);
+        this.notify();
+      });
+    };
+    const upsert = <T,>(list: T[], item: T, key: keyof T) =>
+      list.some(x => x[key] === item[key]) ? list.map(x => x[key] === item[key] ? item : x) : [...list, item];
+
+    for (const kind of ['created', 'updated'] as const) {
+      on(`driver.${kind}`, d => { this.drivers = upsert(this.drivers, d as Driver, 'driver_id'); });
+      on(`truck.${kind}`, t => { this.trucks = upsert(this.trucks, t as Truck, 'truck_id'); });
+      on(`safety_event.${kind}`, e => { this.safety_events = upsert(this.safety_events, e as SafetyEvent, 'safety_event_id'); });
+      on(`scorecard_event.${kind}`, e => { this.scorecard_events = upsert(this.scorecard_events, e as ScoreCardEvent, 'scorecard_event_id'); });
+    }
+    on('driver.deleted', d => { this.drivers = this.drivers.filter(x => x.driver_id !== d.driver_id); });
+    on('truck.deleted', t => { this.trucks = this.trucks.filter(x => x.truck_id !== t.truck_id); });
+    on('safety_event.deleted', e => { this.safety_events = this.safety_events.filter(x => x.safety_event_id !== e.safety_event_id); });
+    on('scorecard_event.deleted', e => { this.scorecard_events = this.scorecard_events.filter(x => x.scorecard_event_id !== e.scorecard_event_id); });
+    // Assignments change both records (and their versions): fetch them fresh
+    on('truck.assigned', a => { this.refresh(a.driver_id, a.truck_id); });
+    on('truck.unassigned', a => { this.refresh(a.driver_id, a.truck_id); });
+    // Too far behind to replay: reload everything
+    this.stream.addEventListener('reset', () => {
+      this.http.get<any>('/bootstrap').then(data => this.applyBootstrap(data)).catch(() => {});
+    });
+  }
+
   private applyBootstrap(data: any) {
     // Direct assignment works because names are identical
     Object.assign(this, {
@@ -83,6 +143,34 @@ export class DBStore implements DBStoreState {
     this.notify();
   }
 
+  // Re-reads single records so local copies carry the current version (ETag)
+  private async refresh(driverId?: number | null, ...truckIds: (number | null | undefined)[]) {
+    try {
+      if (driverId) {
+        const d = await this.http.get<Driver>(`/drivers/${driverId}`);
+        this.drivers = this.drivers.map(x => x.driver_id === d.driver_id ? d : x);
+      }
+      for (const id of truckIds) {
+        if (!id) continue;
+        const t = await this.http.get<Truck>(`/trucks/${id}`);
+        this.trucks = this.trucks.map(x => x.truck_id === t.truck_id ? t : x);
+      }
+      this.notify();
+    } catch (err) {
+      console.error("Refresh failed", err);
+    }
+  }
+
+  // On 412 the API sends the record as it is now; keep that and let the caller
+  // show the error so the user can redo their change on top of it.
+  private conflict<T>(err: unknown, apply: (current: T) => void): never {
+    if (err instanceof ApiError && err.status === 412 && err.body?.current) {
+      apply(err.body.current as T);
+      this.notify();
+    }
+    throw err;
+  }
+
   subscribe(l: Listener) {
     this.listeners.add(l);
     return () => this.listeners.delete(l);
@@ -121,6 +209,7 @@ export class DBStore implements DBStoreState {
       );
 
       this.notify(); 
+      await this.refresh(driverId, truckId, oldTruckId);
     } catch (err) {
       console.error("Assignment failed", err);
     }
@@ -130,10 +219,15 @@ export class DBStore implements DBStoreState {
     const isUpdate = !!data.driver_id;
     const path = isUpdate ? `/drivers/${data.driver_id}` : '/drivers';
 
-    // 1. Perform the API call
+    // 1. Perform the API call. Updates are merge patches so fields the form
+    // didn't send (truck, photo) are left as they are.
+    const version = data.version ?? this.drivers.find(d => d.driver_id === data.driver_id)?.version;
     const savedDriver = await (isUpdate 
-      ? this.http.put<Driver>(path, data) 
-      : this.http.post<Driver>(path, data));
+      ? this.http.patch<Driver>(path, data, version) 
+      : this.http.post<Driver>(path, data)
+    ).catch(err => this.conflict<Driver>(err, d => {
+      this.drivers = this.drivers.map(x => x.driver_id === d.driver_id ? d : x);
+    }));
 
     // 2. Refresh everything (trucks, drivers, types) in one shot
     // This ensures Unit 2544 is now marked as 'assigned' in the local state
@@ -143,7 +237,10 @@ export class DBStore implements DBStoreState {
   }
 
   async deleteDriver(id: number) {
-    await this.http.delete(`/drivers/${id}`);
+    await this.http.delete(`/drivers/${id}`, this.drivers.find(d => d.driver_id === id)?.version)
+      .catch(err => this.conflict<Driver>(err, d => {
+        this.drivers = this.drivers.map(x => x.driver_id === d.driver_id ? d : x);
+      }));
     
     // Update local state: remove driver and free up their truck
     const driverToDelete = this.drivers.find(d => d.driver_id === id);
@@ -171,9 +268,13 @@ export class DBStore implements DBStoreState {
   async saveTruck(data: Partial<Truck>): Promise<Truck> {
     const isUpdate = !!data.truck_id;
     const path = isUpdate ? `/trucks/${data.truck_id}` : '/trucks';
+    const version = data.version ?? this.trucks.find(t => t.truck_id === data.truck_id)?.version;
     const savedTruck = await (isUpdate 
-      ? this.http.put<Truck>(path, data) 
-      : this.http.post<Truck>(path, data));
+      ? this.http.patch<Truck>(path, data, version) 
+      : this.http.post<Truck>(path, data)
+    ).catch(err => this.conflict<Truck>(err, t => {
+      this.trucks = this.trucks.map(x => x.truck_id === t.truck_id ? t : x);
+    }));
 
     if (isUpdate) {
       this.trucks = this.trucks.map(t => t.truck_id === savedTruck.truck_id ? savedTruck : t);
@@ -4,6 +4,7 @@ export interface Truck {
   unit_number: string;
   year: number;
   status: 'available' | 'maintenance' | 'assigned';
+  version?: number; // ETag; sent back as If-Match on update/delete
 }
 
 export interface TruckHistoryEvent {
@@ -28,7 +29,9 @@ export interface Driver {
   start_date: string;
   truck_id: number | null;
   driver_type_id: number | null;
+  active?: boolean;
   profile_pic?: string; // Base64 or URL
+  version?: number;
 }
 
 export interface SafetyCategory {
@@ -55,6 +58,8 @@ export interface SafetyEvent {
   bonus_score: number;
   p_i_score: number;
   bonus_period: boolean;
+  dispute_status?: 'open' | 'under_review' | 'upheld' | 'overturned' | null;
+  version?: number;
 }
 
 export interface ScoreCardEvent {
@@ -64,6 +69,7 @@ export interface ScoreCardEvent {
   sc_category_id: number;
   sc_score: number;
   notes: string;
+  version?: number;
 }
 
 export interface ScoreCardSummary {